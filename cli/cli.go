@@ -94,6 +94,12 @@ func (s *Subcommand) Config() *config.Config {
 	return s.config
 }
 
+// ConfigPath returns the path passed via the --config flag.
+// It is empty if the default locations were searched.
+func (s *Subcommand) ConfigPath() string {
+	return rootArgs.configPath
+}
+
 func (s *Subcommand) run(cmd *cobra.Command, args []string) {
 	s.tryParseConfig()
 	err := s.Run(s, args)
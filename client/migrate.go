@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/kr/pretty"
@@ -71,6 +72,10 @@ func doMigratePlaceholder0_1(sc *cli.Subcommand, args []string) error {
 		var rfsS string
 		switch job := j.Ret.(type) {
 		case *config.SinkJob:
+			if job.RootFS == "" || strings.Contains(job.RootFS, endpoint.ClientRootTemplatePlaceholder) {
+				fmt.Printf("ignoring job %q (%d/%d): root_fs is not a single filesystem\n", j.Name(), i, len(cfg.Jobs))
+				continue
+			}
 			rfsS = job.RootFS
 		case *config.PullJob:
 			rfsS = job.RootFS
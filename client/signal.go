@@ -9,16 +9,22 @@ import (
 )
 
 var SignalCmd = &cli.Subcommand{
-	Use:   "signal [wakeup|reset] JOB",
-	Short: "wake up a job from wait state or abort its current invocation",
+	Use:   "signal [wakeup|reset] JOB | signal reload",
+	Short: "wake up a job from wait state, abort its current invocation, or reload the daemon's config",
 	Run: func(subcommand *cli.Subcommand, args []string) error {
 		return runSignalCmd(subcommand.Config(), args)
 	},
 }
 
 func runSignalCmd(config *config.Config, args []string) error {
-	if len(args) != 2 {
-		return errors.Errorf("Expected 2 arguments: [wakeup|reset] JOB")
+	var name string
+	switch {
+	case len(args) == 1 && args[0] == "reload":
+		// reload applies to the entire daemon
+	case len(args) == 2 && args[0] != "reload":
+		name = args[1]
+	default:
+		return errors.Errorf("Expected arguments: [wakeup|reset] JOB | reload")
 	}
 
 	httpc, err := controlHttpClient(config.Global.Control.SockPath)
@@ -31,7 +37,7 @@ func runSignalCmd(config *config.Config, args []string) error {
 			Name string
 			Op   string
 		}{
-			Name: args[1],
+			Name: name,
 			Op:   args[0],
 		},
 		struct{}{},
@@ -29,51 +29,51 @@ import (
 	"github.com/zrepl/zrepl/daemon/pruner"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/replication/report"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
 )
 
-type byteProgressMeasurement struct {
-	time time.Time
-	val  int64
-}
-
+// bytesProgressHistory animates the progress bars.
+// The throughput is computed by the daemon, see report.Throughput.
 type bytesProgressHistory struct {
-	last        *byteProgressMeasurement // pointer as poor man's optional
+	last        *int64 // pointer as poor man's optional
 	changeCount int
 	lastChange  time.Time
-	bpsAvg      float64
 }
 
-func (p *bytesProgressHistory) Update(currentVal int64) (bytesPerSecondAvg int64, changeCount int) {
+// changeCount = 0 indicates stall / no progress
+func (p *bytesProgressHistory) Update(currentVal int64) (changeCount int) {
 
 	if p.last == nil {
-		p.last = &byteProgressMeasurement{
-			time: time.Now(),
-			val:  currentVal,
-		}
-		return 0, 0
+		p.last = &currentVal
+		return 0
 	}
 
-	if p.last.val != currentVal {
+	if *p.last != currentVal {
 		p.changeCount++
 		p.lastChange = time.Now()
 	}
 
 	if time.Since(p.lastChange) > 3*time.Second {
 		p.last = nil
-		return 0, 0
+		return 0
 	}
 
-	deltaV := currentVal - p.last.val
-	deltaT := time.Since(p.last.time)
-	rate := float64(deltaV) / deltaT.Seconds()
-
-	factor := 0.3
-	p.bpsAvg = (1-factor)*p.bpsAvg + factor*rate
+	*p.last = currentVal
 
-	p.last.time = time.Now()
-	p.last.val = currentVal
+	return p.changeCount
+}
 
-	return int64(p.bpsAvg), p.changeCount
+// formats the throughput t (may be nil) as " @ <rate>/s (<eta> remaining)"
+func formatThroughput(t *report.Throughput) string {
+	var rate int64
+	if t != nil {
+		rate = t.BytesPerSecond
+	}
+	s := fmt.Sprintf(" @ %s/s", ByteCountBinary(rate))
+	if t != nil && t.ETA > 0 {
+		s += fmt.Sprintf(" (%s remaining)", humanizeDuration(t.ETA))
+	}
+	return s
 }
 
 type tui struct {
@@ -86,12 +86,14 @@ type tui struct {
 
 	jobFilter string
 
-	replicationProgress map[string]*bytesProgressHistory // by job name
+	replicationProgress   map[string]*bytesProgressHistory            // by job name
+	fsReplicationProgress map[string]map[string]*bytesProgressHistory // by job name, filesystem
 }
 
 func newTui() tui {
 	return tui{
-		replicationProgress: make(map[string]*bytesProgressHistory),
+		replicationProgress:   make(map[string]*bytesProgressHistory),
+		fsReplicationProgress: make(map[string]map[string]*bytesProgressHistory),
 	}
 }
 
@@ -273,6 +275,25 @@ func (t *tui) getReplicationProgressHistory(jobName string) *bytesProgressHistor
 	return p
 }
 
+// returns nil and forgets the filesystem's history if it is not active
+func (t *tui) getFilesystemReplicationProgressHistory(jobName string, fs *report.FilesystemReport) *bytesProgressHistory {
+	fss, ok := t.fsReplicationProgress[jobName]
+	if !ok {
+		fss = make(map[string]*bytesProgressHistory)
+		t.fsReplicationProgress[jobName] = fss
+	}
+	if !fs.Active {
+		delete(fss, fs.Info.Name)
+		return nil
+	}
+	p, ok := fss[fs.Info.Name]
+	if !ok {
+		p = &bytesProgressHistory{}
+		fss[fs.Info.Name] = p
+	}
+	return p
+}
+
 func (t *tui) draw() {
 	t.lock.Lock()
 	defer t.lock.Unlock()
@@ -326,11 +347,41 @@ func (t *tui) draw() {
 					continue
 				}
 
-				t.printf("Replication:")
-				t.newline()
-				t.addIndent(1)
-				t.renderReplicationReport(activeStatus.Replication, t.getReplicationProgressHistory(k))
-				t.addIndent(-1)
+				if activeStatus.Targets == nil {
+					t.renderBandwidthLimitReport(activeStatus.BandwidthLimit)
+					t.renderReplicationWindowReport(activeStatus.ReplicationWindow)
+
+					t.printf("Replication:")
+					t.newline()
+					t.addIndent(1)
+					t.renderReplicationReport(k, activeStatus.Replication)
+					t.addIndent(-1)
+				} else {
+					targets := make([]string, 0, len(activeStatus.Targets))
+					for name := range activeStatus.Targets {
+						targets = append(targets, name)
+					}
+					sort.Strings(targets)
+					for _, name := range targets {
+						ts := activeStatus.Targets[name]
+						t.printf("Target: %s", name)
+						t.newline()
+						t.addIndent(1)
+						t.renderBandwidthLimitReport(ts.BandwidthLimit)
+						t.renderReplicationWindowReport(ts.ReplicationWindow)
+						t.printf("Replication:")
+						t.newline()
+						t.addIndent(1)
+						// the progress history is keyed like the target's job ID
+						t.renderReplicationReport(k+"_"+name, ts.Replication)
+						t.addIndent(-1)
+						t.printf("Pruning Receiver:")
+						t.newline()
+						t.addIndent(1)
+						t.renderPrunerReport(ts.PruningReceiver)
+						t.addIndent(-2)
+					}
+				}
 
 				t.printf("Pruning Sender:")
 				t.newline()
@@ -338,11 +389,13 @@ func (t *tui) draw() {
 				t.renderPrunerReport(activeStatus.PruningSender)
 				t.addIndent(-1)
 
-				t.printf("Pruning Receiver:")
-				t.newline()
-				t.addIndent(1)
-				t.renderPrunerReport(activeStatus.PruningReceiver)
-				t.addIndent(-1)
+				if activeStatus.Targets == nil {
+					t.printf("Pruning Receiver:")
+					t.newline()
+					t.addIndent(1)
+					t.renderPrunerReport(activeStatus.PruningReceiver)
+					t.addIndent(-1)
+				}
 
 				if v.Type == job.TypePush {
 					t.printf("Snapshotting:")
@@ -372,6 +425,7 @@ func (t *tui) draw() {
 			} else if v.Type == job.TypeSource {
 
 				st := v.JobSpecific.(*job.PassiveStatus)
+				t.renderBandwidthLimitReport(st.BandwidthLimit)
 				t.printf("Snapshotting:\n")
 				t.addIndent(1)
 				t.renderSnapperReport(st.Snapper)
@@ -395,7 +449,19 @@ func (t *tui) draw() {
 	termbox.Flush()
 }
 
-func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgressHistory) {
+func (t *tui) renderReplicationWindowReport(r *job.ReplicationWindowReport) {
+	if r == nil {
+		return
+	}
+	t.printf("Replication window: %s", r)
+	t.newline()
+	if r.Waiting {
+		t.printf("Replication deferred until the replication window opens")
+		t.newline()
+	}
+}
+
+func (t *tui) renderReplicationReport(jobName string, rep *report.Report) {
 	if rep == nil {
 		t.printf("...\n")
 		return
@@ -422,6 +488,12 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 		t.newline()
 	}
 
+	if !rep.NextAttemptAt.IsZero() {
+		t.printfDrawIndentedAndWrappedIfMultiline("Retry: next attempt after transient error in %s @ %s",
+			time.Until(rep.NextAttemptAt).Round(time.Second), rep.NextAttemptAt)
+		t.newline()
+	}
+
 	// TODO visualize more than the latest attempt by folding all attempts into one
 	if len(rep.Attempts) == 0 {
 		t.printf("no attempts made yet")
@@ -462,31 +534,32 @@ func (t *tui) renderReplicationReport(rep *report.Report, history *bytesProgress
 		// Draw global progress bar
 		// Progress: [---------------]
 		expected, replicated, containsInvalidSizeEstimates := latest.BytesSum()
-		rate, changeCount := history.Update(replicated)
-		eta := time.Duration(0)
-		if rate > 0 {
-			eta = time.Duration((expected-replicated)/rate) * time.Second
-		}
+		changeCount := t.getReplicationProgressHistory(jobName).Update(replicated)
 		t.write("Progress: ")
 		t.drawBar(50, replicated, expected, changeCount)
-		t.write(fmt.Sprintf(" %s / %s @ %s/s", ByteCountBinary(replicated), ByteCountBinary(expected), ByteCountBinary(rate)))
-		if eta != 0 {
-			t.write(fmt.Sprintf(" (%s remaining)", humanizeDuration(eta)))
-		}
+		t.write(fmt.Sprintf(" %s / %s", ByteCountBinary(replicated), ByteCountBinary(expected)))
+		t.write(formatThroughput(latest.Throughput))
 		t.newline()
 		if containsInvalidSizeEstimates {
 			t.write("NOTE: not all steps could be size-estimated, total estimate is likely imprecise!")
 			t.newline()
 		}
 
-		var maxFSLen int
+		var maxFSLen, activeCount int
 		for _, fs := range latest.Filesystems {
 			if len(fs.Info.Name) > maxFSLen {
 				maxFSLen = len(fs.Info.Name)
 			}
+			if fs.Active {
+				activeCount++
+			}
+		}
+		if activeCount > 0 {
+			t.printf("Active: %d of %d filesystems", activeCount, len(latest.Filesystems))
+			t.newline()
 		}
 		for _, fs := range latest.Filesystems {
-			t.printFilesystemStatus(fs, false, maxFSLen) // FIXME bring 'active' flag back
+			t.printFilesystemStatus(fs, t.getFilesystemReplicationProgressHistory(jobName, fs), maxFSLen)
 		}
 
 	}
@@ -538,7 +611,11 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 
 	var totalDestroyCount, completedDestroyCount int
 	var maxFSname int
+	var orphanCount int
 	for _, fs := range all {
+		if fs.Orphan {
+			orphanCount++
+		}
 		totalDestroyCount += len(fs.DestroyList)
 		if fs.completed {
 			completedDestroyCount += len(fs.DestroyList)
@@ -558,6 +635,9 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 	t.write("]")
 	t.printf(" %d/%d snapshots", completedDestroyCount, totalDestroyCount)
 	t.newline()
+	if orphanCount > 0 {
+		t.printf("Orphans: %d filesystems are not listed by the sender\n", orphanCount)
+	}
 
 	sort.SliceStable(all, func(i, j int) bool {
 		return strings.Compare(all[i].Filesystem, all[j].Filesystem) == -1
@@ -568,7 +648,11 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 		t.write(rightPad(fs.Filesystem, maxFSname, " "))
 		t.write(" ")
 		if !fs.SkipReason.NotSkipped() {
-			t.printf("skipped: %s\n", fs.SkipReason)
+			if fs.Orphan {
+				t.printf("orphan, skipped: %s\n", fs.SkipReason)
+			} else {
+				t.printf("skipped: %s\n", fs.SkipReason)
+			}
 			continue
 		}
 		if fs.LastError != "" {
@@ -584,6 +668,10 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 
 		pruneRuleActionStr := fmt.Sprintf("(destroy %d of %d snapshots)",
 			len(fs.DestroyList), len(fs.SnapshotList))
+		if fs.Orphan {
+			pruneRuleActionStr = fmt.Sprintf("(orphan, destroy %d of %d snapshots)",
+				len(fs.DestroyList), len(fs.SnapshotList))
+		}
 
 		if fs.completed {
 			t.printf("Completed  %s\n", pruneRuleActionStr)
@@ -601,6 +689,21 @@ func (t *tui) renderPrunerReport(r *pruner.Report) {
 
 }
 
+func (t *tui) renderBandwidthLimitReport(r *job.BandwidthLimitReport) {
+	if r == nil {
+		return
+	}
+	rate := "unlimited"
+	if r.BytesPerSecond != bandwidthlimit.Unlimited {
+		rate = fmt.Sprintf("%s/s", ByteCountBinary(r.BytesPerSecond))
+	}
+	t.printf("Bandwidth limit (%s): %s", r.Direction, rate)
+	if !r.NextChange.IsZero() {
+		t.printf(" (until %s)", r.NextChange)
+	}
+	t.newline()
+}
+
 func (t *tui) renderSnapperReport(r *snapper.Report) {
 	if r == nil {
 		t.printf("<snapshot type does not have a report>\n")
@@ -616,6 +719,12 @@ func (t *tui) renderSnapperReport(r *snapper.Report) {
 	if !r.SleepUntil.IsZero() {
 		t.printf("Sleep until: %s\n", r.SleepUntil)
 	}
+	if r.Schedule != "" {
+		t.printf("Schedule: %s\n", r.Schedule)
+	}
+	if !r.NextSnapshotAt.IsZero() {
+		t.printf("Next snapshot: %s\n", r.NextSnapshotAt)
+	}
 
 	sort.Slice(r.Progress, func(i, j int) bool {
 		return strings.Compare(r.Progress[i].Path, r.Progress[j].Path) == -1
@@ -716,7 +825,8 @@ func (t *tui) drawBar(length int, bytes, totalBytes int64, changeCount int) {
 	t.write("]")
 }
 
-func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, maxFS int) {
+// history is nil if the filesystem is not active
+func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, history *bytesProgressHistory, maxFS int) {
 
 	expected, replicated, containsInvalidSizeEstimates := rep.BytesSum()
 	sizeEstimationImpreciseNotice := ""
@@ -727,15 +837,24 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 		sizeEstimationImpreciseNotice = " (step lacks size estimation)"
 	}
 
-	status := fmt.Sprintf("%s (step %d/%d, %s/%s)%s",
+	var queueNotice string
+	if rep.Info.Priority != 0 {
+		queueNotice += fmt.Sprintf(" (priority %d)", rep.Info.Priority)
+	}
+	if rep.QueuePosition > 0 {
+		queueNotice += fmt.Sprintf(" (queued #%d)", rep.QueuePosition)
+	}
+
+	status := fmt.Sprintf("%s (step %d/%d, %s/%s)%s%s",
 		strings.ToUpper(string(rep.State)),
 		rep.CurrentStep, len(rep.Steps),
 		ByteCountBinary(replicated), ByteCountBinary(expected),
 		sizeEstimationImpreciseNotice,
+		queueNotice,
 	)
 
 	activeIndicator := " "
-	if active {
+	if history != nil {
 		activeIndicator = "*"
 	}
 	t.printf("%s %s %s ",
@@ -743,18 +862,45 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 		rightPad(rep.Info.Name, maxFS, " "),
 		status)
 
+	// individual progress of the step that is currently being executed
+	if history != nil && rep.State == report.FilesystemStepping && rep.CurrentStep < len(rep.Steps) {
+		step := rep.Steps[rep.CurrentStep]
+		changeCount := history.Update(step.Info.BytesReplicated)
+		t.drawBar(20, step.Info.BytesReplicated, step.Info.BytesExpected, changeCount)
+		t.write(formatThroughput(step.Throughput) + " ")
+	}
+
 	next := ""
 	if err := rep.Error(); err != nil {
 		next = err.Err
+		if !rep.NextRetryAt.IsZero() {
+			next = fmt.Sprintf("retry #%d in %s: %s", rep.Retries, time.Until(rep.NextRetryAt).Round(time.Second), err.Err)
+		}
 	} else if rep.State != report.FilesystemDone {
 		if nextStep := rep.NextStep(); nextStep != nil {
-			if nextStep.IsIncremental() {
+			if nextStep.Info.RollbackOnly {
+				next = fmt.Sprintf("next: rollback to %s", nextStep.Info.RollbackTo)
+			} else if nextStep.Info.RenameOnly {
+				next = fmt.Sprintf("next: rename from %s", nextStep.Info.RenameFrom)
+			} else if nextStep.IsIncremental() {
 				next = fmt.Sprintf("next: %s => %s", nextStep.Info.From, nextStep.Info.To)
 			} else {
 				next = fmt.Sprintf("next: full send %s", nextStep.Info.To)
 			}
 			attribs := []string{}
 
+			if n := len(nextStep.Info.Intermediates); n > 0 {
+				attribs = append(attribs, fmt.Sprintf("%d intermediate snapshots", n))
+			}
+
+			if nextStep.Info.RollbackTo != "" && !nextStep.Info.RollbackOnly {
+				attribs = append(attribs, fmt.Sprintf("rollback to %s", nextStep.Info.RollbackTo))
+			}
+
+			if nextStep.Info.RenameFrom != "" && !nextStep.Info.RenameOnly {
+				attribs = append(attribs, fmt.Sprintf("rename from %s", nextStep.Info.RenameFrom))
+			}
+
 			if nextStep.Info.Resumed {
 				attribs = append(attribs, "resumed")
 			}
@@ -770,6 +916,13 @@ func (t *tui) printFilesystemStatus(rep *report.FilesystemReport, active bool, m
 	t.printfDrawIndentedAndWrappedIfMultiline("%s", next)
 
 	t.newline()
+
+	if rep.Info.ConflictResolution != "" {
+		t.addIndent(1)
+		t.printfDrawIndentedAndWrappedIfMultiline("conflict resolved: %s", rep.Info.ConflictResolution)
+		t.newline()
+		t.addIndent(-1)
+	}
 }
 
 func ByteCountBinary(b int64) string {
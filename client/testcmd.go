@@ -52,22 +52,23 @@ func runTestFilterCmd(subcommand *cli.Subcommand, args []string) error {
 	ctx := context.Background()
 
 	var confFilter config.FilesystemsFilter
+	var confPriorities map[string]int
 	job, err := conf.Job(testFilterArgs.job)
 	if err != nil {
 		return err
 	}
 	switch j := job.Ret.(type) {
 	case *config.SourceJob:
-		confFilter = j.Filesystems
+		confFilter, confPriorities = j.Filesystems.Filter, j.Filesystems.Priorities
 	case *config.PushJob:
-		confFilter = j.Filesystems
+		confFilter, confPriorities = j.Filesystems.Filter, j.Filesystems.Priorities
 	case *config.SnapJob:
 		confFilter = j.Filesystems
 	default:
 		return fmt.Errorf("job type %T does not have filesystems filter", j)
 	}
 
-	f, err := filters.DatasetMapFilterFromConfig(confFilter)
+	f, err := filters.PrioritizedDatasetMapFilterFromConfig(confFilter, confPriorities)
 	if err != nil {
 		return fmt.Errorf("filter invalid: %s", err)
 	}
@@ -106,6 +107,9 @@ func runTestFilterCmd(subcommand *cli.Subcommand, args []string) error {
 			hadFilterErr = true
 		} else if pass {
 			res = "ACCEPT"
+			if prio := f.Priority(in); prio != 0 {
+				errStr = fmt.Sprintf("priority=%d", prio)
+			}
 		} else {
 			res = "REJECT"
 		}
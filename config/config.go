@@ -8,9 +8,11 @@ import (
 	"reflect"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
 	"github.com/zrepl/yaml-config"
 )
 
@@ -52,18 +54,230 @@ func (j JobEnum) Name() string {
 }
 
 type ActiveJob struct {
-	Type    string                `yaml:"type"`
-	Name    string                `yaml:"name"`
-	Connect ConnectEnum           `yaml:"connect"`
-	Pruning PruningSenderReceiver `yaml:"pruning"`
-	Debug   JobDebugSettings      `yaml:"debug,optional"`
+	Type               string                `yaml:"type"`
+	Name               string                `yaml:"name"`
+	Connect            ConnectEnum           `yaml:"connect,optional"` // required unless push job with targets
+	Pruning            PruningSenderReceiver `yaml:"pruning"`
+	ReplicationWindows *ReplicationWindows   `yaml:"replication_windows,optional"`
+	Replication        *Replication          `yaml:"replication,optional,fromdefaults"`
+	Debug              JobDebugSettings      `yaml:"debug,optional"`
+}
+
+type Replication struct {
+	Concurrency        *ReplicationConcurrency `yaml:"concurrency,optional,fromdefaults"`
+	ConflictResolution string                  `yaml:"conflict_resolution,optional,default=fail"`
+	Initial            ReplicationInitial      `yaml:"initial,optional"`
+	StepStrategy       string                  `yaml:"step_strategy,optional,default=individual"`
+	RenameDetection    string                  `yaml:"rename_detection,optional,default=off"`
+	Retry              *ReplicationRetry       `yaml:"retry,optional,fromdefaults"`
+}
+
+type ReplicationRetry struct {
+	// 0 means ZREPL_REPLICATION_MAX_ATTEMPTS
+	MaxAttempts       int           `yaml:"max_attempts,optional,default=0"`
+	FilesystemRetries int           `yaml:"filesystem_retries,optional,default=0"`
+	InitialBackoff    time.Duration `yaml:"initial_backoff,optional,positive,default=10s"`
+	MaxBackoff        time.Duration `yaml:"max_backoff,optional,positive,default=5m"`
+	// nil means the default list of the replication driver
+	TransientErrors []string `yaml:"transient_errors,optional"`
+}
+
+type ReplicationConcurrency struct {
+	Steps int `yaml:"steps,optional,default=1"`
+}
+
+// ReplicationInitial determines the sender snapshots that are replicated
+// to a receiver that does not have the filesystem yet.
+// The zero value is `most_recent`.
+type ReplicationInitial struct {
+	// replicate all snapshots
+	All bool
+	// if > 0, replicate all snapshots created within Since before planning,
+	// or the most recent snapshot if there are none
+	Since time.Duration
+}
+
+var _ yaml.Unmarshaler = (*ReplicationInitial)(nil)
+
+func (i *ReplicationInitial) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var s string
+	if err := u(&s, true); err != nil {
+		return err
+	}
+	switch {
+	case s == "most_recent":
+		*i = ReplicationInitial{}
+	case s == "all":
+		*i = ReplicationInitial{All: true}
+	case strings.HasPrefix(s, "since:"):
+		d, err := parsePositiveDuration(strings.TrimPrefix(s, "since:"))
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration in %q", s)
+		}
+		*i = ReplicationInitial{Since: d}
+	default:
+		return fmt.Errorf("must be `most_recent`, `all` or `since:<duration>` (e.g. since:30d): %q", s)
+	}
+	return nil
+}
+
+type ReplicationWindows struct {
+	TimeZone string               `yaml:"timezone,optional,default=Local"`
+	OnClose  string               `yaml:"on_close,optional,default=continue"`
+	Windows  []*ReplicationWindow `yaml:"windows"`
+}
+
+type BandwidthLimit struct {
+	Max      Bandwidth                     `yaml:"max"`
+	TimeZone string                        `yaml:"timezone,optional,default=Local"`
+	Schedule []*BandwidthLimitScheduleItem `yaml:"schedule,optional"`
+}
+
+// BandwidthLimitScheduleItem uses the time window format of ReplicationWindow.
+type BandwidthLimitScheduleItem struct {
+	ReplicationWindow `yaml:",inline"`
+	Max               Bandwidth `yaml:"max"`
+}
+
+// Bandwidth is a number of bytes per second or unlimited.
+type Bandwidth struct {
+	BytesPerSecond int64
+	Unlimited      bool
+}
+
+var _ yaml.Unmarshaler = (*Bandwidth)(nil)
+
+var bandwidthRegex = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([KMGT]i?B|kB|B)?\s*(?:/s)?\s*$`)
+
+var bandwidthUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"kB":  1e3,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KiB": 1 << 10,
+	"MiB": 1 << 20,
+	"GiB": 1 << 30,
+	"TiB": 1 << 40,
+}
+
+func (b *Bandwidth) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var s string
+	if err := u(&s, true); err != nil {
+		return err
+	}
+	if s == "unlimited" {
+		*b = Bandwidth{Unlimited: true}
+		return nil
+	}
+	comps := bandwidthRegex.FindStringSubmatch(s)
+	if len(comps) != 3 {
+		return fmt.Errorf("bandwidth must be `unlimited` or a number of bytes per second with optional unit (e.g. 10 MiB): %q", s)
+	}
+	v, err := strconv.ParseFloat(comps[1], 64)
+	if err != nil {
+		return err
+	}
+	bps := int64(v * bandwidthUnits[comps[2]])
+	if bps <= 0 {
+		return fmt.Errorf("bandwidth must be positive or `unlimited`: %q", s)
+	}
+	*b = Bandwidth{BytesPerSecond: bps}
+	return nil
+}
+
+// DataSize is a number of bytes.
+type DataSize struct {
+	Bytes int64
+}
+
+var _ yaml.Unmarshaler = (*DataSize)(nil)
+
+var dataSizeRegex = regexp.MustCompile(`^\s*(\d+(?:\.\d+)?)\s*([KMGT]i?B|kB|B)?\s*$`)
+
+func (d *DataSize) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var s string
+	if err := u(&s, true); err != nil {
+		return err
+	}
+	comps := dataSizeRegex.FindStringSubmatch(s)
+	if len(comps) != 3 {
+		return fmt.Errorf("data size must be a number of bytes with optional unit (e.g. 10 GiB): %q", s)
+	}
+	v, err := strconv.ParseFloat(comps[1], 64)
+	if err != nil {
+		return err
+	}
+	bytes := int64(v * bandwidthUnits[comps[2]])
+	if bytes <= 0 {
+		return fmt.Errorf("data size must be positive: %q", s)
+	}
+	*d = DataSize{Bytes: bytes}
+	return nil
+}
+
+type ReplicationWindow struct {
+	Days  []string   `yaml:"days,optional"`
+	Start *TimeOfDay `yaml:"start"`
+	End   *TimeOfDay `yaml:"end"`
+}
+
+// TimeOfDay is a wall-clock time formatted as HH:MM.
+// 24:00 denotes the end of the day.
+type TimeOfDay struct {
+	Hour, Minute int
+}
+
+var _ yaml.Unmarshaler = (*TimeOfDay)(nil)
+
+var timeOfDayRegex = regexp.MustCompile(`^\s*(\d{1,2}):(\d{2})\s*$`)
+
+func (t *TimeOfDay) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var s string
+	if err := u(&s, true); err != nil {
+		return err
+	}
+	comps := timeOfDayRegex.FindStringSubmatch(s)
+	if len(comps) != 3 {
+		return fmt.Errorf("time of day must be formatted as HH:MM: %q", s)
+	}
+	hour, _ := strconv.Atoi(comps[1])
+	minute, _ := strconv.Atoi(comps[2])
+	if hour > 24 || minute > 59 || (hour == 24 && minute != 0) {
+		return fmt.Errorf("invalid time of day %q", s)
+	}
+	t.Hour, t.Minute = hour, minute
+	return nil
+}
+
+// Minutes returns the number of minutes since the start of the day.
+func (t TimeOfDay) Minutes() int {
+	return t.Hour*60 + t.Minute
+}
+
+func (t TimeOfDay) String() string {
+	return fmt.Sprintf("%02d:%02d", t.Hour, t.Minute)
 }
 
 type PassiveJob struct {
-	Type  string           `yaml:"type"`
-	Name  string           `yaml:"name"`
-	Serve ServeEnum        `yaml:"serve"`
-	Debug JobDebugSettings `yaml:"debug,optional"`
+	Type              string                        `yaml:"type"`
+	Name              string                        `yaml:"name"`
+	Serve             ServeEnum                     `yaml:"serve"`
+	ClientPermissions map[string]*ClientPermissions `yaml:"client_permissions,optional"`
+	AuditLog          *AuditLog                     `yaml:"audit_log,optional"`
+	Debug             JobDebugSettings              `yaml:"debug,optional"`
+}
+
+type AuditLog struct {
+	Path string `yaml:"path"`
+}
+
+type ClientPermissions struct {
+	ReadOnly    bool              `yaml:"read_only,default=false"`
+	NoDestroy   bool              `yaml:"no_destroy,default=false"`
+	Filesystems FilesystemsFilter `yaml:"filesystems,optional"`
 }
 
 type SnapJob struct {
@@ -76,7 +290,23 @@ type SnapJob struct {
 }
 
 type SendOptions struct {
-	Encrypted bool `yaml:"encrypted"`
+	Encrypted        bool            `yaml:"encrypted"`
+	LargeBlocks      bool            `yaml:"large_blocks,default=false"`
+	Compressed       bool            `yaml:"compressed,default=false"`
+	EmbeddedData     bool            `yaml:"embedded_data,default=false"`
+	SendProperties   bool            `yaml:"send_properties,default=false"`
+	BackupProperties bool            `yaml:"backup_properties,default=false"`
+	Saved            bool            `yaml:"saved,default=false"`
+	BandwidthLimit   *BandwidthLimit `yaml:"bandwidth_limit,optional"`
+	SnapshotFilter   *SnapshotFilter `yaml:"snapshot_filter,optional"`
+}
+
+// SnapshotFilter selects the snapshots that are replicated by name.
+// A snapshot matches if it matches Regex or starts with one of Prefixes.
+type SnapshotFilter struct {
+	Regex    string   `yaml:"regex,optional"`
+	Prefixes []string `yaml:"prefixes,optional"`
+	Negate   bool     `yaml:"negate,optional,default=false"`
 }
 
 var _ yaml.Defaulter = (*SendOptions)(nil)
@@ -91,19 +321,57 @@ type RecvOptions struct {
 
 	// Future:
 	// Reencrypt bool `yaml:"reencrypt"`
+
+	Properties *PropertyRecvOptions `yaml:"properties,fromdefaults"`
+
+	BandwidthLimit *BandwidthLimit `yaml:"bandwidth_limit,optional"`
+
+	// maps the sender's filesystem names to names below root_fs
+	Mapping *RecvMapping `yaml:"mapping,optional"`
+}
+
+type RecvMapping struct {
+	// DatasetMapFilter syntax, "!" excludes the filesystem
+	Table           map[string]string  `yaml:"table,optional"`
+	StripComponents int                `yaml:"strip_components,optional,default=0"`
+	Prefix          *RecvMappingPrefix `yaml:"prefix,optional"`
+}
+
+type RecvMappingPrefix struct {
+	From string `yaml:"from"`
+	// empty removes the prefix
+	To string `yaml:"to,optional"`
+}
+
+type PropertyRecvOptions struct {
+	Inherit  []string          `yaml:"inherit,optional"`
+	Override map[string]string `yaml:"override,optional"`
 }
 
 var _ yaml.Defaulter = (*RecvOptions)(nil)
 
 func (l *RecvOptions) SetDefault() {
-	*l = RecvOptions{}
+	*l = RecvOptions{Properties: &PropertyRecvOptions{}}
 }
 
 type PushJob struct {
 	ActiveJob    `yaml:",inline"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
-	Send         *SendOptions      `yaml:"send,fromdefaults,optional"`
+	Snapshotting SnapshottingEnum             `yaml:"snapshotting"`
+	Filesystems  PrioritizedFilesystemsFilter `yaml:"filesystems"`
+	Send         *SendOptions                 `yaml:"send,fromdefaults,optional"`
+	// mutually exclusive with ActiveJob.Connect
+	Targets []*PushTarget `yaml:"targets,optional"`
+}
+
+type PushTarget struct {
+	Name    string             `yaml:"name"`
+	Connect ConnectEnum        `yaml:"connect"`
+	Pruning *PushTargetPruning `yaml:"pruning,optional"`
+}
+
+// PushTargetPruning overrides the keep_receiver rules of the push job for a target.
+type PushTargetPruning struct {
+	KeepReceiver []PruningEnum `yaml:"keep_receiver"`
 }
 
 type PullJob struct {
@@ -146,19 +414,101 @@ func (i *PositiveDurationOrManual) UnmarshalYAML(u func(interface{}, bool) error
 
 type SinkJob struct {
 	PassiveJob `yaml:",inline"`
-	RootFS     string       `yaml:"root_fs"`
-	Recv       *RecvOptions `yaml:"recv,optional,fromdefaults"`
+	// may contain the placeholder {{.Client}}, optional if ClientRootFS is set
+	RootFS string `yaml:"root_fs,optional"`
+	// client identity => root filesystem of that client, takes precedence over RootFS
+	ClientRootFS map[string]string `yaml:"client_root_fs,optional"`
+	Recv         *RecvOptions      `yaml:"recv,optional,fromdefaults"`
+	AppendOnly   *SinkAppendOnly   `yaml:"append_only,optional"`
+	// serves the received filesystems to other jobs (cascading replication)
+	ServeReceived *SinkServeReceived `yaml:"serve_received,optional"`
+	Quota         *SinkQuota         `yaml:"quota,optional"`
+}
+
+type SinkQuota struct {
+	// client identity => maximum `used` of the client's root filesystem
+	Clients map[string]*DataSize `yaml:"clients,optional"`
+	// quota of clients that are not in Clients, unlimited if not specified
+	Default *DataSize `yaml:"default,optional"`
+	// space that must remain available in the receiving pool
+	PoolReserve *DataSize `yaml:"pool_reserve,optional"`
+}
+
+type SinkServeReceived struct {
+	Serve             ServeEnum                     `yaml:"serve"`
+	ClientPermissions map[string]*ClientPermissions `yaml:"client_permissions,optional"`
+	Send              *SendOptions                  `yaml:"send,optional,fromdefaults"`
+}
+
+type SinkAppendOnly struct {
+	// zero means that clients must not destroy any snapshots
+	DestroyMinAge time.Duration `yaml:"destroy_min_age,optional,zeropositive"`
+	Pruning       *SinkPruning  `yaml:"pruning,optional"`
+}
+
+type SinkPruning struct {
+	PruningLocal `yaml:",inline"`
+	Interval     time.Duration `yaml:"interval,positive"`
 }
 
 type SourceJob struct {
 	PassiveJob   `yaml:",inline"`
-	Snapshotting SnapshottingEnum  `yaml:"snapshotting"`
-	Filesystems  FilesystemsFilter `yaml:"filesystems"`
-	Send         *SendOptions      `yaml:"send,optional,fromdefaults"`
+	Snapshotting SnapshottingEnum             `yaml:"snapshotting"`
+	Filesystems  PrioritizedFilesystemsFilter `yaml:"filesystems"`
+	Send         *SendOptions                 `yaml:"send,optional,fromdefaults"`
 }
 
 type FilesystemsFilter map[string]bool
 
+// PrioritizedFilesystemsFilter is a FilesystemsFilter whose values may also be
+// a mapping that includes the filesystems and assigns them a replication priority:
+//
+//	"pool/db<": {priority: 10}
+type PrioritizedFilesystemsFilter struct {
+	Filter FilesystemsFilter
+	// by filter pattern, only contains patterns with an explicit priority
+	Priorities map[string]int
+}
+
+var _ yaml.Unmarshaler = (*PrioritizedFilesystemsFilter)(nil)
+
+func (f *PrioritizedFilesystemsFilter) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var in map[string]prioritizedFilesystemsFilterValue
+	if err := u(&in, true); err != nil {
+		return err
+	}
+	f.Filter = make(FilesystemsFilter, len(in))
+	f.Priorities = make(map[string]int)
+	for pattern, v := range in {
+		f.Filter[pattern] = v.accept
+		if v.priority != nil {
+			f.Priorities[pattern] = *v.priority
+		}
+	}
+	return nil
+}
+
+type prioritizedFilesystemsFilterValue struct {
+	accept   bool
+	priority *int
+}
+
+func (v *prioritizedFilesystemsFilterValue) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var attrs map[string]int
+	if err := u(&v.accept, true); err == nil {
+		return nil
+	} else if err := u(&attrs, true); err != nil {
+		return fmt.Errorf("filter value must be a boolean or a mapping with attribute `priority`")
+	}
+	priority, ok := attrs["priority"]
+	if !ok || len(attrs) != 1 {
+		return fmt.Errorf("filter value mapping must have exactly the attribute `priority`")
+	}
+	v.accept = true
+	v.priority = &priority
+	return nil
+}
+
 type SnapshottingEnum struct {
 	Ret interface{}
 }
@@ -170,13 +520,97 @@ type SnapshottingPeriodic struct {
 	Hooks    HookList      `yaml:"hooks,optional"`
 }
 
+type SnapshottingCron struct {
+	Type     string   `yaml:"type"`
+	Prefix   string   `yaml:"prefix"`
+	Cron     CronSpec `yaml:"cron"`
+	TimeZone string   `yaml:"timezone,optional,default=Local"`
+	Hooks    HookList `yaml:"hooks,optional"`
+}
+
+// CronSpec is a single cron expression or a list of cron expressions
+// in standard 5-field syntax (minute, hour, day of month, month, day of week).
+// Descriptors such as @daily or @hourly are supported as well.
+// If multiple expressions are given, the schedule fires whenever any of them does.
+type CronSpec struct {
+	Specs     []string
+	Schedules []cron.Schedule
+}
+
+var _ yaml.Unmarshaler = (*CronSpec)(nil)
+
+func (s *CronSpec) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var specs []string
+	var single string
+	if err := u(&single, true); err == nil {
+		specs = []string{single}
+	} else if err := u(&specs, true); err != nil {
+		return fmt.Errorf("must be a cron expression or a list of cron expressions")
+	}
+	if len(specs) == 0 {
+		return fmt.Errorf("must specify at least one cron expression")
+	}
+	s.Specs = specs
+	s.Schedules = make([]cron.Schedule, len(specs))
+	for i, spec := range specs {
+		if strings.Contains(spec, "TZ=") {
+			return fmt.Errorf("invalid cron expression %q: use the timezone field instead of TZ= or CRON_TZ=", spec)
+		}
+		s.Schedules[i], err = cron.ParseStandard(spec)
+		if err != nil {
+			return fmt.Errorf("invalid cron expression %q: %s", spec, err)
+		}
+	}
+	return nil
+}
+
 type SnapshottingManual struct {
 	Type string `yaml:"type"`
 }
 
 type PruningSenderReceiver struct {
-	KeepSender   []PruningEnum `yaml:"keep_sender"`
-	KeepReceiver []PruningEnum `yaml:"keep_receiver"`
+	KeepSender      []PruningEnum          `yaml:"keep_sender"`
+	KeepReceiver    []PruningEnum          `yaml:"keep_receiver"`
+	ReceiverOrphans PruningReceiverOrphans `yaml:"receiver_orphans,optional"`
+}
+
+// PruningReceiverOrphans determines how the receiver pruner handles orphans,
+// i.e., receiver filesystems that the sender does not list (anymore).
+// The zero value only reports them.
+type PruningReceiverOrphans struct {
+	// log a warning for each orphan
+	Warn bool
+	// prune the snapshots of orphans with the keep_receiver rules
+	PruneWithReceiverRules bool
+	// if > 0, destroy all snapshots of an orphan
+	// once its most recent snapshot is older than DestroyAfter
+	DestroyAfter time.Duration
+}
+
+var _ yaml.Unmarshaler = (*PruningReceiverOrphans)(nil)
+
+func (o *PruningReceiverOrphans) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
+	var s string
+	if err := u(&s, true); err != nil {
+		return err
+	}
+	switch {
+	case s == "report":
+		*o = PruningReceiverOrphans{}
+	case s == "warn":
+		*o = PruningReceiverOrphans{Warn: true}
+	case s == "prune_with_receiver_rules":
+		*o = PruningReceiverOrphans{PruneWithReceiverRules: true}
+	case strings.HasPrefix(s, "destroy_after:"):
+		d, err := parsePositiveDuration(strings.TrimPrefix(s, "destroy_after:"))
+		if err != nil {
+			return errors.Wrapf(err, "invalid duration in %q", s)
+		}
+		*o = PruningReceiverOrphans{DestroyAfter: d}
+	default:
+		return fmt.Errorf("must be `report`, `warn`, `prune_with_receiver_rules` or `destroy_after:<duration>` (e.g. destroy_after:30d): %q", s)
+	}
+	return nil
 }
 
 type PruningLocal struct {
@@ -226,7 +660,8 @@ type ConnectEnum struct {
 }
 
 type ConnectCommon struct {
-	Type string `yaml:"type"`
+	Type        string   `yaml:"type"`
+	Compression []string `yaml:"compression,optional"`
 }
 
 type TCPConnect struct {
@@ -264,12 +699,45 @@ type LocalConnect struct {
 	DialTimeout    time.Duration `yaml:"dial_timeout,zeropositive,default=2s"`
 }
 
+// Compression returns the stream compression algorithms of the connect block.
+func (e ConnectEnum) Compression() []string {
+	switch v := e.Ret.(type) {
+	case *TCPConnect:
+		return v.Compression
+	case *TLSConnect:
+		return v.Compression
+	case *SSHStdinserverConnect:
+		return v.Compression
+	case *LocalConnect:
+		return v.Compression
+	default:
+		panic(fmt.Sprintf("unknown connect type %T", v))
+	}
+}
+
 type ServeEnum struct {
 	Ret interface{}
 }
 
+// Compression returns the stream compression algorithms of the serve block.
+func (e ServeEnum) Compression() []string {
+	switch v := e.Ret.(type) {
+	case *TCPServe:
+		return v.Compression
+	case *TLSServe:
+		return v.Compression
+	case *StdinserverServer:
+		return v.Compression
+	case *LocalServe:
+		return v.Compression
+	default:
+		panic(fmt.Sprintf("unknown serve type %T", v))
+	}
+}
+
 type ServeCommon struct {
-	Type string `yaml:"type"`
+	Type        string   `yaml:"type"`
+	Compression []string `yaml:"compression,optional"`
 }
 
 type TCPServe struct {
@@ -491,6 +959,7 @@ func (t *PruningEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error)
 func (t *SnapshottingEnum) UnmarshalYAML(u func(interface{}, bool) error) (err error) {
 	t.Ret, err = enumUnmarshal(u, map[string]interface{}{
 		"periodic": &SnapshottingPeriodic{},
+		"cron":     &SnapshottingCron{},
 		"manual":   &SnapshottingManual{},
 	})
 	return
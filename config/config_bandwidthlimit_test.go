@@ -0,0 +1,76 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBandwidthLimit(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  send:
+    encrypted: false
+    bandwidth_limit:
+      max: %s
+      schedule:
+      - days: [mon, tue, wed, thu, fri]
+        start: "08:00"
+        end: "18:00"
+        max: 1 MiB
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	type tc struct {
+		in        string
+		bps       int64
+		unlimited bool
+		err       bool
+	}
+	tcs := []tc{
+		{in: "unlimited", unlimited: true},
+		{in: "1234", bps: 1234},
+		{in: "1234 B", bps: 1234},
+		{in: "10 MiB", bps: 10 << 20},
+		{in: "10MiB/s", bps: 10 << 20},
+		{in: "1.5 GiB", bps: 3 << 29},
+		{in: "2 MB", bps: 2e6},
+		{in: "0", err: true},
+		{in: "-1", err: true},
+		{in: "10 mb", err: true},
+		{in: "fast", err: true},
+	}
+	for _, c := range tcs {
+		t.Run(c.in, func(t *testing.T) {
+			conf, err := testConfig(t, fmt.Sprintf(tmpl, c.in))
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			bl := conf.Jobs[0].Ret.(*PushJob).Send.BandwidthLimit
+			require.NotNil(t, bl)
+			assert.Equal(t, Bandwidth{BytesPerSecond: c.bps, Unlimited: c.unlimited}, bl.Max)
+			assert.Equal(t, "Local", bl.TimeZone)
+			require.Len(t, bl.Schedule, 1)
+			assert.Equal(t, int64(1<<20), bl.Schedule[0].Max.BytesPerSecond)
+			assert.Equal(t, 8*60, bl.Schedule[0].Start.Minutes())
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientPermissions(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: source
+  serve:
+    type: local
+    listener_name: foo
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Empty(t, c.Jobs[0].Ret.(*SourceJob).ClientPermissions)
+	})
+
+	t.Run("permissions", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  client_permissions:
+    "backup1":
+      read_only: true
+    "backup2":
+      no_destroy: true
+      filesystems: {"pool/a<": true}
+    "backup3": {}
+`))
+		perms := c.Jobs[0].Ret.(*SourceJob).ClientPermissions
+		require.Len(t, perms, 3)
+		assert.Equal(t, &ClientPermissions{ReadOnly: true}, perms["backup1"])
+		assert.Equal(t, &ClientPermissions{
+			NoDestroy:   true,
+			Filesystems: FilesystemsFilter{"pool/a<": true},
+		}, perms["backup2"])
+		assert.Equal(t, &ClientPermissions{}, perms["backup3"])
+	})
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrioritizedFilesystemsFilter(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: source
+  serve:
+    type: local
+    listener_name: foo
+  snapshotting:
+    type: manual
+  filesystems: %s
+`
+	t.Run("booleans", func(t *testing.T) {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, `{"pool<": true, "pool/tmp<": false}`))
+		fs := c.Jobs[0].Ret.(*SourceJob).Filesystems
+		assert.Equal(t, FilesystemsFilter{"pool<": true, "pool/tmp<": false}, fs.Filter)
+		assert.Empty(t, fs.Priorities)
+	})
+
+	t.Run("priorities", func(t *testing.T) {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, `{
+    "pool<": true,
+    "pool/db<": {priority: 10},
+    "pool/scratch<": {priority: -1},
+    "pool/tmp<": false,
+  }`))
+		fs := c.Jobs[0].Ret.(*SourceJob).Filesystems
+		assert.Equal(t, FilesystemsFilter{
+			"pool<":         true,
+			"pool/db<":      true,
+			"pool/scratch<": true,
+			"pool/tmp<":     false,
+		}, fs.Filter)
+		assert.Equal(t, map[string]int{"pool/db<": 10, "pool/scratch<": -1}, fs.Priorities)
+	})
+
+	t.Run("invalid_value", func(t *testing.T) {
+		_, err := testConfig(t, fmt.Sprintf(tmpl, `{"pool<": {prio: 10}}`))
+		assert.Error(t, err)
+	})
+}
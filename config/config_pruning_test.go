@@ -0,0 +1,64 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPruningReceiverOrphans(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: pull
+  connect:
+    type: tcp
+    address: "server:8888"
+  root_fs: "pool/backups"
+  interval: 10m
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+    %s
+`
+	fill := func(orphans string) string {
+		return fmt.Sprintf(tmpl, "receiver_orphans: "+orphans)
+	}
+	orphans := func(t *testing.T, s string) PruningReceiverOrphans {
+		c := testValidConfig(t, fill(s))
+		return c.Jobs[0].Ret.(*PullJob).Pruning.ReceiverOrphans
+	}
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+		assert.Equal(t, PruningReceiverOrphans{}, c.Jobs[0].Ret.(*PullJob).Pruning.ReceiverOrphans)
+	})
+
+	t.Run("report", func(t *testing.T) {
+		assert.Equal(t, PruningReceiverOrphans{}, orphans(t, "report"))
+	})
+
+	t.Run("warn", func(t *testing.T) {
+		assert.Equal(t, PruningReceiverOrphans{Warn: true}, orphans(t, "warn"))
+	})
+
+	t.Run("prune_with_receiver_rules", func(t *testing.T) {
+		assert.Equal(t, PruningReceiverOrphans{PruneWithReceiverRules: true}, orphans(t, "prune_with_receiver_rules"))
+	})
+
+	t.Run("destroy_after", func(t *testing.T) {
+		assert.Equal(t, PruningReceiverOrphans{DestroyAfter: 2 * 7 * 24 * time.Hour}, orphans(t, "destroy_after:2w"))
+	})
+
+	for _, invalid := range []string{"destroy_after:", "destroy_after:0d", "destroy", "off", `""`} {
+		t.Run("invalid_"+invalid, func(t *testing.T) {
+			_, err := testConfig(t, fill(invalid))
+			assert.Error(t, err)
+		})
+	}
+}
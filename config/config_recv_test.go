@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecvOptions(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  %s
+`
+	recv_not_specified := `
+`
+
+	properties := `
+  recv:
+    properties:
+      inherit:
+      - "keylocation"
+      override:
+        mountpoint: none
+        readonly: on
+        canmount: noauto
+`
+
+	properties_unspecified := `
+  recv: {}
+`
+
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("recv_not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(recv_not_specified))
+		recv := c.Jobs[0].Ret.(*SinkJob).Recv
+		require.NotNil(t, recv)
+		require.NotNil(t, recv.Properties)
+		assert.Empty(t, recv.Properties.Inherit)
+		assert.Empty(t, recv.Properties.Override)
+	})
+
+	t.Run("properties_unspecified", func(t *testing.T) {
+		c := testValidConfig(t, fill(properties_unspecified))
+		recv := c.Jobs[0].Ret.(*SinkJob).Recv
+		require.NotNil(t, recv.Properties)
+		assert.Empty(t, recv.Properties.Override)
+	})
+
+	t.Run("properties", func(t *testing.T) {
+		c := testValidConfig(t, fill(properties))
+		props := c.Jobs[0].Ret.(*SinkJob).Recv.Properties
+		assert.Equal(t, []string{"keylocation"}, props.Inherit)
+		assert.Equal(t, map[string]string{
+			"mountpoint": "none",
+			"readonly":   "on",
+			"canmount":   "noauto",
+		}, props.Override)
+	})
+}
+
+func TestSinkAppendOnly(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Nil(t, c.Jobs[0].Ret.(*SinkJob).AppendOnly)
+	})
+
+	t.Run("refuse_all", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  append_only: {}
+`))
+		ao := c.Jobs[0].Ret.(*SinkJob).AppendOnly
+		require.NotNil(t, ao)
+		assert.Equal(t, time.Duration(0), ao.DestroyMinAge)
+		assert.Nil(t, ao.Pruning)
+	})
+
+	t.Run("min_age_and_pruning", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  append_only:
+    destroy_min_age: 720h
+    pruning:
+      interval: 1h
+      keep:
+      - type: last_n
+        count: 10
+`))
+		ao := c.Jobs[0].Ret.(*SinkJob).AppendOnly
+		assert.Equal(t, 720*time.Hour, ao.DestroyMinAge)
+		require.NotNil(t, ao.Pruning)
+		assert.Equal(t, time.Hour, ao.Pruning.Interval)
+		assert.Len(t, ao.Pruning.Keep, 1)
+	})
+
+	t.Run("pruning_requires_interval", func(t *testing.T) {
+		_, err := testConfig(t, fill(`
+  append_only:
+    pruning:
+      keep:
+      - type: last_n
+        count: 10
+`))
+		assert.Error(t, err)
+	})
+}
+
+func TestRecvMapping(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Nil(t, c.Jobs[0].Ret.(*SinkJob).Recv.Mapping)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  recv:
+    mapping:
+      table:
+        "zroot/var/db<": "db"
+        "zroot/tmp<": "!"
+      strip_components: 1
+      prefix:
+        from: "data"
+        to: "backups"
+`))
+		m := c.Jobs[0].Ret.(*SinkJob).Recv.Mapping
+		require.NotNil(t, m)
+		assert.Equal(t, map[string]string{"zroot/var/db<": "db", "zroot/tmp<": "!"}, m.Table)
+		assert.Equal(t, 1, m.StripComponents)
+		require.NotNil(t, m.Prefix)
+		assert.Equal(t, "data", m.Prefix.From)
+		assert.Equal(t, "backups", m.Prefix.To)
+	})
+
+	t.Run("prefix_to_empty", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  recv:
+    mapping:
+      prefix:
+        from: "zroot/data"
+        to: ""
+`))
+		m := c.Jobs[0].Ret.(*SinkJob).Recv.Mapping
+		assert.Equal(t, 0, m.StripComponents)
+		assert.Equal(t, "", m.Prefix.To)
+	})
+}
+
+func TestSinkRootFS(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("template", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  root_fs: "pool_{{.Client}}/backups"
+`))
+		sink := c.Jobs[0].Ret.(*SinkJob)
+		assert.Equal(t, "pool_{{.Client}}/backups", sink.RootFS)
+		assert.Nil(t, sink.ClientRootFS)
+	})
+
+	t.Run("client_root_fs_only", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  client_root_fs:
+    prod1: "pool1/backups"
+    prod2: "pool2/backups"
+`))
+		sink := c.Jobs[0].Ret.(*SinkJob)
+		assert.Equal(t, "", sink.RootFS)
+		assert.Equal(t, map[string]string{"prod1": "pool1/backups", "prod2": "pool2/backups"}, sink.ClientRootFS)
+	})
+
+	t.Run("root_fs_and_client_root_fs", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  root_fs: "zroot/sink"
+  client_root_fs:
+    prod1: "pool1/backups"
+`))
+		sink := c.Jobs[0].Ret.(*SinkJob)
+		assert.Equal(t, "zroot/sink", sink.RootFS)
+		assert.Len(t, sink.ClientRootFS, 1)
+	})
+}
+
+func TestSinkQuota(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Nil(t, c.Jobs[0].Ret.(*SinkJob).Quota)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  quota:
+    clients:
+      prod1: 100 GiB
+      prod2: "1.5 TB"
+    default: 10 GiB
+    pool_reserve: 512 MiB
+`))
+		q := c.Jobs[0].Ret.(*SinkJob).Quota
+		require.NotNil(t, q)
+		require.Len(t, q.Clients, 2)
+		assert.Equal(t, int64(100<<30), q.Clients["prod1"].Bytes)
+		assert.Equal(t, int64(1.5e12), q.Clients["prod2"].Bytes)
+		assert.Equal(t, int64(10<<30), q.Default.Bytes)
+		assert.Equal(t, int64(512<<20), q.PoolReserve.Bytes)
+	})
+
+	t.Run("only_pool_reserve", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  quota:
+    pool_reserve: 1048576
+`))
+		q := c.Jobs[0].Ret.(*SinkJob).Quota
+		assert.Nil(t, q.Clients)
+		assert.Nil(t, q.Default)
+		assert.Equal(t, int64(1<<20), q.PoolReserve.Bytes)
+	})
+
+	for _, invalid := range []string{"0", "-1 GiB", "10 GiB/s", "unlimited", "ten"} {
+		t.Run("invalid_"+invalid, func(t *testing.T) {
+			_, err := testConfig(t, fill(fmt.Sprintf(`
+  quota:
+    default: %q
+`, invalid)))
+			assert.Error(t, err)
+		})
+	}
+}
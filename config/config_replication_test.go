@@ -0,0 +1,281 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationConcurrency(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Equal(t, 1, c.Jobs[0].Ret.(*PushJob).Replication.Concurrency.Steps)
+	})
+
+	t.Run("concurrency_unspecified", func(t *testing.T) {
+		c := testValidConfig(t, fill("replication: {}"))
+		assert.Equal(t, 1, c.Jobs[0].Ret.(*PushJob).Replication.Concurrency.Steps)
+	})
+
+	t.Run("steps", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    concurrency:
+      steps: 8
+`))
+		assert.Equal(t, 8, c.Jobs[0].Ret.(*PushJob).Replication.Concurrency.Steps)
+	})
+}
+
+func TestReplicationConflictResolution(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: pull
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  root_fs: "zroot/pull"
+  interval: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Equal(t, "fail", c.Jobs[0].Ret.(*PullJob).Replication.ConflictResolution)
+	})
+
+	t.Run("rollback_to_common_ancestor", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    conflict_resolution: rollback_to_common_ancestor
+`))
+		assert.Equal(t, "rollback_to_common_ancestor", c.Jobs[0].Ret.(*PullJob).Replication.ConflictResolution)
+		assert.Equal(t, 1, c.Jobs[0].Ret.(*PullJob).Replication.Concurrency.Steps)
+	})
+}
+
+func TestReplicationInitial(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(initial string) string {
+		return fmt.Sprintf(tmpl, "replication:\n    initial: "+initial)
+	}
+	initial := func(t *testing.T, s string) ReplicationInitial {
+		c := testValidConfig(t, fill(s))
+		return c.Jobs[0].Ret.(*PushJob).Replication.Initial
+	}
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fmt.Sprintf(tmpl, ""))
+		assert.Equal(t, ReplicationInitial{}, c.Jobs[0].Ret.(*PushJob).Replication.Initial)
+	})
+
+	t.Run("most_recent", func(t *testing.T) {
+		assert.Equal(t, ReplicationInitial{}, initial(t, "most_recent"))
+	})
+
+	t.Run("all", func(t *testing.T) {
+		assert.Equal(t, ReplicationInitial{All: true}, initial(t, "all"))
+	})
+
+	t.Run("since", func(t *testing.T) {
+		assert.Equal(t, ReplicationInitial{Since: 30 * 24 * time.Hour}, initial(t, "since:30d"))
+	})
+
+	for _, invalid := range []string{"since:", "since:-1d", "since:0d", "oldest", `""`} {
+		t.Run("invalid_"+invalid, func(t *testing.T) {
+			_, err := testConfig(t, fill(invalid))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReplicationStepStrategy(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Equal(t, "individual", c.Jobs[0].Ret.(*PushJob).Replication.StepStrategy)
+	})
+
+	t.Run("batched", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    step_strategy: batched
+`))
+		assert.Equal(t, "batched", c.Jobs[0].Ret.(*PushJob).Replication.StepStrategy)
+	})
+}
+
+func TestReplicationRenameDetection(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: pull
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  root_fs: "zroot/pull"
+  interval: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Equal(t, "off", c.Jobs[0].Ret.(*PullJob).Replication.RenameDetection)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    rename_detection: rename
+`))
+		assert.Equal(t, "rename", c.Jobs[0].Ret.(*PullJob).Replication.RenameDetection)
+	})
+}
+
+func TestReplicationRetry(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("default", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		r := c.Jobs[0].Ret.(*PushJob).Replication.Retry
+		require.NotNil(t, r)
+		assert.Equal(t, 0, r.MaxAttempts)
+		assert.Equal(t, 0, r.FilesystemRetries)
+		assert.Equal(t, 10*time.Second, r.InitialBackoff)
+		assert.Equal(t, 5*time.Minute, r.MaxBackoff)
+		assert.Nil(t, r.TransientErrors)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  replication:
+    retry:
+      max_attempts: 5
+      filesystem_retries: 2
+      initial_backoff: 30s
+      max_backoff: 1h
+      transient_errors:
+      - "dataset is busy"
+      - "connection reset by peer"
+`))
+		r := c.Jobs[0].Ret.(*PushJob).Replication.Retry
+		assert.Equal(t, 5, r.MaxAttempts)
+		assert.Equal(t, 2, r.FilesystemRetries)
+		assert.Equal(t, 30*time.Second, r.InitialBackoff)
+		assert.Equal(t, time.Hour, r.MaxBackoff)
+		assert.Equal(t, []string{"dataset is busy", "connection reset by peer"}, r.TransientErrors)
+	})
+
+	t.Run("backoff_must_be_positive", func(t *testing.T) {
+		_, err := testConfig(t, fill(`
+  replication:
+    retry:
+      initial_backoff: 0s
+`))
+		assert.Error(t, err)
+	})
+}
@@ -45,6 +45,26 @@ jobs:
 	send_not_specified := `
 `
 
+	flags := `
+  send:
+    encrypted: false
+    large_blocks: true
+    compressed: true
+    embedded_data: true
+    send_properties: true
+    backup_properties: true
+    saved: true
+`
+
+	snapshot_filter := `
+  send:
+    encrypted: false
+    snapshot_filter:
+      regex: "^zrepl_"
+      prefixes: ["manual_"]
+      negate: true
+`
+
 	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
 	var c *Config
 
@@ -71,4 +91,40 @@ jobs:
 		assert.NotNil(t, c)
 	})
 
+	t.Run("flags", func(t *testing.T) {
+		c = testValidConfig(t, fill(flags))
+		send := c.Jobs[0].Ret.(*PushJob).Send
+		assert.Equal(t, &SendOptions{
+			Encrypted:        false,
+			LargeBlocks:      true,
+			Compressed:       true,
+			EmbeddedData:     true,
+			SendProperties:   true,
+			BackupProperties: true,
+			Saved:            true,
+		}, send)
+	})
+
+	t.Run("flags_default_false", func(t *testing.T) {
+		c = testValidConfig(t, fill(encrypted_true))
+		send := c.Jobs[0].Ret.(*PushJob).Send
+		assert.False(t, send.LargeBlocks || send.Compressed || send.EmbeddedData ||
+			send.SendProperties || send.BackupProperties || send.Saved)
+	})
+
+	t.Run("snapshot_filter", func(t *testing.T) {
+		c = testValidConfig(t, fill(snapshot_filter))
+		send := c.Jobs[0].Ret.(*PushJob).Send
+		assert.Equal(t, &SnapshotFilter{
+			Regex:    "^zrepl_",
+			Prefixes: []string{"manual_"},
+			Negate:   true,
+		}, send.SnapshotFilter)
+	})
+
+	t.Run("snapshot_filter_default_nil", func(t *testing.T) {
+		c = testValidConfig(t, fill(flags))
+		assert.Nil(t, c.Jobs[0].Ret.(*PushJob).Send.SnapshotFilter)
+	})
+
 }
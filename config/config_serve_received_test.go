@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSinkServeReceived(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  %s
+`
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	t.Run("not_specified", func(t *testing.T) {
+		c := testValidConfig(t, fill(""))
+		assert.Nil(t, c.Jobs[0].Ret.(*SinkJob).ServeReceived)
+	})
+
+	t.Run("send_defaults", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  serve_received:
+    serve:
+      type: local
+      listener_name: foo_received
+`))
+		sr := c.Jobs[0].Ret.(*SinkJob).ServeReceived
+		require.NotNil(t, sr)
+		require.NotNil(t, sr.Send)
+		assert.False(t, sr.Send.Encrypted)
+		assert.Empty(t, sr.ClientPermissions)
+	})
+
+	t.Run("full", func(t *testing.T) {
+		c := testValidConfig(t, fill(`
+  serve_received:
+    serve:
+      type: local
+      listener_name: foo_received
+    client_permissions:
+      offsite:
+        read_only: true
+    send:
+      encrypted: true
+`))
+		sr := c.Jobs[0].Ret.(*SinkJob).ServeReceived
+		require.NotNil(t, sr)
+		assert.True(t, sr.Send.Encrypted)
+		require.Contains(t, sr.ClientPermissions, "offsite")
+		assert.True(t, sr.ClientPermissions["offsite"].ReadOnly)
+	})
+
+	t.Run("serve_required", func(t *testing.T) {
+		_, err := testConfig(t, fill(`
+  serve_received:
+    send:
+      encrypted: true
+`))
+		assert.Error(t, err)
+	})
+}
@@ -38,6 +38,28 @@ jobs:
     interval: 10m
 `
 
+	cron := `
+  snapshotting:
+    type: cron
+    prefix: zrepl_
+    cron: "0 2,14 * * *"
+    timezone: Europe/Berlin
+`
+	cronList := `
+  snapshotting:
+    type: cron
+    prefix: zrepl_
+    cron:
+    - "0 2,14 * * *"
+    - "0 9-17 * * 1-5"
+`
+	cronInvalid := `
+  snapshotting:
+    type: cron
+    prefix: zrepl_
+    cron: "0 25 * * *"
+`
+
 	hooks := `
   snapshotting:
     type: periodic
@@ -78,6 +100,29 @@ jobs:
 		assert.Equal(t, "zrepl_", snp.Prefix)
 	})
 
+	t.Run("cron", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(cron))
+		snc := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingCron)
+		assert.Equal(t, "cron", snc.Type)
+		assert.Equal(t, "zrepl_", snc.Prefix)
+		assert.Equal(t, []string{"0 2,14 * * *"}, snc.Cron.Specs)
+		assert.Len(t, snc.Cron.Schedules, 1)
+		assert.Equal(t, "Europe/Berlin", snc.TimeZone)
+	})
+
+	t.Run("cron_list", func(t *testing.T) {
+		c = testValidConfig(t, fillSnapshotting(cronList))
+		snc := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingCron)
+		assert.Equal(t, []string{"0 2,14 * * *", "0 9-17 * * 1-5"}, snc.Cron.Specs)
+		assert.Len(t, snc.Cron.Schedules, 2)
+		assert.Equal(t, "Local", snc.TimeZone)
+	})
+
+	t.Run("cron_invalid", func(t *testing.T) {
+		_, err := testConfig(t, fillSnapshotting(cronInvalid))
+		assert.Error(t, err)
+	})
+
 	t.Run("hooks", func(t *testing.T) {
 		c = testValidConfig(t, fillSnapshotting(hooks))
 		hs := c.Jobs[0].Ret.(*PushJob).Snapshotting.Ret.(*SnapshottingPeriodic).Hooks
@@ -75,6 +75,15 @@ jobs:
 			server_cn: "server1"
 			`,
 		},
+		{
+			Name:        "tcp_with_compression",
+			ExpectError: false,
+			Connect: `
+			type: tcp
+			address: 10.0.0.23:42
+			compression: [zstd, lz4]
+			`,
+		},
 	}
 
 	for _, tc := range testTable {
@@ -0,0 +1,198 @@
+// Package auditlog implements an rpc.RequestAuditor that writes a structured,
+// append-only audit trail of the operations that clients perform on a passive job.
+//
+// Each audited request produces one JSON object per line.
+package auditlog
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc"
+)
+
+// Record is the format of a line in the audit log.
+type Record struct {
+	Time       time.Time `json:"time"`
+	Job        string    `json:"job"`
+	Client     string    `json:"client"`
+	Operation  string    `json:"operation"`
+	Filesystem string    `json:"filesystem"`
+	// Send, Receive, Rollback (To)
+	From          string `json:"from,omitempty"`
+	To            string `json:"to,omitempty"`
+	Intermediates bool   `json:"intermediates,omitempty"`
+	ResumeToken   bool   `json:"resume_token,omitempty"`
+	DryRun        bool   `json:"dry_run,omitempty"`
+	Bytes         *int64 `json:"bytes,omitempty"`
+	// Receive
+	RenameExistingAside bool `json:"rename_existing_aside,omitempty"`
+	// Receive, Rename
+	RenameFrom string `json:"rename_from,omitempty"`
+	// DestroySnapshots
+	Snapshots     []string          `json:"snapshots,omitempty"`
+	DestroyErrors map[string]string `json:"destroy_errors,omitempty"`
+	// ReplicationCursor
+	ReplicationCursorGUID *uint64 `json:"replication_cursor_guid,omitempty"`
+
+	Result Result `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Result string
+
+const (
+	ResultOK     Result = "ok"
+	ResultError  Result = "error"
+	ResultDenied Result = "denied"
+)
+
+// the following are the values of Record.Operation
+const (
+	OpSend              = "Send"
+	OpReceive           = "Receive"
+	OpDestroySnapshots  = "DestroySnapshots"
+	OpRollback          = "Rollback"
+	OpRename            = "Rename"
+	OpReplicationCursor = "ReplicationCursor"
+)
+
+type Logger struct {
+	job    string
+	errLog logger.Logger
+
+	mtx sync.Mutex
+	w   io.WriteCloser
+}
+
+var _ rpc.RequestAuditor = (*Logger)(nil)
+
+// Open opens the audit log file at path for appending, creating it if necessary.
+// Errors writing to the file are logged to errLog.
+func Open(path string, job string, errLog logger.Logger) (*Logger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return New(f, job, errLog), nil
+}
+
+func New(w io.WriteCloser, job string, errLog logger.Logger) *Logger {
+	return &Logger{job: job, errLog: errLog, w: w}
+}
+
+func (l *Logger) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.w.Close()
+}
+
+// AuditRequest implements rpc.RequestAuditor.
+// Requests other than those of the Op* operations are not logged.
+func (l *Logger) AuditRequest(ctx context.Context, req interface{}, res interface{}, streamBytes int64, err error) {
+	r := Record{
+		Time: time.Now(),
+		Job:  l.job,
+	}
+	r.Client, _ = ctx.Value(endpoint.ClientIdentityKey).(string)
+
+	switch req := req.(type) {
+	case *pdu.SendReq:
+		r.Operation = OpSend
+		r.Filesystem = req.GetFilesystem()
+		r.From = relName(req.GetFrom())
+		r.To = relName(req.GetTo())
+		r.Intermediates = req.GetIntermediates()
+		r.ResumeToken = req.GetResumeToken() != ""
+		r.DryRun = req.GetDryRun()
+		r.Bytes = &streamBytes
+	case *pdu.ReceiveReq:
+		r.Operation = OpReceive
+		r.Filesystem = req.GetFilesystem()
+		r.To = relName(req.GetTo())
+		r.Bytes = &streamBytes
+		r.RenameExistingAside = req.GetRenameExistingAside()
+		r.RenameFrom = req.GetRenameFrom()
+	case *pdu.DestroySnapshotsReq:
+		r.Operation = OpDestroySnapshots
+		r.Filesystem = req.GetFilesystem()
+		for _, s := range req.GetSnapshots() {
+			r.Snapshots = append(r.Snapshots, relName(s))
+		}
+		if res, ok := res.(*pdu.DestroySnapshotsRes); ok {
+			for _, sr := range res.GetResults() {
+				if sr.GetError() == "" {
+					continue
+				}
+				if r.DestroyErrors == nil {
+					r.DestroyErrors = make(map[string]string)
+				}
+				r.DestroyErrors[relName(sr.GetSnapshot())] = sr.GetError()
+			}
+		}
+	case *pdu.RollbackReq:
+		r.Operation = OpRollback
+		r.Filesystem = req.GetFilesystem()
+		r.To = relName(req.GetTo())
+	case *pdu.RenameReq:
+		r.Operation = OpRename
+		r.Filesystem = req.GetFilesystem()
+		r.RenameFrom = req.GetRenameFrom()
+	case *pdu.ReplicationCursorReq:
+		r.Operation = OpReplicationCursor
+		r.Filesystem = req.GetFilesystem()
+		if res, ok := res.(*pdu.ReplicationCursorRes); ok && !res.GetNotexist() {
+			guid := res.GetGuid()
+			r.ReplicationCursorGUID = &guid
+		}
+	default:
+		return
+	}
+
+	switch {
+	case err == nil && len(r.DestroyErrors) == 0:
+		r.Result = ResultOK
+	case err == nil:
+		r.Result = ResultError
+	case rpc.IsPermissionDenied(err):
+		r.Result = ResultDenied
+		r.Error = err.Error()
+	default:
+		r.Result = ResultError
+		r.Error = err.Error()
+	}
+
+	l.write(&r)
+}
+
+// relName is like pdu.FilesystemVersion.GetRelName, but returns "" if v is nil
+// (e.g., the From version of a full send).
+func relName(v *pdu.FilesystemVersion) string {
+	if v == nil {
+		return ""
+	}
+	return v.GetRelName()
+}
+
+func (l *Logger) write(r *Record) {
+	line, err := json.Marshal(r)
+	if err != nil {
+		panic(fmt.Sprintf("implementation error: cannot marshal audit record: %s", err))
+	}
+	line = append(line, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	// a single write per record, which is atomic for files opened with O_APPEND
+	if _, err := l.w.Write(line); err != nil {
+		l.errLog.WithError(err).WithField("record", string(line)).Error("cannot write audit log record")
+	}
+}
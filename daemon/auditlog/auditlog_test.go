@@ -0,0 +1,81 @@
+package auditlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+type nopCloser struct{ bytes.Buffer }
+
+func (*nopCloser) Close() error { return nil }
+
+func TestAuditRequest(t *testing.T) {
+	var buf nopCloser
+	l := New(&buf, "sinkjob", logger.NewNullLogger())
+	ctx := context.WithValue(context.Background(), endpoint.ClientIdentityKey, "prod1")
+
+	snap := func(name string) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: name, Creation: "2020-01-01T00:00:00Z"}
+	}
+
+	l.AuditRequest(ctx, &pdu.ReceiveReq{Filesystem: "pool/fs", To: snap("b")}, &pdu.ReceiveRes{}, 4711, nil)
+	l.AuditRequest(ctx, &pdu.PingReq{}, &pdu.PingRes{}, 0, nil) // not audited
+	l.AuditRequest(ctx,
+		&pdu.DestroySnapshotsReq{Filesystem: "pool/fs", Snapshots: []*pdu.FilesystemVersion{snap("a"), snap("b")}},
+		&pdu.DestroySnapshotsRes{Results: []*pdu.DestroySnapshotRes{
+			{Snapshot: snap("a")},
+			{Snapshot: snap("b"), Error: "dataset is busy"},
+		}}, 0, nil)
+	l.AuditRequest(ctx, &pdu.DestroySnapshotsReq{Filesystem: "pool/fs"}, nil, 0, status.Error(codes.PermissionDenied, "read-only"))
+	l.AuditRequest(ctx, &pdu.SendReq{Filesystem: "pool/fs", To: snap("b")}, nil, 0, fmt.Errorf("some error"))
+	l.AuditRequest(ctx, &pdu.RollbackReq{Filesystem: "pool/fs", To: snap("a")}, &pdu.RollbackRes{}, 0, nil)
+	l.AuditRequest(ctx, &pdu.RenameReq{Filesystem: "pool/fs", RenameFrom: "pool/old"}, &pdu.RenameRes{}, 0, nil)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 6)
+	var recs []Record
+	for _, line := range lines {
+		var r Record
+		require.NoError(t, json.Unmarshal([]byte(line), &r))
+		assert.Equal(t, "sinkjob", r.Job)
+		assert.Equal(t, "prod1", r.Client)
+		recs = append(recs, r)
+	}
+
+	assert.Equal(t, OpReceive, recs[0].Operation)
+	assert.Equal(t, "@b", recs[0].To)
+	require.NotNil(t, recs[0].Bytes)
+	assert.Equal(t, int64(4711), *recs[0].Bytes)
+	assert.Equal(t, ResultOK, recs[0].Result)
+
+	assert.Equal(t, OpDestroySnapshots, recs[1].Operation)
+	assert.Equal(t, []string{"@a", "@b"}, recs[1].Snapshots)
+	assert.Equal(t, map[string]string{"@b": "dataset is busy"}, recs[1].DestroyErrors)
+	assert.Equal(t, ResultError, recs[1].Result)
+
+	assert.Equal(t, ResultDenied, recs[2].Result)
+
+	assert.Equal(t, OpSend, recs[3].Operation)
+	assert.Equal(t, ResultError, recs[3].Result)
+	assert.Equal(t, "some error", recs[3].Error)
+
+	assert.Equal(t, OpRollback, recs[4].Operation)
+	assert.Equal(t, "@a", recs[4].To)
+	assert.Equal(t, ResultOK, recs[4].Result)
+
+	assert.Equal(t, OpRename, recs[5].Operation)
+	assert.Equal(t, "pool/old", recs[5].RenameFrom)
+}
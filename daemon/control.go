@@ -19,17 +19,17 @@ import (
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/version"
-	"github.com/zrepl/zrepl/zfs"
 	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
 type controlJob struct {
 	sockaddr *net.UnixAddr
 	jobs     *jobs
+	reloader *reloader
 }
 
-func newControlJob(sockpath string, jobs *jobs) (j *controlJob, err error) {
-	j = &controlJob{jobs: jobs}
+func newControlJob(sockpath string, jobs *jobs, reloader *reloader) (j *controlJob, err error) {
+	j = &controlJob{jobs: jobs, reloader: reloader}
 
 	j.sockaddr, err = net.ResolveUnixAddr("unix", sockpath)
 	if err != nil {
@@ -44,7 +44,7 @@ func (j *controlJob) Name() string { return jobNameControl }
 
 func (j *controlJob) Status() *job.Status { return &job.Status{Type: job.TypeInternal} }
 
-func (j *controlJob) OwnedDatasetSubtreeRoot() (p *zfs.DatasetPath, ok bool) { return nil, false }
+func (j *controlJob) OwnedDatasetSubtreeRoots() []string { return nil }
 
 func (j *controlJob) SenderConfig() *endpoint.SenderConfig { return nil }
 
@@ -79,6 +79,20 @@ const (
 	ControlJobEndpointSignal  string = "/signal"
 )
 
+// signal handles requests to ControlJobEndpointSignal.
+func (j *controlJob) signal(op, jobName string) error {
+	switch op {
+	case "wakeup":
+		return j.jobs.wakeup(jobName)
+	case "reset":
+		return j.jobs.reset(jobName)
+	case "reload":
+		return j.reloader.Reload()
+	default:
+		return fmt.Errorf("operation %q is invalid", op)
+	}
+}
+
 func (j *controlJob) Run(ctx context.Context) {
 
 	log := job.GetLogger(ctx)
@@ -135,17 +149,7 @@ func (j *controlJob) Run(ctx context.Context) {
 				return nil, errors.Errorf("decode failed")
 			}
 
-			var err error
-			switch req.Op {
-			case "wakeup":
-				err = j.jobs.wakeup(req.Name)
-			case "reset":
-				err = j.jobs.reset(req.Name)
-			default:
-				err = fmt.Errorf("operation %q is invalid", req.Op)
-			}
-
-			return struct{}{}, err
+			return struct{}{}, j.signal(req.Op, req.Name)
 		}}})
 	server := http.Server{
 		Handler: mux,
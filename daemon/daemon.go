@@ -23,7 +23,7 @@ import (
 	"github.com/zrepl/zrepl/zfs/zfscmd"
 )
 
-func Run(conf *config.Config) error {
+func Run(conf *config.Config, configPath string) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 
@@ -57,9 +57,10 @@ func Run(conf *config.Config) error {
 	ctx = job.WithLogger(ctx, log)
 
 	jobs := newJobs()
+	reloader := newReloader(ctx, configPath, conf, jobs)
 
 	// start control socket
-	controlJob, err := newControlJob(conf.Global.Control.SockPath, jobs)
+	controlJob, err := newControlJob(conf.Global.Control.SockPath, jobs, reloader)
 	if err != nil {
 		panic(err) // FIXME
 	}
@@ -92,6 +93,10 @@ func Run(conf *config.Config) error {
 		jobs.start(ctx, j, false)
 	}
 
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go reloadOnSignal(ctx, hupChan, reloader)
+
 	select {
 	case <-jobs.wait():
 		log.Info("all jobs finished")
@@ -109,6 +114,7 @@ type jobs struct {
 	m       sync.RWMutex
 	wakeups map[string]wakeup.Func // by Job.Name
 	resets  map[string]reset.Func  // by Job.Name
+	stops   map[string]jobStop     // by Job.Name
 	jobs    map[string]job.Job
 }
 
@@ -116,6 +122,7 @@ func newJobs() *jobs {
 	return &jobs{
 		wakeups: make(map[string]wakeup.Func),
 		resets:  make(map[string]reset.Func),
+		stops:   make(map[string]jobStop),
 		jobs:    make(map[string]job.Job),
 	}
 }
@@ -216,21 +223,107 @@ func (s *jobs) start(ctx context.Context, j job.Job, internal bool) {
 		panic(fmt.Sprintf("duplicate job name %s", jobName))
 	}
 
-	j.RegisterMetrics(prometheus.DefaultRegisterer)
+	// unregister the job's metrics when it exits so that
+	// a job of the same name can be started again after a reload
+	registerer := newUnregisteringRegisterer(prometheus.DefaultRegisterer)
+	j.RegisterMetrics(registerer)
 
 	s.jobs[jobName] = j
 	ctx = job.WithLogger(ctx, jobLog)
 	ctx = zfscmd.WithJobID(ctx, j.Name())
 	ctx, wakeup := wakeup.Context(ctx)
 	ctx, resetFunc := reset.Context(ctx)
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
 	s.wakeups[jobName] = wakeup
 	s.resets[jobName] = resetFunc
+	s.stops[jobName] = jobStop{cancel, done}
 
 	s.wg.Add(1)
 	go func() {
 		defer s.wg.Done()
+		defer close(done)
+		defer registerer.unregisterAll()
 		jobLog.Info("starting job")
 		defer jobLog.Info("job exited")
 		j.Run(ctx)
 	}()
 }
+
+type jobStop struct {
+	cancel context.CancelFunc
+	done   <-chan struct{} // closed when the job exited
+}
+
+// stop cancels the contexts of the jobs with the given names and waits for them to exit.
+// The jobs are removed from s before stop waits, i.e., they are no longer visible to
+// status, wakeup or reset while shutting down, and s is not locked while waiting.
+// Jobs that do not exist are skipped and reported in the returned error.
+func (s *jobs) stop(jobNames ...string) error {
+	s.m.Lock()
+	stops := make([]jobStop, 0, len(jobNames))
+	var missing []string
+	for _, jobName := range jobNames {
+		stop, ok := s.stops[jobName]
+		if !ok {
+			missing = append(missing, jobName)
+			continue
+		}
+		stops = append(stops, stop)
+		delete(s.jobs, jobName)
+		delete(s.wakeups, jobName)
+		delete(s.resets, jobName)
+		delete(s.stops, jobName)
+	}
+	s.m.Unlock()
+
+	for _, stop := range stops {
+		stop.cancel()
+	}
+	for _, stop := range stops {
+		<-stop.done
+	}
+	if len(missing) > 0 {
+		return errors.Errorf("jobs do not exist: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// unregisteringRegisterer records all collectors registered through it
+// so that they can be unregistered once the job that registered them exits.
+type unregisteringRegisterer struct {
+	prometheus.Registerer
+	mtx        sync.Mutex
+	collectors []prometheus.Collector
+}
+
+func newUnregisteringRegisterer(r prometheus.Registerer) *unregisteringRegisterer {
+	return &unregisteringRegisterer{Registerer: r}
+}
+
+func (r *unregisteringRegisterer) Register(c prometheus.Collector) error {
+	if err := r.Registerer.Register(c); err != nil {
+		return err
+	}
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+func (r *unregisteringRegisterer) MustRegister(cs ...prometheus.Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (r *unregisteringRegisterer) unregisterAll() {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+	for _, c := range r.collectors {
+		r.Registerer.Unregister(c)
+	}
+	r.collectors = nil
+}
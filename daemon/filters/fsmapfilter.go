@@ -24,6 +24,8 @@ type datasetMapFilterEntry struct {
 	// we have to convert it to the desired rep dynamically
 	mapping      string
 	subtreeMatch bool
+	// replication priority, see Priority
+	priority int
 }
 
 func NewDatasetMapFilter(capacity int, filterMode bool) *DatasetMapFilter {
@@ -241,6 +243,17 @@ func (m DatasetMapFilter) AsFilter() endpoint.FSFilter {
 	return f
 }
 
+// Priority returns the priority of the most specific entry that matches p,
+// or 0 if no entry matches.
+// Priorities can only be set through PrioritizedDatasetMapFilterFromConfig.
+func (m DatasetMapFilter) Priority(p *zfs.DatasetPath) int {
+	mi, found := m.mostSpecificPrefixMapping(p)
+	if !found {
+		return 0
+	}
+	return m.entries[mi].priority
+}
+
 const (
 	MapFilterResultOk   string = "ok"
 	MapFilterResultOmit string = "!"
@@ -259,6 +272,18 @@ func (m DatasetMapFilter) parseDatasetFilterResult(result string) (pass bool, er
 }
 
 func DatasetMapFilterFromConfig(in map[string]bool) (f *DatasetMapFilter, err error) {
+	return PrioritizedDatasetMapFilterFromConfig(in, nil)
+}
+
+// PrioritizedDatasetMapFilterFromConfig is DatasetMapFilterFromConfig with
+// priorities for some of the path patterns in `in` (see DatasetMapFilter.Priority).
+func PrioritizedDatasetMapFilterFromConfig(in map[string]bool, priorities map[string]int) (f *DatasetMapFilter, err error) {
+
+	for pathPattern := range priorities {
+		if _, ok := in[pathPattern]; !ok {
+			return nil, fmt.Errorf("priority for unknown mapping entry '%s'", pathPattern)
+		}
+	}
 
 	f = NewDatasetMapFilter(len(in), true)
 	for pathPattern, accept := range in {
@@ -270,6 +295,7 @@ func DatasetMapFilterFromConfig(in map[string]bool) (f *DatasetMapFilter, err er
 			err = fmt.Errorf("invalid mapping entry ['%s':'%s']: %s", pathPattern, mapping, err)
 			return
 		}
+		f.entries[len(f.entries)-1].priority = priorities[pathPattern]
 	}
 	return
 }
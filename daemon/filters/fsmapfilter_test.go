@@ -87,3 +87,47 @@ func TestDatasetMapFilter(t *testing.T) {
 	}
 
 }
+
+func TestPrioritizedDatasetMapFilter(t *testing.T) {
+
+	f, err := PrioritizedDatasetMapFilterFromConfig(
+		map[string]bool{
+			"tank<":         true,
+			"tank/db<":      true,
+			"tank/db/tmp<":  true,
+			"tank/scratch":  true,
+			"tank/excluded": false,
+		},
+		map[string]int{
+			"tank/db<":     10,
+			"tank/scratch": -5,
+		},
+	)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	checkPriority := map[string]int{
+		"zroot":           0,
+		"tank":            0,
+		"tank/db":         10,
+		"tank/db/pg":      10,
+		"tank/db/tmp":     0, // more specific pattern without priority
+		"tank/scratch":    -5,
+		"tank/scratch/ch": 0,
+	}
+	for p, expected := range checkPriority {
+		zp, err := zfs.NewDatasetPath(p)
+		if err != nil {
+			t.Fatalf("incorrect path spec: %s", err)
+		}
+		if prio := f.Priority(zp); prio != expected {
+			t.Errorf("%q: expected priority %d, got %d", p, expected, prio)
+		}
+	}
+
+	_, err = PrioritizedDatasetMapFilterFromConfig(map[string]bool{"tank<": true}, map[string]int{"tank": 1})
+	if err == nil {
+		t.Errorf("expected error for priority of unknown pattern")
+	}
+}
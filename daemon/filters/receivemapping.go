@@ -0,0 +1,156 @@
+package filters
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ReceiveMapping maps the sender's filesystem names to names relative to a receiver's root_fs.
+//
+// A filesystem that matches an entry of the table is mapped by that entry, which may exclude it.
+// All other filesystems are mapped by stripping the first stripComponents path components
+// and then replacing prefixFrom with prefixTo.
+type ReceiveMapping struct {
+	// nil if there is no table
+	table           *DatasetMapFilter
+	stripComponents int
+	// nil if there is no prefix rewrite
+	prefixFrom, prefixTo *zfs.DatasetPath
+}
+
+var _ endpoint.ReceiveMapping = (*ReceiveMapping)(nil)
+
+// ReceiveMappingFromConfig returns nil, nil if in is nil.
+func ReceiveMappingFromConfig(in *config.RecvMapping) (*ReceiveMapping, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if in.StripComponents < 0 {
+		return nil, errors.New("strip_components must not be negative")
+	}
+	m := &ReceiveMapping{stripComponents: in.StripComponents}
+	if len(in.Table) > 0 {
+		m.table = NewDatasetMapFilter(len(in.Table), false)
+		for pathPattern, mapping := range in.Table {
+			if err := m.table.Add(pathPattern, mapping); err != nil {
+				return nil, fmt.Errorf("invalid table entry ['%s':'%s']: %s", pathPattern, mapping, err)
+			}
+			if mapping == MapFilterResultOmit {
+				continue
+			}
+			if _, err := zfs.NewDatasetPath(mapping); err != nil {
+				return nil, fmt.Errorf("invalid table entry ['%s':'%s']: mapping target is not a dataset path: %s", pathPattern, mapping, err)
+			}
+		}
+	}
+	if in.Prefix != nil {
+		var err error
+		if m.prefixFrom, err = zfs.NewDatasetPath(in.Prefix.From); err != nil {
+			return nil, errors.Wrap(err, "invalid prefix.from")
+		}
+		if m.prefixFrom.Length() == 0 {
+			return nil, errors.New("prefix.from must not be empty")
+		}
+		if m.prefixTo, err = zfs.NewDatasetPath(in.Prefix.To); err != nil {
+			return nil, errors.Wrap(err, "invalid prefix.to")
+		}
+	}
+	return m, nil
+}
+
+func (m *ReceiveMapping) Map(fs *zfs.DatasetPath) (*zfs.DatasetPath, error) {
+	mapped, err := m.mapUnchecked(fs)
+	if err != nil {
+		return nil, err
+	}
+	if mapped.Length() == 0 {
+		return nil, errors.Errorf("filesystem %q is mapped to an empty path", fs.ToString())
+	}
+	return mapped, nil
+}
+
+func (m *ReceiveMapping) mapUnchecked(fs *zfs.DatasetPath) (*zfs.DatasetPath, error) {
+	if m.table != nil {
+		if idx, found := m.table.mostSpecificPrefixMapping(fs); found {
+			if m.table.entries[idx].mapping == MapFilterResultOmit {
+				return nil, errors.Errorf("filesystem %q is excluded by the receive mapping", fs.ToString())
+			}
+			return m.table.Map(fs)
+		}
+	}
+	if fs.Length() <= m.stripComponents {
+		return nil, errors.Errorf("cannot strip %d components of filesystem %q", m.stripComponents, fs.ToString())
+	}
+	mapped := fs.Copy()
+	mapped.TrimNPrefixComps(m.stripComponents)
+	if m.prefixFrom != nil && mapped.HasPrefix(m.prefixFrom) {
+		mapped.TrimPrefix(m.prefixFrom)
+		rewritten := m.prefixTo.Copy()
+		rewritten.Extend(mapped)
+		mapped = rewritten
+	}
+	return mapped, nil
+}
+
+// Invert returns the sender's name of the filesystem that is mapped to local.
+// It returns ok = false if there is no such name or if it cannot be determined
+// because the mapping strips components.
+func (m *ReceiveMapping) Invert(local *zfs.DatasetPath) (fs *zfs.DatasetPath, ok bool) {
+	var candidates []*zfs.DatasetPath
+	if m.table != nil {
+		for _, e := range m.table.entries {
+			if e.mapping == MapFilterResultOmit {
+				continue
+			}
+			target, err := zfs.NewDatasetPath(e.mapping)
+			if err != nil {
+				continue
+			}
+			switch {
+			case e.subtreeMatch && local.HasPrefix(target):
+				c := local.Copy()
+				c.TrimPrefix(target)
+				p := e.path.Copy()
+				p.Extend(c)
+				candidates = append(candidates, p)
+			case !e.subtreeMatch && local.Equal(target):
+				candidates = append(candidates, e.path.Copy())
+			}
+		}
+	}
+	if m.stripComponents == 0 {
+		if m.prefixFrom != nil && local.HasPrefix(m.prefixTo) {
+			c := local.Copy()
+			c.TrimPrefix(m.prefixTo)
+			p := m.prefixFrom.Copy()
+			p.Extend(c)
+			candidates = append(candidates, p)
+		}
+		candidates = append(candidates, local.Copy())
+	}
+	for _, c := range candidates {
+		if mapped, err := m.Map(c); err == nil && mapped.Equal(local) {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// TableTargets returns the mapping targets of the table entries that do not exclude filesystems.
+func (m *ReceiveMapping) TableTargets() []string {
+	if m == nil || m.table == nil {
+		return nil
+	}
+	var targets []string
+	for _, e := range m.table.entries {
+		if e.mapping != MapFilterResultOmit {
+			targets = append(targets, e.mapping)
+		}
+	}
+	return targets
+}
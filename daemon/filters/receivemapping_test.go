@@ -0,0 +1,137 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestReceiveMapping(t *testing.T) {
+	type tc struct {
+		name string
+		in   *config.RecvMapping
+		// sender's name => local name, "" if mapping fails
+		mapped map[string]string
+		// local names whose sender's name cannot be determined
+		notInvertible []string
+	}
+	tcs := []tc{
+		{
+			name: "identity",
+			in:   &config.RecvMapping{},
+			mapped: map[string]string{
+				"zroot/data/a": "zroot/data/a",
+			},
+		},
+		{
+			name: "strip_components",
+			in:   &config.RecvMapping{StripComponents: 2},
+			mapped: map[string]string{
+				"zroot/data/a":   "a",
+				"zroot/data/a/b": "a/b",
+				"zroot/data":     "",
+			},
+			notInvertible: []string{"a", "a/b"},
+		},
+		{
+			name: "prefix",
+			in:   &config.RecvMapping{Prefix: &config.RecvMappingPrefix{From: "zroot/data", To: "backups/data"}},
+			mapped: map[string]string{
+				"zroot/data/a": "backups/data/a",
+				"zroot/data":   "backups/data",
+				"zroot/other":  "zroot/other",
+				"zroot/datax":  "zroot/datax",
+			},
+		},
+		{
+			name: "prefix_to_empty",
+			in:   &config.RecvMapping{Prefix: &config.RecvMappingPrefix{From: "zroot/data"}},
+			mapped: map[string]string{
+				"zroot/data/a": "a",
+				"zroot/data":   "",
+			},
+		},
+		{
+			name: "strip_components_then_prefix",
+			in:   &config.RecvMapping{StripComponents: 1, Prefix: &config.RecvMappingPrefix{From: "data", To: "backups"}},
+			mapped: map[string]string{
+				"zroot/data/a": "backups/a",
+				"tank/data/a":  "backups/a",
+				"zroot/var":    "var",
+			},
+			notInvertible: []string{"backups/a", "var"},
+		},
+		{
+			name: "table",
+			in: &config.RecvMapping{
+				Table: map[string]string{
+					"zroot/var/db<":  "db",
+					"zroot/var/db/x": "x",
+					"zroot/tmp<":     "!",
+				},
+				StripComponents: 1,
+			},
+			mapped: map[string]string{
+				"zroot/var/db":     "db",
+				"zroot/var/db/a":   "db/a",
+				"zroot/var/db/x":   "x",
+				"zroot/tmp":        "",
+				"zroot/tmp/a":      "",
+				"zroot/var/log":    "var/log",
+				"zroot/var/db2/a":  "var/db2/a",
+				"zroot/var/db/x/y": "db/x/y",
+			},
+			notInvertible: []string{"var/log", "var/db2/a"},
+		},
+	}
+
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			m, err := ReceiveMappingFromConfig(c.in)
+			require.NoError(t, err)
+			for in, exp := range c.mapped {
+				p, err := zfs.NewDatasetPath(in)
+				require.NoError(t, err)
+				mapped, err := m.Map(p)
+				if exp == "" {
+					assert.Error(t, err, "%s", in)
+					continue
+				}
+				require.NoError(t, err, "%s", in)
+				assert.Equal(t, exp, mapped.ToString(), "%s", in)
+				notInvertible := false
+				for _, n := range c.notInvertible {
+					notInvertible = notInvertible || n == exp
+				}
+				inv, ok := m.Invert(mapped)
+				if notInvertible {
+					assert.False(t, ok, "%s", exp)
+				} else if assert.True(t, ok, "%s", exp) {
+					assert.Equal(t, in, inv.ToString())
+				}
+			}
+		})
+	}
+
+	t.Run("nil", func(t *testing.T) {
+		m, err := ReceiveMappingFromConfig(nil)
+		assert.NoError(t, err)
+		assert.Nil(t, m)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		for _, in := range []*config.RecvMapping{
+			{StripComponents: -1},
+			{Table: map[string]string{"zroot/a<": "in@valid"}},
+			{Table: map[string]string{"zroot/a<<": "a"}},
+			{Prefix: &config.RecvMappingPrefix{From: "", To: "a"}},
+		} {
+			_, err := ReceiveMappingFromConfig(in)
+			assert.Error(t, err, "%#v", in)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package filters
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+// SnapshotFilter implements endpoint.SnapshotFilter.
+// A nil *SnapshotFilter passes all snapshots.
+type SnapshotFilter struct {
+	regex    *regexp.Regexp // nil if not configured
+	prefixes []string
+	negate   bool
+}
+
+var _ endpoint.SnapshotFilter = (*SnapshotFilter)(nil)
+
+// SnapshotFilterFromConfig returns nil if in is nil.
+func SnapshotFilterFromConfig(in *config.SnapshotFilter) (*SnapshotFilter, error) {
+	if in == nil {
+		return nil, nil
+	}
+	if in.Regex == "" && len(in.Prefixes) == 0 {
+		return nil, fmt.Errorf("must specify `regex` or `prefixes`")
+	}
+	f := &SnapshotFilter{negate: in.Negate}
+	if in.Regex != "" {
+		var err error
+		if f.regex, err = regexp.Compile(in.Regex); err != nil {
+			return nil, errors.Wrap(err, "invalid regex")
+		}
+	}
+	for _, p := range in.Prefixes {
+		if p == "" {
+			return nil, fmt.Errorf("prefixes must not be empty")
+		}
+		f.prefixes = append(f.prefixes, p)
+	}
+	return f, nil
+}
+
+// Filter returns true if the snapshot with the given name (without filesystem and `@`) shall be replicated.
+func (f *SnapshotFilter) Filter(snapshotName string) bool {
+	if f == nil {
+		return true
+	}
+	matches := f.regex != nil && f.regex.MatchString(snapshotName)
+	for _, p := range f.prefixes {
+		matches = matches || strings.HasPrefix(snapshotName, p)
+	}
+	return matches != f.negate
+}
@@ -0,0 +1,71 @@
+package filters
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestSnapshotFilter(t *testing.T) {
+	type tc struct {
+		name     string
+		in       *config.SnapshotFilter
+		pass     []string
+		fail     []string
+		expError bool
+	}
+	tcs := []tc{
+		{
+			name: "regex",
+			in:   &config.SnapshotFilter{Regex: "^zrepl_"},
+			pass: []string{"zrepl_20200101_000000_000"},
+			fail: []string{"tmp-1", "foo_zrepl_"},
+		},
+		{
+			name: "prefixes",
+			in:   &config.SnapshotFilter{Prefixes: []string{"zrepl_", "manual_"}},
+			pass: []string{"zrepl_1", "manual_1"},
+			fail: []string{"tmp-1"},
+		},
+		{
+			name: "regex_or_prefixes",
+			in:   &config.SnapshotFilter{Regex: "_daily$", Prefixes: []string{"zrepl_"}},
+			pass: []string{"zrepl_1", "foo_daily"},
+			fail: []string{"tmp-1"},
+		},
+		{
+			name: "negate",
+			in:   &config.SnapshotFilter{Prefixes: []string{"tmp-"}, Negate: true},
+			pass: []string{"zrepl_1", "manual"},
+			fail: []string{"tmp-1"},
+		},
+		{name: "empty", in: &config.SnapshotFilter{}, expError: true},
+		{name: "empty_prefix", in: &config.SnapshotFilter{Prefixes: []string{""}}, expError: true},
+		{name: "invalid_regex", in: &config.SnapshotFilter{Regex: "("}, expError: true},
+	}
+
+	for _, c := range tcs {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := SnapshotFilterFromConfig(c.in)
+			if c.expError {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			for _, n := range c.pass {
+				assert.True(t, f.Filter(n), n)
+			}
+			for _, n := range c.fail {
+				assert.False(t, f.Filter(n), n)
+			}
+		})
+	}
+
+	f, err := SnapshotFilterFromConfig(nil)
+	require.NoError(t, err)
+	assert.Nil(t, f)
+	assert.True(t, f.Filter("tmp-1"))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -22,6 +23,7 @@ import (
 	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/replication/report"
 	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
 	"github.com/zrepl/zrepl/zfs"
@@ -31,12 +33,27 @@ type ActiveSide struct {
 	mode      activeMode
 	name      endpoint.JobID
 	connecter transport.Connecter
+	// in order of preference, empty if disabled
+	streamCompression []compression.Algorithm
 
 	prunerFactory *pruner.PrunerFactory
 
+	// nil if replication is not restricted to time windows
+	replicationWindows *replicationWindows
+
+	// nil if unlimited
+	bandwidthLimit *bandwidthLimit
+
+	replicationDriverConfig driver.Config
+
+	// set for the targets of a FanOutPush, which prunes the sender itself
+	skipPruneSender bool
+
 	promRepStateSecs    *prometheus.HistogramVec // labels: state
 	promPruneSecs       *prometheus.HistogramVec // labels: prune_side
-	promBytesReplicated *prometheus.CounterVec   // labels: filesystem
+	promReceiverOrphans prometheus.Gauge
+	promBytesReplicated *prometheus.CounterVec // labels: filesystem
+	promThroughput      *replicationThroughputCollector
 
 	tasksMtx sync.Mutex
 	tasks    activeSideTasks
@@ -55,6 +72,9 @@ const (
 type activeSideTasks struct {
 	state ActiveSideState
 
+	// whether the invocation is waiting for the replication window to open
+	waitingForReplicationWindow bool
+
 	// valid for state ActiveSideReplicating, ActiveSidePruneSender, ActiveSidePruneReceiver, ActiveSideDone
 	replicationReport driver.ReportFunc
 	replicationCancel context.CancelFunc
@@ -79,7 +99,7 @@ func (a *ActiveSide) updateTasks(u func(*activeSideTasks)) activeSideTasks {
 }
 
 type activeMode interface {
-	ConnectEndpoints(rpcLoggers rpc.Loggers, connecter transport.Connecter)
+	ConnectEndpoints(rpcLoggers rpc.Loggers, connecter transport.Connecter, streamCompression []compression.Algorithm)
 	DisconnectEndpoints()
 	SenderReceiver() (logic.Sender, logic.Receiver)
 	Type() Type
@@ -98,14 +118,14 @@ type modePush struct {
 	snapper       *snapper.PeriodicOrManual
 }
 
-func (m *modePush) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Connecter) {
+func (m *modePush) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Connecter, streamCompression []compression.Algorithm) {
 	m.setupMtx.Lock()
 	defer m.setupMtx.Unlock()
 	if m.receiver != nil || m.sender != nil {
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.sender = endpoint.NewSender(*m.senderConfig)
-	m.receiver = rpc.NewClient(connecter, loggers)
+	m.receiver = rpc.NewClient(connecter, loggers, streamCompression)
 }
 
 func (m *modePush) DisconnectEndpoints() {
@@ -142,21 +162,64 @@ func (m *modePush) ResetConnectBackoff() {
 	}
 }
 
-func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.JobID) (*modePush, error) {
+// snapshotFilterFromConfig returns nil if in.SnapshotFilter is not configured
+func snapshotFilterFromConfig(in *config.SendOptions) (endpoint.SnapshotFilter, error) {
+	f, err := filters.SnapshotFilterFromConfig(in.SnapshotFilter)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build snapshot filter")
+	}
+	if f == nil {
+		return nil, nil // not a typed nil
+	}
+	return f, nil
+}
+
+func sendFlagsFromConfig(in *config.SendOptions) zfs.ZFSSendFlags {
+	return zfs.ZFSSendFlags{
+		LargeBlocks:      in.LargeBlocks,
+		Compressed:       in.Compressed,
+		EmbeddedData:     in.EmbeddedData,
+		Properties:       in.SendProperties,
+		BackupProperties: in.BackupProperties,
+		Saved:            in.Saved,
+	}
+}
+
+func modePushFromConfig(g *config.Global, in *config.PushJob, jobID endpoint.JobID, bwLimit *bandwidthLimit) (*modePush, error) {
 	m := &modePush{}
 
-	fsf, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	fsf, err := filters.PrioritizedDatasetMapFilterFromConfig(in.Filesystems.Filter, in.Filesystems.Priorities)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
 
+	snapshotFilter, err := snapshotFilterFromConfig(in.Send)
+	if err != nil {
+		return nil, err
+	}
+
 	m.senderConfig = &endpoint.SenderConfig{
-		FSF:     fsf,
-		Encrypt: &zfs.NilBool{B: in.Send.Encrypted},
-		JobID:   jobID,
+		FSF:            fsf,
+		FSPriorities:   fsf,
+		Encrypt:        &zfs.NilBool{B: in.Send.Encrypted},
+		SendFlags:      sendFlagsFromConfig(in.Send),
+		JobID:          jobID,
+		BandwidthLimit: bwLimit.Limiter(),
+		SnapshotFilter: snapshotFilter,
 	}
 	m.plannerPolicy = &logic.PlannerPolicy{
 		EncryptedSend: logic.TriFromBool(in.Send.Encrypted),
+		SendFlags:     logic.SendFlagsPolicyFromFlags(m.senderConfig.SendFlags),
+		Initial:       initialReplicationFromConfig(in.Replication.Initial),
+	}
+	if m.plannerPolicy.ConflictResolution, err = logic.ConflictResolutionFromString(in.Replication.ConflictResolution); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.conflict_resolution")
+	}
+	if m.plannerPolicy.StepStrategy, err = logic.StepStrategyFromString(in.Replication.StepStrategy); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.step_strategy")
+	}
+	if m.plannerPolicy.RenameDetection, err = logic.RenameDetectionFromString(in.Replication.RenameDetection); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.rename_detection")
 	}
 
 	if m.snapper, err = snapper.FromConfig(g, fsf, in.Snapshotting); err != nil {
@@ -176,14 +239,14 @@ type modePull struct {
 	interval       config.PositiveDurationOrManual
 }
 
-func (m *modePull) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Connecter) {
+func (m *modePull) ConnectEndpoints(loggers rpc.Loggers, connecter transport.Connecter, streamCompression []compression.Algorithm) {
 	m.setupMtx.Lock()
 	defer m.setupMtx.Unlock()
 	if m.receiver != nil || m.sender != nil {
 		panic("inconsistent use of ConnectEndpoints and DisconnectEndpoints")
 	}
 	m.receiver = endpoint.NewReceiver(m.receiverConfig)
-	m.sender = rpc.NewClient(connecter, loggers)
+	m.sender = rpc.NewClient(connecter, loggers, streamCompression)
 }
 
 func (m *modePull) DisconnectEndpoints() {
@@ -241,7 +304,11 @@ func (m *modePull) ResetConnectBackoff() {
 	}
 }
 
-func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.JobID) (m *modePull, err error) {
+func initialReplicationFromConfig(in config.ReplicationInitial) logic.InitialReplication {
+	return logic.InitialReplication{All: in.All, Since: in.Since}
+}
+
+func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.JobID, bwLimit *bandwidthLimit) (m *modePull, err error) {
 	m = &modePull{}
 	m.interval = in.Interval
 
@@ -255,13 +322,28 @@ func modePullFromConfig(g *config.Global, in *config.PullJob, jobID endpoint.Job
 
 	m.plannerPolicy = &logic.PlannerPolicy{
 		EncryptedSend: logic.DontCare,
+		Initial:       initialReplicationFromConfig(in.Replication.Initial),
+	}
+	if m.plannerPolicy.ConflictResolution, err = logic.ConflictResolutionFromString(in.Replication.ConflictResolution); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.conflict_resolution")
+	}
+	if m.plannerPolicy.StepStrategy, err = logic.StepStrategyFromString(in.Replication.StepStrategy); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.step_strategy")
+	}
+	if m.plannerPolicy.RenameDetection, err = logic.RenameDetectionFromString(in.Replication.RenameDetection); err != nil {
+		return nil, errors.Wrap(err, "invalid replication.rename_detection")
 	}
 
 	m.receiverConfig = endpoint.ReceiverConfig{
 		JobID:                      jobID,
 		RootWithoutClientComponent: m.rootFS,
-		AppendClientIdentity:       false, // !
 		UpdateLastReceivedHold:     true,
+		BandwidthLimit:             bwLimit.Limiter(),
+		OverrideProperties:         in.Recv.Properties.Override,
+		InheritProperties:          in.Recv.Properties.Inherit,
+	}
+	if m.receiverConfig.Mapping, err = receiveMappingFromConfig(in.Recv); err != nil {
+		return nil, err
 	}
 	if err := m.receiverConfig.Validate(); err != nil {
 		return nil, errors.Wrap(err, "cannot build receiver config")
@@ -278,11 +360,30 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		return nil, errors.Wrap(err, "invalid job name")
 	}
 
+	j.replicationDriverConfig, err = replicationDriverConfigFromConfig(in.Replication)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build replication driver config")
+	}
+
 	switch v := configJob.(type) {
 	case *config.PushJob:
-		j.mode, err = modePushFromConfig(g, v, j.name) // shadow
+		j.bandwidthLimit, err = bandwidthLimitFromConfig(v.Send.BandwidthLimit, BandwidthLimitSend, j.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build bandwidth limit")
+		}
+		if err := endpoint.CheckMaxConcurrentSends(in.Replication.Concurrency.Steps); err != nil {
+			return nil, errors.Wrap(err, "replication.concurrency.steps")
+		}
+		j.mode, err = modePushFromConfig(g, v, j.name, j.bandwidthLimit) // shadow
 	case *config.PullJob:
-		j.mode, err = modePullFromConfig(g, v, j.name) // shadow
+		j.bandwidthLimit, err = bandwidthLimitFromConfig(v.Recv.BandwidthLimit, BandwidthLimitRecv, j.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build bandwidth limit")
+		}
+		if err := endpoint.CheckMaxConcurrentRecvs(in.Replication.Concurrency.Steps); err != nil {
+			return nil, errors.Wrap(err, "replication.concurrency.steps")
+		}
+		j.mode, err = modePullFromConfig(g, v, j.name, j.bandwidthLimit) // shadow
 	default:
 		panic(fmt.Sprintf("implementation error: unknown job type %T", v))
 	}
@@ -304,11 +405,19 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		Help:        "number of bytes replicated from sender to receiver per filesystem",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"filesystem"})
+	j.promThroughput = newReplicationThroughputCollector(j)
 
+	if in.Connect.Ret == nil {
+		return nil, errors.New("connect must be specified")
+	}
 	j.connecter, err = fromconfig.ConnecterFromConfig(g, in.Connect)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build client")
 	}
+	j.streamCompression, err = compression.AlgorithmsFromConfig(in.Connect.Compression())
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build client")
+	}
 
 	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
 		Namespace:   "zrepl",
@@ -317,18 +426,53 @@ func activeSide(g *config.Global, in *config.ActiveJob, configJob interface{}) (
 		Help:        "seconds spent in pruner",
 		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
 	}, []string{"prune_side"})
-	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.promPruneSecs)
+	j.promReceiverOrphans = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "pruning",
+		Name:        "receiver_orphans",
+		Help:        "number of receiver filesystems that the sender does not list, as of the last receiver pruning",
+		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
+	})
+	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.promPruneSecs, j.promReceiverOrphans)
 	if err != nil {
 		return nil, err
 	}
 
+	j.replicationWindows, err = replicationWindowsFromConfig(in.ReplicationWindows)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build replication windows")
+	}
+
 	return j, nil
 }
 
+func replicationDriverConfigFromConfig(in *config.Replication) (driver.Config, error) {
+	if in.Concurrency.Steps < 1 {
+		return driver.Config{}, errors.New("replication.concurrency.steps must be >= 1")
+	}
+	retry := driver.RetryPolicy{
+		MaxAttempts:       in.Retry.MaxAttempts,
+		TransientErrors:   in.Retry.TransientErrors,
+		FilesystemRetries: in.Retry.FilesystemRetries,
+		InitialBackoff:    in.Retry.InitialBackoff,
+		MaxBackoff:        in.Retry.MaxBackoff,
+	}
+	if err := retry.Validate(); err != nil {
+		return driver.Config{}, errors.Wrap(err, "invalid replication.retry")
+	}
+	return driver.Config{
+		StepQueueConcurrency: in.Concurrency.Steps,
+		Retry:                retry,
+	}, nil
+}
+
 func (j *ActiveSide) RegisterMetrics(registerer prometheus.Registerer) {
 	registerer.MustRegister(j.promRepStateSecs)
 	registerer.MustRegister(j.promPruneSecs)
+	registerer.MustRegister(j.promReceiverOrphans)
 	registerer.MustRegister(j.promBytesReplicated)
+	registerer.MustRegister(j.promThroughput)
+	j.bandwidthLimit.RegisterMetrics(registerer)
 }
 
 func (j *ActiveSide) Name() string { return j.name.String() }
@@ -337,6 +481,13 @@ type ActiveSideStatus struct {
 	Replication                    *report.Report
 	PruningSender, PruningReceiver *pruner.Report
 	Snapshotting                   *snapper.Report
+	// nil if replication is not restricted to time windows
+	ReplicationWindow *ReplicationWindowReport
+	// nil if unlimited
+	BandwidthLimit *BandwidthLimitReport
+	// nil unless the job is a FanOutPush, in which case Replication, PruningReceiver,
+	// ReplicationWindow and BandwidthLimit are reported per target instead
+	Targets map[string]*ActiveSideTargetStatus `json:",omitempty"`
 }
 
 func (j *ActiveSide) Status() *Status {
@@ -354,16 +505,20 @@ func (j *ActiveSide) Status() *Status {
 		s.PruningReceiver = tasks.prunerReceiver.Report()
 	}
 	s.Snapshotting = j.mode.SnapperReport()
+	if j.replicationWindows != nil {
+		s.ReplicationWindow = j.replicationWindows.report(tasks.waitingForReplicationWindow)
+	}
+	s.BandwidthLimit = j.bandwidthLimit.Report()
 	return &Status{Type: t, JobSpecific: s}
 }
 
-func (j *ActiveSide) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
+func (j *ActiveSide) OwnedDatasetSubtreeRoots() []string {
 	pull, ok := j.mode.(*modePull)
 	if !ok {
 		_ = j.mode.(*modePush) // make sure we didn't introduce a new job type
-		return nil, false
+		return nil
 	}
-	return pull.rootFS.Copy(), true
+	return []string{pull.rootFS.ToString()}
 }
 
 func (j *ActiveSide) SenderConfig() *endpoint.SenderConfig {
@@ -385,6 +540,7 @@ func (j *ActiveSide) Run(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	go j.mode.RunPeriodic(ctx, periodicDone)
+	go j.bandwidthLimit.Run(ctx)
 
 	invocationCount := 0
 outer:
@@ -409,9 +565,6 @@ func (j *ActiveSide) do(ctx context.Context) {
 
 	log := GetLogger(ctx)
 	ctx = logging.WithSubsystemLoggers(ctx, log)
-	loggers := rpc.GetLoggersOrPanic(ctx) // filled by WithSubsystemLoggers
-	j.mode.ConnectEndpoints(loggers, j.connecter)
-	defer j.mode.DisconnectEndpoints()
 
 	// allow cancellation of an invocation (this function)
 	ctx, cancelThisRun := context.WithCancel(ctx)
@@ -425,31 +578,69 @@ func (j *ActiveSide) do(ctx context.Context) {
 		}
 	}()
 
+	if !j.waitForReplicationWindow(ctx) {
+		return
+	}
+
+	loggers := rpc.GetLoggersOrPanic(ctx) // filled by WithSubsystemLoggers
+	j.mode.ConnectEndpoints(loggers, j.connecter, j.streamCompression)
+	defer j.mode.DisconnectEndpoints()
+
 	sender, receiver := j.mode.SenderReceiver()
 
-	{
+	var prune bool
+	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
 		}
-		ctx, repCancel := context.WithCancel(ctx)
+		repCtx, repCancel := context.WithCancel(ctx)
 		var repWait driver.WaitFunc
 		j.updateTasks(func(tasks *activeSideTasks) {
 			// reset it
 			*tasks = activeSideTasks{}
 			tasks.replicationCancel = repCancel
 			tasks.replicationReport, repWait = replication.Do(
-				ctx, logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, j.mode.PlannerPolicy()),
+				repCtx, j.replicationDriverConfig, logic.NewPlanner(j.promRepStateSecs, j.promBytesReplicated, sender, receiver, j.mode.PlannerPolicy()),
 			)
 			tasks.state = ActiveSideReplicating
 		})
+		var closedByWindow int32
+		if j.replicationWindows != nil && j.replicationWindows.onClose != ReplicationWindowOnCloseContinue {
+			go func() {
+				if j.replicationWindows.wait(repCtx, false) == nil {
+					log.WithField("on_close", j.replicationWindows.onClose).
+						Info("replication window closed, cancelling replication")
+					atomic.StoreInt32(&closedByWindow, 1)
+					repCancel()
+				}
+			}()
+		}
 		log.Info("start replication")
 		repWait(true) // wait blocking
 		repCancel()   // always cancel to free up context resources
+
+		var retryWhenOpen bool
+		retryWhenOpen, prune = j.replicationWindows.afterAttempt(atomic.LoadInt32(&closedByWindow) != 0)
+		if !retryWhenOpen {
+			break
+		}
+		log.Info("pausing replication until the replication window opens again")
+		if !j.waitForReplicationWindow(ctx) {
+			return
+		}
 	}
 
-	{
+	if !prune {
+		log.Info("skipping pruning because the replication window closed")
+		j.updateTasks(func(tasks *activeSideTasks) {
+			tasks.state = ActiveSideDone
+		})
+		return
+	}
+
+	if !j.skipPruneSender {
 		select {
 		case <-ctx.Done():
 			return
@@ -489,3 +680,26 @@ func (j *ActiveSide) do(ctx context.Context) {
 	})
 
 }
+
+// waitForReplicationWindow blocks until the replication window is open.
+// Returns false if ctx is done before that.
+func (j *ActiveSide) waitForReplicationWindow(ctx context.Context) bool {
+	if j.replicationWindows == nil || j.replicationWindows.open(time.Now()) {
+		return true
+	}
+	log := GetLogger(ctx)
+	log.WithField("opens_at", j.replicationWindows.nextChange(time.Now())).
+		Info("replication window is closed, deferring replication")
+	j.updateTasks(func(tasks *activeSideTasks) {
+		tasks.waitingForReplicationWindow = true
+	})
+	defer j.updateTasks(func(tasks *activeSideTasks) {
+		tasks.waitingForReplicationWindow = false
+	})
+	if err := j.replicationWindows.wait(ctx, true); err != nil {
+		log.WithError(err).Info("stopped waiting for replication window")
+		return false
+	}
+	log.Info("replication window opened")
+	return true
+}
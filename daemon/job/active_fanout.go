@@ -0,0 +1,321 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job/reset"
+	"github.com/zrepl/zrepl/daemon/job/wakeup"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/daemon/snapper"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// FanOutPush is a push job that replicates to multiple targets.
+//
+// Each target is replicated to by an ActiveSide with its own job ID
+// (see fanOutTargetJobName), i.e., its own replication cursors and step holds,
+// and its own receiver-side pruning.
+// The targets share the job's snapshotting and sender-side pruning.
+// The latter only considers snapshots as replicated if they have been replicated to all targets.
+type FanOutPush struct {
+	name          endpoint.JobID
+	senderConfig  *endpoint.SenderConfig
+	snapper       *snapper.PeriodicOrManual
+	prunerFactory *pruner.PrunerFactory
+	promPruneSecs *prometheus.HistogramVec // labels: prune_side
+
+	targets []*fanOutTarget
+
+	mtx          sync.Mutex
+	prunerSender *pruner.Pruner
+}
+
+type fanOutTarget struct {
+	name string
+	side *ActiveSide
+}
+
+// fanOutTargetJobName returns the name of the job ID that scopes the
+// replication cursors and holds of target of the push job job.
+func fanOutTargetJobName(job, target string) string {
+	return fmt.Sprintf("%s_%s", job, target)
+}
+
+func fanOutPushFromConfig(g *config.Global, in *config.PushJob) (j *FanOutPush, err error) {
+	if in.Connect.Ret != nil {
+		return nil, errors.New("connect and targets are mutually exclusive")
+	}
+
+	j = &FanOutPush{}
+	j.name, err = endpoint.MakeJobID(in.Name)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid job name")
+	}
+
+	// we only use the sender config and the snapper of the job's own modePush
+	m, err := modePushFromConfig(g, in, j.name, nil)
+	if err != nil {
+		return nil, err
+	}
+	j.senderConfig = m.senderConfig
+	j.snapper = m.snapper
+
+	j.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "pruning",
+		Name:        "time",
+		Help:        "seconds spent in pruner",
+		ConstLabels: prometheus.Labels{"zrepl_job": j.name.String()},
+	}, []string{"prune_side"})
+	// the targets' ActiveSides build the receiver pruners
+	j.prunerFactory, err = pruner.NewPrunerFactory(in.Pruning, j.promPruneSecs, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(in.Targets))
+	for _, t := range in.Targets {
+		if t.Name == "" {
+			return nil, errors.New("target name must not be empty")
+		}
+		if names[t.Name] {
+			return nil, errors.Errorf("duplicate target name %q", t.Name)
+		}
+		names[t.Name] = true
+		side, err := fanOutTargetSideFromConfig(g, in, t)
+		if err != nil {
+			return nil, errors.Wrapf(err, "cannot build target %q", t.Name)
+		}
+		j.targets = append(j.targets, &fanOutTarget{name: t.Name, side: side})
+	}
+
+	return j, nil
+}
+
+// The ActiveSide of a target is built from a copy of the job's config
+// that connects to the target and does not take snapshots.
+func fanOutTargetSideFromConfig(g *config.Global, in *config.PushJob, t *config.PushTarget) (*ActiveSide, error) {
+	tin := *in
+	tin.Name = fanOutTargetJobName(in.Name, t.Name)
+	tin.Connect = t.Connect
+	tin.Targets = nil
+	tin.Snapshotting = config.SnapshottingEnum{Ret: &config.SnapshottingManual{Type: "manual"}}
+	if t.Pruning != nil {
+		tin.Pruning.KeepReceiver = t.Pruning.KeepReceiver
+	}
+	side, err := activeSide(g, &tin.ActiveJob, &tin)
+	if err != nil {
+		return nil, err
+	}
+	side.skipPruneSender = true
+	return side, nil
+}
+
+// targetJobNames returns the job IDs of the targets, see fanOutTargetJobName.
+func (j *FanOutPush) targetJobNames() []string {
+	names := make([]string, len(j.targets))
+	for i, t := range j.targets {
+		names[i] = t.side.Name()
+	}
+	return names
+}
+
+func (j *FanOutPush) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.promPruneSecs)
+	for _, t := range j.targets {
+		t.side.RegisterMetrics(registerer)
+	}
+}
+
+func (j *FanOutPush) Name() string { return j.name.String() }
+
+type ActiveSideTargetStatus struct {
+	Replication     *report.Report
+	PruningReceiver *pruner.Report
+	// nil if replication is not restricted to time windows
+	ReplicationWindow *ReplicationWindowReport
+	// nil if unlimited
+	BandwidthLimit *BandwidthLimitReport
+}
+
+func (j *FanOutPush) Status() *Status {
+	j.mtx.Lock()
+	prunerSender := j.prunerSender
+	j.mtx.Unlock()
+
+	s := &ActiveSideStatus{
+		Targets: make(map[string]*ActiveSideTargetStatus, len(j.targets)),
+	}
+	if prunerSender != nil {
+		s.PruningSender = prunerSender.Report()
+	}
+	s.Snapshotting = j.snapper.Report()
+	for _, t := range j.targets {
+		ts := t.side.Status().JobSpecific.(*ActiveSideStatus)
+		s.Targets[t.name] = &ActiveSideTargetStatus{
+			Replication:       ts.Replication,
+			PruningReceiver:   ts.PruningReceiver,
+			ReplicationWindow: ts.ReplicationWindow,
+			BandwidthLimit:    ts.BandwidthLimit,
+		}
+	}
+	return &Status{Type: TypePush, JobSpecific: s}
+}
+
+func (j *FanOutPush) OwnedDatasetSubtreeRoots() []string { return nil }
+
+func (j *FanOutPush) SenderConfig() *endpoint.SenderConfig { return j.senderConfig }
+
+func (j *FanOutPush) Run(ctx context.Context) {
+	log := GetLogger(ctx)
+	ctx = logging.WithSubsystemLoggers(ctx, log)
+
+	defer log.Info("job exiting")
+
+	periodicDone := make(chan struct{})
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go j.snapper.Run(ctx, periodicDone)
+	for _, t := range j.targets {
+		go t.side.bandwidthLimit.Run(ctx)
+	}
+
+	invocationCount := 0
+outer:
+	for {
+		log.Info("wait for wakeups")
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Info("context")
+			break outer
+
+		case <-wakeup.Wait(ctx):
+			for _, t := range j.targets {
+				t.side.mode.ResetConnectBackoff()
+			}
+		case <-periodicDone:
+		}
+		invocationCount++
+		invLog := log.WithField("invocation", invocationCount)
+		j.do(WithLogger(ctx, invLog))
+	}
+}
+
+func (j *FanOutPush) do(ctx context.Context) {
+
+	log := GetLogger(ctx)
+	ctx = logging.WithSubsystemLoggers(ctx, log)
+
+	// allow cancellation of an invocation (this function)
+	ctx, cancelThisRun := context.WithCancel(ctx)
+	defer cancelThisRun()
+	go func() {
+		select {
+		case <-reset.Wait(ctx):
+			log.Info("reset received, cancelling current invocation")
+			cancelThisRun()
+		case <-ctx.Done():
+		}
+	}()
+
+	// Only one waiter receives a reset, hence the targets must not wait for it themselves.
+	// They are cancelled through ctx instead.
+	targetCtx, _ := reset.Context(ctx)
+	var wg sync.WaitGroup
+	for _, t := range j.targets {
+		wg.Add(1)
+		go func(t *fanOutTarget) {
+			defer wg.Done()
+			t.side.do(WithLogger(targetCtx, log.WithField("target", t.name)))
+		}(t)
+	}
+	wg.Wait()
+
+	select {
+	case <-ctx.Done():
+		return
+	default:
+	}
+
+	sender := endpoint.NewSender(*j.senderConfig)
+	history := fanOutReplicationCursorHistory{
+		sender:  sender,
+		targets: make([]pruner.History, len(j.targets)),
+	}
+	for i, t := range j.targets {
+		history.targets[i] = endpoint.NewSender(*t.side.SenderConfig())
+	}
+	pr := j.prunerFactory.BuildSenderPruner(ctx, sender, history)
+	j.mtx.Lock()
+	j.prunerSender = pr
+	j.mtx.Unlock()
+	log.Info("start pruning sender")
+	pr.Prune()
+	log.Info("finished pruning sender")
+}
+
+// fanOutReplicationCursorHistory is the pruner.History of the sender-side pruning of a FanOutPush.
+// Its replication cursor is the oldest of the targets' replication cursors,
+// i.e., a snapshot is only replicated if it was replicated to all targets.
+type fanOutReplicationCursorHistory struct {
+	// the Target passed as Target to BuildSenderPruner
+	sender pruner.Target
+	// one per target, returning the replication cursor of the target's job ID
+	targets []pruner.History
+}
+
+var _ pruner.History = fanOutReplicationCursorHistory{}
+
+func (h fanOutReplicationCursorHistory) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	guids := make([]uint64, 0, len(h.targets))
+	for _, t := range h.targets {
+		res, err := t.ReplicationCursor(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if res.GetNotexist() {
+			// not replicated to this target yet
+			return res, nil
+		}
+		guids = append(guids, res.GetGuid())
+	}
+	if len(guids) == 0 {
+		return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Notexist{Notexist: true}}, nil
+	}
+
+	fsvReq := &pdu.ListFilesystemVersionsReq{
+		Filesystem: req.GetFilesystem(),
+	}
+	res, err := h.sender.ListFilesystemVersions(ctx, fsvReq)
+	if err != nil {
+		return nil, err
+	}
+	createTXG := make(map[uint64]uint64, len(res.GetVersions()))
+	for _, fsv := range res.GetVersions() {
+		createTXG[fsv.GetGuid()] = fsv.GetCreateTXG()
+	}
+	oldest := guids[0]
+	for _, guid := range guids {
+		txg, ok := createTXG[guid]
+		if !ok {
+			return nil, errors.Errorf("replication cursor with guid %v not found in filesystem versions of %q", guid, req.GetFilesystem())
+		}
+		if txg < createTXG[oldest] {
+			oldest = guid
+		}
+	}
+	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: oldest}}, nil
+}
+
+func (h fanOutReplicationCursorHistory) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	return h.sender.ListFilesystems(ctx, req)
+}
@@ -0,0 +1,165 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestFanOutPushFromConfig(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10
+%s
+`
+	target := func(name string) string {
+		return fmt.Sprintf(`
+  - name: %s
+    connect:
+      type: local
+      listener_name: %s
+      client_identity: foo`, name, name)
+	}
+	fill := func(s string) string { return fmt.Sprintf(tmpl, s) }
+
+	type Case struct {
+		name  string
+		conf  string
+		valid bool
+	}
+	cases := []Case{
+		{"two_targets", "  targets:" + target("onsite") + target("offsite"), true},
+		{"target_pruning", "  targets:" + target("onsite") + `
+    pruning:
+      keep_receiver:
+      - type: last_n
+        count: 100`, true},
+		{"duplicate_target", "  targets:" + target("onsite") + target("onsite"), false},
+		{"connect_and_targets", `  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  targets:` + target("onsite"), false},
+		{"neither_connect_nor_targets", "", false},
+		{"invalid_target_job_id", "  targets:" + target("with/slash"), false},
+		{"target_job_id_collision", "  targets:" + target("bar") + `
+- name: foo_bar
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: not_replicated
+    keep_receiver:
+    - type: last_n
+      count: 10`, false},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := config.ParseConfigBytes([]byte(fill(c.conf)))
+			require.NoError(t, err)
+			jobs, err := JobsFromConfig(conf)
+			if !c.valid {
+				t.Logf("error: %s", err)
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, jobs, 1)
+			f, ok := jobs[0].(*FanOutPush)
+			require.True(t, ok)
+			assert.Equal(t, "foo", f.Name())
+			for _, n := range f.targetJobNames() {
+				assert.Contains(t, []string{"foo_onsite", "foo_offsite"}, n)
+			}
+		})
+	}
+}
+
+type fanOutTestHistory struct {
+	cursor *pdu.ReplicationCursorRes
+}
+
+func (h fanOutTestHistory) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	return h.cursor, nil
+}
+
+func (h fanOutTestHistory) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	panic("not implemented")
+}
+
+type fanOutTestSender struct {
+	pruner.Target
+	versions []*pdu.FilesystemVersion
+}
+
+func (s fanOutTestSender) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	return &pdu.ListFilesystemVersionsRes{Versions: s.versions}, nil
+}
+
+func TestFanOutReplicationCursorHistory(t *testing.T) {
+	sender := fanOutTestSender{versions: []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "a", Guid: 1, CreateTXG: 10},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "b", Guid: 2, CreateTXG: 20},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "c", Guid: 3, CreateTXG: 30},
+	}}
+	cursor := func(guid uint64) pruner.History {
+		return fanOutTestHistory{&pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: guid}}}
+	}
+	notexist := fanOutTestHistory{&pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Notexist{Notexist: true}}}
+
+	type Case struct {
+		name     string
+		targets  []pruner.History
+		notexist bool
+		guid     uint64
+		err      bool
+	}
+	cases := []Case{
+		{name: "single", targets: []pruner.History{cursor(2)}, guid: 2},
+		{name: "oldest", targets: []pruner.History{cursor(3), cursor(1), cursor(2)}, guid: 1},
+		{name: "one_not_replicated", targets: []pruner.History{cursor(3), notexist}, notexist: true},
+		{name: "unknown_guid", targets: []pruner.History{cursor(3), cursor(4)}, err: true},
+	}
+
+	for i := range cases {
+		c := cases[i]
+		t.Run(c.name, func(t *testing.T) {
+			h := fanOutReplicationCursorHistory{sender: sender, targets: c.targets}
+			res, err := h.ReplicationCursor(context.Background(), &pdu.ReplicationCursorReq{Filesystem: "pool/fs"})
+			if c.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, c.notexist, res.GetNotexist())
+			if !c.notexist {
+				assert.Equal(t, c.guid, res.GetGuid())
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package job
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+// replicationThroughputCollector exports the throughput and ETA of the
+// replication attempt that is currently running, as computed by the replication driver
+// for the job's status report.
+// It exports nothing while no attempt is running.
+type replicationThroughputCollector struct {
+	side *ActiveSide
+
+	bytesPerSecond, eta     *prometheus.Desc
+	fsBytesPerSecond, fsETA *prometheus.Desc
+}
+
+var _ prometheus.Collector = (*replicationThroughputCollector)(nil)
+
+func newReplicationThroughputCollector(side *ActiveSide) *replicationThroughputCollector {
+	constLabels := prometheus.Labels{"zrepl_job": side.name.String()}
+	return &replicationThroughputCollector{
+		side: side,
+		bytesPerSecond: prometheus.NewDesc(prometheus.BuildFQName("zrepl", "replication", "throughput_bytes_per_second"),
+			"smoothed replication throughput of the current replication attempt",
+			nil, constLabels),
+		eta: prometheus.NewDesc(prometheus.BuildFQName("zrepl", "replication", "eta_seconds"),
+			"estimated time until the current replication attempt has replicated all expected bytes, not exported if unknown",
+			nil, constLabels),
+		fsBytesPerSecond: prometheus.NewDesc(prometheus.BuildFQName("zrepl", "replication", "filesystem_throughput_bytes_per_second"),
+			"smoothed replication throughput per filesystem that is currently being replicated",
+			[]string{"filesystem"}, constLabels),
+		fsETA: prometheus.NewDesc(prometheus.BuildFQName("zrepl", "replication", "filesystem_eta_seconds"),
+			"estimated time until a filesystem that is currently being replicated has replicated all expected bytes, not exported if unknown",
+			[]string{"filesystem"}, constLabels),
+	}
+}
+
+func (c *replicationThroughputCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.bytesPerSecond
+	ch <- c.eta
+	ch <- c.fsBytesPerSecond
+	ch <- c.fsETA
+}
+
+func (c *replicationThroughputCollector) Collect(ch chan<- prometheus.Metric) {
+	tasks := c.side.updateTasks(nil)
+	if tasks.replicationReport == nil {
+		return
+	}
+	rep := tasks.replicationReport()
+	if len(rep.Attempts) == 0 {
+		return
+	}
+	latest := rep.Attempts[len(rep.Attempts)-1]
+	if latest.Throughput == nil {
+		return
+	}
+	collect := func(bytesPerSecond, eta *prometheus.Desc, t *report.Throughput, labels ...string) {
+		ch <- prometheus.MustNewConstMetric(bytesPerSecond, prometheus.GaugeValue, float64(t.BytesPerSecond), labels...)
+		if t.ETA > 0 {
+			ch <- prometheus.MustNewConstMetric(eta, prometheus.GaugeValue, t.ETA.Seconds(), labels...)
+		}
+	}
+	collect(c.bytesPerSecond, c.eta, latest.Throughput)
+	for _, fs := range latest.Filesystems {
+		if fs.Throughput != nil {
+			collect(c.fsBytesPerSecond, c.fsETA, fs.Throughput, fs.Info.Name)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package job
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+)
+
+type BandwidthLimitDirection string
+
+const (
+	BandwidthLimitSend BandwidthLimitDirection = "send"
+	BandwidthLimitRecv BandwidthLimitDirection = "recv"
+)
+
+type bandwidthLimitScheduleItem struct {
+	window *replicationWindows
+	rate   int64
+}
+
+// bandwidthLimit adjusts the rate of a bandwidthlimit.Limiter
+// shared by all streams of a job according to a time-of-day schedule.
+type bandwidthLimit struct {
+	direction   BandwidthLimitDirection
+	limiter     *bandwidthlimit.Limiter
+	defaultRate int64
+	schedule    []bandwidthLimitScheduleItem // first match wins
+
+	promRate prometheus.Gauge
+}
+
+func bandwidthFromConfig(in config.Bandwidth) int64 {
+	if in.Unlimited {
+		return bandwidthlimit.Unlimited
+	}
+	return in.BytesPerSecond
+}
+
+// returns nil, nil if in is nil
+func bandwidthLimitFromConfig(in *config.BandwidthLimit, direction BandwidthLimitDirection, jobID endpoint.JobID) (*bandwidthLimit, error) {
+	if in == nil {
+		return nil, nil
+	}
+	b := &bandwidthLimit{
+		direction:   direction,
+		defaultRate: bandwidthFromConfig(in.Max),
+	}
+	for i, item := range in.Schedule {
+		// on_close is irrelevant, only the time window is used
+		w, err := replicationWindowsFromConfig(&config.ReplicationWindows{
+			TimeZone: in.TimeZone,
+			OnClose:  string(ReplicationWindowOnCloseContinue),
+			Windows:  []*config.ReplicationWindow{&item.ReplicationWindow},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "schedule item #%d", i+1)
+		}
+		b.schedule = append(b.schedule, bandwidthLimitScheduleItem{w, bandwidthFromConfig(item.Max)})
+	}
+	b.limiter = bandwidthlimit.NewLimiter(b.rateAt(time.Now()))
+	b.promRate = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "bandwidth_limit",
+		Name:        "bytes_per_second",
+		Help:        "effective bandwidth limit, +Inf if unlimited",
+		ConstLabels: prometheus.Labels{"zrepl_job": jobID.String(), "direction": string(direction)},
+	})
+	return b, nil
+}
+
+// Limiter returns nil if b is nil, i.e., if no bandwidth limit is configured.
+func (b *bandwidthLimit) Limiter() *bandwidthlimit.Limiter {
+	if b == nil {
+		return nil
+	}
+	return b.limiter
+}
+
+func (b *bandwidthLimit) RegisterMetrics(registerer prometheus.Registerer) {
+	if b == nil {
+		return
+	}
+	registerer.MustRegister(b.promRate)
+}
+
+func (b *bandwidthLimit) rateAt(t time.Time) int64 {
+	for _, item := range b.schedule {
+		if item.window.open(t) {
+			return item.rate
+		}
+	}
+	return b.defaultRate
+}
+
+// returns the zero time if the rate never changes
+func (b *bandwidthLimit) nextChange(t time.Time) time.Time {
+	var next time.Time
+	for _, item := range b.schedule {
+		n := item.window.nextChange(t)
+		if !n.IsZero() && (next.IsZero() || n.Before(next)) {
+			next = n
+		}
+	}
+	return next
+}
+
+func (b *bandwidthLimit) setRate(rate int64) {
+	b.limiter.SetRate(rate)
+	if rate == bandwidthlimit.Unlimited {
+		b.promRate.Set(math.Inf(1))
+	} else {
+		b.promRate.Set(float64(rate))
+	}
+}
+
+// Run applies the schedule until ctx is done. No-op if b is nil.
+func (b *bandwidthLimit) Run(ctx context.Context) {
+	if b == nil {
+		return
+	}
+	log := GetLogger(ctx).WithField("direction", b.direction)
+	for {
+		now := time.Now()
+		rate := b.rateAt(now)
+		if rate != b.limiter.Rate() {
+			log.WithField("bytes_per_second", rate).Info("changing bandwidth limit")
+		}
+		b.setRate(rate)
+
+		next := b.nextChange(now)
+		if next.IsZero() {
+			<-ctx.Done()
+			return
+		}
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return
+		}
+	}
+}
+
+type BandwidthLimitReport struct {
+	Direction BandwidthLimitDirection
+	// bandwidthlimit.Unlimited (-1) if unlimited
+	BytesPerSecond int64
+	// zero if the limit does not change according to the schedule
+	NextChange time.Time
+}
+
+// Report returns nil if b is nil
+func (b *bandwidthLimit) Report() *BandwidthLimitReport {
+	if b == nil {
+		return nil
+	}
+	return &BandwidthLimitReport{
+		Direction:      b.direction,
+		BytesPerSecond: b.limiter.Rate(),
+		NextChange:     b.nextChange(time.Now()),
+	}
+}
@@ -0,0 +1,55 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
+)
+
+func TestBandwidthLimitSchedule(t *testing.T) {
+	conf, err := config.ParseConfigBytes([]byte(`
+jobs:
+- name: foo
+  type: sink
+  serve:
+    type: local
+    listener_name: foo
+  root_fs: "zroot/sink"
+  recv:
+    bandwidth_limit:
+      max: unlimited
+      timezone: UTC
+      schedule:
+      - days: [mon, tue, wed, thu, fri]
+        start: "08:00"
+        end: "18:00"
+        max: 1 MiB
+      - start: "07:00"
+        end: "20:00"
+        max: 10 MiB
+`))
+	require.NoError(t, err)
+	jobs, err := JobsFromConfig(conf)
+	require.NoError(t, err)
+	b := jobs[0].(*PassiveSide).bandwidthLimit
+	require.NotNil(t, b)
+	assert.Equal(t, BandwidthLimitRecv, b.direction)
+
+	// 2020-01-06 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 1, 6+day, hour, minute, 0, 0, time.UTC)
+	}
+	assert.Equal(t, bandwidthlimit.Unlimited, b.rateAt(at(0, 6, 59)))
+	assert.Equal(t, int64(10<<20), b.rateAt(at(0, 7, 0)))
+	assert.Equal(t, int64(1<<20), b.rateAt(at(0, 8, 0)), "first matching item wins")
+	assert.Equal(t, int64(10<<20), b.rateAt(at(5, 8, 0)), "saturday")
+	assert.Equal(t, bandwidthlimit.Unlimited, b.rateAt(at(5, 20, 0)))
+
+	assert.Equal(t, at(0, 8, 0), b.nextChange(at(0, 7, 0)))
+	assert.Equal(t, at(0, 18, 0), b.nextChange(at(0, 8, 0)))
+}
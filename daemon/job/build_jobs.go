@@ -2,12 +2,15 @@ package job
 
 import (
 	"fmt"
+	"path"
 	"sort"
 	"strings"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/filters"
+	"github.com/zrepl/zrepl/endpoint"
 )
 
 func JobsFromConfig(c *config.Config) ([]Job, error) {
@@ -23,15 +26,28 @@ func JobsFromConfig(c *config.Config) ([]Job, error) {
 		js[i] = j
 	}
 
+	// job IDs scope replication cursors and holds and must hence be unique
+	{
+		ids := make(map[string]bool, len(js))
+		for _, j := range js {
+			names := []string{j.Name()}
+			if f, ok := j.(*FanOutPush); ok {
+				names = append(names, f.targetJobNames()...)
+			}
+			for _, n := range names {
+				if ids[n] {
+					return nil, fmt.Errorf("job name %q is not unique (push targets use job name <job>_<target>)", n)
+				}
+				ids[n] = true
+			}
+		}
+	}
+
 	// receiving-side root filesystems must not overlap
 	{
 		rfss := make([]string, 0, len(js))
 		for _, j := range js {
-			jrfs, ok := j.OwnedDatasetSubtreeRoot()
-			if !ok {
-				continue
-			}
-			rfss = append(rfss, jrfs.ToString())
+			rfss = append(rfss, j.OwnedDatasetSubtreeRoots()...)
 		}
 		if err := validateReceivingSidesDoNotOverlap(rfss); err != nil {
 			return nil, err
@@ -63,7 +79,11 @@ func buildJob(c *config.Global, in config.JobEnum) (j Job, err error) {
 			return cannotBuildJob(err, v.Name)
 		}
 	case *config.PushJob:
-		j, err = activeSide(c, &v.ActiveJob, v)
+		if len(v.Targets) > 0 {
+			j, err = fanOutPushFromConfig(c, v)
+		} else {
+			j, err = activeSide(c, &v.ActiveJob, v)
+		}
 		if err != nil {
 			return cannotBuildJob(err, v.Name)
 		}
@@ -79,12 +99,50 @@ func buildJob(c *config.Global, in config.JobEnum) (j Job, err error) {
 
 }
 
+// validateReceivingSidesDoNotOverlap checks the roots returned by Job.OwnedDatasetSubtreeRoots,
+// which may contain endpoint.ClientRootTemplatePlaceholder.
 func validateReceivingSidesDoNotOverlap(receivingRootFSs []string) error {
-	if len(receivingRootFSs) == 0 {
-		return nil
+	for i := range receivingRootFSs {
+		for j := i + 1; j < len(receivingRootFSs); j++ {
+			a, b := receivingRootFSs[i], receivingRootFSs[j]
+			if endpoint.ClientRootPatternsOverlap(a, b) {
+				return fmt.Errorf("receiving jobs with overlapping root filesystems are forbidden: %q and %q", a, b)
+			}
+		}
 	}
-	rfss := make([]string, len(receivingRootFSs))
-	copy(rfss, receivingRootFSs)
+	return nil
+}
+
+// receiveMappingFromConfig returns nil if in.Mapping is not configured.
+//
+// The targets of the mapping's table must not overlap, otherwise filesystems
+// of different subtrees on the sender would be received into the same subtree.
+func receiveMappingFromConfig(in *config.RecvOptions) (endpoint.ReceiveMapping, error) {
+	m, err := filters.ReceiveMappingFromConfig(in.Mapping)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build receive mapping")
+	}
+	if m == nil {
+		return nil, nil // not a typed nil
+	}
+	// targets are relative to root_fs, an empty target is root_fs itself
+	targets := m.TableTargets()
+	for i := range targets {
+		targets[i] = path.Join("root_fs", targets[i])
+	}
+	if a, b, overlap := findOverlappingPaths(targets); overlap {
+		return nil, fmt.Errorf("cannot build receive mapping: table entries with overlapping targets are forbidden: %q and %q", a, b)
+	}
+	return m, nil
+}
+
+// findOverlappingPaths returns two of paths if one of them is equal to or a prefix of the other.
+func findOverlappingPaths(paths []string) (a, b string, overlap bool) {
+	if len(paths) == 0 {
+		return "", "", false
+	}
+	rfss := make([]string, len(paths))
+	copy(rfss, paths)
 	sort.Slice(rfss, func(i, j int) bool {
 		return strings.Compare(rfss[i], rfss[j]) == -1
 	})
@@ -102,8 +160,8 @@ func validateReceivingSidesDoNotOverlap(receivingRootFSs []string) error {
 	// if any i is prefix of i+n (n >= 1), there is overlap
 	for i := 0; i < len(rfss)-1; i++ {
 		if strings.HasPrefix(rfss[i+1], rfss[i]) {
-			return fmt.Errorf("receiving jobs with overlapping root filesystems are forbidden")
+			return strings.TrimSuffix(rfss[i], "/"), strings.TrimSuffix(rfss[i+1], "/"), true
 		}
 	}
-	return nil
+	return "", "", false
 }
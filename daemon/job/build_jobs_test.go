@@ -33,6 +33,12 @@ func TestValidateReceivingSidesDoNotOverlap(t *testing.T) {
 		{true, []string{"a/x", "b/x", "a/x/y"}},
 		{true, []string{"a", "a/b", "a/c", "a/b"}},
 		{true, []string{"a/b", "a/c", "a/b", "a/d", "a/c"}},
+		// sink jobs with templated root_fs
+		{false, []string{"pool_{{.Client}}/sink1", "pool_{{.Client}}/sink2"}},
+		{false, []string{"pool_{{.Client}}/sink", "otherpool/sink"}},
+		{true, []string{"pool_{{.Client}}/sink", "pool_a/sink/b"}},
+		{true, []string{"pool_{{.Client}}/sink", "pool{{.Client}}/sink"}},
+		{true, []string{"zroot/{{.Client}}", "zroot/pull"}},
 	}
 
 	for _, tc := range tcs {
@@ -108,3 +114,67 @@ jobs:
 	}
 
 }
+
+func TestReceiveMappingTableTargetsDoNotOverlap(t *testing.T) {
+	tcs := []struct {
+		err   bool
+		table map[string]string
+	}{
+		{false, map[string]string{"zroot/a<": "a", "zroot/b<": "b", "zroot/c<": "!"}},
+		{false, map[string]string{"zroot/a<": "x/a", "zroot/b<": "x/ab"}},
+		{true, map[string]string{"zroot/a<": "x", "zroot/b<": "x"}},
+		{true, map[string]string{"zroot/a<": "x", "zroot/b<": "x/b"}},
+		{true, map[string]string{"zroot/a<": "", "zroot/b<": "b"}},
+	}
+	for _, tc := range tcs {
+		t.Logf("table: %v", tc.table)
+		_, err := receiveMappingFromConfig(&config.RecvOptions{Mapping: &config.RecvMapping{Table: tc.table}})
+		if tc.err {
+			assert.Error(t, err)
+		} else {
+			assert.NoError(t, err)
+		}
+	}
+}
+
+func TestConcurrencyStepsDaemonWideLimit(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: %s
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  %s
+  replication:
+    concurrency:
+      steps: %d
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+`
+	for _, typ := range []string{"push", "pull"} {
+		t.Run(typ, func(t *testing.T) {
+			local := "filesystems: {\"<\": true}\n  snapshotting:\n    type: manual"
+			if typ == "pull" {
+				local = "root_fs: pool/sink\n  interval: manual"
+			}
+			build := func(steps int) error {
+				conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, typ, local, steps)))
+				require.NoError(t, err)
+				_, err = JobsFromConfig(conf)
+				return err
+			}
+			// the default of ZREPL_ENDPOINT_MAX_CONCURRENT_SEND and _RECV
+			assert.NoError(t, build(10))
+			err := build(11)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "replication.concurrency.steps")
+		})
+	}
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
-	"github.com/zrepl/zrepl/zfs"
 )
 
 type Logger = logger.Logger
@@ -36,9 +35,11 @@ type Job interface {
 	Run(ctx context.Context)
 	Status() *Status
 	RegisterMetrics(registerer prometheus.Registerer)
-	// Jobs that return a subtree of the dataset hierarchy
-	// must return the root of that subtree as rfs and ok = true
-	OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool)
+	// Jobs that own subtrees of the dataset hierarchy
+	// must return the roots of these subtrees.
+	// The roots may contain endpoint.ClientRootTemplatePlaceholder,
+	// see endpoint.ClientRoots.OwnedSubtreeRoots.
+	OwnedDatasetSubtreeRoots() []string
 	SenderConfig() *endpoint.SenderConfig
 }
 
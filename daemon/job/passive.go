@@ -3,16 +3,20 @@ package job
 import (
 	"context"
 	"fmt"
+	"path/filepath"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/auditlog"
 	"github.com/zrepl/zrepl/daemon/filters"
 	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/pruner"
 	"github.com/zrepl/zrepl/daemon/snapper"
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/transport/fromconfig"
 	"github.com/zrepl/zrepl/zfs"
@@ -22,17 +26,31 @@ type PassiveSide struct {
 	mode   passiveMode
 	name   endpoint.JobID
 	listen transport.AuthenticatedListenerFactory
+	// empty if disabled
+	streamCompression []compression.Algorithm
+	// nil if all clients have full permissions
+	authorizer rpc.RequestAuthorizer
+	// empty if disabled
+	auditLogPath string
+
+	// nil if unlimited
+	bandwidthLimit *bandwidthLimit
 }
 
 type passiveMode interface {
 	Handler() rpc.Handler
 	RunPeriodic(ctx context.Context)
 	SnapperReport() *snapper.Report // may be nil
+	PrunerReport() *pruner.Report   // may be nil
 	Type() Type
 }
 
 type modeSink struct {
 	receiverConfig endpoint.ReceiverConfig
+
+	pruning *sinkPruning // nil if not append-only or no sink-local pruning
+
+	serveReceived *serveReceived // nil if the received filesystems are not served
 }
 
 func (m *modeSink) Type() Type { return TypeSink }
@@ -41,22 +59,69 @@ func (m *modeSink) Handler() rpc.Handler {
 	return endpoint.NewReceiver(m.receiverConfig)
 }
 
-func (m *modeSink) RunPeriodic(_ context.Context)  {}
+func (m *modeSink) RunPeriodic(ctx context.Context) {
+	if m.pruning != nil {
+		m.pruning.Run(ctx)
+	}
+}
+
 func (m *modeSink) SnapperReport() *snapper.Report { return nil }
 
-func modeSinkFromConfig(g *config.Global, in *config.SinkJob, jobID endpoint.JobID) (m *modeSink, err error) {
+func (m *modeSink) PrunerReport() *pruner.Report { return m.pruning.Report() }
+
+func modeSinkFromConfig(g *config.Global, in *config.SinkJob, jobID endpoint.JobID, bwLimit *bandwidthLimit) (m *modeSink, err error) {
 	m = &modeSink{}
 
-	rootDataset, err := zfs.NewDatasetPath(in.RootFS)
+	for clientIdentity := range in.ClientRootFS {
+		if err := transport.ValidateClientIdentity(clientIdentity); err != nil {
+			return nil, errors.Wrapf(err, "client_root_fs: invalid client identity %q", clientIdentity)
+		}
+	}
+	clientRoots, err := endpoint.NewClientRoots(in.RootFS, in.ClientRootFS)
 	if err != nil {
-		return nil, errors.New("root dataset is not a valid zfs filesystem path")
+		return nil, errors.Wrap(err, "cannot build root_fs")
+	}
+	// the client permissions must not refer to clients whose filesystems cannot be received
+	for clientIdentity := range in.ClientPermissions {
+		if err := clientRoots.TestClientIdentity(clientIdentity); err != nil {
+			return nil, errors.Wrapf(err, "client_permissions: client %q", clientIdentity)
+		}
 	}
 
 	m.receiverConfig = endpoint.ReceiverConfig{
-		JobID:                      jobID,
-		RootWithoutClientComponent: rootDataset,
-		AppendClientIdentity:       true, // !
-		UpdateLastReceivedHold:     true,
+		JobID:                  jobID,
+		ClientRoots:            clientRoots,
+		UpdateLastReceivedHold: true,
+		BandwidthLimit:         bwLimit.Limiter(),
+		OverrideProperties:     in.Recv.Properties.Override,
+		InheritProperties:      in.Recv.Properties.Inherit,
+	}
+	if m.receiverConfig.Mapping, err = receiveMappingFromConfig(in.Recv); err != nil {
+		return nil, err
+	}
+	if in.Quota != nil {
+		m.receiverConfig.Quota, err = receiveQuotaFromConfig(in.Quota, clientRoots)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build quota")
+		}
+	}
+	if in.ServeReceived != nil {
+		m.receiverConfig.ReceiveTracker = endpoint.NewReceiveTracker()
+		m.serveReceived, err = serveReceivedFromConfig(g, in.ServeReceived, jobID, clientRoots, m.receiverConfig.ReceiveTracker)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build serve_received")
+		}
+	}
+	if in.AppendOnly != nil {
+		m.receiverConfig.AppendOnly = &endpoint.AppendOnlyConfig{
+			DestroyMinAge: in.AppendOnly.DestroyMinAge,
+		}
+		if in.AppendOnly.Pruning != nil {
+			m.pruning, err = sinkPruningFromConfig(in.AppendOnly.Pruning, jobID, clientRoots)
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot build append-only pruning")
+			}
+		}
 	}
 	if err := m.receiverConfig.Validate(); err != nil {
 		return nil, errors.Wrap(err, "cannot build receiver config")
@@ -65,22 +130,52 @@ func modeSinkFromConfig(g *config.Global, in *config.SinkJob, jobID endpoint.Job
 	return m, nil
 }
 
+func receiveQuotaFromConfig(in *config.SinkQuota, clientRoots *endpoint.ClientRoots) (*endpoint.ReceiveQuotaConfig, error) {
+	q := &endpoint.ReceiveQuotaConfig{
+		ClientQuotas: make(map[string]int64, len(in.Clients)),
+	}
+	for clientIdentity, size := range in.Clients {
+		if err := transport.ValidateClientIdentity(clientIdentity); err != nil {
+			return nil, errors.Wrapf(err, "invalid client identity %q", clientIdentity)
+		}
+		if err := clientRoots.TestClientIdentity(clientIdentity); err != nil {
+			return nil, errors.Wrapf(err, "client %q", clientIdentity)
+		}
+		q.ClientQuotas[clientIdentity] = size.Bytes
+	}
+	if in.Default != nil {
+		q.DefaultQuota = in.Default.Bytes
+	}
+	if in.PoolReserve != nil {
+		q.PoolReserve = in.PoolReserve.Bytes
+	}
+	return q, nil
+}
+
 type modeSource struct {
 	senderConfig *endpoint.SenderConfig
 	snapper      *snapper.PeriodicOrManual
 }
 
-func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint.JobID) (m *modeSource, err error) {
+func modeSourceFromConfig(g *config.Global, in *config.SourceJob, jobID endpoint.JobID, bwLimit *bandwidthLimit) (m *modeSource, err error) {
 	// FIXME exact dedup of modePush
 	m = &modeSource{}
-	fsf, err := filters.DatasetMapFilterFromConfig(in.Filesystems)
+	fsf, err := filters.PrioritizedDatasetMapFilterFromConfig(in.Filesystems.Filter, in.Filesystems.Priorities)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build filesystem filter")
 	}
+	snapshotFilter, err := snapshotFilterFromConfig(in.Send)
+	if err != nil {
+		return nil, err
+	}
 	m.senderConfig = &endpoint.SenderConfig{
-		FSF:     fsf,
-		Encrypt: &zfs.NilBool{B: in.Send.Encrypted},
-		JobID:   jobID,
+		FSF:            fsf,
+		FSPriorities:   fsf,
+		Encrypt:        &zfs.NilBool{B: in.Send.Encrypted},
+		SendFlags:      sendFlagsFromConfig(in.Send),
+		JobID:          jobID,
+		BandwidthLimit: bwLimit.Limiter(),
+		SnapshotFilter: snapshotFilter,
 	}
 
 	if m.snapper, err = snapper.FromConfig(g, fsf, in.Snapshotting); err != nil {
@@ -104,6 +199,8 @@ func (m *modeSource) SnapperReport() *snapper.Report {
 	return m.snapper.Report()
 }
 
+func (m *modeSource) PrunerReport() *pruner.Report { return nil }
+
 func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob interface{}) (s *PassiveSide, err error) {
 
 	s = &PassiveSide{}
@@ -115,9 +212,17 @@ func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob in
 
 	switch v := configJob.(type) {
 	case *config.SinkJob:
-		s.mode, err = modeSinkFromConfig(g, v, s.name) // shadow
+		s.bandwidthLimit, err = bandwidthLimitFromConfig(v.Recv.BandwidthLimit, BandwidthLimitRecv, s.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build bandwidth limit")
+		}
+		s.mode, err = modeSinkFromConfig(g, v, s.name, s.bandwidthLimit) // shadow
 	case *config.SourceJob:
-		s.mode, err = modeSourceFromConfig(g, v, s.name) // shadow
+		s.bandwidthLimit, err = bandwidthLimitFromConfig(v.Send.BandwidthLimit, BandwidthLimitSend, s.name)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build bandwidth limit")
+		}
+		s.mode, err = modeSourceFromConfig(g, v, s.name, s.bandwidthLimit) // shadow
 	}
 	if err != nil {
 		return nil, err // no wrapping necessary
@@ -126,30 +231,76 @@ func passiveSideFromConfig(g *config.Global, in *config.PassiveJob, configJob in
 	if s.listen, err = fromconfig.ListenerFactoryFromConfig(g, in.Serve); err != nil {
 		return nil, errors.Wrap(err, "cannot build listener factory")
 	}
+	if s.streamCompression, err = compression.AlgorithmsFromConfig(in.Serve.Compression()); err != nil {
+		return nil, errors.Wrap(err, "cannot build listener factory")
+	}
+	if in.AuditLog != nil {
+		if !filepath.IsAbs(in.AuditLog.Path) {
+			return nil, errors.Errorf("audit log path must be absolute, got %q", in.AuditLog.Path)
+		}
+		s.auditLogPath = in.AuditLog.Path
+	}
+	if len(in.ClientPermissions) > 0 {
+		s.authorizer, err = authorizerFromConfig(in.ClientPermissions, s.mode.Type())
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build client permissions")
+		}
+	}
 
 	return s, nil
 }
 
+func authorizerFromConfig(in map[string]*config.ClientPermissions, t Type) (*endpoint.Authorizer, error) {
+	perms := make(map[string]endpoint.ClientPermissions, len(in))
+	for clientIdentity, p := range in {
+		if err := transport.ValidateClientIdentity(clientIdentity); err != nil {
+			return nil, errors.Wrapf(err, "invalid client identity %q", clientIdentity)
+		}
+		perm := endpoint.ClientPermissions{
+			ReadOnly:  p.ReadOnly,
+			NoDestroy: p.NoDestroy,
+		}
+		if p.Filesystems != nil {
+			var err error
+			if t != TypeSource {
+				return nil, errors.Errorf("client %q: `filesystems` is only supported for source jobs", clientIdentity)
+			}
+			perm.Filesystems, err = filters.DatasetMapFilterFromConfig(p.Filesystems)
+			if err != nil {
+				return nil, errors.Wrapf(err, "client %q: cannot build filesystem filter", clientIdentity)
+			}
+		}
+		perms[clientIdentity] = perm
+	}
+	return endpoint.NewAuthorizer(perms), nil
+}
+
 func (j *PassiveSide) Name() string { return j.name.String() }
 
 type PassiveStatus struct {
 	Snapper *snapper.Report
+	// nil unless sink job with append-only pruning
+	Pruning *pruner.Report
+	// nil if unlimited
+	BandwidthLimit *BandwidthLimitReport
 }
 
 func (s *PassiveSide) Status() *Status {
 	st := &PassiveStatus{
-		Snapper: s.mode.SnapperReport(),
+		Snapper:        s.mode.SnapperReport(),
+		Pruning:        s.mode.PrunerReport(),
+		BandwidthLimit: s.bandwidthLimit.Report(),
 	}
 	return &Status{Type: s.mode.Type(), JobSpecific: st}
 }
 
-func (j *PassiveSide) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
+func (j *PassiveSide) OwnedDatasetSubtreeRoots() []string {
 	sink, ok := j.mode.(*modeSink)
 	if !ok {
 		_ = j.mode.(*modeSource) // make sure we didn't introduce a new job type
-		return nil, false
+		return nil
 	}
-	return sink.receiverConfig.RootWithoutClientComponent.Copy(), true
+	return sink.receiverConfig.ClientRoots.OwnedSubtreeRoots()
 }
 
 func (j *PassiveSide) SenderConfig() *endpoint.SenderConfig {
@@ -161,7 +312,15 @@ func (j *PassiveSide) SenderConfig() *endpoint.SenderConfig {
 	return source.senderConfig
 }
 
-func (*PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {}
+func (j *PassiveSide) RegisterMetrics(registerer prometheus.Registerer) {
+	j.bandwidthLimit.RegisterMetrics(registerer)
+	if sink, ok := j.mode.(*modeSink); ok && sink.pruning != nil {
+		sink.pruning.RegisterMetrics(registerer)
+	}
+	if sink, ok := j.mode.(*modeSink); ok && sink.serveReceived != nil {
+		sink.serveReceived.RegisterMetrics(registerer)
+	}
+}
 
 func (j *PassiveSide) Run(ctx context.Context) {
 
@@ -172,6 +331,7 @@ func (j *PassiveSide) Run(ctx context.Context) {
 		ctx, cancel := context.WithCancel(ctx) // shadowing
 		defer cancel()
 		go j.mode.RunPeriodic(ctx)
+		go j.bandwidthLimit.Run(ctx)
 	}
 
 	handler := j.mode.Handler()
@@ -184,7 +344,29 @@ func (j *PassiveSide) Run(ctx context.Context) {
 	}
 
 	rpcLoggers := rpc.GetLoggersOrPanic(ctx) // WithSubsystemLoggers above
-	server := rpc.NewServer(handler, rpcLoggers, ctxInterceptor)
+
+	var auditor rpc.RequestAuditor
+	if j.auditLogPath != "" {
+		auditLog, err := auditlog.Open(j.auditLogPath, j.name.String(), rpcLoggers.General)
+		if err != nil {
+			log.WithError(err).Error("cannot open audit log")
+			return
+		}
+		defer func() {
+			if err := auditLog.Close(); err != nil {
+				log.WithError(err).Error("cannot close audit log")
+			}
+		}()
+		auditor = auditLog
+	}
+
+	if sink, ok := j.mode.(*modeSink); ok && sink.serveReceived != nil {
+		ctx, cancel := context.WithCancel(ctx) // shadowing
+		defer cancel()
+		go sink.serveReceived.Run(WithLogger(ctx, log.WithField("serve", "received")), ctxInterceptor, auditor)
+	}
+
+	server := rpc.NewServer(handler, rpcLoggers, ctxInterceptor, j.authorizer, auditor, j.streamCompression)
 
 	listener, err := j.listen()
 	if err != nil {
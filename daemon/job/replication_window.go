@@ -0,0 +1,221 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+// ReplicationWindowOnClose determines what happens to a replication attempt
+// that is still running when the replication window closes.
+type ReplicationWindowOnClose string
+
+const (
+	// let the attempt run to completion
+	ReplicationWindowOnCloseContinue ReplicationWindowOnClose = "continue"
+	// cancel the attempt, replication resumes with the next invocation
+	ReplicationWindowOnCloseCancel ReplicationWindowOnClose = "cancel"
+	// cancel the attempt and start a new one when the window opens again
+	ReplicationWindowOnClosePause ReplicationWindowOnClose = "pause"
+)
+
+type replicationWindow struct {
+	days       [7]bool // indexed by time.Weekday
+	start, end int     // minutes since start of day, end <= start means the window wraps past midnight
+}
+
+func (w replicationWindow) open(t time.Time) bool {
+	m := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && w.start <= m && m < w.end
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && m >= w.start) || (w.days[yesterday] && m < w.end)
+}
+
+type replicationWindows struct {
+	loc     *time.Location
+	onClose ReplicationWindowOnClose
+	windows []replicationWindow
+}
+
+var weekdaysByName = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// returns nil, nil if in is nil
+func replicationWindowsFromConfig(in *config.ReplicationWindows) (*replicationWindows, error) {
+	if in == nil {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(in.TimeZone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid timezone %q", in.TimeZone)
+	}
+	w := &replicationWindows{
+		loc:     loc,
+		onClose: ReplicationWindowOnClose(in.OnClose),
+	}
+	switch w.onClose {
+	case ReplicationWindowOnCloseContinue:
+	case ReplicationWindowOnCloseCancel:
+	case ReplicationWindowOnClosePause:
+	default:
+		return nil, errors.Errorf("invalid on_close value %q", in.OnClose)
+	}
+	if len(in.Windows) == 0 {
+		return nil, errors.New("at least one window must be specified")
+	}
+	for i, cw := range in.Windows {
+		var rw replicationWindow
+		if len(cw.Days) == 0 {
+			for d := range rw.days {
+				rw.days[d] = true
+			}
+		}
+		for _, d := range cw.Days {
+			wd, ok := weekdaysByName[strings.ToLower(d)]
+			if !ok {
+				return nil, errors.Errorf("window #%d: invalid day %q", i+1, d)
+			}
+			rw.days[wd] = true
+		}
+		rw.start, rw.end = cw.Start.Minutes(), cw.End.Minutes()
+		if rw.start == rw.end {
+			return nil, errors.Errorf("window #%d: start and end must not be equal", i+1)
+		}
+		if rw.start == 24*60 {
+			return nil, errors.Errorf("window #%d: start must be before 24:00", i+1)
+		}
+		w.windows = append(w.windows, rw)
+	}
+	return w, nil
+}
+
+func (w *replicationWindows) open(t time.Time) bool {
+	t = t.In(w.loc)
+	for _, rw := range w.windows {
+		if rw.open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextChange returns the first point in time after t at which the window opens or closes.
+// Returns the zero time if the state does not change within a week, i.e., never.
+func (w *replicationWindows) nextChange(t time.Time) time.Time {
+	state := w.open(t)
+	// The state can only change at the start or end of a window.
+	// Collect those edges for the next 8 days and check them in chronological order.
+	// Edges that fall into a DST gap are normalized by time.Date, i.e., they are
+	// reached later than the wall clock minute at which the window opens or closes.
+	lt := t.In(w.loc)
+	var edges []time.Time
+	for d := 0; d <= 8; d++ {
+		for _, rw := range w.windows {
+			for _, m := range []int{rw.start, rw.end} {
+				e := time.Date(lt.Year(), lt.Month(), lt.Day()+d, 0, m, 0, 0, w.loc)
+				if e.After(t) {
+					edges = append(edges, e)
+				}
+			}
+		}
+	}
+	sort.Slice(edges, func(i, j int) bool { return edges[i].Before(edges[j]) })
+	for _, e := range edges {
+		if w.open(e) != state {
+			return e
+		}
+	}
+	return time.Time{}
+}
+
+// wait blocks until the window is in the desired state or ctx is done.
+func (w *replicationWindows) wait(ctx context.Context, open bool) error {
+	for {
+		now := time.Now()
+		if w.open(now) == open {
+			return nil
+		}
+		next := w.nextChange(now)
+		if next.IsZero() {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		t := time.NewTimer(time.Until(next))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// afterAttempt determines how ActiveSide.do continues after a replication attempt.
+// closedByWindow is true if the attempt was cancelled because the window closed.
+// With on_close: pause, the attempt is repeated once the window opens again.
+// Pruning is skipped if the attempt was cancelled, because the job must not
+// use the sender or receiver outside the window.
+// w may be nil.
+func (w *replicationWindows) afterAttempt(closedByWindow bool) (retryWhenOpen, prune bool) {
+	if w == nil || !closedByWindow {
+		return false, true
+	}
+	switch w.onClose {
+	case ReplicationWindowOnClosePause:
+		return true, false
+	case ReplicationWindowOnCloseCancel:
+		return false, false
+	default:
+		return false, true
+	}
+}
+
+type ReplicationWindowReport struct {
+	Open bool
+	// zero if the window never opens or closes
+	NextChange time.Time
+	OnClose    ReplicationWindowOnClose
+	// whether replication is deferred until the window opens
+	Waiting bool
+}
+
+func (r *ReplicationWindowReport) String() string {
+	state := "closed"
+	if r.Open {
+		state = "open"
+	}
+	var next string
+	if !r.NextChange.IsZero() {
+		if r.Open {
+			next = fmt.Sprintf(", closes at %s", r.NextChange)
+		} else {
+			next = fmt.Sprintf(", opens at %s", r.NextChange)
+		}
+	}
+	return fmt.Sprintf("%s%s (on close: %s)", state, next, r.OnClose)
+}
+
+func (w *replicationWindows) report(waiting bool) *ReplicationWindowReport {
+	now := time.Now()
+	return &ReplicationWindowReport{
+		Open:       w.open(now),
+		NextChange: w.nextChange(now),
+		OnClose:    w.onClose,
+		Waiting:    waiting,
+	}
+}
@@ -0,0 +1,163 @@
+package job
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestReplicationWindows(t *testing.T) {
+	tmpl := `
+jobs:
+- name: foo
+  type: push
+  connect:
+    type: local
+    listener_name: foo
+    client_identity: bar
+  filesystems: {"<": true}
+  snapshotting:
+    type: manual
+  pruning:
+    keep_sender:
+    - type: last_n
+      count: 10
+    keep_receiver:
+    - type: last_n
+      count: 10
+  replication_windows:
+    timezone: UTC
+%s
+`
+	build := func(t *testing.T, windows string) (*replicationWindows, error) {
+		conf, err := config.ParseConfigBytes([]byte(fmt.Sprintf(tmpl, windows)))
+		if err != nil {
+			return nil, err
+		}
+		jobs, err := JobsFromConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		require.Len(t, jobs, 1)
+		return jobs[0].(*ActiveSide).replicationWindows, nil
+	}
+
+	// 2020-01-06 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2020, 1, 6+day, hour, minute, 0, 0, time.UTC)
+	}
+
+	t.Run("weekday_nights_and_weekends", func(t *testing.T) {
+		w, err := build(t, `
+    on_close: pause
+    windows:
+    - days: [mon, tue, wed, thu, fri]
+      start: "18:00"
+      end: "07:00"
+    - days: [sat, sun]
+      start: "00:00"
+      end: "24:00"
+`)
+		require.NoError(t, err)
+		assert.Equal(t, ReplicationWindowOnClosePause, w.onClose)
+
+		assert.False(t, w.open(at(0, 6, 59))) // Monday early morning: Sunday is not in the first window
+		assert.False(t, w.open(at(0, 12, 0)))
+		assert.True(t, w.open(at(0, 18, 0)))
+		assert.True(t, w.open(at(1, 6, 59)))  // Tuesday morning, wrapped from Monday
+		assert.False(t, w.open(at(1, 7, 0)))  // end is exclusive
+		assert.True(t, w.open(at(4, 23, 0)))  // Friday night
+		assert.True(t, w.open(at(5, 12, 0)))  // Saturday
+		assert.True(t, w.open(at(6, 23, 59))) // Sunday
+		assert.False(t, w.open(at(7, 0, 0)))  // Monday
+
+		assert.Equal(t, at(0, 18, 0), w.nextChange(at(0, 12, 0).Add(30*time.Second)))
+		assert.Equal(t, at(1, 7, 0), w.nextChange(at(0, 18, 0)))
+		assert.Equal(t, at(7, 0, 0), w.nextChange(at(4, 18, 0)))
+	})
+
+	t.Run("default_days_and_on_close", func(t *testing.T) {
+		w, err := build(t, `
+    windows:
+    - start: "00:00"
+      end: "24:00"
+`)
+		require.NoError(t, err)
+		assert.Equal(t, ReplicationWindowOnCloseContinue, w.onClose)
+		assert.True(t, w.open(at(2, 3, 4)))
+		assert.True(t, w.nextChange(at(2, 3, 4)).IsZero())
+	})
+
+	t.Run("next_change_matches_minute_scan", func(t *testing.T) {
+		w, err := build(t, `
+    windows:
+    - days: [mon, wed]
+      start: "22:30"
+      end: "01:15"
+    - days: [tue]
+      start: "00:00"
+      end: "24:00"
+    - days: [sat]
+      start: "08:00"
+      end: "09:00"
+`)
+		require.NoError(t, err)
+		scan := func(t time.Time) time.Time {
+			state := w.open(t)
+			for c := t.Truncate(time.Minute).Add(time.Minute); c.Sub(t) <= 8*24*time.Hour; c = c.Add(time.Minute) {
+				if w.open(c) != state {
+					return c
+				}
+			}
+			return time.Time{}
+		}
+		for c := at(0, 0, 0); c.Before(at(7, 0, 0)); c = c.Add(17 * time.Minute) {
+			assert.Equal(t, scan(c), w.nextChange(c), "%s", c)
+		}
+	})
+
+	invalid := map[string]string{
+		"no_windows":    "    windows: []\n",
+		"invalid_day":   "    windows:\n    - days: [caturday]\n      start: \"01:00\"\n      end: \"02:00\"\n",
+		"equal":         "    windows:\n    - start: \"01:00\"\n      end: \"01:00\"\n",
+		"invalid_time":  "    windows:\n    - start: \"25:00\"\n      end: \"01:00\"\n",
+		"start_at_24":   "    windows:\n    - start: \"24:00\"\n      end: \"01:00\"\n",
+		"invalid_close": "    on_close: explode\n    windows:\n    - start: \"01:00\"\n      end: \"02:00\"\n",
+	}
+	for name, windows := range invalid {
+		t.Run(name, func(t *testing.T) {
+			_, err := build(t, windows)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestReplicationWindowsAfterAttempt(t *testing.T) {
+	var nilWindows *replicationWindows
+	retry, prune := nilWindows.afterAttempt(false)
+	assert.False(t, retry)
+	assert.True(t, prune)
+
+	tcs := []struct {
+		onClose        ReplicationWindowOnClose
+		closedByWindow bool
+		retry, prune   bool
+	}{
+		{ReplicationWindowOnCloseContinue, false, false, true},
+		{ReplicationWindowOnCloseCancel, false, false, true},
+		{ReplicationWindowOnCloseCancel, true, false, false},
+		{ReplicationWindowOnClosePause, false, false, true},
+		{ReplicationWindowOnClosePause, true, true, false},
+	}
+	for _, tc := range tcs {
+		w := &replicationWindows{onClose: tc.onClose}
+		retry, prune := w.afterAttempt(tc.closedByWindow)
+		assert.Equal(t, tc.retry, retry, "%s %v", tc.onClose, tc.closedByWindow)
+		assert.Equal(t, tc.prune, prune, "%s %v", tc.onClose, tc.closedByWindow)
+	}
+}
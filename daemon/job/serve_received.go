@@ -0,0 +1,100 @@
+package job
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/rpc"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
+	"github.com/zrepl/zrepl/transport"
+	"github.com/zrepl/zrepl/transport/fromconfig"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// serveReceived serves the filesystems below the root_fs of a sink job
+// to other jobs through a second listener, e.g. to a pull job on a third machine.
+//
+// The Sender uses the sink's job ID for its replication cursors and step holds
+// and shares the Receiver's endpoint.ReceiveTracker, i.e., it refuses to send
+// filesystems while they are received into.
+type serveReceived struct {
+	listen transport.AuthenticatedListenerFactory
+	// empty if disabled
+	streamCompression []compression.Algorithm
+	// nil if all clients have full permissions
+	authorizer rpc.RequestAuthorizer
+
+	senderConfig *endpoint.SenderConfig
+
+	// nil if unlimited
+	bandwidthLimit *bandwidthLimit
+}
+
+func serveReceivedFromConfig(g *config.Global, in *config.SinkServeReceived, jobID endpoint.JobID, received zfs.DatasetFilter, tracker *endpoint.ReceiveTracker) (s *serveReceived, err error) {
+	s = &serveReceived{}
+
+	s.bandwidthLimit, err = bandwidthLimitFromConfig(in.Send.BandwidthLimit, BandwidthLimitSend, jobID)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build bandwidth limit")
+	}
+
+	snapshotFilter, err := snapshotFilterFromConfig(in.Send)
+	if err != nil {
+		return nil, err
+	}
+	s.senderConfig = &endpoint.SenderConfig{
+		FSF:            received,
+		Encrypt:        &zfs.NilBool{B: in.Send.Encrypted},
+		SendFlags:      sendFlagsFromConfig(in.Send),
+		JobID:          jobID,
+		BandwidthLimit: s.bandwidthLimit.Limiter(),
+		ReceiveTracker: tracker,
+		SnapshotFilter: snapshotFilter,
+	}
+	if err := s.senderConfig.Validate(); err != nil {
+		return nil, errors.Wrap(err, "cannot build sender config")
+	}
+
+	if s.listen, err = fromconfig.ListenerFactoryFromConfig(g, in.Serve); err != nil {
+		return nil, errors.Wrap(err, "cannot build listener factory")
+	}
+	if s.streamCompression, err = compression.AlgorithmsFromConfig(in.Serve.Compression()); err != nil {
+		return nil, errors.Wrap(err, "cannot build listener factory")
+	}
+	if len(in.ClientPermissions) > 0 {
+		s.authorizer, err = authorizerFromConfig(in.ClientPermissions, TypeSource)
+		if err != nil {
+			return nil, errors.Wrap(err, "cannot build client permissions")
+		}
+	}
+
+	return s, nil
+}
+
+func (s *serveReceived) RegisterMetrics(registerer prometheus.Registerer) {
+	s.bandwidthLimit.RegisterMetrics(registerer)
+}
+
+// Run serves until ctx is done. auditor may be nil.
+func (s *serveReceived) Run(ctx context.Context, ctxInterceptor rpc.HandlerContextInterceptor, auditor rpc.RequestAuditor) {
+	log := GetLogger(ctx)
+
+	go s.bandwidthLimit.Run(ctx)
+
+	handler := endpoint.NewSender(*s.senderConfig)
+	rpcLoggers := rpc.GetLoggersOrPanic(ctx)
+	server := rpc.NewServer(handler, rpcLoggers, ctxInterceptor, s.authorizer, auditor, s.streamCompression)
+
+	listener, err := s.listen()
+	if err != nil {
+		log.WithError(err).Error("cannot listen")
+		return
+	}
+
+	log.Info("serving received filesystems")
+	server.Serve(ctx, listener)
+}
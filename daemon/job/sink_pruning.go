@@ -0,0 +1,101 @@
+package job
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/logging"
+	"github.com/zrepl/zrepl/daemon/pruner"
+	"github.com/zrepl/zrepl/endpoint"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// sinkPruning prunes the snapshots below the root_fs of an append-only sink job.
+// In contrast to the keep_receiver rules of the sending side,
+// the clients of the sink cannot influence it.
+type sinkPruning struct {
+	jobID         endpoint.JobID
+	interval      time.Duration
+	fsfilter      zfs.DatasetFilter
+	prunerFactory *pruner.LocalPrunerFactory
+	promPruneSecs *prometheus.HistogramVec // labels: prune_side
+
+	mtx    sync.Mutex
+	pruner *pruner.Pruner
+}
+
+func sinkPruningFromConfig(in *config.SinkPruning, jobID endpoint.JobID, received zfs.DatasetFilter) (*sinkPruning, error) {
+	p := &sinkPruning{
+		jobID:    jobID,
+		interval: in.Interval,
+		fsfilter: received,
+	}
+	var err error
+	p.promPruneSecs = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace:   "zrepl",
+		Subsystem:   "pruning",
+		Name:        "time",
+		Help:        "seconds spent in pruner",
+		ConstLabels: prometheus.Labels{"zrepl_job": jobID.String()},
+	}, []string{"prune_side"})
+	p.prunerFactory, err = pruner.NewLocalPrunerFactory(in.PruningLocal, p.promPruneSecs)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot build pruning rules")
+	}
+	return p, nil
+}
+
+func (p *sinkPruning) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(p.promPruneSecs)
+}
+
+// Report returns nil if p is nil or has not run yet.
+func (p *sinkPruning) Report() *pruner.Report {
+	if p == nil {
+		return nil
+	}
+	p.mtx.Lock()
+	defer p.mtx.Unlock()
+	if p.pruner == nil {
+		return nil
+	}
+	return p.pruner.Report()
+}
+
+func (p *sinkPruning) Run(ctx context.Context) {
+	log := GetLogger(ctx)
+	t := time.NewTicker(p.interval)
+	defer t.Stop()
+	for {
+		p.doPrune(ctx)
+		select {
+		case <-ctx.Done():
+			log.WithError(ctx.Err()).Info("context done")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (p *sinkPruning) doPrune(ctx context.Context) {
+	log := GetLogger(ctx)
+	ctx = logging.WithSubsystemLoggers(ctx, log)
+	target := endpoint.NewSender(endpoint.SenderConfig{
+		JobID: p.jobID,
+		FSF:   p.fsfilter,
+		// encryption setting is irrelevant because the endpoint is only used as pruner.Target
+		Encrypt: &zfs.NilBool{B: true},
+	})
+	pr := p.prunerFactory.BuildSinkPruner(ctx, target, alwaysUpToDateReplicationCursorHistory{target})
+	p.mtx.Lock()
+	p.pruner = pr
+	p.mtx.Unlock()
+	log.Info("start pruning")
+	pr.Prune()
+	log.Info("finished pruning")
+}
@@ -82,9 +82,7 @@ func (j *SnapJob) Status() *Status {
 	return &Status{Type: t, JobSpecific: s}
 }
 
-func (j *SnapJob) OwnedDatasetSubtreeRoot() (rfs *zfs.DatasetPath, ok bool) {
-	return nil, false
-}
+func (j *SnapJob) OwnedDatasetSubtreeRoots() []string { return nil }
 
 func (j *SnapJob) SenderConfig() *endpoint.SenderConfig { return nil }
 
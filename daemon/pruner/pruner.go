@@ -12,6 +12,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/logger"
 	"github.com/zrepl/zrepl/pruning"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
@@ -56,6 +57,9 @@ type args struct {
 	retryWait                      time.Duration
 	considerSnapAtCursorReplicated bool
 	promPruneSecs                  prometheus.Observer
+	orphans                        orphanPolicy
+	promOrphans                    prometheus.Gauge // nil unless receiver pruner
+	keepMostRecent                 bool             // never destroy the most recent snapshot of a filesystem
 }
 
 type Pruner struct {
@@ -78,6 +82,8 @@ type PrunerFactory struct {
 	retryWait                      time.Duration
 	considerSnapAtCursorReplicated bool
 	promPruneSecs                  *prometheus.HistogramVec
+	receiverOrphans                orphanPolicy
+	promReceiverOrphans            prometheus.Gauge
 }
 
 type LocalPrunerFactory struct {
@@ -106,7 +112,8 @@ func NewLocalPrunerFactory(in config.PruningLocal, promPruneSecs *prometheus.His
 	return f, nil
 }
 
-func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus.HistogramVec) (*PrunerFactory, error) {
+// promReceiverOrphans may be nil if the factory does not build receiver pruners.
+func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus.HistogramVec, promReceiverOrphans prometheus.Gauge) (*PrunerFactory, error) {
 	keepRulesReceiver, err := pruning.RulesFromConfig(in.KeepReceiver)
 	if err != nil {
 		return nil, errors.Wrap(err, "cannot build receiver pruning rules")
@@ -131,6 +138,8 @@ func NewPrunerFactory(in config.PruningSenderReceiver, promPruneSecs *prometheus
 		retryWait:                      envconst.Duration("ZREPL_PRUNER_RETRY_INTERVAL", 10*time.Second),
 		considerSnapAtCursorReplicated: considerSnapAtCursorReplicated,
 		promPruneSecs:                  promPruneSecs,
+		receiverOrphans:                orphanPolicyFromConfig(in.ReceiverOrphans),
+		promReceiverOrphans:            promReceiverOrphans,
 	}
 	return f, nil
 }
@@ -145,6 +154,9 @@ func (f *PrunerFactory) BuildSenderPruner(ctx context.Context, target Target, re
 			f.retryWait,
 			f.considerSnapAtCursorReplicated,
 			f.promPruneSecs.WithLabelValues("sender"),
+			orphanPolicy{}, // the sender is its own history
+			nil,
+			false,
 		},
 		state: Plan,
 	}
@@ -161,6 +173,9 @@ func (f *PrunerFactory) BuildReceiverPruner(ctx context.Context, target Target,
 			f.retryWait,
 			false, // senseless here anyways
 			f.promPruneSecs.WithLabelValues("receiver"),
+			f.receiverOrphans,
+			f.promReceiverOrphans,
+			false,
 		},
 		state: Plan,
 	}
@@ -177,12 +192,33 @@ func (f *LocalPrunerFactory) BuildLocalPruner(ctx context.Context, target Target
 			f.retryWait,
 			false, // considerSnapAtCursorReplicated is not relevant for local pruning
 			f.promPruneSecs.WithLabelValues("local"),
+			orphanPolicy{}, // the target is its own history
+			nil,
+			false,
 		},
 		state: Plan,
 	}
 	return p
 }
 
+// BuildSinkPruner is like BuildLocalPruner, but the pruner never destroys the most recent snapshot
+// of a filesystem because it is the incremental base of the sink's clients (and protected by the last-received-hold).
+func (f *LocalPrunerFactory) BuildSinkPruner(ctx context.Context, target Target, receiver History) *Pruner {
+	p := f.BuildLocalPruner(ctx, target, receiver)
+	p.args.keepMostRecent = true
+	return p
+}
+
+func withoutSnapshot(snaps []pruning.Snapshot, without snapshot) []pruning.Snapshot {
+	ret := make([]pruning.Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if s.(snapshot).fsv.Guid != without.fsv.Guid {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
 //go:generate enumer -type=State
 type State int
 
@@ -225,6 +261,8 @@ type FSReport struct {
 	SnapshotList, DestroyList []SnapshotReport
 	SkipReason                FSSkipReason
 	LastError                 string
+	// the sender does not list the filesystem (anymore)
+	Orphan bool
 }
 
 type SnapshotReport struct {
@@ -267,6 +305,9 @@ type fs struct {
 	// contains the reason
 	skipReason FSSkipReason
 
+	// the fs is not listed by the sender, see orphanPolicy
+	orphan bool
+
 	// snapshots presented by target
 	// (type snapshot)
 	snaps []pruning.Snapshot
@@ -286,6 +327,8 @@ const (
 	NotSkipped                   = ""
 	SkipPlaceholder              = "filesystem is placeholder"
 	SkipNoCorrespondenceOnSender = "filesystem has no correspondence on sender"
+	SkipOrphanSenderListsNothing = "filesystem has no correspondence on sender, but the sender lists no filesystems at all"
+	SkipConflictAside            = "filesystem was renamed aside by conflict resolution"
 )
 
 func (r FSSkipReason) NotSkipped() bool {
@@ -299,6 +342,7 @@ func (f *fs) Report() FSReport {
 	r := FSReport{}
 	r.Filesystem = f.path
 	r.SkipReason = f.skipReason
+	r.Orphan = f.orphan
 	if !r.SkipReason.NotSkipped() {
 		return r
 	}
@@ -371,6 +415,7 @@ func doOneAttempt(a *args, u updater) {
 	}
 	tfss := tfssres.GetFilesystems()
 
+	var orphanCount int
 	pfss := make([]*fs, len(tfss))
 tfss_loop:
 	for i, tfs := range tfss {
@@ -387,10 +432,28 @@ tfss_loop:
 			pfs.skipReason = SkipPlaceholder
 			l.WithField("skip_reason", pfs.skipReason).Debug("skipping filesystem")
 			continue
-		} else if sfs := sfss[tfs.GetPath()]; sfs == nil {
-			pfs.skipReason = SkipNoCorrespondenceOnSender
-			l.WithField("skip_reason", pfs.skipReason).WithField("sfs", sfs.GetPath()).Debug("skipping filesystem")
+		} else if sfs := sfss[tfs.GetPath()]; sfs == nil && endpoint.IsConflictAside(tfs.GetPath()) {
+			// kept until the user destroys it, see full_resend_into_new_dataset
+			pfs.skipReason = SkipConflictAside
+			l.WithField("skip_reason", pfs.skipReason).Debug("skipping filesystem")
 			continue
+		} else if sfs == nil {
+			pfs.orphan = true
+			orphanCount++
+			if !a.orphans.destroysSnapshots() {
+				pfs.skipReason = SkipNoCorrespondenceOnSender
+				if a.orphans.warn {
+					l.Warn("filesystem is not listed by the sender (anymore), its snapshots are not pruned")
+				}
+				l.WithField("skip_reason", pfs.skipReason).WithField("sfs", sfs.GetPath()).Debug("skipping filesystem")
+				continue
+			}
+			if len(sfss) == 0 {
+				// protect against a misconfigured or broken sender
+				pfs.skipReason = SkipOrphanSenderListsNothing
+				l.WithField("skip_reason", pfs.skipReason).Warn("skipping filesystem")
+				continue
+			}
 		}
 
 		pfsPlanErrAndLog := func(err error, message string) {
@@ -410,6 +473,15 @@ tfss_loop:
 
 		pfs.snaps = make([]pruning.Snapshot, 0, len(tfsvs))
 
+		if pfs.orphan {
+			if err := planOrphan(a, pfs, tfsvs); err != nil {
+				pfsPlanErrAndLog(err, "fs version with invalid creation date")
+				continue tfss_loop
+			}
+			l.WithField("destroy_count", len(pfs.destroyList)).Info("filesystem is not listed by the sender (anymore), pruning it with the policy for orphans")
+			continue tfss_loop
+		}
+
 		rcReq := &pdu.ReplicationCursorReq{
 			Filesystem: tfs.Path,
 		}
@@ -465,6 +537,13 @@ tfss_loop:
 
 		// Apply prune rules
 		pfs.destroyList = pruning.PruneSnapshots(pfs.snaps, a.rules)
+		if a.keepMostRecent && len(pfs.snaps) > 0 {
+			pfs.destroyList = withoutSnapshot(pfs.destroyList, pfs.snaps[len(pfs.snaps)-1].(snapshot))
+		}
+	}
+
+	if a.promOrphans != nil {
+		a.promOrphans.Set(float64(orphanCount))
 	}
 
 	u(func(pruner *Pruner) {
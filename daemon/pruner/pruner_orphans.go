@@ -0,0 +1,85 @@
+package pruner
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/pruning"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// orphanPolicy determines how a receiver pruner handles orphans,
+// i.e., target filesystems that the sender does not list (anymore),
+// e.g., because they were destroyed on the sender.
+// Without replication, orphans never get new snapshots, and without an orphanPolicy, they are never pruned.
+// Filesystems that the receiver renamed aside to resolve a conflict (see endpoint.IsConflictAside)
+// are not orphans, they are kept for the user to inspect.
+//
+// Only snapshots are destroyed, the orphan itself and its most recent snapshot remain on
+// the receiver because the endpoint protocol does not support destroying filesystems.
+type orphanPolicy struct {
+	warn                   bool
+	pruneWithReceiverRules bool
+	destroyAfter           time.Duration
+}
+
+func orphanPolicyFromConfig(in config.PruningReceiverOrphans) orphanPolicy {
+	return orphanPolicy{
+		warn:                   in.Warn,
+		pruneWithReceiverRules: in.PruneWithReceiverRules,
+		destroyAfter:           in.DestroyAfter,
+	}
+}
+
+// destroysSnapshots returns false if orphans are only reported.
+func (o orphanPolicy) destroysSnapshots() bool {
+	return o.pruneWithReceiverRules || o.destroyAfter > 0
+}
+
+// destroyList returns the snapshots of an orphan that the policy destroys.
+// snaps must be sorted by CreateTXG.
+// All snapshots of an orphan are considered replicated.
+//
+// destroyAfter keeps the most recent snapshot because it is held by the
+// last-received-hold of the receiver and hence cannot be destroyed.
+func (o orphanPolicy) destroyList(snaps []pruning.Snapshot, rules []pruning.KeepRule, now time.Time) []pruning.Snapshot {
+	if o.pruneWithReceiverRules {
+		return pruning.PruneSnapshots(snaps, rules)
+	}
+	if o.destroyAfter > 0 && len(snaps) > 0 {
+		for _, s := range snaps {
+			if now.Sub(s.Date()) < o.destroyAfter {
+				// the orphan has a snapshot that is too recent
+				return []pruning.Snapshot{}
+			}
+		}
+		return withoutSnapshot(snaps, snaps[len(snaps)-1].(snapshot))
+	}
+	return []pruning.Snapshot{}
+}
+
+// planOrphan is the counterpart of the planning in doOneAttempt for an orphan pfs.
+// Orphans have no replication cursor on the sender.
+func planOrphan(a *args, pfs *fs, tfsvs []*pdu.FilesystemVersion) error {
+	sort.Slice(tfsvs, func(i, j int) bool {
+		return tfsvs[i].CreateTXG < tfsvs[j].CreateTXG
+	})
+	for _, tfsv := range tfsvs {
+		if tfsv.Type != pdu.FilesystemVersion_Snapshot {
+			continue
+		}
+		creation, err := tfsv.CreationAsTime()
+		if err != nil {
+			return fmt.Errorf("%s: %s", tfsv.RelName(), err)
+		}
+		pfs.snaps = append(pfs.snaps, snapshot{
+			replicated: true,
+			date:       creation,
+			fsv:        tfsv,
+		})
+	}
+	pfs.destroyList = a.orphans.destroyList(pfs.snaps, a.rules, time.Now())
+	return nil
+}
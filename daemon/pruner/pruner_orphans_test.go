@@ -0,0 +1,121 @@
+package pruner
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/pruning"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestReceiverPrunerOrphans(t *testing.T) {
+	now := time.Now()
+	snap := func(name string, guid uint64, age time.Duration) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:      name,
+			Type:      pdu.FilesystemVersion_Snapshot,
+			Guid:      guid,
+			CreateTXG: guid,
+			Creation:  pdu.FilesystemVersionCreation(now.Add(-age)),
+		}
+	}
+	day := 24 * time.Hour
+	lastOne, err := pruning.NewKeepLastN(1)
+	require.NoError(t, err)
+
+	runHeld := func(t *testing.T, policy orphanPolicy, held map[string]bool, senderFSs ...string) (*Report, map[string][]string, float64) {
+		sender := &testEndpoint{versions: make(map[string][]*pdu.FilesystemVersion)}
+		for _, p := range senderFSs {
+			sender.versions[p] = []*pdu.FilesystemVersion{snap("a", 1, 3*day)}
+		}
+		receiver := &testEndpoint{
+			versions: map[string][]*pdu.FilesystemVersion{
+				"pool/fs":     {snap("a", 1, 3*day)},
+				"pool/gone":   {snap("b", 2, 10*day), snap("c", 3, 9*day)},
+				"pool/recent": {snap("d", 4, 10*day), snap("e", 5, time.Hour)},
+				// renamed aside by full_resend_into_new_dataset
+				"pool/fs_zrepl_conflict_20200304_030607": {snap("f", 6, 10*day), snap("g", 7, 9*day)},
+			},
+			destroyed: make(map[string][]string),
+			held:      held,
+		}
+		promOrphans := prometheus.NewGauge(prometheus.GaugeOpts{Name: "orphans"})
+		p := &Pruner{
+			args: args{
+				ctx:           context.Background(),
+				target:        receiver,
+				receiver:      sender,
+				rules:         []pruning.KeepRule{lastOne},
+				promPruneSecs: prometheus.NewHistogram(prometheus.HistogramOpts{Name: "secs"}),
+				orphans:       policy,
+				promOrphans:   promOrphans,
+			},
+			state: Plan,
+		}
+		p.Prune()
+		return p.Report(), receiver.destroyed, testutil.ToFloat64(promOrphans)
+	}
+	run := func(t *testing.T, policy orphanPolicy, senderFSs ...string) (*Report, map[string][]string, float64) {
+		return runHeld(t, policy, nil, senderFSs...)
+	}
+	fsReport := func(r *Report, fs string) FSReport {
+		for _, fsr := range r.Completed {
+			if fsr.Filesystem == fs {
+				return fsr
+			}
+		}
+		t.Fatalf("no report for %q", fs)
+		return FSReport{}
+	}
+
+	t.Run("report", func(t *testing.T) {
+		r, destroyed, orphans := run(t, orphanPolicy{}, "pool/fs")
+		assert.Equal(t, Done.String(), r.State)
+		assert.Equal(t, float64(2), orphans)
+		assert.Empty(t, destroyed)
+		assert.False(t, fsReport(r, "pool/fs").Orphan)
+		gone := fsReport(r, "pool/gone")
+		assert.True(t, gone.Orphan)
+		assert.Equal(t, FSSkipReason(SkipNoCorrespondenceOnSender), gone.SkipReason)
+		aside := fsReport(r, "pool/fs_zrepl_conflict_20200304_030607")
+		assert.False(t, aside.Orphan)
+		assert.Equal(t, FSSkipReason(SkipConflictAside), aside.SkipReason)
+	})
+
+	t.Run("prune_with_receiver_rules", func(t *testing.T) {
+		r, destroyed, _ := run(t, orphanPolicy{pruneWithReceiverRules: true}, "pool/fs")
+		assert.Equal(t, Done.String(), r.State)
+		assert.Equal(t, map[string][]string{"pool/gone": {"b"}, "pool/recent": {"d"}}, destroyed)
+		assert.True(t, fsReport(r, "pool/gone").SkipReason.NotSkipped())
+	})
+
+	t.Run("destroy_after", func(t *testing.T) {
+		r, destroyed, _ := run(t, orphanPolicy{destroyAfter: 7 * day}, "pool/fs")
+		assert.Equal(t, Done.String(), r.State)
+		assert.Equal(t, map[string][]string{"pool/gone": {"b"}}, destroyed)
+		assert.Empty(t, fsReport(r, "pool/recent").DestroyList)
+	})
+
+	t.Run("destroy_after_keeps_held_most_recent_snapshot", func(t *testing.T) {
+		// the most recent snapshots are held by the last-received-hold
+		r, destroyed, _ := runHeld(t, orphanPolicy{destroyAfter: 7 * day}, map[string]bool{"a": true, "c": true, "e": true}, "pool/fs")
+		assert.Equal(t, Done.String(), r.State)
+		assert.Equal(t, map[string][]string{"pool/gone": {"b"}}, destroyed)
+		gone := fsReport(r, "pool/gone")
+		assert.Len(t, gone.DestroyList, 1)
+		assert.Empty(t, gone.LastError)
+	})
+
+	t.Run("sender_lists_nothing", func(t *testing.T) {
+		r, destroyed, orphans := run(t, orphanPolicy{destroyAfter: 7 * day})
+		assert.Equal(t, float64(3), orphans)
+		assert.Empty(t, destroyed)
+		assert.Equal(t, FSSkipReason(SkipOrphanSenderListsNothing), fsReport(r, "pool/gone").SkipReason)
+	})
+}
@@ -0,0 +1,111 @@
+package pruner
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/pruning"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// testEndpoint implements Target and History with in-memory filesystems.
+type testEndpoint struct {
+	versions  map[string][]*pdu.FilesystemVersion
+	destroyed map[string][]string
+	held      map[string]bool // snapshot names that cannot be destroyed
+}
+
+func (e *testEndpoint) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
+	res := &pdu.ListFilesystemRes{}
+	for p := range e.versions {
+		res.Filesystems = append(res.Filesystems, &pdu.Filesystem{Path: p})
+	}
+	return res, nil
+}
+
+func (e *testEndpoint) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	v, ok := e.versions[req.Filesystem]
+	if !ok {
+		return nil, fmt.Errorf("filesystem %q does not exist", req.Filesystem)
+	}
+	return &pdu.ListFilesystemVersionsRes{Versions: v}, nil
+}
+
+func (e *testEndpoint) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
+	res := &pdu.DestroySnapshotsRes{}
+	for _, s := range req.Snapshots {
+		if e.held[s.Name] {
+			res.Results = append(res.Results, &pdu.DestroySnapshotRes{Snapshot: s, Error: "dataset is busy"})
+			continue
+		}
+		e.destroyed[req.Filesystem] = append(e.destroyed[req.Filesystem], s.Name)
+		res.Results = append(res.Results, &pdu.DestroySnapshotRes{Snapshot: s})
+	}
+	return res, nil
+}
+
+func (e *testEndpoint) ReplicationCursor(ctx context.Context, req *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
+	v := e.versions[req.Filesystem]
+	if len(v) == 0 {
+		return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Notexist{Notexist: true}}, nil
+	}
+	return &pdu.ReplicationCursorRes{Result: &pdu.ReplicationCursorRes_Guid{Guid: v[len(v)-1].Guid}}, nil
+}
+
+func TestSinkPrunerKeepsMostRecentSnapshot(t *testing.T) {
+	now := time.Now()
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:      name,
+			Type:      pdu.FilesystemVersion_Snapshot,
+			Guid:      guid,
+			CreateTXG: guid,
+			Creation:  pdu.FilesystemVersionCreation(now.Add(-time.Duration(10-guid) * time.Hour)),
+		}
+	}
+	keepNone, err := pruning.NewKeepRegex("^keep_", false)
+	require.NoError(t, err)
+	f := &LocalPrunerFactory{
+		keepRules:     []pruning.KeepRule{keepNone},
+		promPruneSecs: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "secs"}, []string{"prune_side"}),
+	}
+
+	run := func(t *testing.T, build func(ctx context.Context, target Target, receiver History) *Pruner) (*Report, map[string][]string) {
+		target := &testEndpoint{
+			versions: map[string][]*pdu.FilesystemVersion{
+				"pool/sink/client/fs": {snap("a", 1), snap("b", 2), snap("c", 3)},
+			},
+			destroyed: make(map[string][]string),
+			// the last-received-hold
+			held: map[string]bool{"c": true},
+		}
+		p := build(context.Background(), target, target)
+		p.Prune()
+		return p.Report(), target.destroyed
+	}
+
+	t.Run("local", func(t *testing.T) {
+		r, destroyed := run(t, f.BuildLocalPruner)
+		// the pruner does not destroy snapshots in a particular order
+		assert.ElementsMatch(t, []string{"a", "b"}, destroyed["pool/sink/client/fs"])
+		require.Len(t, r.Completed, 1)
+		assert.Len(t, r.Completed[0].DestroyList, 3)
+		assert.NotEmpty(t, r.Completed[0].LastError)
+	})
+
+	t.Run("sink", func(t *testing.T) {
+		r, destroyed := run(t, f.BuildSinkPruner)
+		assert.Equal(t, Done.String(), r.State)
+		// the pruner does not destroy snapshots in a particular order
+		assert.ElementsMatch(t, []string{"a", "b"}, destroyed["pool/sink/client/fs"])
+		require.Len(t, r.Completed, 1)
+		assert.Len(t, r.Completed[0].DestroyList, 2)
+		assert.Empty(t, r.Completed[0].LastError)
+	})
+}
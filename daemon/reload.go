@@ -0,0 +1,156 @@
+package daemon
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+)
+
+// reloader re-reads the config file and applies changes to the job set
+// of a running daemon.
+type reloader struct {
+	ctx        context.Context // the context that config jobs are started with
+	configPath string
+	jobs       *jobs
+	buildJobs  func(*config.Config) ([]job.Job, error) // job.JobsFromConfig, replaced by tests
+
+	mtx  sync.Mutex // serializes reloads, protects conf
+	conf *config.Config
+}
+
+func newReloader(ctx context.Context, configPath string, conf *config.Config, jobs *jobs) *reloader {
+	return &reloader{
+		ctx:        ctx,
+		configPath: configPath,
+		jobs:       jobs,
+		buildJobs:  job.JobsFromConfig,
+		conf:       conf,
+	}
+}
+
+// reloadOnSignal reloads the config whenever a signal is received on sigs (SIGHUP).
+func reloadOnSignal(ctx context.Context, sigs <-chan os.Signal, r *reloader) {
+	log := job.GetLogger(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigs:
+			log.Info("received SIGHUP, reloading config")
+			if err := r.Reload(); err != nil {
+				log.WithError(err).Error("config reload failed, keeping current config")
+			}
+		}
+	}
+}
+
+type jobConfigDiff struct {
+	removed, changed, added []string // job names
+}
+
+func (d jobConfigDiff) empty() bool {
+	return len(d.removed) == 0 && len(d.changed) == 0 && len(d.added) == 0
+}
+
+// diffJobConfigs compares the jobs of two configs by name.
+// A job whose config differs in any way is reported as changed.
+func diffJobConfigs(old, new *config.Config) (d jobConfigDiff) {
+	oldJobs := make(map[string]config.JobEnum, len(old.Jobs))
+	for _, j := range old.Jobs {
+		oldJobs[j.Name()] = j
+	}
+	newJobs := make(map[string]config.JobEnum, len(new.Jobs))
+	for _, j := range new.Jobs {
+		newJobs[j.Name()] = j
+	}
+	for name, oj := range oldJobs {
+		nj, ok := newJobs[name]
+		if !ok {
+			d.removed = append(d.removed, name)
+		} else if !reflect.DeepEqual(oj.Ret, nj.Ret) {
+			d.changed = append(d.changed, name)
+		}
+	}
+	for name := range newJobs {
+		if _, ok := oldJobs[name]; !ok {
+			d.added = append(d.added, name)
+		}
+	}
+	sort.Strings(d.removed)
+	sort.Strings(d.changed)
+	sort.Strings(d.added)
+	return d
+}
+
+// Reload parses the config file and builds all jobs from it.
+// If that fails, the currently running jobs are left untouched and an error is returned.
+// Otherwise, jobs that were removed or changed are stopped (waiting for them to exit),
+// and jobs that were added or changed are started.
+// Unchanged jobs keep running.
+//
+// Changes to the global section cannot be applied at runtime and cause the reload to be refused.
+func (r *reloader) Reload() error {
+	r.mtx.Lock()
+	defer r.mtx.Unlock()
+
+	log := job.GetLogger(r.ctx)
+
+	newConf, err := config.ParseConfig(r.configPath)
+	if err != nil {
+		return errors.Wrap(err, "cannot parse config")
+	}
+
+	if !reflect.DeepEqual(r.conf.Global, newConf.Global) {
+		return errors.New("changes to the global section require a daemon restart")
+	}
+
+	// builds all jobs and runs cross-job validation (e.g. non-overlapping receiving sides)
+	newJobs, err := r.buildJobs(newConf)
+	if err != nil {
+		return errors.Wrap(err, "cannot build jobs from config")
+	}
+	newJobsByName := make(map[string]job.Job, len(newJobs))
+	for _, j := range newJobs {
+		if IsInternalJobName(j.Name()) {
+			return errors.Errorf("internal job name used for config job '%s'", j.Name())
+		}
+		newJobsByName[j.Name()] = j
+	}
+
+	diff := diffJobConfigs(r.conf, newConf)
+	if diff.empty() {
+		log.Info("config reload: no job changes")
+		r.conf = newConf
+		return nil
+	}
+	log.WithField("removed", diff.removed).
+		WithField("changed", diff.changed).
+		WithField("added", diff.added).
+		Info("config reload: applying job changes")
+
+	// stop all jobs at once so that they shut down concurrently
+	if stop := append(append([]string{}, diff.removed...), diff.changed...); len(stop) > 0 {
+		log.WithField("jobs", stop).Info("config reload: stopping jobs")
+		if err := r.jobs.stop(stop...); err != nil {
+			// should not happen, but don't abort the reload half-way
+			log.WithError(err).Error("config reload: cannot stop jobs")
+		}
+	}
+	for _, names := range [][]string{diff.changed, diff.added} {
+		for _, name := range names {
+			log.WithField(logJobField, name).Info("config reload: starting job")
+			r.jobs.start(r.ctx, newJobsByName[name], false)
+		}
+	}
+
+	r.conf = newConf
+	log.Info("config reload: done")
+	return nil
+}
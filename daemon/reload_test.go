@@ -0,0 +1,234 @@
+package daemon
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/daemon/job"
+	"github.com/zrepl/zrepl/endpoint"
+)
+
+func reloadTestSnapJob(name, interval string) string {
+	return fmt.Sprintf(`
+- name: %s
+  type: snap
+  filesystems: {"<": true}
+  snapshotting:
+    type: periodic
+    prefix: zrepl_
+    interval: %s
+  pruning:
+    keep:
+    - type: last_n
+      count: 10
+`, name, interval)
+}
+
+func TestDiffJobConfigs(t *testing.T) {
+	snapJob := reloadTestSnapJob
+	parse := func(jobs ...string) *config.Config {
+		s := "jobs:"
+		for _, j := range jobs {
+			s += j
+		}
+		c, err := config.ParseConfigBytes([]byte(s))
+		require.NoError(t, err)
+		return c
+	}
+
+	old := parse(snapJob("unchanged", "10m"), snapJob("changed", "10m"), snapJob("removed", "10m"))
+	new := parse(snapJob("unchanged", "10m"), snapJob("changed", "20m"), snapJob("added", "10m"))
+
+	d := diffJobConfigs(old, new)
+	assert.Equal(t, []string{"removed"}, d.removed)
+	assert.Equal(t, []string{"changed"}, d.changed)
+	assert.Equal(t, []string{"added"}, d.added)
+	assert.False(t, d.empty())
+
+	assert.True(t, diffJobConfigs(old, parse(snapJob("unchanged", "10m"), snapJob("changed", "10m"), snapJob("removed", "10m"))).empty())
+}
+
+// reloadTestJob runs until it is stopped.
+type reloadTestJob struct {
+	name             string
+	metric           prometheus.Gauge
+	running, stopped chan struct{}
+}
+
+func newReloadTestJob(name string) *reloadTestJob {
+	return &reloadTestJob{
+		name: name,
+		metric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name:        "zrepl_reload_test_job",
+			ConstLabels: prometheus.Labels{"zrepl_job": name},
+		}),
+		running: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+func (j *reloadTestJob) Name() string { return j.name }
+
+func (j *reloadTestJob) Run(ctx context.Context) {
+	close(j.running)
+	<-ctx.Done()
+	close(j.stopped)
+}
+
+func (j *reloadTestJob) Status() *job.Status { return &job.Status{Type: job.TypeSnap} }
+
+func (j *reloadTestJob) RegisterMetrics(registerer prometheus.Registerer) {
+	registerer.MustRegister(j.metric)
+}
+
+func (j *reloadTestJob) OwnedDatasetSubtreeRoots() []string { return nil }
+
+func (j *reloadTestJob) SenderConfig() *endpoint.SenderConfig { return nil }
+
+func TestReload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "zrepl.yml")
+	writeConfig := func(global string, jobs ...string) {
+		s := global + "\njobs:"
+		for _, j := range jobs {
+			s += j
+		}
+		require.NoError(t, ioutil.WriteFile(configPath, []byte(s), 0600))
+	}
+	snapJob := reloadTestSnapJob
+
+	// all instances built for a job name, the most recent one last
+	var builtMtx sync.Mutex
+	built := make(map[string][]*reloadTestJob)
+	buildJobs := func(c *config.Config) ([]job.Job, error) {
+		builtMtx.Lock()
+		defer builtMtx.Unlock()
+		var jobs []job.Job
+		for _, jc := range c.Jobs {
+			j := newReloadTestJob(jc.Name())
+			built[j.name] = append(built[j.name], j)
+			jobs = append(jobs, j)
+		}
+		return jobs, nil
+	}
+	latest := func(name string) *reloadTestJob {
+		builtMtx.Lock()
+		defer builtMtx.Unlock()
+		require.NotEmpty(t, built[name], name)
+		return built[name][len(built[name])-1]
+	}
+	waitClosed := func(c chan struct{}, what string) {
+		select {
+		case <-c:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timeout waiting for %s", what)
+		}
+	}
+	isClosed := func(c chan struct{}) bool {
+		select {
+		case <-c:
+			return true
+		default:
+			return false
+		}
+	}
+	jobsWithMetric := func() (names []string) {
+		mfs, err := prometheus.DefaultGatherer.Gather()
+		require.NoError(t, err)
+		for _, mf := range mfs {
+			if mf.GetName() != "zrepl_reload_test_job" {
+				continue
+			}
+			for _, m := range mf.GetMetric() {
+				for _, l := range m.GetLabel() {
+					if l.GetName() == "zrepl_job" {
+						names = append(names, l.GetValue())
+					}
+				}
+			}
+		}
+		sort.Strings(names)
+		return names
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	js := newJobs()
+	defer func() {
+		_ = js.stop("unchanged", "changed", "removed", "added")
+	}()
+
+	writeConfig("", snapJob("unchanged", "10m"), snapJob("changed", "10m"), snapJob("removed", "10m"))
+	conf, err := config.ParseConfig(configPath)
+	require.NoError(t, err)
+	initial, err := buildJobs(conf)
+	require.NoError(t, err)
+	for _, j := range initial {
+		js.start(ctx, j, false)
+		waitClosed(j.(*reloadTestJob).running, j.Name())
+	}
+	r := newReloader(ctx, configPath, conf, js)
+	r.buildJobs = buildJobs
+	unchanged, changed, removed := latest("unchanged"), latest("changed"), latest("removed")
+	assert.Equal(t, []string{"changed", "removed", "unchanged"}, jobsWithMetric())
+
+	t.Run("sighup", func(t *testing.T) {
+		writeConfig("", snapJob("unchanged", "10m"), snapJob("changed", "20m"), snapJob("added", "10m"))
+		sigs := make(chan os.Signal, 1)
+		go reloadOnSignal(ctx, sigs, r)
+		sigs <- syscall.SIGHUP
+
+		// stopping happens before starting
+		require.Eventually(t, func() bool {
+			builtMtx.Lock()
+			defer builtMtx.Unlock()
+			return len(built["added"]) > 0
+		}, 10*time.Second, 10*time.Millisecond)
+		waitClosed(latest("added").running, "added job")
+		waitClosed(latest("changed").running, "changed job")
+		assert.True(t, isClosed(removed.stopped))
+		assert.True(t, isClosed(changed.stopped))
+		assert.False(t, isClosed(unchanged.stopped))
+		builtMtx.Lock()
+		assert.Len(t, built["unchanged"], 2, "jobs are built from the new config")
+		builtMtx.Unlock()
+
+		js.m.RLock()
+		assert.Same(t, unchanged, js.jobs["unchanged"], "unchanged jobs keep running")
+		assert.Same(t, latest("changed"), js.jobs["changed"])
+		assert.NotContains(t, js.jobs, "removed")
+		js.m.RUnlock()
+
+		// the metrics of the old instance of the changed job were unregistered, otherwise registering those of the new instance would have failed
+		assert.Equal(t, []string{"added", "changed", "unchanged"}, jobsWithMetric())
+	})
+
+	t.Run("control_socket", func(t *testing.T) {
+		control := &controlJob{jobs: js, reloader: r}
+		added := latest("added")
+
+		writeConfig("global:\n  control:\n    sockpath: /tmp/other.sock", snapJob("unchanged", "10m"), snapJob("changed", "20m"))
+		err := control.signal("reload", "")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "global")
+		assert.False(t, isClosed(added.stopped), "a refused reload must not stop jobs")
+
+		writeConfig("", snapJob("unchanged", "10m"), snapJob("changed", "20m"))
+		require.NoError(t, control.signal("reload", ""))
+		assert.True(t, isClosed(added.stopped))
+		assert.False(t, isClosed(unchanged.stopped))
+		assert.Equal(t, []string{"changed", "unchanged"}, jobsWithMetric())
+	})
+}
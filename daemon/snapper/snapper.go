@@ -47,7 +47,7 @@ type args struct {
 	ctx            context.Context
 	log            Logger
 	prefix         string
-	interval       time.Duration
+	schedule       schedule
 	fsf            *filters.DatasetMapFilter
 	snapshotsTaken chan<- struct{}
 	hooks          *hooks.List
@@ -136,7 +136,37 @@ func PeriodicFromConfig(g *config.Global, fsf *filters.DatasetMapFilter, in *con
 
 	args := args{
 		prefix:   in.Prefix,
-		interval: in.Interval,
+		schedule: periodicSchedule{in.Interval},
+		fsf:      fsf,
+		hooks:    hookList,
+		// ctx and log is set in Run()
+	}
+
+	return &Snapper{state: SyncUp, args: args}, nil
+}
+
+func CronFromConfig(g *config.Global, fsf *filters.DatasetMapFilter, in *config.SnapshottingCron) (*Snapper, error) {
+	if in.Prefix == "" {
+		return nil, errors.New("prefix must not be empty")
+	}
+	loc, err := time.LoadLocation(in.TimeZone)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid timezone %q", in.TimeZone)
+	}
+
+	schedule := cronSchedule{in.Cron, loc}
+	if schedule.next(time.Now()).IsZero() {
+		return nil, errors.New("cron expression never matches")
+	}
+
+	hookList, err := hooks.ListFromConfig(&in.Hooks)
+	if err != nil {
+		return nil, errors.Wrap(err, "hook config error")
+	}
+
+	args := args{
+		prefix:   in.Prefix,
+		schedule: schedule,
 		fsf:      fsf,
 		hooks:    hookList,
 		// ctx and log is set in Run()
@@ -209,7 +239,7 @@ func syncUp(a args, u updater) state {
 	if err != nil {
 		return onErr(err, u)
 	}
-	syncPoint, err := findSyncPoint(a.log, fss, a.prefix, a.interval)
+	syncPoint, err := a.schedule.syncPoint(a.log, fss, a.prefix)
 	if err != nil {
 		return onErr(err, u)
 	}
@@ -374,9 +404,9 @@ func wait(a args, u updater) state {
 	var sleepUntil time.Time
 	u(func(snapper *Snapper) {
 		lastTick := snapper.lastInvocation
-		snapper.sleepUntil = lastTick.Add(a.interval)
+		snapper.sleepUntil = a.schedule.next(lastTick)
 		sleepUntil = snapper.sleepUntil
-		log := a.log.WithField("sleep_until", sleepUntil).WithField("duration", a.interval)
+		log := a.log.WithField("sleep_until", sleepUntil).WithField("schedule", a.schedule.String())
 		logFunc := log.Debug
 		if snapper.state == ErrorWait || snapper.state == SyncUpErrWait {
 			logFunc = log.Error
@@ -40,6 +40,12 @@ func FromConfig(g *config.Global, fsf *filters.DatasetMapFilter, in config.Snaps
 			return nil, err
 		}
 		return &PeriodicOrManual{snapper}, nil
+	case *config.SnapshottingCron:
+		snapper, err := CronFromConfig(g, fsf, v)
+		if err != nil {
+			return nil, err
+		}
+		return &PeriodicOrManual{snapper}, nil
 	case *config.SnapshottingManual:
 		return &PeriodicOrManual{}, nil
 	default:
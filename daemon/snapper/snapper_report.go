@@ -13,6 +13,10 @@ type Report struct {
 	State State
 	// valid in state SyncUp and Waiting
 	SleepUntil time.Time
+	// human-readable description of the snapshotting schedule
+	Schedule string
+	// time at which the next snapshot is scheduled, zero if unknown (e.g. in state Stopped)
+	NextSnapshotAt time.Time
 	// valid in state Err
 	Error string
 	// valid in state Snapshotting
@@ -107,11 +111,21 @@ func (s *Snapper) Report() *Report {
 		return strings.Compare(pReps[i].Path, pReps[j].Path) == -1
 	})
 
+	var nextSnapshotAt time.Time
+	switch s.state {
+	case SyncUp, SyncUpErrWait, Waiting, ErrorWait:
+		nextSnapshotAt = s.sleepUntil
+	case Planning, Snapshotting:
+		nextSnapshotAt = s.args.schedule.next(s.lastInvocation)
+	}
+
 	r := &Report{
-		State:      s.state,
-		SleepUntil: s.sleepUntil,
-		Error:      errOrEmptyString(s.err),
-		Progress:   pReps,
+		State:          s.state,
+		SleepUntil:     s.sleepUntil,
+		Schedule:       s.args.schedule.String(),
+		NextSnapshotAt: nextSnapshotAt,
+		Error:          errOrEmptyString(s.err),
+		Progress:       pReps,
 	}
 
 	return r
@@ -0,0 +1,73 @@
+package snapper
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zrepl/zrepl/config"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// schedule determines when the snapper takes snapshots.
+type schedule interface {
+	// syncPoint returns the time of the first snapshot after the snapper started.
+	syncPoint(log Logger, fss []*zfs.DatasetPath, prefix string) (time.Time, error)
+	// next returns the time of the next snapshot after lastInvocation.
+	next(lastInvocation time.Time) time.Time
+	String() string
+}
+
+// periodicSchedule snapshots every interval, aligned to the latest existing snapshot.
+type periodicSchedule struct {
+	interval time.Duration
+}
+
+func (s periodicSchedule) syncPoint(log Logger, fss []*zfs.DatasetPath, prefix string) (time.Time, error) {
+	return findSyncPoint(log, fss, prefix, s.interval)
+}
+
+func (s periodicSchedule) next(lastInvocation time.Time) time.Time {
+	return lastInvocation.Add(s.interval)
+}
+
+func (s periodicSchedule) String() string {
+	return fmt.Sprintf("every %s", s.interval)
+}
+
+// cronSchedule snapshots at the wall-clock times of one or more cron expressions,
+// evaluated in location loc.
+// There is no sync-up with existing snapshots: the first snapshot is taken at the next
+// time matched by the expressions.
+type cronSchedule struct {
+	spec config.CronSpec
+	loc  *time.Location
+}
+
+func (s cronSchedule) syncPoint(log Logger, fss []*zfs.DatasetPath, prefix string) (time.Time, error) {
+	syncPoint := s.next(time.Now())
+	log.WithField("syncPoint", syncPoint.String()).Info("determined sync point from cron schedule")
+	return syncPoint, nil
+}
+
+func (s cronSchedule) next(lastInvocation time.Time) time.Time {
+	var next time.Time
+	for _, sched := range s.spec.Schedules {
+		n := sched.Next(lastInvocation.In(s.loc))
+		if n.IsZero() {
+			continue // expression never matches, e.g. Feb 30
+		}
+		if next.IsZero() || n.Before(next) {
+			next = n
+		}
+	}
+	return next
+}
+
+func (s cronSchedule) String() string {
+	quoted := make([]string, len(s.spec.Specs))
+	for i := range s.spec.Specs {
+		quoted[i] = fmt.Sprintf("%q", s.spec.Specs[i])
+	}
+	return fmt.Sprintf("cron %s (%s)", strings.Join(quoted, ", "), s.loc)
+}
@@ -0,0 +1,38 @@
+package snapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/config"
+)
+
+func TestCronScheduleNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	specs := []string{"0 2,14 * * *", "0 9-17 * * 1-5"}
+	spec := config.CronSpec{Specs: specs}
+	for _, s := range specs {
+		sched, err := cron.ParseStandard(s)
+		require.NoError(t, err)
+		spec.Schedules = append(spec.Schedules, sched)
+	}
+	s := cronSchedule{spec, berlin}
+
+	// Friday 2020-01-10 17:30 Berlin => next is 02:00 Berlin on Saturday
+	now := time.Date(2020, 1, 10, 17, 30, 0, 0, berlin).In(time.UTC)
+	assert.True(t, time.Date(2020, 1, 11, 2, 0, 0, 0, berlin).Equal(s.next(now)))
+
+	// Friday 2020-01-10 12:10 Berlin => business hours
+	now = time.Date(2020, 1, 10, 12, 10, 0, 0, berlin).In(time.UTC)
+	assert.True(t, time.Date(2020, 1, 10, 13, 0, 0, 0, berlin).Equal(s.next(now)))
+
+	// Saturday 2020-01-11 02:00 Berlin (exactly on the tick) => next is 14:00
+	now = time.Date(2020, 1, 11, 2, 0, 0, 0, berlin)
+	assert.True(t, time.Date(2020, 1, 11, 14, 0, 0, 0, berlin).Equal(s.next(now)))
+}
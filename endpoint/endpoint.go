@@ -4,22 +4,49 @@ package endpoint
 import (
 	"context"
 	"fmt"
-	"path"
+	"regexp"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 
 	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/bandwidthlimit"
 	"github.com/zrepl/zrepl/util/chainlock"
 	"github.com/zrepl/zrepl/util/envconst"
 	"github.com/zrepl/zrepl/util/semaphore"
 	"github.com/zrepl/zrepl/zfs"
 )
 
+// FSPrioritizer assigns replication priorities to filesystems, see pdu.Filesystem.Priority.
+type FSPrioritizer interface {
+	Priority(fs *zfs.DatasetPath) int
+}
+
+// SnapshotFilter selects the snapshots that a Sender replicates by their name (without filesystem and `@`).
+type SnapshotFilter interface {
+	Filter(snapshotName string) bool
+}
+
 type SenderConfig struct {
-	FSF     zfs.DatasetFilter
-	Encrypt *zfs.NilBool
-	JobID   JobID
+	FSF zfs.DatasetFilter
+	// nil means that all filesystems have priority 0
+	FSPriorities FSPrioritizer
+	Encrypt      *zfs.NilBool
+	SendFlags    zfs.ZFSSendFlags
+	JobID        JobID
+
+	BandwidthLimit *bandwidthlimit.Limiter // nil means unlimited
+
+	// Non-nil if the Sender serves the filesystems received by a Receiver with the same ReceiveTracker.
+	// The Sender then refuses to send filesystems while they are received into
+	// and does not list placeholder filesystems.
+	ReceiveTracker *ReceiveTracker
+
+	// nil means that all snapshots are replicated.
+	// Otherwise, the Sender does not list and refuses to send the snapshots that do not pass the filter.
+	// Bookmarks are always listed.
+	SnapshotFilter SnapshotFilter
 }
 
 func (c *SenderConfig) Validate() error {
@@ -35,9 +62,14 @@ func (c *SenderConfig) Validate() error {
 
 // Sender implements replication.ReplicationEndpoint for a sending side
 type Sender struct {
-	FSFilter zfs.DatasetFilter
-	encrypt  *zfs.NilBool
-	jobId    JobID
+	FSFilter       zfs.DatasetFilter
+	fsPriorities   FSPrioritizer
+	encrypt        *zfs.NilBool
+	sendFlags      zfs.ZFSSendFlags
+	jobId          JobID
+	bandwidthLimit *bandwidthlimit.Limiter
+	receiveTracker *ReceiveTracker
+	snapshotFilter SnapshotFilter
 }
 
 func NewSender(conf SenderConfig) *Sender {
@@ -45,9 +77,14 @@ func NewSender(conf SenderConfig) *Sender {
 		panic("invalid config" + err.Error())
 	}
 	return &Sender{
-		FSFilter: conf.FSF,
-		encrypt:  conf.Encrypt,
-		jobId:    conf.JobID,
+		FSFilter:       conf.FSF,
+		fsPriorities:   conf.FSPriorities,
+		encrypt:        conf.Encrypt,
+		sendFlags:      conf.SendFlags,
+		jobId:          conf.JobID,
+		bandwidthLimit: conf.BandwidthLimit,
+		receiveTracker: conf.ReceiveTracker,
+		snapshotFilter: conf.SnapshotFilter,
 	}
 }
 
@@ -74,18 +111,32 @@ func (s *Sender) ListFilesystems(ctx context.Context, r *pdu.ListFilesystemReq)
 	if err != nil {
 		return nil, err
 	}
-	rfss := make([]*pdu.Filesystem, len(fss))
+	rfss := make([]*pdu.Filesystem, 0, len(fss))
 	for i := range fss {
+		if s.receiveTracker != nil {
+			// we serve received filesystems, whose placeholders have no snapshots to send
+			ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, fss[i])
+			if err != nil {
+				return nil, errors.Wrap(err, "cannot get placeholder state")
+			}
+			if ph.IsPlaceholder {
+				continue
+			}
+		}
 		encEnabled, err := zfs.ZFSGetEncryptionEnabled(ctx, fss[i].ToString())
 		if err != nil {
 			return nil, errors.Wrap(err, "cannot get filesystem encryption status")
 		}
-		rfss[i] = &pdu.Filesystem{
+		rfs := &pdu.Filesystem{
 			Path: fss[i].ToString(),
 			// ResumeToken does not make sense from Sender
 			IsPlaceholder: false, // sender FSs are never placeholders
 			IsEncrypted:   encEnabled,
 		}
+		if s.fsPriorities != nil {
+			rfs.Priority = int32(s.fsPriorities.Priority(fss[i]))
+		}
+		rfss = append(rfss, rfs)
 	}
 	res := &pdu.ListFilesystemRes{Filesystems: rfss}
 	return res, nil
@@ -100,13 +151,69 @@ func (s *Sender) ListFilesystemVersions(ctx context.Context, r *pdu.ListFilesyst
 	if err != nil {
 		return nil, err
 	}
-	rfsvs := make([]*pdu.FilesystemVersion, len(fsvs))
+	return s.filterVersions(fsvs), nil
+
+}
+
+// filterVersions returns the versions in fsvs that pass s.snapshotFilter
+// and the CreateTXGs of those that do not.
+func (s *Sender) filterVersions(fsvs []zfs.FilesystemVersion) *pdu.ListFilesystemVersionsRes {
+	res := &pdu.ListFilesystemVersionsRes{Versions: make([]*pdu.FilesystemVersion, 0, len(fsvs))}
 	for i := range fsvs {
-		rfsvs[i] = pdu.FilesystemVersionFromZFS(&fsvs[i])
+		if !s.snapshotPassesFilter(fsvs[i]) {
+			// the planner must not batch steps across excluded snapshots (see checkSnapshotFilter)
+			res.ExcludedSnapshotCreateTXGs = append(res.ExcludedSnapshotCreateTXGs, fsvs[i].CreateTXG)
+			continue
+		}
+		res.Versions = append(res.Versions, pdu.FilesystemVersionFromZFS(&fsvs[i]))
 	}
-	res := &pdu.ListFilesystemVersionsRes{Versions: rfsvs}
-	return res, nil
+	return res
+}
 
+// snapshotPassesFilter returns true if v is a bookmark or passes s.snapshotFilter
+func (s *Sender) snapshotPassesFilter(v zfs.FilesystemVersion) bool {
+	return s.snapshotFilter == nil || v.Type != zfs.Snapshot || s.snapshotFilter.Filter(v.Name)
+}
+
+// checkSnapshotFilter returns an error if a snapshot of the send does not pass s.snapshotFilter
+func (s *Sender) checkSnapshotFilter(ctx context.Context, sendArgs zfs.ZFSSendArgsValidated) error {
+	if s.snapshotFilter == nil {
+		return nil
+	}
+	var snaps []zfs.FilesystemVersion
+	if sendArgs.Intermediates {
+		dp, err := zfs.NewDatasetPath(sendArgs.FS)
+		if err != nil {
+			return err
+		}
+		snaps, err = zfs.ZFSListFilesystemVersions(ctx, dp, zfs.ListFilesystemVersionsOptions{Types: zfs.Snapshots})
+		if err != nil {
+			return errors.Wrap(err, "cannot list intermediate snapshots")
+		}
+	}
+	return s.checkSnapshotFilterVersions(sendArgs, snaps)
+}
+
+// checkSnapshotFilterVersions is the part of checkSnapshotFilter that does not depend on zfs.
+// snaps are the filesystem's snapshots if sendArgs.Intermediates is set.
+func (s *Sender) checkSnapshotFilterVersions(sendArgs zfs.ZFSSendArgsValidated, snaps []zfs.FilesystemVersion) error {
+	versions := []zfs.FilesystemVersion{sendArgs.ToVersion}
+	if sendArgs.FromVersion != nil {
+		versions = append(versions, *sendArgs.FromVersion)
+	}
+	if sendArgs.Intermediates {
+		for _, snap := range snaps {
+			if snap.CreateTXG > sendArgs.FromVersion.CreateTXG && snap.CreateTXG < sendArgs.ToVersion.CreateTXG {
+				versions = append(versions, snap)
+			}
+		}
+	}
+	for _, v := range versions {
+		if !s.snapshotPassesFilter(v) {
+			return fmt.Errorf("snapshot %s is excluded from replication by the snapshot filter", v.RelName())
+		}
+	}
+	return nil
 }
 
 func (p *Sender) HintMostRecentCommonAncestor(ctx context.Context, r *pdu.HintMostRecentCommonAncestorReq) (*pdu.HintMostRecentCommonAncestorRes, error) {
@@ -220,7 +327,17 @@ func (m *HintMostRecentCommonAncestorStepCleanupMode) Set(s string) error {
 
 var senderHintMostRecentCommonAncestorStepCleanupMode = *envconst.Var("ZREPL_ENDPOINT_SENDER_HINT_MOST_RECENT_STEP_HOLD_CLEANUP_MODE", &StepCleanupRangeSinceReplicationCursor).(*HintMostRecentCommonAncestorStepCleanupMode)
 
-var maxConcurrentZFSSendSemaphore = semaphore.New(envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_SEND", 10))
+var maxConcurrentZFSSend = envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_SEND", 10)
+var maxConcurrentZFSSendSemaphore = semaphore.New(maxConcurrentZFSSend)
+
+// CheckMaxConcurrentSends returns an error if n concurrent Send requests exceed the daemon-wide
+// limit of concurrent zfs send processes, i.e., if some of them would always wait for the others.
+func CheckMaxConcurrentSends(n int) error {
+	if int64(n) > maxConcurrentZFSSend {
+		return fmt.Errorf("%d exceeds the daemon-wide limit of %d concurrent zfs send processes (environment variable ZREPL_ENDPOINT_MAX_CONCURRENT_SEND)", n, maxConcurrentZFSSend)
+	}
+	return nil
+}
 
 func uncheckedSendArgsFromPDU(fsv *pdu.FilesystemVersion) *zfs.ZFSSendArgVersion {
 	if fsv == nil {
@@ -241,12 +358,59 @@ func sendArgsFromPDUAndValidateExistsAndGetVersion(ctx context.Context, fs strin
 	return version, nil
 }
 
+// checkRequestedSendFlags returns an error if r requests zfs send flags
+// that differ from those configured for s.
+// Saved sends (zfs send -S) are the exception: they are only performed if requested,
+// and the configuration merely permits them.
+func (s *Sender) checkRequestedSendFlags(r *pdu.SendReq) error {
+	if r.GetSaved() == pdu.Tri_True && !s.sendFlags.Saved {
+		return errors.New("sender is configured with saved=false, but a saved send was requested")
+	}
+	flags := []struct {
+		name       string
+		requested  pdu.Tri
+		configured bool
+	}{
+		{"large_blocks", r.GetLargeBlocks(), s.sendFlags.LargeBlocks},
+		{"compressed", r.GetCompressed(), s.sendFlags.Compressed},
+		{"embedded_data", r.GetEmbeddedData(), s.sendFlags.EmbeddedData},
+		{"send_properties", r.GetSendProperties(), s.sendFlags.Properties},
+		{"backup_properties", r.GetBackupProperties(), s.sendFlags.BackupProperties},
+	}
+	for _, f := range flags {
+		switch f.requested {
+		case pdu.Tri_DontCare:
+		case pdu.Tri_False:
+			if f.configured {
+				return fmt.Errorf("sender is configured with %s=true, but %s=false requested", f.name, f.name)
+			}
+		case pdu.Tri_True:
+			if !f.configured {
+				return fmt.Errorf("sender is configured with %s=false, but %s=true requested", f.name, f.name)
+			}
+		default:
+			return fmt.Errorf("unknown pdu.Tri variant %q for %s", f.requested, f.name)
+		}
+	}
+	return nil
+}
+
 func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
 
 	_, err := s.filterCheckFS(r.Filesystem)
 	if err != nil {
 		return nil, nil, err
 	}
+	endSend, err := s.receiveTracker.beginSend(r.Filesystem)
+	if err != nil {
+		return nil, nil, err
+	}
+	sendStreamReturned := false
+	defer func() {
+		if !sendStreamReturned {
+			endSend()
+		}
+	}()
 	switch r.Encrypted {
 	case pdu.Tri_DontCare:
 		// use s.encrypt setting
@@ -264,19 +428,35 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.St
 	default:
 		return nil, nil, fmt.Errorf("unknown pdu.Tri variant %q", r.Encrypted)
 	}
+	if err := s.checkRequestedSendFlags(r); err != nil {
+		return nil, nil, err
+	}
+
+	sendFlags := s.sendFlags
+	if r.GetSaved() == pdu.Tri_True {
+		// the stream has the flags of the interrupted stream
+		sendFlags = zfs.ZFSSendFlags{Saved: true}
+	} else {
+		sendFlags.Saved = false
+	}
 
 	sendArgsUnvalidated := zfs.ZFSSendArgsUnvalidated{
-		FS:          r.Filesystem,
-		From:        uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendDry / zfs.ZFSSend
-		To:          uncheckedSendArgsFromPDU(r.GetTo()),   // validated by zfs.ZFSSendDry / zfs.ZFSSend
-		Encrypted:   s.encrypt,
-		ResumeToken: r.ResumeToken, // nil or not nil, depending on decoding success
+		FS:            r.Filesystem,
+		From:          uncheckedSendArgsFromPDU(r.GetFrom()), // validated by zfs.ZFSSendDry / zfs.ZFSSend
+		To:            uncheckedSendArgsFromPDU(r.GetTo()),   // validated by zfs.ZFSSendDry / zfs.ZFSSend
+		Encrypted:     s.encrypt,
+		ZFSSendFlags:  sendFlags,
+		Intermediates: r.GetIntermediates(),
+		ResumeToken:   r.ResumeToken, // nil or not nil, depending on decoding success
 	}
 
 	sendArgs, err := sendArgsUnvalidated.Validate(ctx)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "validate send arguments")
 	}
+	if err := s.checkSnapshotFilter(ctx, sendArgs); err != nil {
+		return nil, nil, err
+	}
 
 	getLogger(ctx).Debug("acquire concurrent send semaphore")
 	// TODO use try-acquire and fail with resource-exhaustion rpc status
@@ -332,18 +512,27 @@ func (s *Sender) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.St
 		}
 	}
 	// make sure `To` doesn't go away in order to make this step resumable
-	_, err = HoldStep(ctx, sendArgs.FS, sendArgs.ToVersion, s.jobId)
-	if err != nil {
-		return nil, nil, errors.Wrapf(err, "cannot hold `to` version %q before starting send", sendArgs.ToVersion)
+	// (the `To` of a saved send is not a snapshot yet)
+	if !sendArgs.Saved {
+		_, err = HoldStep(ctx, sendArgs.FS, sendArgs.ToVersion, s.jobId)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "cannot hold `to` version %q before starting send", sendArgs.ToVersion)
+		}
 	}
 
 	// step holds & replication cursor released / moved forward in s.SendCompleted => s.moveCursorAndReleaseSendHolds
 
-	streamCopier, err := zfs.ZFSSend(ctx, sendArgs)
+	var streamCopier zfs.StreamCopier
+	streamCopier, err = zfs.ZFSSend(ctx, sendArgs)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "zfs send failed")
 	}
-	return res, streamCopier, nil
+	if s.bandwidthLimit != nil {
+		streamCopier = bandwidthlimit.WrapStreamCopier(ctx, streamCopier, s.bandwidthLimit)
+	}
+	// the send is active until the stream has been sent
+	sendStreamReturned = true
+	return res, newTrackedSendStream(streamCopier, endSend), nil
 }
 
 func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
@@ -355,6 +544,11 @@ func (p *Sender) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*p
 	}
 	fs := fsp.ToString()
 
+	if orig.GetSaved() == pdu.Tri_True {
+		// neither the replication cursor nor the step holds apply to saved sends
+		return &pdu.SendCompletedRes{}, nil
+	}
+
 	var from *zfs.FilesystemVersion
 	if orig.GetFrom() != nil {
 		f, err := sendArgsFromPDUAndValidateExistsAndGetVersion(ctx, fs, orig.GetFrom()) // no shadow
@@ -480,6 +674,14 @@ func (p *Sender) Receive(ctx context.Context, r *pdu.ReceiveReq, receive zfs.Str
 	return nil, fmt.Errorf("sender does not implement Receive()")
 }
 
+func (p *Sender) Rollback(ctx context.Context, r *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	return nil, fmt.Errorf("sender does not implement Rollback()")
+}
+
+func (p *Sender) Rename(ctx context.Context, r *pdu.RenameReq) (*pdu.RenameRes, error) {
+	return nil, fmt.Errorf("sender does not implement Rename()")
+}
+
 type FSFilter interface { // FIXME unused
 	Filter(path *zfs.DatasetPath) (pass bool, err error)
 }
@@ -495,20 +697,87 @@ type FSMap interface { // FIXME unused
 type ReceiverConfig struct {
 	JobID JobID
 
-	RootWithoutClientComponent *zfs.DatasetPath // TODO use
-	AppendClientIdentity       bool
+	// The root of all received filesystems if ClientRoots is nil.
+	RootWithoutClientComponent *zfs.DatasetPath
+	// If non-nil, the received filesystems of each client are below the client's root.
+	ClientRoots *ClientRoots
 
 	UpdateLastReceivedHold bool
+
+	BandwidthLimit *bandwidthlimit.Limiter // nil means unlimited
+
+	// applied to all receives, see zfs.RecvOptions
+	OverrideProperties map[string]string
+	InheritProperties  []string
+
+	AppendOnly *AppendOnlyConfig // nil means clients may destroy snapshots
+
+	Quota *ReceiveQuotaConfig // nil means that the available space is not checked before receiving
+
+	// nil if the received filesystems are not served by a Sender, see SenderConfig.ReceiveTracker
+	ReceiveTracker *ReceiveTracker
+
+	// nil means that filesystems are received at their sender's name below the client root
+	Mapping ReceiveMapping
+}
+
+// ReceiveMapping maps the filesystem names in requests to a Receiver, i.e., the sender's names,
+// to names relative to the client root (see Receiver.clientRootFromCtx).
+//
+// The Receiver records the sender's name of a received filesystem in zfs.ReceivedFromPropertyName
+// and only uses Invert for filesystems that do not have it, e.g. placeholders.
+type ReceiveMapping interface {
+	// returns an error if fs must not be received
+	Map(fs *zfs.DatasetPath) (*zfs.DatasetPath, error)
+	// returns ok = false if the sender's name cannot be determined
+	Invert(local *zfs.DatasetPath) (fs *zfs.DatasetPath, ok bool)
 }
 
 func (c *ReceiverConfig) copyIn() {
-	c.RootWithoutClientComponent = c.RootWithoutClientComponent.Copy()
+	if c.RootWithoutClientComponent != nil {
+		c.RootWithoutClientComponent = c.RootWithoutClientComponent.Copy()
+	}
+
+	override := make(map[string]string, len(c.OverrideProperties))
+	for k, v := range c.OverrideProperties {
+		override[k] = v
+	}
+	c.OverrideProperties = override
+	c.InheritProperties = append([]string(nil), c.InheritProperties...)
+	if c.AppendOnly != nil {
+		ao := *c.AppendOnly
+		c.AppendOnly = &ao
+	}
+	if c.Quota != nil {
+		q := *c.Quota
+		q.ClientQuotas = make(map[string]int64, len(c.Quota.ClientQuotas))
+		for k, v := range c.Quota.ClientQuotas {
+			q.ClientQuotas[k] = v
+		}
+		c.Quota = &q
+	}
 }
 
 func (c *ReceiverConfig) Validate() error {
 	c.JobID.MustValidate()
-	if c.RootWithoutClientComponent.Length() <= 0 {
-		return errors.New("RootWithoutClientComponent must not be an empty dataset path")
+	if c.ClientRoots == nil {
+		if c.RootWithoutClientComponent == nil || c.RootWithoutClientComponent.Length() <= 0 {
+			return errors.New("RootWithoutClientComponent must not be an empty dataset path")
+		}
+	} else if c.RootWithoutClientComponent != nil {
+		return errors.New("RootWithoutClientComponent and ClientRoots are mutually exclusive")
+	}
+	if c.Quota != nil {
+		if err := c.Quota.Validate(); err != nil {
+			return errors.Wrap(err, "invalid quota config")
+		}
+	}
+	propOpts := zfs.RecvOptions{
+		OverrideProperties: c.OverrideProperties,
+		InheritProperties:  c.InheritProperties,
+	}
+	if err := propOpts.ValidateProperties(); err != nil {
+		return errors.Wrap(err, "invalid receive properties")
 	}
 	return nil
 }
@@ -531,27 +800,21 @@ func NewReceiver(config ReceiverConfig) *Receiver {
 	}
 }
 
+// TestClientIdentity returns an error if a sink with root_fs rootFS cannot receive the filesystems of clientIdentity.
+// See ClientRoots.TestClientIdentity for templated and per-client root filesystems.
 func TestClientIdentity(rootFS *zfs.DatasetPath, clientIdentity string) error {
-	_, err := clientRoot(rootFS, clientIdentity)
-	return err
-}
-
-func clientRoot(rootFS *zfs.DatasetPath, clientIdentity string) (*zfs.DatasetPath, error) {
-	rootFSLen := rootFS.Length()
-	clientRootStr := path.Join(rootFS.ToString(), clientIdentity)
-	clientRoot, err := zfs.NewDatasetPath(clientRootStr)
+	roots, err := NewClientRoots(rootFS.ToString(), nil)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if rootFSLen+1 != clientRoot.Length() {
-		return nil, fmt.Errorf("client identity must be a single ZFS filesystem path component")
-	}
-	return clientRoot, nil
+	return roots.TestClientIdentity(clientIdentity)
 }
 
-func (s *Receiver) clientRootFromCtx(ctx context.Context) *zfs.DatasetPath {
-	if !s.conf.AppendClientIdentity {
-		return s.conf.RootWithoutClientComponent.Copy()
+// clientRootFromCtx returns the client root of the request's client
+// and the filesystem below which the Receiver creates placeholders for it (see ClientRoots.ClientRoot).
+func (s *Receiver) clientRootFromCtx(ctx context.Context) (root, mustExist *zfs.DatasetPath, err error) {
+	if s.conf.ClientRoots == nil {
+		return s.conf.RootWithoutClientComponent.Copy(), s.conf.RootWithoutClientComponent.Copy(), nil
 	}
 
 	clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
@@ -559,15 +822,16 @@ func (s *Receiver) clientRootFromCtx(ctx context.Context) *zfs.DatasetPath {
 		panic(fmt.Sprintf("ClientIdentityKey context value must be set"))
 	}
 
-	clientRoot, err := clientRoot(s.conf.RootWithoutClientComponent, clientIdentity)
+	root, mustExist, err = s.conf.ClientRoots.ClientRoot(clientIdentity)
 	if err != nil {
-		panic(fmt.Sprintf("ClientIdentityContextKey must have been validated before invoking Receiver: %s", err))
+		return nil, nil, errors.Wrapf(err, "cannot determine root filesystem of client %q", clientIdentity)
 	}
-	return clientRoot
+	return root, mustExist, nil
 }
 
 type subroot struct {
 	localRoot *zfs.DatasetPath
+	mapping   ReceiveMapping // may be nil
 }
 
 var _ zfs.DatasetFilter = subroot{}
@@ -585,14 +849,22 @@ func (f subroot) MapToLocal(fs string) (*zfs.DatasetPath, error) {
 	if p.Length() == 0 {
 		return nil, errors.Errorf("cannot map empty filesystem")
 	}
+	if f.mapping != nil {
+		if p, err = f.mapping.Map(p); err != nil {
+			return nil, err
+		}
+	}
 	c := f.localRoot.Copy()
 	c.Extend(p)
 	return c, nil
 }
 
 func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemReq) (*pdu.ListFilesystemRes, error) {
-	root := s.clientRootFromCtx(ctx)
-	filtered, err := zfs.ZFSListMapping(ctx, subroot{root})
+	root, _, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	filtered, err := zfs.ZFSListMapping(ctx, subroot{root, s.conf.Mapping})
 	if err != nil {
 		return nil, err
 	}
@@ -624,6 +896,18 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 		l.WithField("receive_resume_token", token).Debug("receive resume token")
 
 		a.TrimPrefix(root)
+		if s.conf.Mapping != nil {
+			senderFS, ok, err := s.unmapFilesystem(ctx, root, a, token)
+			if err != nil {
+				l.WithError(err).Error("cannot determine sender's filesystem name")
+				return nil, err
+			}
+			if !ok {
+				l.Debug("omitting filesystem whose sender's name cannot be determined from the receive mapping")
+				continue
+			}
+			a = senderFS
+		}
 
 		fs := &pdu.Filesystem{
 			Path:          a.ToString(),
@@ -640,9 +924,65 @@ func (s *Receiver) ListFilesystems(ctx context.Context, req *pdu.ListFilesystemR
 	return &pdu.ListFilesystemRes{Filesystems: fss}, nil
 }
 
+// unmapFilesystem returns the sender's name of local, which is relative to root.
+// resumeToken is local's receive resume token, if any.
+// ok is false if it cannot be determined.
+func (s *Receiver) unmapFilesystem(ctx context.Context, root, local *zfs.DatasetPath, resumeToken string) (senderFS *zfs.DatasetPath, ok bool, err error) {
+	full := root.Copy()
+	full.Extend(local)
+	receivedFrom, err := zfs.ZFSGetReceivedFrom(ctx, full)
+	if err != nil {
+		return nil, false, err
+	}
+	var resumeTokenFS string
+	if resumeToken != "" {
+		t, err := zfs.ParseResumeToken(ctx, resumeToken)
+		if err != nil {
+			return nil, false, errors.Wrap(err, "cannot decode receive resume token")
+		}
+		resumeTokenFS = resumeTokenFilesystem(t)
+	}
+	senderFS, ok = s.unmapFilesystemFrom(local, receivedFrom, resumeTokenFS)
+	return senderFS, ok, nil
+}
+
+// unmapFilesystemFrom is the part of unmapFilesystem that does not depend on zfs.
+//
+// receivedFrom is preferred because the filesystem might have been renamed (e.g. renameAside)
+// or the mapping might have changed.
+// An interrupted receive, e.g. the initial full receive, did not record receivedFrom yet,
+// but the filesystem of its resume token is the sender's name.
+func (s *Receiver) unmapFilesystemFrom(local *zfs.DatasetPath, receivedFrom, resumeTokenFS string) (senderFS *zfs.DatasetPath, ok bool) {
+	for _, candidate := range []string{receivedFrom, resumeTokenFS} {
+		if candidate == "" {
+			continue
+		}
+		p, err := zfs.NewDatasetPath(candidate)
+		if err != nil || p.Length() == 0 {
+			continue
+		}
+		if mapped, err := s.conf.Mapping.Map(p); err == nil && mapped.Equal(local) {
+			return p, true
+		}
+	}
+	return s.conf.Mapping.Invert(local)
+}
+
+// resumeTokenFilesystem returns the filesystem of the token's `toname`, or "" if it has none.
+func resumeTokenFilesystem(t *zfs.ResumeToken) string {
+	fs, _, _, err := zfs.DecomposeVersionString(t.ToName)
+	if err != nil {
+		return ""
+	}
+	return fs
+}
+
 func (s *Receiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.GetFilesystem())
+	root, _, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := subroot{root, s.conf.Mapping}.MapToLocal(req.GetFilesystem())
 	if err != nil {
 		return nil, err
 	}
@@ -684,14 +1024,26 @@ func (s *Receiver) Send(ctx context.Context, req *pdu.SendReq) (*pdu.SendRes, zf
 	return nil, nil, fmt.Errorf("receiver does not implement Send()")
 }
 
-var maxConcurrentZFSRecvSemaphore = semaphore.New(envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_RECV", 10))
+var maxConcurrentZFSRecv = envconst.Int64("ZREPL_ENDPOINT_MAX_CONCURRENT_RECV", 10)
+var maxConcurrentZFSRecvSemaphore = semaphore.New(maxConcurrentZFSRecv)
+
+// CheckMaxConcurrentRecvs is the counterpart of CheckMaxConcurrentSends for Receive requests.
+func CheckMaxConcurrentRecvs(n int) error {
+	if int64(n) > maxConcurrentZFSRecv {
+		return fmt.Errorf("%d exceeds the daemon-wide limit of %d concurrent zfs recv processes (environment variable ZREPL_ENDPOINT_MAX_CONCURRENT_RECV)", n, maxConcurrentZFSRecv)
+	}
+	return nil
+}
 
 func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
 	getLogger(ctx).Debug("incoming Receive")
 	defer receive.Close()
 
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	root, mustExist, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := subroot{root, s.conf.Mapping}.MapToLocal(req.Filesystem)
 	if err != nil {
 		return nil, errors.Wrap(err, "`Filesystem` invalid")
 	}
@@ -703,9 +1055,180 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 	if !to.IsSnapshot() {
 		return nil, errors.New("`To` must be a snapshot")
 	}
+	var renameFrom *zfs.DatasetPath
+	if req.RenameFrom != "" {
+		if req.RenameExistingAside {
+			return nil, errors.New("`RenameFrom` and `RenameExistingAside` are mutually exclusive")
+		}
+		renameFrom, err = subroot{root, s.conf.Mapping}.MapToLocal(req.RenameFrom)
+		if err != nil {
+			return nil, errors.Wrap(err, "`RenameFrom` invalid")
+		}
+	}
+
+	// a Sender with the same ReceiveTracker must not send lp or renameFrom while they are modified
+	endReceive, err := s.conf.ReceiveTracker.beginReceive(lp.ToString())
+	if err != nil {
+		return nil, err
+	}
+	defer endReceive()
+	if renameFrom != nil {
+		endReceiveRenameFrom, err := s.conf.ReceiveTracker.beginReceive(renameFrom.ToString())
+		if err != nil {
+			return nil, err
+		}
+		defer endReceiveRenameFrom()
+	}
+
+	// refuse early instead of failing in the middle of the stream
+	if err := s.checkReceiveSpace(ctx, root, lp, req.GetExpectedSize()); err != nil {
+		getLogger(ctx).WithError(err).Error("refusing to receive")
+		return nil, err
+	}
 
 	// create placeholder parent filesystems as appropriate
-	//
+	if err := s.createPlaceholderParents(ctx, lp, mustExist); err != nil {
+		return nil, err
+	}
+
+	if req.RenameExistingAside {
+		if err := renameAside(ctx, lp, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+	if renameFrom != nil {
+		if err := renameRenamedOnSender(ctx, renameFrom, lp); err != nil {
+			return nil, err
+		}
+	}
+
+	// determine whether we need to rollback the filesystem / change its placeholder state
+	var clearPlaceholderProperty bool
+	recvOpts := zfs.RecvOptions{
+		OverrideProperties: s.conf.OverrideProperties,
+		InheritProperties:  s.conf.InheritProperties,
+	}
+	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp)
+	if err == nil && ph.FSExists && ph.IsPlaceholder {
+		recvOpts.RollbackAndForceRecv = true
+		clearPlaceholderProperty = true
+	}
+	if clearPlaceholderProperty {
+		if err := zfs.ZFSSetPlaceholder(ctx, lp, false); err != nil {
+			return nil, fmt.Errorf("cannot clear placeholder property for forced receive: %s", err)
+		}
+	}
+
+	if req.ClearResumeToken && ph.FSExists {
+		if err := zfs.ZFSRecvClearResumeToken(ctx, lp.ToString()); err != nil {
+			return nil, errors.Wrap(err, "cannot clear resume token")
+		}
+	}
+
+	recvOpts.SavePartialRecvState, err = zfs.ResumeRecvSupported(ctx, lp)
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot determine whether we can use resumable send & recv")
+	}
+
+	getLogger(ctx).Debug("acquire concurrent recv semaphore")
+	// TODO use try-acquire and fail with resource-exhaustion rpc status
+	// => would require handling on the client-side
+	// => this is a dataconn endpoint, doesn't have the status code semantics of gRPC
+	guard, err := maxConcurrentZFSRecvSemaphore.Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer guard.Release()
+
+	getLogger(ctx).WithField("opts", fmt.Sprintf("%#v", recvOpts)).Debug("start receive command")
+
+	if s.conf.BandwidthLimit != nil {
+		receive = bandwidthlimit.WrapStreamCopier(ctx, receive, s.conf.BandwidthLimit)
+	}
+
+	snapFullPath := to.FullPath(lp.ToString())
+	if err := zfs.ZFSRecv(ctx, lp.ToString(), to, receive, recvOpts); err != nil {
+		getLogger(ctx).
+			WithError(err).
+			WithField("opts", recvOpts).
+			Error("zfs receive failed")
+		return nil, err
+	}
+
+	// `recv -x` does not affect the local property values of the placeholder, e.g., its `mountpoint=none`
+	if clearPlaceholderProperty {
+		for _, prop := range recvOpts.InheritProperties {
+			if err := zfs.ZFSInherit(ctx, lp, prop); err != nil {
+				return nil, errors.Wrapf(err, "cannot inherit property %q on former placeholder", prop)
+			}
+		}
+	}
+
+	// validate that we actually received what the sender claimed
+	toRecvd, err := to.ValidateExistsAndGetVersion(ctx, lp.ToString())
+	if err != nil {
+		msg := "receive request's `To` version does not match what we received in the stream"
+		getLogger(ctx).WithError(err).WithField("snap", snapFullPath).Error(msg)
+		getLogger(ctx).Error("aborting recv request, but keeping received snapshot for inspection")
+		return nil, errors.Wrap(err, msg)
+	}
+
+	if s.conf.Mapping != nil {
+		if err := zfs.ZFSSetReceivedFrom(ctx, lp, req.Filesystem); err != nil {
+			return nil, errors.Wrap(err, "cannot record sender's filesystem name")
+		}
+	}
+
+	if s.conf.UpdateLastReceivedHold {
+		getLogger(ctx).Debug("move last-received-hold")
+		if err := MoveLastReceivedHold(ctx, lp.ToString(), toRecvd, s.conf.JobID); err != nil {
+			return nil, errors.Wrap(err, "cannot move last-received-hold")
+		}
+	}
+
+	return &pdu.ReceiveRes{}, nil
+}
+
+// Rename renames the receiver's filesystem req.RenameFrom to req.Filesystem because the filesystem
+// was renamed on the sender, like Receive with ReceiveReq.RenameFrom, but without receiving a stream.
+func (s *Receiver) Rename(ctx context.Context, req *pdu.RenameReq) (*pdu.RenameRes, error) {
+	root, mustExist, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := subroot{root, s.conf.Mapping}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, errors.Wrap(err, "`Filesystem` invalid")
+	}
+	renameFrom, err := subroot{root, s.conf.Mapping}.MapToLocal(req.GetRenameFrom())
+	if err != nil {
+		return nil, errors.Wrap(err, "`RenameFrom` invalid")
+	}
+
+	// a Sender with the same ReceiveTracker must not send lp or renameFrom while they are modified
+	endReceive, err := s.conf.ReceiveTracker.beginReceive(lp.ToString())
+	if err != nil {
+		return nil, err
+	}
+	defer endReceive()
+	endReceiveRenameFrom, err := s.conf.ReceiveTracker.beginReceive(renameFrom.ToString())
+	if err != nil {
+		return nil, err
+	}
+	defer endReceiveRenameFrom()
+
+	if err := s.createPlaceholderParents(ctx, lp, mustExist); err != nil {
+		return nil, err
+	}
+	if err := renameRenamedOnSender(ctx, renameFrom, lp); err != nil {
+		return nil, err
+	}
+	return &pdu.RenameRes{}, nil
+}
+
+// createPlaceholderParents creates placeholder filesystems for the parents of lp that do not exist.
+// Only parents below mustExist are created.
+func (s *Receiver) createPlaceholderParents(ctx context.Context, lp, mustExist *zfs.DatasetPath) error {
 	// Manipulating the ZFS dataset hierarchy must happen exclusively.
 	// TODO: Use fine-grained locking to allow separate clients / requests to pass
 	// 		 through the following section concurrently when operating on disjoint
@@ -737,11 +1260,11 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 			}
 
 			if !ph.FSExists {
-				if s.conf.RootWithoutClientComponent.HasPrefix(v.Path) {
+				if v.Path.Length() == 1 || mustExist.HasPrefix(v.Path) {
 					if v.Path.Length() == 1 {
 						visitErr = fmt.Errorf("pool %q not imported", v.Path.ToString())
 					} else {
-						visitErr = fmt.Errorf("root_fs %q does not exist", s.conf.RootWithoutClientComponent.ToString())
+						visitErr = fmt.Errorf("root_fs %q does not exist", mustExist.ToString())
 					}
 					getLogger(ctx).WithError(visitErr).Error("placeholders are only created automatically below root_fs")
 					return false
@@ -761,82 +1284,105 @@ func (s *Receiver) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs
 		})
 	}()
 	getLogger(ctx).WithField("visitErr", visitErr).Debug("complete tree-walk")
-	if visitErr != nil {
-		return nil, visitErr
-	}
+	return visitErr
+}
 
-	// determine whether we need to rollback the filesystem / change its placeholder state
-	var clearPlaceholderProperty bool
-	var recvOpts zfs.RecvOptions
+// renameAside renames lp to a sibling filesystem so that a full stream can be received into lp.
+// It is a no-op if lp does not exist or is a placeholder.
+func renameAside(ctx context.Context, lp *zfs.DatasetPath, now time.Time) error {
 	ph, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp)
-	if err == nil && ph.FSExists && ph.IsPlaceholder {
-		recvOpts.RollbackAndForceRecv = true
-		clearPlaceholderProperty = true
+	if err != nil {
+		return errors.Wrap(err, "cannot get placeholder state")
 	}
-	if clearPlaceholderProperty {
-		if err := zfs.ZFSSetPlaceholder(ctx, lp, false); err != nil {
-			return nil, fmt.Errorf("cannot clear placeholder property for forced receive: %s", err)
-		}
+	aside, err := renameAsideTarget(lp, ph, now)
+	if err != nil || aside == nil {
+		return err
 	}
-
-	if req.ClearResumeToken && ph.FSExists {
-		if err := zfs.ZFSRecvClearResumeToken(ctx, lp.ToString()); err != nil {
-			return nil, errors.Wrap(err, "cannot clear resume token")
-		}
+	getLogger(ctx).WithField("fs", lp.ToString()).WithField("renamed_to", aside.ToString()).
+		Warn("renaming filesystem aside to resolve conflict with sender")
+	if err := zfs.ZFSRename(ctx, lp, aside); err != nil {
+		return errors.Wrap(err, "cannot rename filesystem aside")
 	}
+	return nil
+}
 
-	recvOpts.SavePartialRecvState, err = zfs.ResumeRecvSupported(ctx, lp)
+// renameRenamedOnSender renames from to lp because the filesystem was renamed on the sender.
+// It is a no-op if from was already renamed to lp, e.g. along with its parent.
+func renameRenamedOnSender(ctx context.Context, from, lp *zfs.DatasetPath) error {
+	fromState, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, from)
 	if err != nil {
-		return nil, errors.Wrap(err, "cannot determine whether we can use resumable send & recv")
+		return errors.Wrap(err, "cannot get placeholder state")
 	}
-
-	getLogger(ctx).Debug("acquire concurrent recv semaphore")
-	// TODO use try-acquire and fail with resource-exhaustion rpc status
-	// => would require handling on the client-side
-	// => this is a dataconn endpoint, doesn't have the status code semantics of gRPC
-	guard, err := maxConcurrentZFSRecvSemaphore.Acquire(ctx)
+	lpState, err := zfs.ZFSGetFilesystemPlaceholderState(ctx, lp)
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "cannot get placeholder state")
 	}
-	defer guard.Release()
-
-	getLogger(ctx).WithField("opts", fmt.Sprintf("%#v", recvOpts)).Debug("start receive command")
-
-	snapFullPath := to.FullPath(lp.ToString())
-	if err := zfs.ZFSRecv(ctx, lp.ToString(), to, receive, recvOpts); err != nil {
-		getLogger(ctx).
-			WithError(err).
-			WithField("opts", recvOpts).
-			Error("zfs receive failed")
-		return nil, err
+	switch {
+	case !fromState.FSExists && lpState.FSExists && !lpState.IsPlaceholder:
+		return nil
+	case !fromState.FSExists || fromState.IsPlaceholder:
+		return errors.Errorf("cannot rename %q to %q: %q does not exist or is a placeholder", from.ToString(), lp.ToString(), from.ToString())
+	case lpState.FSExists:
+		return errors.Errorf("cannot rename %q to %q: %q exists", from.ToString(), lp.ToString(), lp.ToString())
 	}
+	getLogger(ctx).WithField("fs", from.ToString()).WithField("renamed_to", lp.ToString()).
+		Info("renaming filesystem that was renamed on the sender")
+	if err := zfs.ZFSRename(ctx, from, lp); err != nil {
+		return errors.Wrap(err, "cannot rename filesystem that was renamed on the sender")
+	}
+	return nil
+}
 
-	// validate that we actually received what the sender claimed
-	toRecvd, err := to.ValidateExistsAndGetVersion(ctx, lp.ToString())
+// renameAsideTarget returns the path that renameAside renames lp to, or nil if there is nothing to rename.
+func renameAsideTarget(lp *zfs.DatasetPath, ph *zfs.FilesystemPlaceholderState, now time.Time) (*zfs.DatasetPath, error) {
+	if !ph.FSExists || ph.IsPlaceholder {
+		return nil, nil
+	}
+	aside, err := zfs.NewDatasetPath(conflictAsideName(lp.ToString(), now))
 	if err != nil {
-		msg := "receive request's `To` version does not match what we received in the stream"
-		getLogger(ctx).WithError(err).WithField("snap", snapFullPath).Error(msg)
-		getLogger(ctx).Error("aborting recv request, but keeping received snapshot for inspection")
-		return nil, errors.Wrap(err, msg)
+		return nil, errors.Wrap(err, "cannot build name of renamed filesystem")
 	}
+	return aside, nil
+}
 
-	if s.conf.UpdateLastReceivedHold {
-		getLogger(ctx).Debug("move last-received-hold")
-		if err := MoveLastReceivedHold(ctx, lp.ToString(), toRecvd, s.conf.JobID); err != nil {
-			return nil, errors.Wrap(err, "cannot move last-received-hold")
-		}
-	}
+func conflictAsideName(fs string, now time.Time) string {
+	return fmt.Sprintf("%s_zrepl_conflict_%s", fs, now.UTC().Format("20060102_150405"))
+}
 
-	return &pdu.ReceiveRes{}, nil
+var conflictAsideNameRE = regexp.MustCompile(`_zrepl_conflict_\d{8}_\d{6}(/|$)`)
+
+// IsConflictAside returns true if fs or one of its parents was renamed aside by
+// the full_resend_into_new_dataset conflict resolution, see conflictAsideName.
+// Such filesystems are not listed by the sender and must not be mistaken for orphans.
+func IsConflictAside(fs string) bool {
+	return conflictAsideNameRE.MatchString(fs)
 }
 
 func (s *Receiver) DestroySnapshots(ctx context.Context, req *pdu.DestroySnapshotsReq) (*pdu.DestroySnapshotsRes, error) {
-	root := s.clientRootFromCtx(ctx)
-	lp, err := subroot{root}.MapToLocal(req.Filesystem)
+	root, _, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := subroot{root, s.conf.Mapping}.MapToLocal(req.Filesystem)
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.AppendOnly == nil {
+		return doDestroySnapshots(ctx, lp, req.Snapshots)
+	}
+	allowed, refused, err := s.filterAppendOnlyDestroys(ctx, lp, req.Snapshots)
 	if err != nil {
 		return nil, err
 	}
-	return doDestroySnapshots(ctx, lp, req.Snapshots)
+	res := &pdu.DestroySnapshotsRes{}
+	if len(allowed) > 0 {
+		res, err = doDestroySnapshots(ctx, lp, allowed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	res.Results = append(res.Results, refused...)
+	return res, nil
 }
 
 func (p *Receiver) HintMostRecentCommonAncestor(ctx context.Context, r *pdu.HintMostRecentCommonAncestorReq) (*pdu.HintMostRecentCommonAncestorRes, error) {
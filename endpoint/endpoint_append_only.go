@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// AppendOnlyConfig makes a Receiver refuse DestroySnapshots and Rollback requests of its clients,
+// protecting the received snapshots from a compromised sending side.
+type AppendOnlyConfig struct {
+	// If non-zero, clients may destroy snapshots that were created at least
+	// DestroyMinAge ago. If zero, all destroys are refused.
+	DestroyMinAge time.Duration
+}
+
+var prom struct {
+	AppendOnlyDestroyRefused        *prometheus.CounterVec
+	ReceiveRefusedInsufficientSpace *prometheus.CounterVec
+}
+
+func init() {
+	prom.AppendOnlyDestroyRefused = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "append_only_destroy_refused",
+		Help:      "Number of snapshot destroys requested by clients of an append-only receiver that were refused",
+	}, []string{"zrepl_job"})
+	prom.ReceiveRefusedInsufficientSpace = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "endpoint",
+		Name:      "receive_refused_insufficient_space",
+		Help:      "Number of receives that were refused because of a receive quota or the pool reserve",
+	}, []string{"zrepl_job"})
+}
+
+func PrometheusRegister(registry prometheus.Registerer) error {
+	if err := registry.Register(prom.AppendOnlyDestroyRefused); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.ReceiveRefusedInsufficientSpace); err != nil {
+		return err
+	}
+	return nil
+}
+
+// refuseDestroyReason returns why the destroy of a snapshot created at created is refused,
+// or an empty string if it is allowed.
+func (c *AppendOnlyConfig) refuseDestroyReason(created time.Time, exists bool, now time.Time) string {
+	if c.DestroyMinAge <= 0 {
+		return "client-initiated destroys are not allowed"
+	}
+	if !exists {
+		return "snapshot does not exist"
+	}
+	if age := now.Sub(created); age < c.DestroyMinAge {
+		return fmt.Sprintf("snapshot age %s is less than minimum age %s", age.Truncate(time.Second), c.DestroyMinAge)
+	}
+	return ""
+}
+
+// filterAppendOnlyDestroys partitions snaps into the snapshots that may be destroyed
+// and the results for the refused ones.
+// The snapshot creation times are looked up locally, the client's claims are not trusted.
+func (s *Receiver) filterAppendOnlyDestroys(ctx context.Context, lp *zfs.DatasetPath, snaps []*pdu.FilesystemVersion) (allowed []*pdu.FilesystemVersion, refused []*pdu.DestroySnapshotRes, err error) {
+	c := s.conf.AppendOnly
+
+	var creation map[string]time.Time
+	if c.DestroyMinAge > 0 {
+		local, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{
+			Types: zfs.Snapshots,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		creation = make(map[string]time.Time, len(local))
+		for _, v := range local {
+			creation[v.Name] = v.Creation
+		}
+	}
+
+	now := time.Now()
+	for _, fsv := range snaps {
+		created, exists := creation[fsv.Name]
+		reason := c.refuseDestroyReason(created, exists, now)
+		if reason == "" {
+			allowed = append(allowed, fsv)
+			continue
+		}
+		getLogger(ctx).
+			WithField("fs", lp.ToString()).
+			WithField("snap", fsv.Name).
+			WithField("reason", reason).
+			Warn("refusing to destroy snapshot on behalf of client")
+		prom.AppendOnlyDestroyRefused.WithLabelValues(s.conf.JobID.String()).Inc()
+		refused = append(refused, &pdu.DestroySnapshotRes{
+			Snapshot: fsv,
+			Error:    fmt.Sprintf("refused by append-only receiver: %s", reason),
+		})
+	}
+	return allowed, refused, nil
+}
@@ -0,0 +1,53 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestAppendOnlyRefusesAllDestroysWithoutMinAge(t *testing.T) {
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+	r := NewReceiver(ReceiverConfig{
+		JobID:                      MustMakeJobID("sink"),
+		RootWithoutClientComponent: root,
+		AppendOnly:                 &AppendOnlyConfig{},
+	})
+	lp, err := zfs.NewDatasetPath("pool/sink/client/fs")
+	require.NoError(t, err)
+	snaps := []*pdu.FilesystemVersion{
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "a"},
+		{Type: pdu.FilesystemVersion_Snapshot, Name: "b"},
+	}
+
+	allowed, refused, err := r.filterAppendOnlyDestroys(context.Background(), lp, snaps)
+	require.NoError(t, err)
+	assert.Empty(t, allowed)
+	require.Len(t, refused, len(snaps))
+	for i := range refused {
+		assert.Equal(t, snaps[i], refused[i].Snapshot)
+		assert.Contains(t, refused[i].Error, "append-only")
+	}
+}
+
+func TestAppendOnlyDestroyMinAge(t *testing.T) {
+	c := &AppendOnlyConfig{DestroyMinAge: 30 * 24 * time.Hour}
+	now := time.Now()
+
+	assert.Empty(t, c.refuseDestroyReason(now.Add(-31*24*time.Hour), true, now))
+	assert.Empty(t, c.refuseDestroyReason(now.Add(-30*24*time.Hour), true, now))
+	assert.Contains(t, c.refuseDestroyReason(now.Add(-29*24*time.Hour), true, now), "less than minimum age")
+	assert.Contains(t, c.refuseDestroyReason(now, true, now), "less than minimum age")
+	// the sink's view is authoritative, unknown snapshots are refused regardless of their age
+	assert.Equal(t, "snapshot does not exist", c.refuseDestroyReason(now.Add(-31*24*time.Hour), false, now))
+
+	noMinAge := &AppendOnlyConfig{}
+	assert.Contains(t, noMinAge.refuseDestroyReason(now.Add(-365*24*time.Hour), true, now), "not allowed")
+}
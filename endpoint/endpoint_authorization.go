@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ClientPermissions restricts the requests that a client identity may perform
+// on the endpoint of a passive job.
+type ClientPermissions struct {
+	// Deny requests that modify the endpoint's filesystems (Receive, Rename, DestroySnapshots, Rollback).
+	ReadOnly bool
+	// Deny DestroySnapshots and Rollback.
+	NoDestroy bool
+	// If non-nil, only the filesystems that pass Filesystems are visible to and
+	// accessible by the client. Only meaningful for Sender endpoints.
+	Filesystems zfs.DatasetFilter
+}
+
+type PermissionDeniedError struct {
+	ClientIdentity string
+	Reason         string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return fmt.Sprintf("permission denied for client %q: %s", e.ClientIdentity, e.Reason)
+}
+
+// Authorizer enforces ClientPermissions per client identity.
+// The client identity is taken from the ClientIdentityKey context value.
+// Clients without ClientPermissions are not restricted.
+//
+// A nil *Authorizer does not restrict any client.
+type Authorizer struct {
+	perms map[string]ClientPermissions
+}
+
+func NewAuthorizer(perms map[string]ClientPermissions) *Authorizer {
+	a := &Authorizer{perms: make(map[string]ClientPermissions, len(perms))}
+	for ci, p := range perms {
+		a.perms[ci] = p
+	}
+	return a
+}
+
+func (a *Authorizer) permissions(ctx context.Context) (p ClientPermissions, clientIdentity string, restricted bool) {
+	if a == nil {
+		return p, "", false
+	}
+	clientIdentity, ok := ctx.Value(ClientIdentityKey).(string)
+	if !ok {
+		panic("ClientIdentityKey context value must be set")
+	}
+	p, restricted = a.perms[clientIdentity]
+	return p, clientIdentity, restricted
+}
+
+// AuthorizeRequest returns a *PermissionDeniedError if the client must not perform req.
+// req is the request message of one of the RPCs of the Replication service or the data connection.
+// Requests of unknown type are denied for restricted clients.
+func (a *Authorizer) AuthorizeRequest(ctx context.Context, req interface{}) error {
+	p, clientIdentity, restricted := a.permissions(ctx)
+	if !restricted {
+		return nil
+	}
+	deny := func(format string, args ...interface{}) error {
+		return &PermissionDeniedError{clientIdentity, fmt.Sprintf(format, args...)}
+	}
+
+	var fs string
+	switch r := req.(type) {
+	case *pdu.PingReq, *pdu.ListFilesystemReq:
+		return nil
+	case *pdu.ListFilesystemVersionsReq:
+		fs = r.GetFilesystem()
+	case *pdu.ReplicationCursorReq:
+		fs = r.GetFilesystem()
+	case *pdu.SendReq:
+		fs = r.GetFilesystem()
+	case *pdu.SendCompletedReq:
+		fs = r.GetOriginalReq().GetFilesystem()
+	case *pdu.HintMostRecentCommonAncestorReq:
+		fs = r.GetFilesystem()
+	case *pdu.ReceiveReq:
+		if p.ReadOnly {
+			return deny("client is read-only")
+		}
+		fs = r.GetFilesystem()
+	case *pdu.RenameReq:
+		if p.ReadOnly {
+			return deny("client is read-only")
+		}
+		fs = r.GetFilesystem()
+	case *pdu.DestroySnapshotsReq:
+		if p.ReadOnly || p.NoDestroy {
+			return deny("client must not destroy snapshots")
+		}
+		fs = r.GetFilesystem()
+	case *pdu.RollbackReq:
+		if p.ReadOnly || p.NoDestroy {
+			return deny("client must not roll back filesystems")
+		}
+		fs = r.GetFilesystem()
+	default:
+		return deny("unknown request type %T", req)
+	}
+
+	if p.Filesystems == nil {
+		return nil
+	}
+	dp, err := zfs.NewDatasetPath(fs)
+	if err != nil {
+		return deny("invalid filesystem %q: %s", fs, err)
+	}
+	pass, err := p.Filesystems.Filter(dp)
+	if err != nil {
+		return deny("cannot evaluate filesystem filter for %q: %s", fs, err)
+	}
+	if !pass {
+		return deny("client must not access filesystem %q", fs)
+	}
+	return nil
+}
+
+// FilterResponse removes the filesystems that the client must not access from res.
+func (a *Authorizer) FilterResponse(ctx context.Context, res interface{}) {
+	p, _, restricted := a.permissions(ctx)
+	if !restricted || p.Filesystems == nil {
+		return
+	}
+	r, ok := res.(*pdu.ListFilesystemRes)
+	if !ok {
+		return
+	}
+	filtered := r.Filesystems[:0]
+	for _, fs := range r.Filesystems {
+		dp, err := zfs.NewDatasetPath(fs.GetPath())
+		if err != nil {
+			continue
+		}
+		if pass, err := p.Filesystems.Filter(dp); err == nil && pass {
+			filtered = append(filtered, fs)
+		}
+	}
+	r.Filesystems = filtered
+}
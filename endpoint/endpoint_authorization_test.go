@@ -0,0 +1,93 @@
+package endpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type prefixFilter string
+
+func (f prefixFilter) Filter(p *zfs.DatasetPath) (bool, error) {
+	prefix, err := zfs.NewDatasetPath(string(f))
+	if err != nil {
+		return false, err
+	}
+	return p.HasPrefix(prefix), nil
+}
+
+func TestAuthorizer(t *testing.T) {
+	a := NewAuthorizer(map[string]ClientPermissions{
+		"ro":        {ReadOnly: true},
+		"nodestroy": {NoDestroy: true},
+		"subtree":   {Filesystems: prefixFilter("pool/a")},
+	})
+	ctxFor := func(ci string) context.Context {
+		return context.WithValue(context.Background(), ClientIdentityKey, ci)
+	}
+	isDenied := func(t *testing.T, err error) {
+		require.Error(t, err)
+		_, ok := err.(*PermissionDeniedError)
+		assert.True(t, ok, "%T", err)
+	}
+
+	recv := &pdu.ReceiveReq{Filesystem: "pool/a/b"}
+	destroy := &pdu.DestroySnapshotsReq{Filesystem: "pool/a/b"}
+	rollback := &pdu.RollbackReq{Filesystem: "pool/a/b"}
+	rename := &pdu.RenameReq{Filesystem: "pool/a/b", RenameFrom: "pool/a/c"}
+	send := &pdu.SendReq{Filesystem: "pool/a/b"}
+
+	t.Run("unrestricted", func(t *testing.T) {
+		ctx := ctxFor("other")
+		assert.NoError(t, a.AuthorizeRequest(ctx, recv))
+		assert.NoError(t, a.AuthorizeRequest(ctx, destroy))
+		assert.NoError(t, a.AuthorizeRequest(ctx, rollback))
+		assert.NoError(t, a.AuthorizeRequest(ctx, struct{}{}))
+	})
+
+	t.Run("nil_authorizer", func(t *testing.T) {
+		var nilA *Authorizer
+		assert.NoError(t, nilA.AuthorizeRequest(ctxFor("ro"), destroy))
+	})
+
+	t.Run("read_only", func(t *testing.T) {
+		ctx := ctxFor("ro")
+		isDenied(t, a.AuthorizeRequest(ctx, recv))
+		isDenied(t, a.AuthorizeRequest(ctx, destroy))
+		isDenied(t, a.AuthorizeRequest(ctx, rollback))
+		isDenied(t, a.AuthorizeRequest(ctx, rename))
+		assert.NoError(t, a.AuthorizeRequest(ctx, send))
+		assert.NoError(t, a.AuthorizeRequest(ctx, &pdu.ListFilesystemReq{}))
+		isDenied(t, a.AuthorizeRequest(ctx, struct{}{}))
+	})
+
+	t.Run("no_destroy", func(t *testing.T) {
+		ctx := ctxFor("nodestroy")
+		assert.NoError(t, a.AuthorizeRequest(ctx, recv))
+		isDenied(t, a.AuthorizeRequest(ctx, destroy))
+		isDenied(t, a.AuthorizeRequest(ctx, rollback))
+		assert.NoError(t, a.AuthorizeRequest(ctx, rename))
+	})
+
+	t.Run("filesystems", func(t *testing.T) {
+		ctx := ctxFor("subtree")
+		assert.NoError(t, a.AuthorizeRequest(ctx, send))
+		isDenied(t, a.AuthorizeRequest(ctx, &pdu.SendReq{Filesystem: "pool/b"}))
+		isDenied(t, a.AuthorizeRequest(ctx, &pdu.SendCompletedReq{OriginalReq: &pdu.SendReq{Filesystem: "pool/b"}}))
+
+		res := &pdu.ListFilesystemRes{Filesystems: []*pdu.Filesystem{
+			{Path: "pool/a"}, {Path: "pool/b"}, {Path: "pool/a/c"},
+		}}
+		a.FilterResponse(ctx, res)
+		var paths []string
+		for _, fs := range res.Filesystems {
+			paths = append(paths, fs.Path)
+		}
+		assert.Equal(t, []string{"pool/a", "pool/a/c"}, paths)
+	})
+}
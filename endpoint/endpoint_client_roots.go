@@ -0,0 +1,205 @@
+package endpoint
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ClientRootTemplatePlaceholder is replaced by the client identity in a ClientRoots template.
+const ClientRootTemplatePlaceholder = "{{.Client}}"
+
+// ClientRoots determines the root filesystem below which a Receiver receives
+// the filesystems of a client, based on the client identity.
+type ClientRoots struct {
+	// Roots of specific clients.
+	perClient map[string]*zfs.DatasetPath
+	// Template for all other clients, empty if other clients are refused.
+	// Contains ClientRootTemplatePlaceholder at least once.
+	template string
+	// The first templateStaticLen components of template do not contain ClientRootTemplatePlaceholder.
+	templateStaticLen int
+	// true if template is the root_fs of a sink job with the client identity appended
+	appendsClientIdentity bool
+}
+
+// NewClientRoots builds a ClientRoots from a sink job's root_fs and per-client roots.
+//
+// If rootFS does not contain ClientRootTemplatePlaceholder, the client identity
+// is appended to rootFS as a child filesystem.
+// rootFS may be empty if perClient is not.
+func NewClientRoots(rootFS string, perClient map[string]string) (*ClientRoots, error) {
+	r := &ClientRoots{perClient: make(map[string]*zfs.DatasetPath, len(perClient))}
+	if rootFS == "" && len(perClient) == 0 {
+		return nil, errors.New("root filesystem must not be empty")
+	}
+	if rootFS != "" {
+		if strings.Contains(strings.ReplaceAll(rootFS, ClientRootTemplatePlaceholder, ""), "{{") {
+			return nil, errors.Errorf("root filesystem template %q: %s is the only supported template", rootFS, ClientRootTemplatePlaceholder)
+		}
+		r.template = rootFS
+		if !strings.Contains(rootFS, ClientRootTemplatePlaceholder) {
+			r.template = rootFS + "/" + ClientRootTemplatePlaceholder
+			r.appendsClientIdentity = true
+		}
+		comps := strings.Split(r.template, "/")
+		for r.templateStaticLen < len(comps) && !strings.Contains(comps[r.templateStaticLen], ClientRootTemplatePlaceholder) {
+			r.templateStaticLen++
+		}
+		// validate the template with a placeholder that is a valid client identity
+		if _, _, err := r.expandTemplate("client"); err != nil {
+			return nil, errors.Wrapf(err, "invalid root filesystem template %q", rootFS)
+		}
+	}
+	for clientIdentity, root := range perClient {
+		p, err := zfs.NewDatasetPath(root)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid root filesystem %q of client %q", root, clientIdentity)
+		}
+		if p.Length() == 0 {
+			return nil, errors.Errorf("root filesystem of client %q must not be empty", clientIdentity)
+		}
+		r.perClient[clientIdentity] = p
+	}
+	// otherwise, clients could receive into each other's filesystems
+	roots := r.OwnedSubtreeRoots()
+	for i := range roots {
+		for j := i + 1; j < len(roots); j++ {
+			if ClientRootPatternsOverlap(roots[i], roots[j]) {
+				return nil, errors.Errorf("root filesystems %q and %q overlap", roots[i], roots[j])
+			}
+		}
+	}
+	return r, nil
+}
+
+// ClientRoot returns the root filesystem of clientIdentity
+// and the filesystem that must exist before the Receiver creates placeholders for the client root.
+// The latter is a prefix of the former and may be empty.
+func (r *ClientRoots) ClientRoot(clientIdentity string) (root, mustExist *zfs.DatasetPath, err error) {
+	if p, ok := r.perClient[clientIdentity]; ok {
+		return p.Copy(), p.Copy(), nil
+	}
+	if r.template == "" {
+		return nil, nil, errors.Errorf("no root filesystem configured for client %q", clientIdentity)
+	}
+	return r.expandTemplate(clientIdentity)
+}
+
+func (r *ClientRoots) expandTemplate(clientIdentity string) (root, mustExist *zfs.DatasetPath, err error) {
+	if clientIdentity == "" || strings.Contains(clientIdentity, "/") {
+		return nil, nil, fmt.Errorf("client identity must be a single ZFS filesystem path component")
+	}
+	root, err = zfs.NewDatasetPath(strings.ReplaceAll(r.template, ClientRootTemplatePlaceholder, clientIdentity))
+	if err != nil {
+		return nil, nil, err
+	}
+	if root.Length() != len(strings.Split(r.template, "/")) {
+		return nil, nil, fmt.Errorf("client identity must be a single ZFS filesystem path component")
+	}
+	mustExist, err = zfs.NewDatasetPath(strings.Join(strings.Split(r.template, "/")[:r.templateStaticLen], "/"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return root, mustExist, nil
+}
+
+// TestClientIdentity returns an error if the Receiver cannot receive the filesystems of clientIdentity.
+func (r *ClientRoots) TestClientIdentity(clientIdentity string) error {
+	_, _, err := r.ClientRoot(clientIdentity)
+	return err
+}
+
+// OwnedSubtreeRoots returns the roots of all subtrees that the client roots may be in,
+// sorted lexicographically. They may contain ClientRootTemplatePlaceholder,
+// which stands for a single, non-empty part of a path component.
+func (r *ClientRoots) OwnedSubtreeRoots() []string {
+	var roots []string
+	if r.appendsClientIdentity {
+		// the placeholders of the client roots are below root_fs, too
+		roots = append(roots, strings.TrimSuffix(r.template, "/"+ClientRootTemplatePlaceholder))
+	} else if r.template != "" {
+		roots = append(roots, r.template)
+	}
+	for _, p := range r.perClient {
+		roots = append(roots, p.ToString())
+	}
+	sort.Strings(roots)
+	return roots
+}
+
+var _ zfs.DatasetFilter = (*ClientRoots)(nil)
+
+// Filter passes the filesystems strictly below the subtree roots returned by OwnedSubtreeRoots.
+func (r *ClientRoots) Filter(p *zfs.DatasetPath) (pass bool, err error) {
+	for _, root := range r.OwnedSubtreeRoots() {
+		if ClientRootPatternIsPrefix(root, p.ToString()) && p.Length() > len(strings.Split(root, "/")) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ClientRootPatternIsPrefix returns true if pattern, which may contain ClientRootTemplatePlaceholder
+// (see OwnedSubtreeRoots), matches the first components of the dataset path p.
+func ClientRootPatternIsPrefix(pattern, p string) bool {
+	pcomps, comps := strings.Split(pattern, "/"), strings.Split(p, "/")
+	if len(pcomps) > len(comps) {
+		return false
+	}
+	for i := range pcomps {
+		if !clientRootPatternComponentRegexp(pcomps[i]).MatchString(comps[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func clientRootPatternComponentRegexp(comp string) *regexp.Regexp {
+	parts := strings.Split(comp, ClientRootTemplatePlaceholder)
+	for i := range parts {
+		parts[i] = regexp.QuoteMeta(parts[i])
+	}
+	return regexp.MustCompile("^" + strings.Join(parts, ".+") + "$")
+}
+
+// ClientRootPatternsOverlap returns true if a dataset path that matches one of the patterns
+// (see OwnedSubtreeRoots) can be equal to or a prefix of a dataset path that matches the other.
+// It may return true for some patterns that do not overlap.
+func ClientRootPatternsOverlap(a, b string) bool {
+	acomps, bcomps := strings.Split(a, "/"), strings.Split(b, "/")
+	n := len(acomps)
+	if len(bcomps) < n {
+		n = len(bcomps)
+	}
+	for i := 0; i < n; i++ {
+		if !clientRootPatternComponentsOverlap(acomps[i], bcomps[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func clientRootPatternComponentsOverlap(a, b string) bool {
+	aTmpl, bTmpl := strings.Contains(a, ClientRootTemplatePlaceholder), strings.Contains(b, ClientRootTemplatePlaceholder)
+	switch {
+	case !aTmpl && !bTmpl:
+		return a == b
+	case aTmpl && !bTmpl:
+		return clientRootPatternComponentRegexp(a).MatchString(b)
+	case !aTmpl && bTmpl:
+		return clientRootPatternComponentRegexp(b).MatchString(a)
+	default:
+		// conservative: the literal prefixes and suffixes must be compatible
+		aPrefix, aSuffix := a[:strings.Index(a, ClientRootTemplatePlaceholder)], a[strings.LastIndex(a, ClientRootTemplatePlaceholder)+len(ClientRootTemplatePlaceholder):]
+		bPrefix, bSuffix := b[:strings.Index(b, ClientRootTemplatePlaceholder)], b[strings.LastIndex(b, ClientRootTemplatePlaceholder)+len(ClientRootTemplatePlaceholder):]
+		prefixesCompatible := strings.HasPrefix(aPrefix, bPrefix) || strings.HasPrefix(bPrefix, aPrefix)
+		suffixesCompatible := strings.HasSuffix(aSuffix, bSuffix) || strings.HasSuffix(bSuffix, aSuffix)
+		return prefixesCompatible && suffixesCompatible
+	}
+}
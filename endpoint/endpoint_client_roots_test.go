@@ -0,0 +1,155 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestClientRoots(t *testing.T) {
+	type root struct {
+		client          string
+		root, mustExist string // empty root means error
+	}
+	tcs := []struct {
+		name      string
+		rootFS    string
+		perClient map[string]string
+		err       bool
+		roots     []root
+		owned     []string
+	}{
+		{
+			name:   "legacy",
+			rootFS: "pool/sink",
+			roots: []root{
+				{"a", "pool/sink/a", "pool/sink"},
+				{"a.b", "pool/sink/a.b", "pool/sink"},
+				{"", "", ""},
+				{"a/b", "", ""},
+			},
+			owned: []string{"pool/sink"},
+		},
+		{
+			name:   "template",
+			rootFS: "pool_{{.Client}}/backups",
+			roots: []root{
+				{"a", "pool_a/backups", ""},
+				{"a/b", "", ""},
+			},
+			owned: []string{"pool_{{.Client}}/backups"},
+		},
+		{
+			name:   "template with static prefix",
+			rootFS: "pool/sink/{{.Client}}-backups/received",
+			roots: []root{
+				{"a", "pool/sink/a-backups/received", "pool/sink"},
+			},
+			owned: []string{"pool/sink/{{.Client}}-backups/received"},
+		},
+		{
+			name:      "per-client and legacy",
+			rootFS:    "pool/sink",
+			perClient: map[string]string{"special": "otherpool/special"},
+			roots: []root{
+				{"special", "otherpool/special", "otherpool/special"},
+				{"a", "pool/sink/a", "pool/sink"},
+			},
+			owned: []string{"otherpool/special", "pool/sink"},
+		},
+		{
+			name:      "per-client only",
+			perClient: map[string]string{"a": "pool/a", "b": "pool/b"},
+			roots: []root{
+				{"a", "pool/a", "pool/a"},
+				{"b", "pool/b", "pool/b"},
+				{"c", "", ""},
+			},
+			owned: []string{"pool/a", "pool/b"},
+		},
+		{name: "empty", err: true},
+		{name: "unsupported template", rootFS: "pool/{{.Job}}", err: true},
+		{name: "invalid template", rootFS: "pool/{{.Client}}@snap", err: true},
+		{name: "empty per-client root", perClient: map[string]string{"a": ""}, err: true},
+		{name: "per-client roots overlap", perClient: map[string]string{"a": "pool/a", "b": "pool/a/b"}, err: true},
+		{name: "per-client root below legacy root", rootFS: "pool/sink", perClient: map[string]string{"a": "pool/sink/b"}, err: true},
+		{name: "per-client root matches template", rootFS: "pool/{{.Client}}", perClient: map[string]string{"a": "pool/b"}, err: true},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewClientRoots(tc.rootFS, tc.perClient)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.owned, r.OwnedSubtreeRoots())
+			for _, c := range tc.roots {
+				root, mustExist, err := r.ClientRoot(c.client)
+				if c.root == "" {
+					assert.Error(t, err, "client %q", c.client)
+					assert.Error(t, r.TestClientIdentity(c.client))
+					continue
+				}
+				require.NoError(t, err, "client %q", c.client)
+				assert.NoError(t, r.TestClientIdentity(c.client))
+				assert.Equal(t, c.root, root.ToString())
+				assert.Equal(t, c.mustExist, mustExist.ToString())
+			}
+		})
+	}
+}
+
+func TestClientRootsFilter(t *testing.T) {
+	r, err := NewClientRoots("pool_{{.Client}}/backups", map[string]string{"special": "pool/special"})
+	require.NoError(t, err)
+	tcs := []struct {
+		fs   string
+		pass bool
+	}{
+		{"pool_a/backups/fs", true},
+		{"pool_a/backups/fs/child", true},
+		{"pool_a/backups", false},
+		{"pool_a/other/fs", false},
+		{"pool_/backups/fs", false},
+		{"pool/special", false},
+		{"pool/special/fs", true},
+		{"pool/specialfs", false},
+	}
+	for _, tc := range tcs {
+		p, err := zfs.NewDatasetPath(tc.fs)
+		require.NoError(t, err)
+		pass, err := r.Filter(p)
+		require.NoError(t, err)
+		assert.Equal(t, tc.pass, pass, "%q", tc.fs)
+	}
+}
+
+func TestClientRootPatternsOverlap(t *testing.T) {
+	tcs := []struct {
+		a, b    string
+		overlap bool
+	}{
+		{"pool/a", "pool/a", true},
+		{"pool/a", "pool/a/b", true},
+		{"pool/a", "pool/ab", false},
+		{"pool/{{.Client}}", "pool/a", true},
+		{"pool/{{.Client}}", "pool/a/b", true},
+		{"pool/{{.Client}}", "otherpool/a", false},
+		{"pool/{{.Client}}-x", "pool/a-y", false},
+		{"pool/{{.Client}}-x", "pool/a-x/b", true},
+		{"pool/{{.Client}}", "pool", true},
+		{"pool_{{.Client}}/a", "pool_{{.Client}}/b", false},
+		{"pool_{{.Client}}/a", "pool{{.Client}}/a", true},
+		{"x{{.Client}}/a", "y{{.Client}}/a", false},
+		{"{{.Client}}x/a", "{{.Client}}y/a", false},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.overlap, ClientRootPatternsOverlap(tc.a, tc.b), "%q %q", tc.a, tc.b)
+		assert.Equal(t, tc.overlap, ClientRootPatternsOverlap(tc.b, tc.a), "%q %q", tc.b, tc.a)
+	}
+}
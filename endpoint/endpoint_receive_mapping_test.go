@@ -0,0 +1,63 @@
+package endpoint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// stripFirstComponentMapping maps pool/a/b to a/b, like strip_components: 1,
+// and cannot invert the mapping.
+type stripFirstComponentMapping struct{}
+
+func (stripFirstComponentMapping) Map(fs *zfs.DatasetPath) (*zfs.DatasetPath, error) {
+	if fs.Length() < 2 {
+		return nil, errors.Errorf("cannot map %q", fs.ToString())
+	}
+	return zfs.NewDatasetPath(strings.SplitN(fs.ToString(), "/", 2)[1])
+}
+
+func (stripFirstComponentMapping) Invert(local *zfs.DatasetPath) (*zfs.DatasetPath, bool) {
+	return nil, false
+}
+
+func TestReceiverUnmapFilesystem(t *testing.T) {
+	r := NewReceiver(ReceiverConfig{
+		JobID:                      MustMakeJobID("sink"),
+		RootWithoutClientComponent: mustDatasetPath(t, "pool/sink"),
+		Mapping:                    stripFirstComponentMapping{},
+	})
+	local := mustDatasetPath(t, "src/fs")
+	unmap := func(receivedFrom, resumeTokenFS string) string {
+		senderFS, ok := r.unmapFilesystemFrom(local, receivedFrom, resumeTokenFS)
+		if !ok {
+			return ""
+		}
+		return senderFS.ToString()
+	}
+
+	assert.Equal(t, "zroot/src/fs", unmap("zroot/src/fs", ""))
+	assert.Equal(t, "", unmap("", ""), "the mapping cannot be inverted")
+	assert.Equal(t, "", unmap("zroot/other", ""), "receivedFrom is not mapped to local, e.g. after renameAside")
+
+	// an interrupted initial full receive has a resume token, but no receivedFrom
+	assert.Equal(t, "zroot/src/fs", unmap("", "zroot/src/fs"))
+	assert.Equal(t, "zroot/src/fs", unmap("zroot/other", "zroot/src/fs"))
+	assert.Equal(t, "tank/src/fs", unmap("tank/src/fs", "zroot/src/fs"), "receivedFrom takes precedence")
+}
+
+func TestResumeTokenFilesystem(t *testing.T) {
+	assert.Equal(t, "zroot/src/fs", resumeTokenFilesystem(&zfs.ResumeToken{ToName: "zroot/src/fs@zrepl_1"}))
+	assert.Equal(t, "", resumeTokenFilesystem(&zfs.ResumeToken{}))
+}
+
+func mustDatasetPath(t *testing.T, p string) *zfs.DatasetPath {
+	dp, err := zfs.NewDatasetPath(p)
+	require.NoError(t, err)
+	return dp
+}
@@ -0,0 +1,137 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ReceiveQuotaConfig makes a Receiver refuse Receive requests whose stream
+// would not fit into the space that is available to the client,
+// before it starts `zfs recv`.
+// The check is based on the sender's size estimate of the stream (pdu.ReceiveReq.ExpectedSize).
+type ReceiveQuotaConfig struct {
+	// Client identity => maximum `used` of the client root, in bytes.
+	ClientQuotas map[string]int64
+	// Quota of clients that are not in ClientQuotas, 0 means unlimited.
+	DefaultQuota int64
+	// Space in bytes that must remain `available` on the root filesystem of the receiving pool
+	// after the receive, 0 means no reserve.
+	PoolReserve int64
+}
+
+func (c *ReceiveQuotaConfig) Validate() error {
+	for clientIdentity, q := range c.ClientQuotas {
+		if q <= 0 {
+			return errors.Errorf("quota of client %q must be positive", clientIdentity)
+		}
+	}
+	if c.DefaultQuota < 0 {
+		return errors.New("DefaultQuota must not be negative")
+	}
+	if c.PoolReserve < 0 {
+		return errors.New("PoolReserve must not be negative")
+	}
+	return nil
+}
+
+// quota returns 0 if the client is unlimited.
+func (c *ReceiveQuotaConfig) quota(clientIdentity string) int64 {
+	if q, ok := c.ClientQuotas[clientIdentity]; ok {
+		return q
+	}
+	return c.DefaultQuota
+}
+
+// InsufficientSpaceError is returned by Receiver.Receive if it refuses a stream
+// because of its ReceiveQuotaConfig.
+// Retrying the request does not help unless space is freed up on the receiver.
+type InsufficientSpaceError struct {
+	Filesystem string
+	Reason     string
+}
+
+func (e *InsufficientSpaceError) Error() string {
+	return fmt.Sprintf("insufficient space to receive into %q: %s", e.Filesystem, e.Reason)
+}
+
+// checkSpace returns an *InsufficientSpaceError if a stream of expectedSize bytes
+// does not fit, given the current `used` of the client root and `available` of the pool.
+// expectedSize 0 means that there is no size estimate.
+func (c *ReceiveQuotaConfig) checkSpace(clientIdentity, lp string, used, poolAvailable, expectedSize int64) error {
+	refuse := func(format string, args ...interface{}) error {
+		return &InsufficientSpaceError{Filesystem: lp, Reason: fmt.Sprintf(format, args...)}
+	}
+	if q := c.quota(clientIdentity); q > 0 {
+		if used+expectedSize > q || used >= q {
+			return refuse("client %q uses %d bytes of its quota of %d bytes, the stream is estimated at %d bytes",
+				clientIdentity, used, q, expectedSize)
+		}
+	}
+	if c.PoolReserve > 0 {
+		if poolAvailable-expectedSize < c.PoolReserve {
+			return refuse("the pool has %d bytes available and must keep a reserve of %d bytes, the stream is estimated at %d bytes",
+				poolAvailable, c.PoolReserve, expectedSize)
+		}
+	}
+	return nil
+}
+
+// checkReceiveSpace implements the check of ReceiveQuotaConfig for a Receive request into lp.
+// It is a no-op if the Receiver has no ReceiveQuotaConfig.
+func (s *Receiver) checkReceiveSpace(ctx context.Context, root, lp *zfs.DatasetPath, expectedSize int64) error {
+	c := s.conf.Quota
+	if c == nil {
+		return nil
+	}
+	clientIdentity, _ := ctx.Value(ClientIdentityKey).(string)
+
+	getBytes := func(fs *zfs.DatasetPath, prop string) (int64, error) {
+		props, err := zfs.ZFSGet(ctx, fs, []string{prop})
+		if err != nil {
+			return 0, err
+		}
+		v, err := strconv.ParseInt(props.Get(prop), 10, 64)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cannot parse %q of %q", prop, fs.ToString())
+		}
+		return v, nil
+	}
+
+	var used int64
+	if c.quota(clientIdentity) > 0 {
+		var err error
+		used, err = getBytes(root, "used")
+		if _, ok := err.(*zfs.DatasetDoesNotExist); ok {
+			used = 0 // nothing received yet
+		} else if err != nil {
+			return errors.Wrap(err, "cannot determine space used by client")
+		}
+	}
+
+	var poolAvailable int64
+	if c.PoolReserve > 0 {
+		poolName, err := lp.Pool()
+		if err != nil {
+			return err
+		}
+		pool, err := zfs.NewDatasetPath(poolName)
+		if err != nil {
+			return err
+		}
+		poolAvailable, err = getBytes(pool, "available")
+		if err != nil {
+			return errors.Wrap(err, "cannot determine available space of pool")
+		}
+	}
+
+	if err := c.checkSpace(clientIdentity, lp.ToString(), used, poolAvailable, expectedSize); err != nil {
+		prom.ReceiveRefusedInsufficientSpace.WithLabelValues(s.conf.JobID.String()).Inc()
+		return err
+	}
+	return nil
+}
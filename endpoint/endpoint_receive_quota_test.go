@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceiveQuotaConfigCheckSpace(t *testing.T) {
+	c := &ReceiveQuotaConfig{
+		ClientQuotas: map[string]int64{"small": 100, "large": 10000},
+		DefaultQuota: 1000,
+		PoolReserve:  500,
+	}
+	require.NoError(t, c.Validate())
+
+	tcs := []struct {
+		name                              string
+		client                            string
+		used, poolAvailable, expectedSize int64
+		refuse                            bool
+	}{
+		{"fits", "small", 10, 10000, 50, false},
+		{"fits_exactly", "small", 50, 10000, 50, false},
+		{"exceeds_client_quota", "small", 60, 10000, 50, true},
+		{"no_estimate_below_quota", "small", 99, 10000, 0, false},
+		{"no_estimate_quota_used_up", "small", 100, 10000, 0, true},
+		{"default_quota", "other", 900, 10000, 200, true},
+		{"client_quota_takes_precedence", "large", 900, 10000, 200, false},
+		{"pool_reserve_kept_exactly", "large", 0, 1000, 500, false},
+		{"pool_reserve_violated", "large", 0, 1000, 501, true},
+		{"pool_below_reserve_no_estimate", "large", 0, 499, 0, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := c.checkSpace(tc.client, "pool/sink/fs", tc.used, tc.poolAvailable, tc.expectedSize)
+			if !tc.refuse {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			_, ok := err.(*InsufficientSpaceError)
+			assert.True(t, ok, "%T", err)
+			assert.Contains(t, err.Error(), "pool/sink/fs")
+		})
+	}
+
+	t.Run("unlimited", func(t *testing.T) {
+		c := &ReceiveQuotaConfig{}
+		require.NoError(t, c.Validate())
+		assert.NoError(t, c.checkSpace("any", "pool/sink/fs", 1<<40, 0, 1<<40))
+	})
+}
+
+func TestReceiveQuotaConfigValidate(t *testing.T) {
+	assert.Error(t, (&ReceiveQuotaConfig{ClientQuotas: map[string]int64{"a": 0}}).Validate())
+	assert.Error(t, (&ReceiveQuotaConfig{DefaultQuota: -1}).Validate())
+	assert.Error(t, (&ReceiveQuotaConfig{PoolReserve: -1}).Validate())
+}
@@ -0,0 +1,150 @@
+package endpoint
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// ReceiveTracker tracks the local filesystems that a Receiver is currently receiving into
+// and that a Sender is currently sending.
+// A Sender that shares the ReceiveTracker refuses to send a filesystem that is being received into,
+// and the Receiver refuses to receive into a filesystem that is being sent,
+// which allows serving the received filesystems to another job (cascading replication).
+//
+// A nil *ReceiveTracker tracks nothing.
+type ReceiveTracker struct {
+	mtx       sync.Mutex
+	receiving map[string]int
+	sending   map[string]int
+}
+
+func NewReceiveTracker() *ReceiveTracker {
+	return &ReceiveTracker{
+		receiving: make(map[string]int),
+		sending:   make(map[string]int),
+	}
+}
+
+// beginReceive marks fs as being received into until the returned func is called.
+// It returns a *FilesystemSendingError if fs is currently being sent.
+func (t *ReceiveTracker) beginReceive(fs string) (end func(), err error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.sending[fs] > 0 {
+		return nil, &FilesystemSendingError{FS: fs}
+	}
+	return t.begin(t.receiving, fs), nil
+}
+
+// beginSend marks fs as being sent until the returned func is called.
+// It returns a *FilesystemReceivingError if fs is currently being received into.
+func (t *ReceiveTracker) beginSend(fs string) (end func(), err error) {
+	if t == nil {
+		return func() {}, nil
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	if t.receiving[fs] > 0 {
+		return nil, &FilesystemReceivingError{FS: fs}
+	}
+	return t.begin(t.sending, fs), nil
+}
+
+// t.mtx must be held
+func (t *ReceiveTracker) begin(active map[string]int, fs string) (end func()) {
+	active[fs]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.mtx.Lock()
+			defer t.mtx.Unlock()
+			active[fs]--
+			if active[fs] == 0 {
+				delete(active, fs)
+			}
+		})
+	}
+}
+
+// Receiving returns true if fs is currently being received into.
+func (t *ReceiveTracker) Receiving(fs string) bool {
+	if t == nil {
+		return false
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.receiving[fs] > 0
+}
+
+// Sending returns true if fs is currently being sent.
+func (t *ReceiveTracker) Sending(fs string) bool {
+	if t == nil {
+		return false
+	}
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+	return t.sending[fs] > 0
+}
+
+// FilesystemReceivingError and FilesystemSendingError are transient errors,
+// their messages are matched by replication/driver.DefaultTransientErrors.
+type FilesystemReceivingError struct {
+	FS string
+}
+
+func (e *FilesystemReceivingError) Error() string {
+	return fmt.Sprintf("filesystem %q is currently being received into, try again later", e.FS)
+}
+
+type FilesystemSendingError struct {
+	FS string
+}
+
+func (e *FilesystemSendingError) Error() string {
+	return fmt.Sprintf("filesystem %q is currently being sent, try again later", e.FS)
+}
+
+// trackedSendStream calls end when the wrapped StreamCopier's stream
+// has been copied completely or with an error, or when it is closed before.
+type trackedSendStream struct {
+	sc  zfs.StreamCopier
+	end func() // idempotent
+}
+
+func newTrackedSendStream(sc zfs.StreamCopier, end func()) zfs.StreamCopier {
+	s := &trackedSendStream{sc, end}
+	if r, ok := sc.(io.Reader); ok {
+		// preserve the io.Reader optimization of stream.Conn.SendStream
+		return trackedSendStreamAndReader{s, r}
+	}
+	return s
+}
+
+func (s *trackedSendStream) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	defer s.end()
+	return s.sc.WriteStreamTo(w)
+}
+
+func (s *trackedSendStream) Close() error {
+	defer s.end()
+	return s.sc.Close()
+}
+
+type trackedSendStreamAndReader struct {
+	*trackedSendStream
+	r io.Reader
+}
+
+func (s trackedSendStreamAndReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil {
+		s.end()
+	}
+	return n, err
+}
@@ -0,0 +1,138 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/driver"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestReceiveTracker(t *testing.T) {
+	tr := NewReceiveTracker()
+	assert.False(t, tr.Receiving("pool/sink/a"))
+
+	end1, err := tr.beginReceive("pool/sink/a")
+	require.NoError(t, err)
+	end2, err := tr.beginReceive("pool/sink/a")
+	require.NoError(t, err)
+	assert.True(t, tr.Receiving("pool/sink/a"))
+	assert.False(t, tr.Receiving("pool/sink/b"))
+
+	_, err = tr.beginSend("pool/sink/a")
+	assert.IsType(t, &FilesystemReceivingError{}, err)
+	endSend, err := tr.beginSend("pool/sink/b")
+	require.NoError(t, err)
+	assert.True(t, tr.Sending("pool/sink/b"))
+	_, err = tr.beginReceive("pool/sink/b")
+	assert.IsType(t, &FilesystemSendingError{}, err)
+	endSend()
+	endSend() // idempotent
+	assert.False(t, tr.Sending("pool/sink/b"))
+
+	end1()
+	end1() // idempotent
+	assert.True(t, tr.Receiving("pool/sink/a"))
+	end2()
+	assert.False(t, tr.Receiving("pool/sink/a"))
+
+	var nilTracker *ReceiveTracker
+	end, err := nilTracker.beginReceive("pool/sink/a")
+	require.NoError(t, err)
+	end()
+	end, err = nilTracker.beginSend("pool/sink/a")
+	require.NoError(t, err)
+	end()
+	assert.False(t, nilTracker.Receiving("pool/sink/a"))
+	assert.False(t, nilTracker.Sending("pool/sink/a"))
+}
+
+func TestReceiveTrackerErrorsAreTransient(t *testing.T) {
+	isTransient := func(err error) bool {
+		for _, t := range driver.DefaultTransientErrors {
+			if strings.Contains(err.Error(), t) {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, isTransient(&FilesystemSendingError{FS: "pool/sink/a"}))
+	assert.True(t, isTransient(&FilesystemReceivingError{FS: "pool/sink/a"}))
+}
+
+func TestSenderRefusesSendOfFilesystemBeingReceived(t *testing.T) {
+	tr := NewReceiveTracker()
+	s := NewSender(SenderConfig{
+		FSF:            zfs.NoFilter(),
+		Encrypt:        &zfs.NilBool{B: false},
+		JobID:          MustMakeJobID("sink"),
+		ReceiveTracker: tr,
+	})
+	end, err := tr.beginReceive("pool/sink/a")
+	require.NoError(t, err)
+	defer end()
+
+	_, _, err = s.Send(context.Background(), &pdu.SendReq{Filesystem: "pool/sink/a"})
+	require.Error(t, err)
+	_, ok := err.(*FilesystemReceivingError)
+	assert.True(t, ok, "%T", err)
+	assert.False(t, tr.Sending("pool/sink/a"))
+}
+
+type closeRecordingStreamCopier struct {
+	closed bool
+}
+
+func (c *closeRecordingStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	return nil
+}
+
+func (c *closeRecordingStreamCopier) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestReceiverRefusesReceiveIntoFilesystemBeingSent(t *testing.T) {
+	tr := NewReceiveTracker()
+	root, err := zfs.NewDatasetPath("pool/sink")
+	require.NoError(t, err)
+	r := NewReceiver(ReceiverConfig{
+		JobID:                      MustMakeJobID("sink"),
+		RootWithoutClientComponent: root,
+		ReceiveTracker:             tr,
+	})
+	end, err := tr.beginSend("pool/sink/a")
+	require.NoError(t, err)
+	defer end()
+
+	to := &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "b", Guid: 2, Creation: pdu.FilesystemVersionCreation(time.Now())}
+	for _, req := range []*pdu.ReceiveReq{
+		{Filesystem: "a", To: to},
+		// renaming a filesystem that is being sent
+		{Filesystem: "c", RenameFrom: "a", To: to},
+	} {
+		stream := &closeRecordingStreamCopier{}
+		_, err = r.Receive(context.Background(), req, stream)
+		require.Error(t, err)
+		_, ok := err.(*FilesystemSendingError)
+		assert.True(t, ok, "%T", err)
+		assert.True(t, stream.closed)
+		assert.False(t, tr.Receiving("pool/sink/c"))
+	}
+}
+
+func TestTrackedSendStreamEndsWithStream(t *testing.T) {
+	ended := 0
+	var sc zfs.StreamCopier = &closeRecordingStreamCopier{}
+	s := newTrackedSendStream(sc, func() { ended++ })
+	assert.NoError(t, s.WriteStreamTo(&bytes.Buffer{}))
+	assert.Equal(t, 1, ended)
+}
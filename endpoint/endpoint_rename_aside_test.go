@@ -0,0 +1,53 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestConflictAsideName(t *testing.T) {
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.FixedZone("UTC+2", 2*60*60))
+	assert.Equal(t, "pool/sink/fs_zrepl_conflict_20200304_030607", conflictAsideName("pool/sink/fs", now))
+}
+
+func TestIsConflictAside(t *testing.T) {
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	aside := conflictAsideName("pool/sink/fs", now)
+	assert.True(t, IsConflictAside(aside))
+	assert.True(t, IsConflictAside(aside+"/child"), "children are renamed with their parent")
+	assert.False(t, IsConflictAside("pool/sink/fs"))
+	assert.False(t, IsConflictAside("pool/sink/fs_zrepl_conflict"))
+	assert.False(t, IsConflictAside(aside+"_suffix"))
+}
+
+func TestRenameAsideTarget(t *testing.T) {
+	lp, err := zfs.NewDatasetPath("pool/sink/fs")
+	require.NoError(t, err)
+	now := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+
+	t.Run("does_not_exist", func(t *testing.T) {
+		aside, err := renameAsideTarget(lp, &zfs.FilesystemPlaceholderState{FS: lp.ToString()}, now)
+		assert.NoError(t, err)
+		assert.Nil(t, aside)
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		ph := &zfs.FilesystemPlaceholderState{FS: lp.ToString(), FSExists: true, IsPlaceholder: true}
+		aside, err := renameAsideTarget(lp, ph, now)
+		assert.NoError(t, err)
+		assert.Nil(t, aside)
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		ph := &zfs.FilesystemPlaceholderState{FS: lp.ToString(), FSExists: true}
+		aside, err := renameAsideTarget(lp, ph, now)
+		require.NoError(t, err)
+		require.NotNil(t, aside)
+		assert.Equal(t, "pool/sink/fs_zrepl_conflict_20200304_050607", aside.ToString())
+	})
+}
@@ -0,0 +1,107 @@
+package endpoint
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// Rollback rolls the receiver's filesystem back to the snapshot req.To ('zfs rollback -r'),
+// which resolves a conflict with the sender whose most recent common snapshot is req.To.
+// Unlike destroying the more recent snapshots, this also reverts modifications of the filesystem's data.
+func (s *Receiver) Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	root, _, err := s.clientRootFromCtx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := subroot{root, s.conf.Mapping}.MapToLocal(req.GetFilesystem())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetTo() == nil {
+		return nil, errors.New("`To` must not be nil")
+	}
+
+	// a Sender with the same ReceiveTracker must not send lp while it is modified
+	endReceive, err := s.conf.ReceiveTracker.beginReceive(lp.ToString())
+	if err != nil {
+		return nil, err
+	}
+	defer endReceive()
+
+	local, err := zfs.ZFSListFilesystemVersions(ctx, lp, zfs.ListFilesystemVersionsOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot list filesystem versions")
+	}
+	to, destroyed, err := rollbackPlan(local, req.GetTo())
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.AppendOnly != nil {
+		if reason := s.conf.AppendOnly.refuseRollbackReason(destroyed, time.Now()); reason != "" {
+			getLogger(ctx).
+				WithField("fs", lp.ToString()).
+				WithField("to", to.RelName()).
+				WithField("reason", reason).
+				Warn("refusing to roll back filesystem on behalf of client")
+			prom.AppendOnlyDestroyRefused.WithLabelValues(s.conf.JobID.String()).Inc()
+			return nil, fmt.Errorf("refused by append-only receiver: %s", reason)
+		}
+	}
+
+	log := getLogger(ctx).WithField("fs", lp.ToString()).WithField("to", to.RelName())
+	if s.conf.UpdateLastReceivedHold {
+		// the last-received-hold is on the most recent received snapshot, which is destroyed
+		log.Debug("move last-received-hold")
+		if err := MoveLastReceivedHold(ctx, lp.ToString(), to, s.conf.JobID); err != nil {
+			return nil, errors.Wrap(err, "cannot move last-received-hold")
+		}
+	}
+	log.WithField("destroyed", len(destroyed)).Info("rolling back filesystem")
+	if err := zfs.ZFSRollback(ctx, lp, to, "-r"); err != nil {
+		return nil, errors.Wrap(err, "cannot roll back filesystem")
+	}
+	return &pdu.RollbackRes{}, nil
+}
+
+// rollbackPlan returns the local snapshot that corresponds to to
+// and the local versions that a rollback to it destroys.
+// The client's claims about to, except its GUID, are not trusted.
+func rollbackPlan(local []zfs.FilesystemVersion, to *pdu.FilesystemVersion) (target zfs.FilesystemVersion, destroyed []zfs.FilesystemVersion, err error) {
+	found := false
+	for _, v := range local {
+		if v.Type == zfs.Snapshot && v.Guid == to.GetGuid() {
+			target, found = v, true
+			break
+		}
+	}
+	if !found {
+		return target, nil, fmt.Errorf("cannot roll back to %q: no snapshot with guid %d", to.GetRelName(), to.GetGuid())
+	}
+	for _, v := range local {
+		if v.CreateTXG > target.CreateTXG {
+			destroyed = append(destroyed, v)
+		}
+	}
+	return target, destroyed, nil
+}
+
+// refuseRollbackReason returns why a rollback that destroys destroyed is refused,
+// or an empty string if it is allowed.
+// It is allowed if all destroyed snapshots may be destroyed, see refuseDestroyReason.
+func (c *AppendOnlyConfig) refuseRollbackReason(destroyed []zfs.FilesystemVersion, now time.Time) string {
+	for _, v := range destroyed {
+		if v.Type != zfs.Snapshot {
+			continue
+		}
+		if reason := c.refuseDestroyReason(v.Creation, true, now); reason != "" {
+			return fmt.Sprintf("cannot destroy %s: %s", v.RelName(), reason)
+		}
+	}
+	return ""
+}
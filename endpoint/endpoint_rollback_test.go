@@ -0,0 +1,42 @@
+package endpoint
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestRollbackPlan(t *testing.T) {
+	now := time.Now()
+	v := func(typ zfs.VersionType, name string, guid uint64, age time.Duration) zfs.FilesystemVersion {
+		return zfs.FilesystemVersion{Type: typ, Name: name, Guid: guid, CreateTXG: guid, Creation: now.Add(-age)}
+	}
+	day := 24 * time.Hour
+	a := v(zfs.Snapshot, "a", 1, 40*day)
+	aBookmark := v(zfs.Bookmark, "a", 1, 40*day)
+	x := v(zfs.Snapshot, "x", 2, 31*day)
+	y := v(zfs.Bookmark, "y", 3, 1*day)
+	z := v(zfs.Snapshot, "z", 4, 1*day)
+	local := []zfs.FilesystemVersion{aBookmark, a, x, y, z}
+
+	target, destroyed, err := rollbackPlan(local, &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "renamed", Guid: 1})
+	require.NoError(t, err)
+	assert.Equal(t, a, target)
+	assert.Equal(t, []zfs.FilesystemVersion{x, y, z}, destroyed)
+
+	_, _, err = rollbackPlan(local, &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Snapshot, Name: "unknown", Guid: 23})
+	assert.Error(t, err)
+	_, _, err = rollbackPlan([]zfs.FilesystemVersion{aBookmark, x}, &pdu.FilesystemVersion{Type: pdu.FilesystemVersion_Bookmark, Name: "a", Guid: 1})
+	assert.Error(t, err, "cannot roll back to a bookmark")
+
+	c := &AppendOnlyConfig{DestroyMinAge: 30 * day}
+	assert.Empty(t, c.refuseRollbackReason([]zfs.FilesystemVersion{x, y}, now), "bookmarks are not subject to destroy_min_age")
+	assert.Contains(t, c.refuseRollbackReason(destroyed, now), "@z")
+	assert.NotEmpty(t, (&AppendOnlyConfig{}).refuseRollbackReason([]zfs.FilesystemVersion{x}, now))
+	assert.Empty(t, (&AppendOnlyConfig{}).refuseRollbackReason(nil, now))
+}
@@ -0,0 +1,60 @@
+package endpoint
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type prefixSnapshotFilter string
+
+func (f prefixSnapshotFilter) Filter(snapshotName string) bool {
+	return strings.HasPrefix(snapshotName, string(f))
+}
+
+func TestSenderSnapshotFilterWithIntermediates(t *testing.T) {
+	v := func(typ zfs.VersionType, name string, txg uint64) zfs.FilesystemVersion {
+		return zfs.FilesystemVersion{Type: typ, Name: name, Guid: txg, CreateTXG: txg, Creation: time.Unix(int64(txg), 0)}
+	}
+	snaps := []zfs.FilesystemVersion{
+		v(zfs.Snapshot, "zrepl_1", 1),
+		v(zfs.Snapshot, "zrepl_2", 2),
+		v(zfs.Snapshot, "tmp-3", 3),
+		v(zfs.Snapshot, "zrepl_4", 4),
+		v(zfs.Snapshot, "zrepl_5", 5),
+	}
+	versions := append([]zfs.FilesystemVersion{v(zfs.Bookmark, "tmp-bookmark", 2)}, snaps...)
+	s := NewSender(SenderConfig{
+		FSF:            zfs.NoFilter(),
+		Encrypt:        &zfs.NilBool{B: false},
+		JobID:          MustMakeJobID("push"),
+		SnapshotFilter: prefixSnapshotFilter("zrepl_"),
+	})
+
+	res := s.filterVersions(versions)
+	var names []string
+	for _, v := range res.Versions {
+		names = append(names, v.RelName())
+	}
+	assert.Equal(t, []string{"#tmp-bookmark", "@zrepl_1", "@zrepl_2", "@zrepl_4", "@zrepl_5"}, names)
+	assert.Equal(t, []uint64{3}, res.ExcludedSnapshotCreateTXGs)
+
+	send := func(from, to int, intermediates bool) zfs.ZFSSendArgsValidated {
+		var a zfs.ZFSSendArgsValidated
+		a.FS = "pool/fs"
+		a.Intermediates = intermediates
+		a.FromVersion = &snaps[from]
+		a.ToVersion = snaps[to]
+		return a
+	}
+	assert.Error(t, s.checkSnapshotFilterVersions(send(0, 3, true), snaps), "-I across the excluded snapshot")
+	assert.Error(t, s.checkSnapshotFilterVersions(send(1, 2, false), snaps), "excluded snapshot as target")
+	// the steps the planner plans with ExcludedSnapshotCreateTXGs for step_strategy: batched
+	assert.NoError(t, s.checkSnapshotFilterVersions(send(0, 1, false), snaps))
+	assert.NoError(t, s.checkSnapshotFilterVersions(send(1, 3, false), snaps))
+	assert.NoError(t, s.checkSnapshotFilterVersions(send(3, 4, true), snaps))
+}
@@ -61,11 +61,16 @@ func (w *interval) ContextWithDeadlineAtEnd(ctx context.Context) (context.Contex
 type run struct {
 	l *chainlock.L
 
+	config Config
+
 	startedAt, finishedAt time.Time
 
 	waitReconnect      interval
 	waitReconnectError *timedError
 
+	// non-zero while waiting for the next attempt after a transient error
+	nextAttemptAt time.Time
+
 	// the attempts attempted so far:
 	// All but the last in this slice must have finished with some errors.
 	// The last attempt may not be finished and may not have errors.
@@ -80,6 +85,7 @@ type Planner interface {
 // an attempt represents a single planning & execution of fs replications
 type attempt struct {
 	planner Planner
+	config  Config
 
 	l *chainlock.L
 
@@ -89,6 +95,12 @@ type attempt struct {
 	// if both are nil, it must be assumed that Planner.Plan is active
 	planErr *timedError
 	fss     []*fs
+
+	// non-nil after planning succeeded, for reporting the step queue positions of fss
+	stepQueue *stepQueue
+
+	// updated by sampleThroughput
+	throughput report.ThroughputEstimator
 }
 
 type timedError struct {
@@ -141,6 +153,32 @@ type Step interface {
 	ReportInfo() *report.StepInfo
 }
 
+// RangeStep is implemented by Steps that replicate several snapshots at once.
+// If such a step fails midway, a subsequent attempt may continue it
+// with several steps, e.g., a resumable send & recv of the snapshot
+// that was interrupted, followed by a step for the rest of the range.
+type RangeStep interface {
+	Step
+	// Returns true iff other replicates a part of this step's range of snapshots.
+	// If it does, end is true iff other's target is this step's target.
+	//
+	// Implementations can assume that `other` is a step of the same filesystem,
+	// although maybe from a subsequent attempt.
+	Continues(other Step) (continues, end bool)
+}
+
+// continuesPrev returns true iff cur retries prev or continues a part of it.
+// If it does, end is true iff cur has prev's target.
+func continuesPrev(prev, cur Step) (continues, end bool) {
+	if prev.TargetEquals(cur) {
+		return true, true
+	}
+	if r, ok := prev.(RangeStep); ok {
+		return r.Continues(cur)
+	}
+	return false, false
+}
+
 type fs struct {
 	fs FS
 
@@ -161,11 +199,25 @@ type fs struct {
 		// if step >= len(steps), no more work needs to be done
 		step int
 	}
+
+	// true while fs holds a slot in the step queue, i.e., is planning or executing a step
+	active bool
+
+	// number of retries after transient errors within the attempt, see RetryPolicy.FilesystemRetries
+	retries int
+	// non-zero while waiting for the next retry
+	nextRetryAt time.Time
+
+	// updated by sampleThroughput
+	throughput report.ThroughputEstimator
 }
 
 type step struct {
 	l    *chainlock.L
 	step Step
+
+	// updated by sampleThroughput
+	throughput report.ThroughputEstimator
 }
 
 type ReportFunc func() *report.Report
@@ -173,16 +225,38 @@ type WaitFunc func(block bool) (done bool)
 
 var maxAttempts = envconst.Int64("ZREPL_REPLICATION_MAX_ATTEMPTS", 3)
 var reconnectHardFailTimeout = envconst.Duration("ZREPL_REPLICATION_RECONNECT_HARD_FAIL_TIMEOUT", 10*time.Minute)
+var throughputSampleInterval = envconst.Duration("ZREPL_REPLICATION_THROUGHPUT_SAMPLE_INTERVAL", 1*time.Second)
 
-func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
+type Config struct {
+	// maximum number of filesystems that are planned or replicated concurrently
+	StepQueueConcurrency int
+	Retry                RetryPolicy
+}
+
+func (c Config) Validate() error {
+	if c.StepQueueConcurrency < 1 {
+		return errors.New("StepQueueConcurrency must be >= 1")
+	}
+	if err := c.Retry.Validate(); err != nil {
+		return fmt.Errorf("invalid retry policy: %s", err)
+	}
+	return nil
+}
+
+func Do(ctx context.Context, config Config, planner Planner) (ReportFunc, WaitFunc) {
+	if err := config.Validate(); err != nil {
+		panic(err)
+	}
 	log := getLog(ctx)
 	l := chainlock.New()
 	run := &run{
 		l:         l,
+		config:    config,
 		startedAt: time.Now(),
 	}
 
 	done := make(chan struct{})
+	go run.sampleThroughput(done)
 	go func() {
 		defer close(done)
 
@@ -191,18 +265,21 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 		defer log.Debug("run ended")
 		var prev *attempt
 		mainLog := log
-		for ano := 0; ano < int(maxAttempts) || maxAttempts == 0; ano++ {
+		maxAttempts := config.Retry.maxAttempts()
+		for ano := 0; ano < maxAttempts || maxAttempts == 0; ano++ {
 			log := mainLog.WithField("attempt_number", ano)
 			log.Debug("start attempt")
 
 			run.waitReconnect.SetZero()
 			run.waitReconnectError = nil
+			run.nextAttemptAt = time.Time{}
 
 			// do current attempt
 			cur := &attempt{
 				l:         l,
 				startedAt: time.Now(),
 				planner:   planner,
+				config:    config,
 			}
 			run.attempts = append(run.attempts, cur)
 			run.l.DropWhile(func() {
@@ -232,6 +309,24 @@ func Do(ctx context.Context, planner Planner) (ReportFunc, WaitFunc) {
 				break
 			}
 			log.WithError(mostRecentErr.Err).Error("most recent error in this attempt")
+			if mostRecentErrClass == errorClassTransient {
+				if ano+1 == maxAttempts {
+					log.Error("transient error identified, but maximum number of attempts reached, aborting run")
+					return
+				}
+				backoff := config.Retry.backoff(ano + 1)
+				run.nextAttemptAt = time.Now().Add(backoff)
+				log.WithField("next_attempt_at", run.nextAttemptAt).Error("transient error identified, start next attempt after backoff")
+				var sleepErr error
+				run.l.DropWhile(func() {
+					sleepErr = sleepContext(ctx, backoff)
+				})
+				if sleepErr != nil {
+					log.WithError(sleepErr).Info("context error")
+					return
+				}
+				continue
+			}
 			shouldReconnect := mostRecentErrClass == errorClassTemporaryConnectivityRelated
 			log.WithField("reconnect_decision", shouldReconnect).Debug("reconnect decision made")
 			if shouldReconnect {
@@ -355,13 +450,14 @@ func (a *attempt) do(ctx context.Context, prev *attempt) {
 	// invariant: prevs contains an entry for each unambiguous correspondence
 
 	stepQueue := newStepQueue()
-	defer stepQueue.Start(1)() // TODO parallel replication
+	a.stepQueue = stepQueue
+	defer stepQueue.Start(a.config.StepQueueConcurrency)()
 	var fssesDone sync.WaitGroup
 	for _, f := range a.fss {
 		fssesDone.Add(1)
 		go func(f *fs) {
 			defer fssesDone.Done()
-			f.do(ctx, stepQueue, prevs[f])
+			f.do(ctx, stepQueue, prevs[f], a.config.Retry)
 		}(f)
 	}
 	a.l.DropWhile(func() {
@@ -370,10 +466,50 @@ func (a *attempt) do(ctx context.Context, prev *attempt) {
 	a.finishedAt = time.Now()
 }
 
-func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
+// do plans and executes the steps of fs and retries according to retry
+func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs, retry RetryPolicy) {
 
 	defer fs.l.Lock().Unlock()
 
+	for {
+		fs.doTry(ctx, pq, prev)
+
+		err := fs.planning.err
+		if err == nil {
+			err = fs.planned.stepErr
+		}
+		if err == nil || ctx.Err() != nil || fs.retries >= retry.FilesystemRetries || !retry.isTransient(err.Err) {
+			return
+		}
+
+		fs.retries++
+		backoff := retry.backoff(fs.retries)
+		fs.nextRetryAt = time.Now().Add(backoff)
+		debug("fs=%s: transient error, retry %d/%d at %s: %s", fs.fs.ReportInfo().Name, fs.retries, retry.FilesystemRetries, fs.nextRetryAt, err.Err)
+		var sleepErr error
+		fs.l.DropWhile(func() {
+			sleepErr = sleepContext(ctx, backoff)
+		})
+		fs.nextRetryAt = time.Time{}
+		if sleepErr != nil {
+			return
+		}
+
+		// Re-plan because the failed step may have made partial progress, e.g., a resumable receive.
+		// If steps were planned, the retry must not replicate beyond the targets of the failed try.
+		if fs.planning.err == nil {
+			failedTry := *fs
+			prev = &failedTry
+		}
+		fs.planning.done, fs.planning.err = false, nil
+		fs.planned.stepErr, fs.planned.steps, fs.planned.step = nil, nil, 0
+	}
+}
+
+// doTry is a single try of fs.do.
+// caller must hold lock l
+func (fs *fs) doTry(ctx context.Context, pq *stepQueue, prev *fs) {
+
 	// get planned steps from replication logic
 	var psteps []Step
 	var errTime time.Time
@@ -382,7 +518,7 @@ func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 		// TODO hacky
 		// choose target time that is earlier than any snapshot, so fs planning is always prioritized
 		targetDate := time.Unix(0, 0)
-		defer pq.WaitReady(fs, targetDate)()
+		defer fs.waitReady(pq, targetDate)()
 		psteps, err = fs.fs.PlanFS(ctx) // no shadow
 		errTime = time.Now()            // no shadow
 	})
@@ -415,8 +551,8 @@ func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 		}
 		prevFailed := prevUncompleted[0]
 		curFirst := fs.planned.steps[0]
-		// we assume that PlanFS retries prevFailed (using curFirst)
-		if !prevFailed.step.TargetEquals(curFirst.step) {
+		// we assume that PlanFS retries or continues prevFailed (using curFirst)
+		if continues, _ := continuesPrev(prevFailed.step, curFirst.step); !continues {
 			debug("Targets don't match")
 			// Two options:
 			// A: planning algorithm is broken
@@ -437,16 +573,17 @@ func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 			return
 		}
 		// only allow until step targets diverge
-		min := len(prevUncompleted)
-		if min > len(fs.planned.steps) {
-			min = len(fs.planned.steps)
-		}
+		// (several steps may continue one of prevUncompleted, see RangeStep)
 		diverge := 0
-		for ; diverge < min; diverge++ {
+		for prevIdx := 0; diverge < len(fs.planned.steps) && prevIdx < len(prevUncompleted); diverge++ {
 			debug("diverge compare iteration %d", diverge)
-			if !fs.planned.steps[diverge].step.TargetEquals(prevUncompleted[diverge].step) {
+			continues, end := continuesPrev(prevUncompleted[prevIdx].step, fs.planned.steps[diverge].step)
+			if !continues {
 				break
 			}
+			if end {
+				prevIdx++
+			}
 		}
 		debug("diverge is %d", diverge)
 		fs.planned.steps = fs.planned.steps[0:diverge]
@@ -461,7 +598,7 @@ func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 		// lock must not be held while executing step in order for reporting to work
 		fs.l.DropWhile(func() {
 			targetDate := s.step.TargetDate()
-			defer pq.WaitReady(fs, targetDate)()
+			defer fs.waitReady(pq, targetDate)()
 			err = s.step.Step(ctx) // no shadow
 			errTime = time.Now()   // no shadow
 		})
@@ -473,6 +610,64 @@ func (fs *fs) do(ctx context.Context, pq *stepQueue, prev *fs) {
 	}
 }
 
+// waitReady is pq.WaitReady that also maintains fs.active for reporting.
+// caller must not hold lock l
+func (fs *fs) waitReady(pq *stepQueue, targetDate time.Time) StepCompletedFunc {
+	completed := pq.WaitReady(fs, fs.fs.ReportInfo().Priority, targetDate)
+	defer fs.l.Lock().Unlock()
+	fs.active = true
+	return func() {
+		defer fs.l.Lock().Unlock()
+		fs.active = false
+		completed()
+	}
+}
+
+// sampleThroughput updates the throughput estimators of the current attempt
+// every throughputSampleInterval until done is closed.
+func (r *run) sampleThroughput(done <-chan struct{}) {
+	t := time.NewTicker(throughputSampleInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-t.C:
+			r.l.Lock()
+			if len(r.attempts) > 0 {
+				r.attempts[len(r.attempts)-1].sampleThroughput(now)
+			}
+			r.l.Unlock()
+		}
+	}
+}
+
+// caller must hold lock l
+func (a *attempt) sampleThroughput(now time.Time) {
+	if !a.finishedAt.IsZero() {
+		return
+	}
+	var replicated int64
+	for _, f := range a.fss {
+		replicated += f.sampleThroughput(now)
+	}
+	a.throughput.Update(now, replicated)
+}
+
+// returns the number of bytes replicated by f's steps
+// caller must hold lock l
+func (f *fs) sampleThroughput(now time.Time) (replicated int64) {
+	for i, s := range f.planned.steps {
+		bytes := s.step.ReportInfo().BytesReplicated
+		if i == f.planned.step {
+			s.throughput.Update(now, bytes)
+		}
+		replicated += bytes
+	}
+	f.throughput.Update(now, replicated)
+	return replicated
+}
+
 // caller must hold lock l
 func (r *run) report() *report.Report {
 	report := &report.Report{
@@ -482,6 +677,7 @@ func (r *run) report() *report.Report {
 		WaitReconnectSince: r.waitReconnect.begin,
 		WaitReconnectUntil: r.waitReconnect.end,
 		WaitReconnectError: r.waitReconnectError.IntoReportError(),
+		NextAttemptAt:      r.nextAttemptAt,
 	}
 	for i := range report.Attempts {
 		report.Attempts[i] = r.attempts[i].report()
@@ -500,8 +696,13 @@ func (a *attempt) report() *report.AttemptReport {
 		PlanError:   a.planErr.IntoReportError(),
 	}
 
+	var queuePositions map[interface{}]int
+	if a.stepQueue != nil {
+		queuePositions = a.stepQueue.Positions()
+	}
 	for i := range r.Filesystems {
 		r.Filesystems[i] = a.fss[i].report()
+		r.Filesystems[i].QueuePosition = queuePositions[a.fss[i]]
 	}
 
 	state := report.AttemptPlanning
@@ -523,6 +724,11 @@ func (a *attempt) report() *report.AttemptReport {
 	}
 	r.State = state
 
+	if state == report.AttemptFanOutFSs {
+		expected, replicated, _ := r.BytesSum()
+		r.Throughput = a.throughput.Report(expected, replicated)
+	}
+
 	return r
 }
 
@@ -549,10 +755,19 @@ func (f *fs) report() *report.FilesystemReport {
 		StepError:   f.planned.stepErr.IntoReportError(),
 		Steps:       make([]*report.StepReport, len(f.planned.steps)),
 		CurrentStep: f.planned.step,
+		Active:      f.active,
+		Retries:     f.retries,
+		NextRetryAt: f.nextRetryAt,
 	}
 	for i := range r.Steps {
 		r.Steps[i] = f.planned.steps[i].report()
 	}
+	if state == report.FilesystemStepping {
+		expected, replicated, _ := r.BytesSum()
+		r.Throughput = f.throughput.Report(expected, replicated)
+		cur := r.Steps[f.planned.step]
+		cur.Throughput = f.planned.steps[f.planned.step].throughput.Report(cur.Info.BytesExpected, cur.Info.BytesReplicated)
+	}
 	return r
 }
 
@@ -570,6 +785,7 @@ type errorClass int
 const (
 	errorClassPermanent errorClass = iota
 	errorClassTemporaryConnectivityRelated
+	errorClassTransient // see RetryPolicy.TransientErrors
 )
 
 type errorReport struct {
@@ -612,6 +828,10 @@ func (a *attempt) errorReport() *errorReport {
 				putClass(err, errorClassTemporaryConnectivityRelated)
 				continue
 			}
+			if a.config.Retry.isTransient(err.Err) {
+				putClass(err, errorClassTransient)
+				continue
+			}
 			putClass(err, errorClassPermanent)
 		}
 		for _, errs := range r.byClass {
@@ -643,3 +863,15 @@ func (r *errorReport) MostRecent() (err *timedError, errClass errorClass) {
 	}
 	return
 }
+
+// sleepContext returns ctx.Err() if ctx is done before d has passed
+func sleepContext(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
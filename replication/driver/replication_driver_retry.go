@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// DefaultTransientErrors is used for RetryPolicy.TransientErrors if it is nil.
+var DefaultTransientErrors = []string{
+	"dataset is busy",
+	// endpoint.FilesystemSendingError and endpoint.FilesystemReceivingError (cascading replication)
+	"is currently being sent, try again later",
+	"is currently being received into, try again later",
+}
+
+// RetryPolicy determines how a run retries after transient errors,
+// i.e., errors that are likely to disappear without intervention.
+// Connectivity-related errors are handled separately by waiting for
+// reconnection (see Planner.WaitForConnectivity).
+//
+// The zero value uses ZREPL_REPLICATION_MAX_ATTEMPTS, DefaultTransientErrors,
+// does not retry filesystems and does not back off between attempts.
+type RetryPolicy struct {
+	// Maximum number of attempts of a run, 0 means ZREPL_REPLICATION_MAX_ATTEMPTS.
+	MaxAttempts int
+	// Errors whose message contains one of these strings are transient.
+	// nil means DefaultTransientErrors.
+	TransientErrors []string
+	// Number of times that the planning or a step of a filesystem that failed with a
+	// transient error is retried within the same attempt before the attempt fails.
+	FilesystemRetries int
+	// The backoff before the n-th retry of a filesystem or the n-th subsequent attempt
+	// is InitialBackoff * 2^(n-1), at most MaxBackoff, randomized by +/- 20%.
+	InitialBackoff, MaxBackoff time.Duration
+}
+
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return errors.New("MaxAttempts must not be negative")
+	}
+	if p.FilesystemRetries < 0 {
+		return errors.New("FilesystemRetries must not be negative")
+	}
+	if p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.New("backoff must not be negative")
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		return errors.New("MaxBackoff must not be less than InitialBackoff")
+	}
+	return nil
+}
+
+func (p RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts == 0 {
+		return int(maxAttempts)
+	}
+	return p.MaxAttempts
+}
+
+func (p RetryPolicy) isTransient(err error) bool {
+	transient := p.TransientErrors
+	if transient == nil {
+		transient = DefaultTransientErrors
+	}
+	msg := err.Error()
+	for _, t := range transient {
+		if strings.Contains(msg, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns the backoff before the n-th retry, n >= 1
+func (p RetryPolicy) backoff(n int) time.Duration {
+	if n < 1 {
+		panic("n must be >= 1")
+	}
+	d := p.InitialBackoff
+	for i := 1; i < n && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	jitter := (rand.Float64()*0.4 - 0.2) * float64(d)
+	return d + time.Duration(jitter)
+}
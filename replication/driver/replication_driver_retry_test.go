@@ -0,0 +1,239 @@
+package driver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/report"
+)
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 10 * time.Second, MaxBackoff: time.Minute}
+	within := func(t *testing.T, d, exp time.Duration) {
+		assert.True(t, d >= exp*8/10 && d <= exp*12/10, "%s not within 20%% of %s", d, exp)
+	}
+	within(t, p.backoff(1), 10*time.Second)
+	within(t, p.backoff(2), 20*time.Second)
+	within(t, p.backoff(3), 40*time.Second)
+	within(t, p.backoff(4), time.Minute)
+	within(t, p.backoff(100), time.Minute)
+
+	assert.Equal(t, time.Duration(0), RetryPolicy{}.backoff(3))
+}
+
+func TestRetryPolicyIsTransient(t *testing.T) {
+	busy := errors.New("cannot receive incremental stream: dataset is busy")
+	assert.True(t, RetryPolicy{}.isTransient(busy))
+	assert.False(t, RetryPolicy{}.isTransient(errors.New("destination has been modified")))
+	assert.True(t, RetryPolicy{}.isTransient(errors.New(`filesystem "pool/sink/a" is currently being sent, try again later`)))
+	assert.True(t, RetryPolicy{}.isTransient(errors.New(`filesystem "pool/sink/a" is currently being received into, try again later`)))
+
+	custom := RetryPolicy{TransientErrors: []string{"has been modified"}}
+	assert.False(t, custom.isTransient(busy))
+	assert.True(t, custom.isTransient(errors.New("destination has been modified")))
+
+	assert.False(t, RetryPolicy{TransientErrors: []string{}}.isTransient(busy))
+}
+
+type retryMockPlanner struct {
+	fs *retryMockFS
+}
+
+func (p *retryMockPlanner) Plan(ctx context.Context) ([]FS, error) { return []FS{p.fs}, nil }
+
+func (p *retryMockPlanner) WaitForConnectivity(context.Context) error { return nil }
+
+// retryMockFS plans a single step that fails with the errors in stepErrs, in order, then succeeds.
+type retryMockFS struct {
+	stepErrs []error
+	plans    int
+}
+
+func (f *retryMockFS) EqualToPreviousAttempt(other FS) bool { return true }
+
+func (f *retryMockFS) PlanFS(ctx context.Context) ([]Step, error) {
+	f.plans++
+	return []Step{&retryMockStep{f}}, nil
+}
+
+func (f *retryMockFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: "zroot/flaky"}
+}
+
+type retryMockStep struct {
+	fs *retryMockFS
+}
+
+func (s *retryMockStep) TargetEquals(other Step) bool { return true }
+
+func (s *retryMockStep) TargetDate() time.Time { return time.Unix(1, 0) }
+
+func (s *retryMockStep) Step(ctx context.Context) error {
+	if len(s.fs.stepErrs) == 0 {
+		return nil
+	}
+	err := s.fs.stepErrs[0]
+	s.fs.stepErrs = s.fs.stepErrs[1:]
+	return err
+}
+
+func (s *retryMockStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "@a", To: "@b"}
+}
+
+func TestFilesystemRetry(t *testing.T) {
+	busy := errors.New("dataset is busy")
+
+	run := func(t *testing.T, retry RetryPolicy, stepErrs ...error) (*retryMockFS, *report.Report) {
+		fs := &retryMockFS{stepErrs: stepErrs}
+		getReport, wait := Do(context.Background(), Config{StepQueueConcurrency: 1, Retry: retry}, &retryMockPlanner{fs})
+		wait(true)
+		return fs, getReport()
+	}
+
+	t.Run("retried_within_attempt", func(t *testing.T) {
+		fs, rep := run(t, RetryPolicy{MaxAttempts: 1, FilesystemRetries: 2, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, busy, busy)
+		require.Len(t, rep.Attempts, 1)
+		assert.Equal(t, report.AttemptDone, rep.Attempts[0].State)
+		assert.Equal(t, 2, rep.Attempts[0].Filesystems[0].Retries)
+		assert.True(t, rep.Attempts[0].Filesystems[0].NextRetryAt.IsZero())
+		assert.Equal(t, 3, fs.plans)
+	})
+
+	t.Run("retries_exhausted_new_attempt", func(t *testing.T) {
+		_, rep := run(t, RetryPolicy{MaxAttempts: 2, FilesystemRetries: 1, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}, busy, busy)
+		require.Len(t, rep.Attempts, 2)
+		assert.Equal(t, report.AttemptFanOutError, rep.Attempts[0].State)
+		assert.Equal(t, report.AttemptDone, rep.Attempts[1].State)
+		assert.True(t, rep.NextAttemptAt.IsZero())
+	})
+
+	t.Run("permanent_error_not_retried", func(t *testing.T) {
+		fs, rep := run(t, RetryPolicy{MaxAttempts: 3, FilesystemRetries: 3}, errors.New("permission denied"))
+		require.Len(t, rep.Attempts, 1)
+		assert.Equal(t, report.AttemptFanOutError, rep.Attempts[0].State)
+		assert.Equal(t, 0, rep.Attempts[0].Filesystems[0].Retries)
+		assert.Equal(t, 1, fs.plans)
+	})
+}
+
+// rangeMockFS returns the steps in plans, in order, one list per planning.
+type rangeMockFS struct {
+	plans    [][]*rangeMockStep
+	executed []string
+}
+
+func (f *rangeMockFS) EqualToPreviousAttempt(other FS) bool { return true }
+
+func (f *rangeMockFS) PlanFS(ctx context.Context) ([]Step, error) {
+	var steps []Step
+	for _, s := range f.plans[0] {
+		s.fs = f
+		steps = append(steps, s)
+	}
+	f.plans = f.plans[1:]
+	return steps, nil
+}
+
+func (f *rangeMockFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: "zroot/batched"}
+}
+
+type rangeMockPlanner struct {
+	fs *rangeMockFS
+}
+
+func (p *rangeMockPlanner) Plan(ctx context.Context) ([]FS, error) { return []FS{p.fs}, nil }
+
+func (p *rangeMockPlanner) WaitForConnectivity(context.Context) error { return nil }
+
+// rangeMockStep replicates snapshots[from] to snapshots[to] of the single-letter snapshots "abcdef"
+type rangeMockStep struct {
+	fs       *rangeMockFS
+	from, to int
+	err      error
+}
+
+var _ RangeStep = (*rangeMockStep)(nil)
+
+func (s *rangeMockStep) TargetEquals(other Step) bool {
+	o := other.(*rangeMockStep)
+	return s.from == o.from && s.to == o.to
+}
+
+func (s *rangeMockStep) Continues(other Step) (continues, end bool) {
+	o := other.(*rangeMockStep)
+	if o.from < s.from || o.to > s.to {
+		return false, false
+	}
+	return true, o.to == s.to
+}
+
+func (s *rangeMockStep) TargetDate() time.Time { return time.Unix(int64(s.to), 0) }
+
+func (s *rangeMockStep) Step(ctx context.Context) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.fs.executed = append(s.fs.executed, s.String())
+	return nil
+}
+
+func (s *rangeMockStep) String() string {
+	return fmt.Sprintf("@%c=>@%c", "abcdef"[s.from], "abcdef"[s.to])
+}
+
+func (s *rangeMockStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "@" + string("abcdef"[s.from]), To: "@" + string("abcdef"[s.to])}
+}
+
+func TestRangeStepContinuedByRetry(t *testing.T) {
+	busy := errors.New("dataset is busy")
+	retry := RetryPolicy{MaxAttempts: 1, FilesystemRetries: 1}
+
+	run := func(t *testing.T, plans ...[]*rangeMockStep) (*rangeMockFS, *report.FilesystemReport) {
+		fs := &rangeMockFS{plans: plans}
+		getReport, wait := Do(context.Background(), Config{StepQueueConcurrency: 1, Retry: retry}, &rangeMockPlanner{fs})
+		wait(true)
+		rep := getReport()
+		require.Len(t, rep.Attempts, 1)
+		require.Len(t, rep.Attempts[0].Filesystems, 1)
+		return fs, rep.Attempts[0].Filesystems[0]
+	}
+
+	t.Run("continued_up_to_the_original_target", func(t *testing.T) {
+		// the batched step @a=>@d fails while receiving @c,
+		// the retry resumes @b=>@c, then replicates the rest of the range,
+		// but not @e, which was created in the meantime
+		fs, rep := run(t,
+			[]*rangeMockStep{{from: 0, to: 3, err: busy}},
+			[]*rangeMockStep{{from: 1, to: 2}, {from: 2, to: 3}, {from: 3, to: 4}},
+		)
+		assert.Equal(t, report.FilesystemDone, rep.State)
+		assert.Equal(t, []string{"@b=>@c", "@c=>@d"}, fs.executed)
+	})
+
+	t.Run("continued_then_next_step", func(t *testing.T) {
+		fs, rep := run(t,
+			[]*rangeMockStep{{from: 0, to: 3, err: busy}, {from: 3, to: 4}},
+			[]*rangeMockStep{{from: 2, to: 3}, {from: 3, to: 4}, {from: 4, to: 5}},
+		)
+		assert.Equal(t, report.FilesystemDone, rep.State)
+		assert.Equal(t, []string{"@c=>@d", "@d=>@e"}, fs.executed)
+	})
+
+	t.Run("not_part_of_the_range", func(t *testing.T) {
+		fs, rep := run(t,
+			[]*rangeMockStep{{from: 1, to: 3, err: busy}},
+			[]*rangeMockStep{{from: 0, to: 1}, {from: 1, to: 3}},
+		)
+		assert.Equal(t, report.FilesystemSteppingErrored, rep.State)
+		assert.Empty(t, fs.executed)
+	})
+}
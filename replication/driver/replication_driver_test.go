@@ -151,7 +151,7 @@ func TestReplication(t *testing.T) {
 	ctx := context.Background()
 
 	mp := &mockPlanner{}
-	getReport, wait := Do(ctx, mp)
+	getReport, wait := Do(ctx, Config{StepQueueConcurrency: 1}, mp)
 	begin := time.Now()
 	fireAt := []time.Duration{
 		// the following values are relative to the start
@@ -214,3 +214,113 @@ func TestReplication(t *testing.T) {
 	}
 
 }
+
+// blockingPlanner plans filesystems with one step each.
+// The steps signal on started and block until release is closed.
+type blockingPlanner struct {
+	fss     []string
+	started chan string
+	release chan struct{}
+}
+
+func (p *blockingPlanner) Plan(ctx context.Context) ([]FS, error) {
+	fss := make([]FS, len(p.fss))
+	for i, name := range p.fss {
+		fss[i] = &blockingFS{p, name}
+	}
+	return fss, nil
+}
+
+func (p *blockingPlanner) WaitForConnectivity(context.Context) error {
+	return nil
+}
+
+type blockingFS struct {
+	p    *blockingPlanner
+	name string
+}
+
+func (f *blockingFS) EqualToPreviousAttempt(other FS) bool {
+	return f.name == other.(*blockingFS).name
+}
+
+func (f *blockingFS) PlanFS(ctx context.Context) ([]Step, error) {
+	return []Step{&blockingStep{f}}, nil
+}
+
+func (f *blockingFS) ReportInfo() *report.FilesystemInfo {
+	return &report.FilesystemInfo{Name: f.name}
+}
+
+type blockingStep struct {
+	fs *blockingFS
+}
+
+func (s *blockingStep) Step(ctx context.Context) error {
+	s.fs.p.started <- s.fs.name
+	<-s.fs.p.release
+	return nil
+}
+
+func (s *blockingStep) TargetEquals(other Step) bool {
+	return true
+}
+
+func (s *blockingStep) TargetDate() time.Time {
+	return time.Unix(1, 0)
+}
+
+func (s *blockingStep) ReportInfo() *report.StepInfo {
+	return &report.StepInfo{From: "a", To: "b"}
+}
+
+func TestReplicationConcurrentSteps(t *testing.T) {
+
+	ctx := context.Background()
+
+	p := &blockingPlanner{
+		fss:     []string{"zroot/one", "zroot/two", "zroot/three"},
+		started: make(chan string, 3),
+		release: make(chan struct{}),
+	}
+	getReport, wait := Do(ctx, Config{StepQueueConcurrency: 2}, p)
+
+	// both steps must be running at the same time because neither returns before release is closed
+	started := map[string]bool{}
+	for len(started) < 2 {
+		select {
+		case fs := <-p.started:
+			started[fs] = true
+		case <-time.After(10 * time.Second):
+			t.Fatalf("steps did not run concurrently, started: %v", started)
+		}
+	}
+	rep := getReport()
+	require.Len(t, rep.Attempts, 1)
+	fss := rep.Attempts[0].Filesystems
+	require.Len(t, fss, 3)
+	active := 0
+	for _, fs := range fss {
+		if fs.Active {
+			active++
+			assert.True(t, started[fs.Info.Name], "%s", fs.Info.Name)
+			assert.Equal(t, report.FilesystemStepping, fs.State, "%s", fs.Info.Name)
+		}
+	}
+	assert.Equal(t, 2, active)
+	// the third step must wait for one of the running steps
+	select {
+	case fs := <-p.started:
+		t.Fatalf("step of %s started while the step queue was full", fs)
+	default:
+	}
+
+	close(p.release)
+	wait(true)
+	rep = getReport()
+	assert.Equal(t, report.AttemptDone, rep.Attempts[0].State)
+	for _, fs := range rep.Attempts[0].Filesystems {
+		assert.False(t, fs.Active, "%s", fs.Info.Name)
+		assert.Equal(t, report.FilesystemDone, fs.State, "%s", fs.Info.Name)
+	}
+}
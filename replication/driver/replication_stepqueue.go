@@ -2,29 +2,54 @@ package driver
 
 import (
 	"container/heap"
+	"sort"
 	"time"
 
 	"github.com/zrepl/zrepl/util/chainlock"
+	"github.com/zrepl/zrepl/util/envconst"
 )
 
+// The effective priority of a waiting step increases by one for each
+// stepQueuePriorityAgingInterval that it has been waiting, so that steps of
+// low-priority filesystems are not starved by those of high-priority filesystems.
+var stepQueuePriorityAgingInterval = envconst.Duration("ZREPL_REPLICATION_PRIORITY_AGING_INTERVAL", 10*time.Minute)
+
 type stepQueueRec struct {
 	ident      interface{}
+	priority   int
 	targetDate time.Time
+	enqueuedAt time.Time
 	wakeup     chan StepCompletedFunc
 }
 
 type stepQueue struct {
 	stop chan struct{}
 	reqs chan stepQueueRec
+
+	agingInterval time.Duration
+
+	// l protects pending and queueItems
+	l *chainlock.L
+	// priority queue
+	pending *stepQueueHeap
+	// ident => queueItem
+	queueItems map[interface{}]*stepQueueHeapItem
 }
 
 type stepQueueHeapItem struct {
 	idx int
 	req stepQueueRec
+
+	// updated by stepQueueHeap.updateEffectivePriorities
+	effectivePriority int
 }
 type stepQueueHeap []*stepQueueHeapItem
 
+// higher effective priority first, then older target date first
 func (h stepQueueHeap) Less(i, j int) bool {
+	if h[i].effectivePriority != h[j].effectivePriority {
+		return h[i].effectivePriority > h[j].effectivePriority
+	}
 	return h[i].req.targetDate.Before(h[j].req.targetDate)
 }
 
@@ -51,11 +76,23 @@ func (h *stepQueueHeap) Pop() interface{} {
 	return elem
 }
 
+// The effective priorities of all items change over time, and not uniformly.
+// Hence, the heap must be re-initialized after calling this method.
+func (h stepQueueHeap) updateEffectivePriorities(now time.Time, agingInterval time.Duration) {
+	for _, item := range h {
+		item.effectivePriority = item.req.priority + int(now.Sub(item.req.enqueuedAt)/agingInterval)
+	}
+}
+
 // returned stepQueue must be closed with method Close
 func newStepQueue() *stepQueue {
 	q := &stepQueue{
-		stop: make(chan struct{}),
-		reqs: make(chan stepQueueRec),
+		stop:          make(chan struct{}),
+		reqs:          make(chan stepQueueRec),
+		agingInterval: stepQueuePriorityAgingInterval,
+		l:             chainlock.New(),
+		pending:       &stepQueueHeap{},
+		queueItems:    make(map[interface{}]*stepQueueHeapItem),
 	}
 	return q
 }
@@ -69,13 +106,8 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 	if concurrency < 1 {
 		panic("concurrency must be >= 1")
 	}
-	// l protects pending and queueItems
-	l := chainlock.New()
+	l, pending, queueItems := q.l, q.pending, q.queueItems
 	pendingCond := l.NewCond()
-	// priority queue
-	pending := &stepQueueHeap{}
-	// ident => queueItem
-	queueItems := make(map[interface{}]*stepQueueHeapItem)
 	// stopped is used for cancellation of "wake" goroutine
 	stopped := false
 	active := 0
@@ -125,6 +157,8 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 				return
 			}
 			active++
+			pending.updateEffectivePriorities(time.Now(), q.agingInterval)
+			heap.Init(pending)
 			next := heap.Pop(pending).(*stepQueueHeapItem).req
 			delete(queueItems, next.ident)
 
@@ -144,20 +178,38 @@ func (q *stepQueue) Start(concurrency int) (done func()) {
 
 type StepCompletedFunc func()
 
-func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, targetDate time.Time) StepCompletedFunc {
+func (q *stepQueue) sendAndWaitForWakeup(ident interface{}, priority int, targetDate time.Time) StepCompletedFunc {
 	req := stepQueueRec{
 		ident,
+		priority,
 		targetDate,
+		time.Now(),
 		make(chan StepCompletedFunc),
 	}
 	q.reqs <- req
 	return <-req.wakeup
 }
 
-// Wait for the ident with targetDate to be selected to run.
-func (q *stepQueue) WaitReady(ident interface{}, targetDate time.Time) StepCompletedFunc {
+// Wait for the ident with priority and targetDate to be selected to run.
+// Idents with higher priority are selected first, then those with older targetDate.
+func (q *stepQueue) WaitReady(ident interface{}, priority int, targetDate time.Time) StepCompletedFunc {
 	if targetDate.IsZero() {
 		panic("targetDate of zero is reserved for marking Done")
 	}
-	return q.sendAndWaitForWakeup(ident, targetDate)
+	return q.sendAndWaitForWakeup(ident, priority, targetDate)
+}
+
+// Positions returns the order in which the currently waiting idents would be
+// selected to run, as a position starting at 1 for each ident.
+func (q *stepQueue) Positions() map[interface{}]int {
+	defer q.l.Lock().Unlock()
+	q.pending.updateEffectivePriorities(time.Now(), q.agingInterval)
+	sorted := make(stepQueueHeap, len(*q.pending))
+	copy(sorted, *q.pending)
+	sort.Slice(sorted, sorted.Less)
+	positions := make(map[interface{}]int, len(sorted))
+	for i, item := range sorted {
+		positions[item.req.ident] = i + 1
+	}
+	return positions
 }
@@ -22,7 +22,7 @@ func TestPqNotconcurrent(t *testing.T) {
 	wg.Add(4)
 	go func() {
 		defer wg.Done()
-		defer q.WaitReady("1", time.Unix(9999, 0))()
+		defer q.WaitReady("1", 0, time.Unix(9999, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(1), ret)
 		time.Sleep(1 * time.Second)
@@ -35,19 +35,19 @@ func TestPqNotconcurrent(t *testing.T) {
 	// while "1" is still running, queue in "2", "3" and "4"
 	go func() {
 		defer wg.Done()
-		defer q.WaitReady("2", time.Unix(2, 0))()
+		defer q.WaitReady("2", 0, time.Unix(2, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(2), ret)
 	}()
 	go func() {
 		defer wg.Done()
-		defer q.WaitReady("3", time.Unix(3, 0))()
+		defer q.WaitReady("3", 0, time.Unix(3, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(3), ret)
 	}()
 	go func() {
 		defer wg.Done()
-		defer q.WaitReady("4", time.Unix(4, 0))()
+		defer q.WaitReady("4", 0, time.Unix(4, 0))()
 		ret := atomic.AddUint32(&ctr, 1)
 		assert.Equal(t, uint32(4), ret)
 	}()
@@ -95,7 +95,7 @@ func TestPqConcurrent(t *testing.T) {
 			for step := 0; step < stepsPerFS; step++ {
 				pos := atomic.AddUint32(&globalCtr, 1)
 				t := time.Unix(int64(step), 0)
-				done := q.WaitReady(fs, t)
+				done := q.WaitReady(fs, 0, t)
 				wakeAt := time.Since(begin)
 				time.Sleep(sleepTimePerStep)
 				done()
@@ -175,3 +175,55 @@ func TestPqConcurrent(t *testing.T) {
 	}
 
 }
+
+func TestPqPriority(t *testing.T) {
+
+	type testCase struct {
+		name          string
+		agingInterval time.Duration
+		// low is enqueued before high, and high after lowHeadStart
+		lowHeadStart  time.Duration
+		expectedOrder []string
+	}
+
+	tcs := []testCase{
+		{"priority_before_target_date", time.Hour, 100 * time.Millisecond, []string{"high", "low"}},
+		{"aging_prevents_starvation", 50 * time.Millisecond, 400 * time.Millisecond, []string{"low", "high"}},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newStepQueue()
+			q.agingInterval = tc.agingInterval
+			defer q.Start(1)()
+
+			blockerDone := q.WaitReady("blocker", 0, time.Unix(1, 0))
+
+			var mtx sync.Mutex
+			var order []string
+			var wg sync.WaitGroup
+			wg.Add(2)
+			enqueue := func(ident string, priority int, targetDate time.Time) {
+				defer wg.Done()
+				defer q.WaitReady(ident, priority, targetDate)()
+				mtx.Lock()
+				defer mtx.Unlock()
+				order = append(order, ident)
+			}
+			go enqueue("low", 0, time.Unix(2, 0))
+			time.Sleep(tc.lowHeadStart)
+			go enqueue("high", 2, time.Unix(3, 0))
+			time.Sleep(100 * time.Millisecond)
+
+			positions := q.Positions()
+			assert.Len(t, positions, 2)
+			for i, ident := range tc.expectedOrder {
+				assert.Equal(t, i+1, positions[ident], "%s", ident)
+			}
+
+			blockerDone()
+			wg.Wait()
+			assert.Equal(t, tc.expectedOrder, order)
+		})
+	}
+}
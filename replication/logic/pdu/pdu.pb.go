@@ -46,7 +46,7 @@ func (x Tri) String() string {
 	return proto.EnumName(Tri_name, int32(x))
 }
 func (Tri) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{0}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{0}
 }
 
 type FilesystemVersion_VersionType int32
@@ -69,7 +69,7 @@ func (x FilesystemVersion_VersionType) String() string {
 	return proto.EnumName(FilesystemVersion_VersionType_name, int32(x))
 }
 func (FilesystemVersion_VersionType) EnumDescriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{5, 0}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{5, 0}
 }
 
 type ListFilesystemReq struct {
@@ -82,7 +82,7 @@ func (m *ListFilesystemReq) Reset()         { *m = ListFilesystemReq{} }
 func (m *ListFilesystemReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemReq) ProtoMessage()    {}
 func (*ListFilesystemReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{0}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{0}
 }
 func (m *ListFilesystemReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemReq.Unmarshal(m, b)
@@ -113,7 +113,7 @@ func (m *ListFilesystemRes) Reset()         { *m = ListFilesystemRes{} }
 func (m *ListFilesystemRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemRes) ProtoMessage()    {}
 func (*ListFilesystemRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{1}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{1}
 }
 func (m *ListFilesystemRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemRes.Unmarshal(m, b)
@@ -141,10 +141,12 @@ func (m *ListFilesystemRes) GetFilesystems() []*Filesystem {
 }
 
 type Filesystem struct {
-	Path                 string   `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
-	ResumeToken          string   `protobuf:"bytes,2,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	IsPlaceholder        bool     `protobuf:"varint,3,opt,name=IsPlaceholder,proto3" json:"IsPlaceholder,omitempty"`
-	IsEncrypted          bool     `protobuf:"varint,4,opt,name=IsEncrypted,proto3" json:"IsEncrypted,omitempty"`
+	Path          string `protobuf:"bytes,1,opt,name=Path,proto3" json:"Path,omitempty"`
+	ResumeToken   string `protobuf:"bytes,2,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	IsPlaceholder bool   `protobuf:"varint,3,opt,name=IsPlaceholder,proto3" json:"IsPlaceholder,omitempty"`
+	IsEncrypted   bool   `protobuf:"varint,4,opt,name=IsEncrypted,proto3" json:"IsEncrypted,omitempty"`
+	// Replication priority assigned by the sender, see replication.driver
+	Priority             int32    `protobuf:"varint,5,opt,name=Priority,proto3" json:"Priority,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -154,7 +156,7 @@ func (m *Filesystem) Reset()         { *m = Filesystem{} }
 func (m *Filesystem) String() string { return proto.CompactTextString(m) }
 func (*Filesystem) ProtoMessage()    {}
 func (*Filesystem) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{2}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{2}
 }
 func (m *Filesystem) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Filesystem.Unmarshal(m, b)
@@ -202,6 +204,13 @@ func (m *Filesystem) GetIsEncrypted() bool {
 	return false
 }
 
+func (m *Filesystem) GetPriority() int32 {
+	if m != nil {
+		return m.Priority
+	}
+	return 0
+}
+
 type ListFilesystemVersionsReq struct {
 	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -213,7 +222,7 @@ func (m *ListFilesystemVersionsReq) Reset()         { *m = ListFilesystemVersion
 func (m *ListFilesystemVersionsReq) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsReq) ProtoMessage()    {}
 func (*ListFilesystemVersionsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{3}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{3}
 }
 func (m *ListFilesystemVersionsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsReq.Unmarshal(m, b)
@@ -241,17 +250,21 @@ func (m *ListFilesystemVersionsReq) GetFilesystem() string {
 }
 
 type ListFilesystemVersionsRes struct {
-	Versions             []*FilesystemVersion `protobuf:"bytes,1,rep,name=Versions,proto3" json:"Versions,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	Versions []*FilesystemVersion `protobuf:"bytes,1,rep,name=Versions,proto3" json:"Versions,omitempty"`
+	// CreateTXGs of the snapshots that the sender excludes from Versions
+	// because of its snapshot filter. A stream with intermediates
+	// ('zfs send -I') must not include such a snapshot.
+	ExcludedSnapshotCreateTXGs []uint64 `protobuf:"varint,2,rep,packed,name=ExcludedSnapshotCreateTXGs,proto3" json:"ExcludedSnapshotCreateTXGs,omitempty"`
+	XXX_NoUnkeyedLiteral       struct{} `json:"-"`
+	XXX_unrecognized           []byte   `json:"-"`
+	XXX_sizecache              int32    `json:"-"`
 }
 
 func (m *ListFilesystemVersionsRes) Reset()         { *m = ListFilesystemVersionsRes{} }
 func (m *ListFilesystemVersionsRes) String() string { return proto.CompactTextString(m) }
 func (*ListFilesystemVersionsRes) ProtoMessage()    {}
 func (*ListFilesystemVersionsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{4}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{4}
 }
 func (m *ListFilesystemVersionsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ListFilesystemVersionsRes.Unmarshal(m, b)
@@ -278,6 +291,13 @@ func (m *ListFilesystemVersionsRes) GetVersions() []*FilesystemVersion {
 	return nil
 }
 
+func (m *ListFilesystemVersionsRes) GetExcludedSnapshotCreateTXGs() []uint64 {
+	if m != nil {
+		return m.ExcludedSnapshotCreateTXGs
+	}
+	return nil
+}
+
 type FilesystemVersion struct {
 	Type                 FilesystemVersion_VersionType `protobuf:"varint,1,opt,name=Type,proto3,enum=FilesystemVersion_VersionType" json:"Type,omitempty"`
 	Name                 string                        `protobuf:"bytes,2,opt,name=Name,proto3" json:"Name,omitempty"`
@@ -293,7 +313,7 @@ func (m *FilesystemVersion) Reset()         { *m = FilesystemVersion{} }
 func (m *FilesystemVersion) String() string { return proto.CompactTextString(m) }
 func (*FilesystemVersion) ProtoMessage()    {}
 func (*FilesystemVersion) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{5}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{5}
 }
 func (m *FilesystemVersion) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_FilesystemVersion.Unmarshal(m, b)
@@ -359,9 +379,25 @@ type SendReq struct {
 	// SHOULD clear the resume token on their side and use From and To instead If
 	// ResumeToken is not empty, the GUIDs of From and To MUST correspond to those
 	// encoded in the ResumeToken. Otherwise, the Sender MUST return an error.
-	ResumeToken          string   `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
-	Encrypted            Tri      `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
-	DryRun               bool     `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	ResumeToken string `protobuf:"bytes,4,opt,name=ResumeToken,proto3" json:"ResumeToken,omitempty"`
+	Encrypted   Tri    `protobuf:"varint,5,opt,name=Encrypted,proto3,enum=Tri" json:"Encrypted,omitempty"`
+	DryRun      bool   `protobuf:"varint,6,opt,name=DryRun,proto3" json:"DryRun,omitempty"`
+	// Like Encrypted, the following fields express the requester's expectation
+	// on the flags the sender uses for 'zfs send'. The sender decides which flags
+	// to use based on its configuration and MUST return an error if a field is
+	// not DontCare and does not match that configuration.
+	LargeBlocks      Tri `protobuf:"varint,7,opt,name=LargeBlocks,proto3,enum=Tri" json:"LargeBlocks,omitempty"`
+	Compressed       Tri `protobuf:"varint,8,opt,name=Compressed,proto3,enum=Tri" json:"Compressed,omitempty"`
+	EmbeddedData     Tri `protobuf:"varint,9,opt,name=EmbeddedData,proto3,enum=Tri" json:"EmbeddedData,omitempty"`
+	SendProperties   Tri `protobuf:"varint,10,opt,name=SendProperties,proto3,enum=Tri" json:"SendProperties,omitempty"`
+	BackupProperties Tri `protobuf:"varint,11,opt,name=BackupProperties,proto3,enum=Tri" json:"BackupProperties,omitempty"`
+	// Unlike the fields above, True requests a send of the saved partially
+	// received state of Filesystem ('zfs send -S'), and the sender MUST return an
+	// error if its configuration does not permit it. From MUST be nil.
+	Saved Tri `protobuf:"varint,12,opt,name=Saved,proto3,enum=Tri" json:"Saved,omitempty"`
+	// If true, the stream includes all snapshots between From and To
+	// ('zfs send -I'). From MUST be a snapshot and ResumeToken MUST be empty.
+	Intermediates        bool     `protobuf:"varint,13,opt,name=Intermediates,proto3" json:"Intermediates,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -371,7 +407,7 @@ func (m *SendReq) Reset()         { *m = SendReq{} }
 func (m *SendReq) String() string { return proto.CompactTextString(m) }
 func (*SendReq) ProtoMessage()    {}
 func (*SendReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{6}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{6}
 }
 func (m *SendReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendReq.Unmarshal(m, b)
@@ -433,6 +469,55 @@ func (m *SendReq) GetDryRun() bool {
 	return false
 }
 
+func (m *SendReq) GetLargeBlocks() Tri {
+	if m != nil {
+		return m.LargeBlocks
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetCompressed() Tri {
+	if m != nil {
+		return m.Compressed
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetEmbeddedData() Tri {
+	if m != nil {
+		return m.EmbeddedData
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetSendProperties() Tri {
+	if m != nil {
+		return m.SendProperties
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetBackupProperties() Tri {
+	if m != nil {
+		return m.BackupProperties
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetSaved() Tri {
+	if m != nil {
+		return m.Saved
+	}
+	return Tri_DontCare
+}
+
+func (m *SendReq) GetIntermediates() bool {
+	if m != nil {
+		return m.Intermediates
+	}
+	return false
+}
+
 type Property struct {
 	Name                 string   `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
 	Value                string   `protobuf:"bytes,2,opt,name=Value,proto3" json:"Value,omitempty"`
@@ -445,7 +530,7 @@ func (m *Property) Reset()         { *m = Property{} }
 func (m *Property) String() string { return proto.CompactTextString(m) }
 func (*Property) ProtoMessage()    {}
 func (*Property) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{7}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{7}
 }
 func (m *Property) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_Property.Unmarshal(m, b)
@@ -496,7 +581,7 @@ func (m *SendRes) Reset()         { *m = SendRes{} }
 func (m *SendRes) String() string { return proto.CompactTextString(m) }
 func (*SendRes) ProtoMessage()    {}
 func (*SendRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{8}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{8}
 }
 func (m *SendRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendRes.Unmarshal(m, b)
@@ -548,7 +633,7 @@ func (m *SendCompletedReq) Reset()         { *m = SendCompletedReq{} }
 func (m *SendCompletedReq) String() string { return proto.CompactTextString(m) }
 func (*SendCompletedReq) ProtoMessage()    {}
 func (*SendCompletedReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{9}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{9}
 }
 func (m *SendCompletedReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendCompletedReq.Unmarshal(m, b)
@@ -585,7 +670,7 @@ func (m *SendCompletedRes) Reset()         { *m = SendCompletedRes{} }
 func (m *SendCompletedRes) String() string { return proto.CompactTextString(m) }
 func (*SendCompletedRes) ProtoMessage()    {}
 func (*SendCompletedRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{10}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{10}
 }
 func (m *SendCompletedRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_SendCompletedRes.Unmarshal(m, b)
@@ -610,7 +695,19 @@ type ReceiveReq struct {
 	To         *FilesystemVersion `protobuf:"bytes,2,opt,name=To,proto3" json:"To,omitempty"`
 	// If true, the receiver should clear the resume token before performing the
 	// zfs recv of the stream in the request
-	ClearResumeToken     bool     `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
+	ClearResumeToken bool `protobuf:"varint,3,opt,name=ClearResumeToken,proto3" json:"ClearResumeToken,omitempty"`
+	// If true and the filesystem exists, the receiver should rename it aside
+	// before performing the zfs recv of the (full) stream in the request.
+	// Used to resolve conflicts between sender and receiver, see PlannerPolicy.ConflictResolution.
+	RenameExistingAside bool `protobuf:"varint,4,opt,name=RenameExistingAside,proto3" json:"RenameExistingAside,omitempty"`
+	// The sender's estimate of the stream size in bytes (SendRes.ExpectedSize),
+	// 0 if there is no estimate. The receiver may reject the request if it
+	// does not have enough space for the stream.
+	ExpectedSize int64 `protobuf:"varint,5,opt,name=ExpectedSize,proto3" json:"ExpectedSize,omitempty"`
+	// If not empty, the receiver should rename its filesystem RenameFrom to
+	// Filesystem before performing the zfs recv of the (incremental) stream in the request.
+	// Used if the filesystem was renamed on the sender, see PlannerPolicy.RenameDetection.
+	RenameFrom           string   `protobuf:"bytes,6,opt,name=RenameFrom,proto3" json:"RenameFrom,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -620,7 +717,7 @@ func (m *ReceiveReq) Reset()         { *m = ReceiveReq{} }
 func (m *ReceiveReq) String() string { return proto.CompactTextString(m) }
 func (*ReceiveReq) ProtoMessage()    {}
 func (*ReceiveReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{11}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{11}
 }
 func (m *ReceiveReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveReq.Unmarshal(m, b)
@@ -661,6 +758,27 @@ func (m *ReceiveReq) GetClearResumeToken() bool {
 	return false
 }
 
+func (m *ReceiveReq) GetRenameExistingAside() bool {
+	if m != nil {
+		return m.RenameExistingAside
+	}
+	return false
+}
+
+func (m *ReceiveReq) GetExpectedSize() int64 {
+	if m != nil {
+		return m.ExpectedSize
+	}
+	return 0
+}
+
+func (m *ReceiveReq) GetRenameFrom() string {
+	if m != nil {
+		return m.RenameFrom
+	}
+	return ""
+}
+
 type ReceiveRes struct {
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
@@ -671,7 +789,7 @@ func (m *ReceiveRes) Reset()         { *m = ReceiveRes{} }
 func (m *ReceiveRes) String() string { return proto.CompactTextString(m) }
 func (*ReceiveRes) ProtoMessage()    {}
 func (*ReceiveRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{12}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{12}
 }
 func (m *ReceiveRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReceiveRes.Unmarshal(m, b)
@@ -704,7 +822,7 @@ func (m *DestroySnapshotsReq) Reset()         { *m = DestroySnapshotsReq{} }
 func (m *DestroySnapshotsReq) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsReq) ProtoMessage()    {}
 func (*DestroySnapshotsReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{13}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{13}
 }
 func (m *DestroySnapshotsReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsReq.Unmarshal(m, b)
@@ -750,7 +868,7 @@ func (m *DestroySnapshotRes) Reset()         { *m = DestroySnapshotRes{} }
 func (m *DestroySnapshotRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotRes) ProtoMessage()    {}
 func (*DestroySnapshotRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{14}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{14}
 }
 func (m *DestroySnapshotRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotRes.Unmarshal(m, b)
@@ -795,7 +913,7 @@ func (m *DestroySnapshotsRes) Reset()         { *m = DestroySnapshotsRes{} }
 func (m *DestroySnapshotsRes) String() string { return proto.CompactTextString(m) }
 func (*DestroySnapshotsRes) ProtoMessage()    {}
 func (*DestroySnapshotsRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{15}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{15}
 }
 func (m *DestroySnapshotsRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_DestroySnapshotsRes.Unmarshal(m, b)
@@ -822,6 +940,162 @@ func (m *DestroySnapshotsRes) GetResults() []*DestroySnapshotRes {
 	return nil
 }
 
+type RollbackReq struct {
+	Filesystem string `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	// The snapshot to roll back to ('zfs rollback -r'), identified by its GUID.
+	// All snapshots and bookmarks more recent than To are destroyed.
+	To                   *FilesystemVersion `protobuf:"bytes,2,opt,name=To,proto3" json:"To,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
+}
+
+func (m *RollbackReq) Reset()         { *m = RollbackReq{} }
+func (m *RollbackReq) String() string { return proto.CompactTextString(m) }
+func (*RollbackReq) ProtoMessage()    {}
+func (*RollbackReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{16}
+}
+func (m *RollbackReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RollbackReq.Unmarshal(m, b)
+}
+func (m *RollbackReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RollbackReq.Marshal(b, m, deterministic)
+}
+func (dst *RollbackReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RollbackReq.Merge(dst, src)
+}
+func (m *RollbackReq) XXX_Size() int {
+	return xxx_messageInfo_RollbackReq.Size(m)
+}
+func (m *RollbackReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_RollbackReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RollbackReq proto.InternalMessageInfo
+
+func (m *RollbackReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *RollbackReq) GetTo() *FilesystemVersion {
+	if m != nil {
+		return m.To
+	}
+	return nil
+}
+
+type RollbackRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RollbackRes) Reset()         { *m = RollbackRes{} }
+func (m *RollbackRes) String() string { return proto.CompactTextString(m) }
+func (*RollbackRes) ProtoMessage()    {}
+func (*RollbackRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{17}
+}
+func (m *RollbackRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RollbackRes.Unmarshal(m, b)
+}
+func (m *RollbackRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RollbackRes.Marshal(b, m, deterministic)
+}
+func (dst *RollbackRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RollbackRes.Merge(dst, src)
+}
+func (m *RollbackRes) XXX_Size() int {
+	return xxx_messageInfo_RollbackRes.Size(m)
+}
+func (m *RollbackRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_RollbackRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RollbackRes proto.InternalMessageInfo
+
+// Like ReceiveReq.RenameFrom, but without receiving a stream.
+// Used if the filesystem was renamed on the sender and the receiver is up to date.
+type RenameReq struct {
+	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
+	RenameFrom           string   `protobuf:"bytes,2,opt,name=RenameFrom,proto3" json:"RenameFrom,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RenameReq) Reset()         { *m = RenameReq{} }
+func (m *RenameReq) String() string { return proto.CompactTextString(m) }
+func (*RenameReq) ProtoMessage()    {}
+func (*RenameReq) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{18}
+}
+func (m *RenameReq) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RenameReq.Unmarshal(m, b)
+}
+func (m *RenameReq) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RenameReq.Marshal(b, m, deterministic)
+}
+func (dst *RenameReq) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RenameReq.Merge(dst, src)
+}
+func (m *RenameReq) XXX_Size() int {
+	return xxx_messageInfo_RenameReq.Size(m)
+}
+func (m *RenameReq) XXX_DiscardUnknown() {
+	xxx_messageInfo_RenameReq.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RenameReq proto.InternalMessageInfo
+
+func (m *RenameReq) GetFilesystem() string {
+	if m != nil {
+		return m.Filesystem
+	}
+	return ""
+}
+
+func (m *RenameReq) GetRenameFrom() string {
+	if m != nil {
+		return m.RenameFrom
+	}
+	return ""
+}
+
+type RenameRes struct {
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RenameRes) Reset()         { *m = RenameRes{} }
+func (m *RenameRes) String() string { return proto.CompactTextString(m) }
+func (*RenameRes) ProtoMessage()    {}
+func (*RenameRes) Descriptor() ([]byte, []int) {
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{19}
+}
+func (m *RenameRes) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RenameRes.Unmarshal(m, b)
+}
+func (m *RenameRes) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RenameRes.Marshal(b, m, deterministic)
+}
+func (dst *RenameRes) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RenameRes.Merge(dst, src)
+}
+func (m *RenameRes) XXX_Size() int {
+	return xxx_messageInfo_RenameRes.Size(m)
+}
+func (m *RenameRes) XXX_DiscardUnknown() {
+	xxx_messageInfo_RenameRes.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RenameRes proto.InternalMessageInfo
+
 type ReplicationCursorReq struct {
 	Filesystem           string   `protobuf:"bytes,1,opt,name=Filesystem,proto3" json:"Filesystem,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -833,7 +1107,7 @@ func (m *ReplicationCursorReq) Reset()         { *m = ReplicationCursorReq{} }
 func (m *ReplicationCursorReq) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorReq) ProtoMessage()    {}
 func (*ReplicationCursorReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{16}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{20}
 }
 func (m *ReplicationCursorReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorReq.Unmarshal(m, b)
@@ -874,7 +1148,7 @@ func (m *ReplicationCursorRes) Reset()         { *m = ReplicationCursorRes{} }
 func (m *ReplicationCursorRes) String() string { return proto.CompactTextString(m) }
 func (*ReplicationCursorRes) ProtoMessage()    {}
 func (*ReplicationCursorRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{17}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{21}
 }
 func (m *ReplicationCursorRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_ReplicationCursorRes.Unmarshal(m, b)
@@ -1010,7 +1284,7 @@ func (m *PingReq) Reset()         { *m = PingReq{} }
 func (m *PingReq) String() string { return proto.CompactTextString(m) }
 func (*PingReq) ProtoMessage()    {}
 func (*PingReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{18}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{22}
 }
 func (m *PingReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingReq.Unmarshal(m, b)
@@ -1049,7 +1323,7 @@ func (m *PingRes) Reset()         { *m = PingRes{} }
 func (m *PingRes) String() string { return proto.CompactTextString(m) }
 func (*PingRes) ProtoMessage()    {}
 func (*PingRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{19}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{23}
 }
 func (m *PingRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_PingRes.Unmarshal(m, b)
@@ -1097,7 +1371,7 @@ func (m *HintMostRecentCommonAncestorReq) Reset()         { *m = HintMostRecentC
 func (m *HintMostRecentCommonAncestorReq) String() string { return proto.CompactTextString(m) }
 func (*HintMostRecentCommonAncestorReq) ProtoMessage()    {}
 func (*HintMostRecentCommonAncestorReq) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{20}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{24}
 }
 func (m *HintMostRecentCommonAncestorReq) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_HintMostRecentCommonAncestorReq.Unmarshal(m, b)
@@ -1141,7 +1415,7 @@ func (m *HintMostRecentCommonAncestorRes) Reset()         { *m = HintMostRecentC
 func (m *HintMostRecentCommonAncestorRes) String() string { return proto.CompactTextString(m) }
 func (*HintMostRecentCommonAncestorRes) ProtoMessage()    {}
 func (*HintMostRecentCommonAncestorRes) Descriptor() ([]byte, []int) {
-	return fileDescriptor_pdu_e59763dc61674a79, []int{21}
+	return fileDescriptor_pdu_02b5f79b1ee403e3, []int{25}
 }
 func (m *HintMostRecentCommonAncestorRes) XXX_Unmarshal(b []byte) error {
 	return xxx_messageInfo_HintMostRecentCommonAncestorRes.Unmarshal(m, b)
@@ -1178,6 +1452,10 @@ func init() {
 	proto.RegisterType((*DestroySnapshotsReq)(nil), "DestroySnapshotsReq")
 	proto.RegisterType((*DestroySnapshotRes)(nil), "DestroySnapshotRes")
 	proto.RegisterType((*DestroySnapshotsRes)(nil), "DestroySnapshotsRes")
+	proto.RegisterType((*RollbackReq)(nil), "RollbackReq")
+	proto.RegisterType((*RollbackRes)(nil), "RollbackRes")
+	proto.RegisterType((*RenameReq)(nil), "RenameReq")
+	proto.RegisterType((*RenameRes)(nil), "RenameRes")
 	proto.RegisterType((*ReplicationCursorReq)(nil), "ReplicationCursorReq")
 	proto.RegisterType((*ReplicationCursorRes)(nil), "ReplicationCursorRes")
 	proto.RegisterType((*PingReq)(nil), "PingReq")
@@ -1204,6 +1482,8 @@ type ReplicationClient interface {
 	ListFilesystems(ctx context.Context, in *ListFilesystemReq, opts ...grpc.CallOption) (*ListFilesystemRes, error)
 	ListFilesystemVersions(ctx context.Context, in *ListFilesystemVersionsReq, opts ...grpc.CallOption) (*ListFilesystemVersionsRes, error)
 	DestroySnapshots(ctx context.Context, in *DestroySnapshotsReq, opts ...grpc.CallOption) (*DestroySnapshotsRes, error)
+	Rollback(ctx context.Context, in *RollbackReq, opts ...grpc.CallOption) (*RollbackRes, error)
+	Rename(ctx context.Context, in *RenameReq, opts ...grpc.CallOption) (*RenameRes, error)
 	ReplicationCursor(ctx context.Context, in *ReplicationCursorReq, opts ...grpc.CallOption) (*ReplicationCursorRes, error)
 	SendCompleted(ctx context.Context, in *SendCompletedReq, opts ...grpc.CallOption) (*SendCompletedRes, error)
 	HintMostRecentCommonAncestor(ctx context.Context, in *HintMostRecentCommonAncestorReq, opts ...grpc.CallOption) (*HintMostRecentCommonAncestorRes, error)
@@ -1253,6 +1533,24 @@ func (c *replicationClient) DestroySnapshots(ctx context.Context, in *DestroySna
 	return out, nil
 }
 
+func (c *replicationClient) Rollback(ctx context.Context, in *RollbackReq, opts ...grpc.CallOption) (*RollbackRes, error) {
+	out := new(RollbackRes)
+	err := c.cc.Invoke(ctx, "/Replication/Rollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *replicationClient) Rename(ctx context.Context, in *RenameReq, opts ...grpc.CallOption) (*RenameRes, error) {
+	out := new(RenameRes)
+	err := c.cc.Invoke(ctx, "/Replication/Rename", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *replicationClient) ReplicationCursor(ctx context.Context, in *ReplicationCursorReq, opts ...grpc.CallOption) (*ReplicationCursorRes, error) {
 	out := new(ReplicationCursorRes)
 	err := c.cc.Invoke(ctx, "/Replication/ReplicationCursor", in, out, opts...)
@@ -1286,6 +1584,8 @@ type ReplicationServer interface {
 	ListFilesystems(context.Context, *ListFilesystemReq) (*ListFilesystemRes, error)
 	ListFilesystemVersions(context.Context, *ListFilesystemVersionsReq) (*ListFilesystemVersionsRes, error)
 	DestroySnapshots(context.Context, *DestroySnapshotsReq) (*DestroySnapshotsRes, error)
+	Rollback(context.Context, *RollbackReq) (*RollbackRes, error)
+	Rename(context.Context, *RenameReq) (*RenameRes, error)
 	ReplicationCursor(context.Context, *ReplicationCursorReq) (*ReplicationCursorRes, error)
 	SendCompleted(context.Context, *SendCompletedReq) (*SendCompletedRes, error)
 	HintMostRecentCommonAncestor(context.Context, *HintMostRecentCommonAncestorReq) (*HintMostRecentCommonAncestorRes, error)
@@ -1367,6 +1667,42 @@ func _Replication_DestroySnapshots_Handler(srv interface{}, ctx context.Context,
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Replication_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RollbackReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/Rollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Rollback(ctx, req.(*RollbackReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Replication_Rename_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameReq)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ReplicationServer).Rename(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/Replication/Rename",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ReplicationServer).Rename(ctx, req.(*RenameReq))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _Replication_ReplicationCursor_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(ReplicationCursorReq)
 	if err := dec(in); err != nil {
@@ -1441,6 +1777,14 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DestroySnapshots",
 			Handler:    _Replication_DestroySnapshots_Handler,
 		},
+		{
+			MethodName: "Rollback",
+			Handler:    _Replication_Rollback_Handler,
+		},
+		{
+			MethodName: "Rename",
+			Handler:    _Replication_Rename_Handler,
+		},
 		{
 			MethodName: "ReplicationCursor",
 			Handler:    _Replication_ReplicationCursor_Handler,
@@ -1458,64 +1802,80 @@ var _Replication_serviceDesc = grpc.ServiceDesc{
 	Metadata: "pdu.proto",
 }
 
-func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_e59763dc61674a79) }
-
-var fileDescriptor_pdu_e59763dc61674a79 = []byte{
-	// 892 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x8c, 0x56, 0xdf, 0x6f, 0xdb, 0x36,
-	0x10, 0x8e, 0x6c, 0x39, 0x91, 0xcf, 0xe9, 0xea, 0x5c, 0xb2, 0x42, 0x13, 0xba, 0xce, 0xe3, 0x86,
-	0xc1, 0x0d, 0x30, 0x61, 0xc8, 0x7e, 0x60, 0xc3, 0x80, 0x02, 0x8d, 0x93, 0x34, 0xc5, 0xd6, 0xce,
-	0x60, 0xbc, 0x62, 0xe8, 0x9b, 0x6a, 0x1f, 0x12, 0x21, 0xb2, 0xa8, 0x90, 0xf4, 0x50, 0x6f, 0x7b,
-	0xda, 0xe3, 0xfe, 0xbd, 0xe5, 0x0f, 0x2a, 0x44, 0x4b, 0xb6, 0x6c, 0xc9, 0x89, 0x9f, 0xcc, 0xfb,
-	0x78, 0x14, 0xef, 0xbe, 0xfb, 0xee, 0x68, 0x68, 0x26, 0xa3, 0x89, 0x9f, 0x48, 0xa1, 0x05, 0xdb,
-	0x87, 0xbd, 0x5f, 0x43, 0xa5, 0xcf, 0xc2, 0x88, 0xd4, 0x54, 0x69, 0x1a, 0x73, 0xba, 0x61, 0xc7,
-	0x65, 0x50, 0xe1, 0xd7, 0xd0, 0x5a, 0x00, 0xca, 0xb5, 0x3a, 0xf5, 0x6e, 0xeb, 0xa8, 0xe5, 0x17,
-	0x9c, 0x8a, 0xfb, 0xec, 0x3f, 0x0b, 0x60, 0x61, 0x23, 0x82, 0xdd, 0x0f, 0xf4, 0x95, 0x6b, 0x75,
-	0xac, 0x6e, 0x93, 0x9b, 0x35, 0x76, 0xa0, 0xc5, 0x49, 0x4d, 0xc6, 0x34, 0x10, 0xd7, 0x14, 0xbb,
-	0x35, 0xb3, 0x55, 0x84, 0xf0, 0x4b, 0x78, 0xf0, 0x52, 0xf5, 0xa3, 0x60, 0x48, 0x57, 0x22, 0x1a,
-	0x91, 0x74, 0xeb, 0x1d, 0xab, 0xeb, 0xf0, 0x65, 0x30, 0xfd, 0xce, 0x4b, 0x75, 0x1a, 0x0f, 0xe5,
-	0x34, 0xd1, 0x34, 0x72, 0x6d, 0xe3, 0x53, 0x84, 0xd8, 0xcf, 0xf0, 0xc9, 0x72, 0x42, 0x6f, 0x48,
-	0xaa, 0x50, 0xc4, 0x8a, 0xd3, 0x0d, 0x3e, 0x29, 0x06, 0x9a, 0x05, 0x58, 0x40, 0xd8, 0x2f, 0xeb,
-	0x0f, 0x2b, 0xf4, 0xc1, 0xc9, 0xcd, 0x8c, 0x12, 0xf4, 0x4b, 0x9e, 0x7c, 0xee, 0xc3, 0x6e, 0x2d,
-	0xd8, 0x2b, 0xed, 0xe3, 0x11, 0xd8, 0x83, 0x69, 0x42, 0xe6, 0xf2, 0x8f, 0x8e, 0x9e, 0x94, 0xbf,
-	0xe0, 0x67, 0xbf, 0xa9, 0x17, 0x37, 0xbe, 0x29, 0xa3, 0xaf, 0x83, 0x31, 0x65, 0xb4, 0x99, 0x75,
-	0x8a, 0xbd, 0x98, 0x84, 0x23, 0x43, 0x93, 0xcd, 0xcd, 0x1a, 0x1f, 0x43, 0xb3, 0x27, 0x29, 0xd0,
-	0x34, 0xf8, 0xe3, 0x85, 0xe1, 0xc6, 0xe6, 0x0b, 0x00, 0x3d, 0x70, 0x8c, 0x11, 0x8a, 0xd8, 0x6d,
-	0x98, 0x2f, 0xcd, 0x6d, 0xf6, 0x14, 0x5a, 0x85, 0x6b, 0x71, 0x17, 0x9c, 0x8b, 0x38, 0x48, 0xd4,
-	0x95, 0xd0, 0xed, 0xad, 0xd4, 0x3a, 0x16, 0xe2, 0x7a, 0x1c, 0xc8, 0xeb, 0xb6, 0xc5, 0xfe, 0xb7,
-	0x60, 0xe7, 0x82, 0xe2, 0xd1, 0x06, 0x7c, 0xe2, 0x57, 0x60, 0x9f, 0x49, 0x31, 0x36, 0x81, 0x57,
-	0xd3, 0x65, 0xf6, 0x91, 0x41, 0x6d, 0x20, 0x4c, 0x2a, 0xd5, 0x5e, 0xb5, 0x81, 0x58, 0x95, 0x90,
-	0x5d, 0x96, 0x10, 0x83, 0xe6, 0x42, 0x1a, 0x0d, 0xc3, 0xaf, 0xed, 0x0f, 0x64, 0xc8, 0x17, 0x30,
-	0x3e, 0x82, 0xed, 0x13, 0x39, 0xe5, 0x93, 0xd8, 0xdd, 0x36, 0xda, 0xc9, 0x2c, 0xf6, 0x1d, 0x38,
-	0x7d, 0x29, 0x12, 0x92, 0x7a, 0x3a, 0xa7, 0xdb, 0x2a, 0xd0, 0x7d, 0x00, 0x8d, 0x37, 0x41, 0x34,
-	0xc9, 0x6b, 0x30, 0x33, 0xd8, 0xbf, 0x73, 0x2e, 0x14, 0x76, 0xe1, 0xe1, 0xef, 0x8a, 0x46, 0xab,
-	0x32, 0x77, 0xf8, 0x2a, 0x8c, 0x0c, 0x76, 0x4f, 0xdf, 0x27, 0x34, 0xd4, 0x34, 0xba, 0x08, 0xff,
-	0x22, 0x93, 0x77, 0x9d, 0x2f, 0x61, 0xf8, 0x14, 0x20, 0x8b, 0x27, 0x24, 0xe5, 0xda, 0x46, 0x6e,
-	0x4d, 0x3f, 0x0f, 0x91, 0x17, 0x36, 0xd9, 0x33, 0x68, 0xa7, 0x31, 0xf4, 0xc4, 0x38, 0x89, 0x48,
-	0x93, 0x29, 0xcc, 0x21, 0xb4, 0x7e, 0x93, 0xe1, 0x65, 0x18, 0x07, 0x11, 0xa7, 0x9b, 0x8c, 0x7f,
-	0xc7, 0xcf, 0xea, 0xc6, 0x8b, 0x9b, 0x0c, 0x4b, 0xe7, 0x15, 0xfb, 0x07, 0x80, 0xd3, 0x90, 0xc2,
-	0x3f, 0x69, 0x93, 0x32, 0xcf, 0xca, 0x57, 0xbb, 0xb3, 0x7c, 0x87, 0xd0, 0xee, 0x45, 0x14, 0xc8,
-	0x22, 0x3f, 0xb3, 0x16, 0x2f, 0xe1, 0x6c, 0xb7, 0x70, 0xbb, 0x62, 0x97, 0xb0, 0x7f, 0x42, 0x4a,
-	0x4b, 0x31, 0xcd, 0x35, 0xb9, 0x49, 0x2f, 0xe3, 0x37, 0xd0, 0x9c, 0xfb, 0xbb, 0xb5, 0xb5, 0xfd,
-	0xba, 0x70, 0x62, 0x6f, 0x01, 0x57, 0x2e, 0xca, 0xda, 0x3e, 0x37, 0xcd, 0x2d, 0x6b, 0xda, 0x3e,
-	0xf7, 0x49, 0x95, 0x72, 0x2a, 0xa5, 0x90, 0xb9, 0x52, 0x8c, 0xc1, 0x4e, 0xaa, 0x92, 0x48, 0x27,
-	0xed, 0x4e, 0x9a, 0x78, 0xa4, 0xf3, 0x91, 0xb2, 0xef, 0x97, 0x43, 0xe0, 0xb9, 0x0f, 0xfb, 0x01,
-	0x0e, 0x38, 0x25, 0x51, 0x38, 0x34, 0x5d, 0xdb, 0x9b, 0x48, 0x25, 0xe4, 0x26, 0x73, 0x6d, 0x50,
-	0x79, 0x4e, 0xe1, 0x41, 0x36, 0x44, 0xd2, 0x13, 0xf6, 0xf9, 0xd6, 0x7c, 0x8c, 0x38, 0xaf, 0x85,
-	0xa6, 0xf7, 0xa1, 0xd2, 0x33, 0x09, 0x9f, 0x6f, 0xf1, 0x39, 0x72, 0xec, 0xc0, 0xf6, 0x2c, 0x1c,
-	0xf6, 0x05, 0xec, 0xf4, 0xc3, 0xf8, 0x32, 0x0d, 0xc0, 0x85, 0x9d, 0x57, 0xa4, 0x54, 0x70, 0x99,
-	0x77, 0x4d, 0x6e, 0xb2, 0x4f, 0x73, 0x27, 0x95, 0xf6, 0xd5, 0xe9, 0xf0, 0x4a, 0xe4, 0x7d, 0x95,
-	0xae, 0xd9, 0xdf, 0xf0, 0xd9, 0x79, 0x18, 0xeb, 0x57, 0x42, 0xe9, 0xb4, 0xe4, 0xb1, 0xee, 0x89,
-	0xf1, 0x58, 0xc4, 0xcf, 0xe3, 0x21, 0x29, 0xbd, 0x51, 0x72, 0xf8, 0x23, 0x3c, 0x48, 0xf5, 0x4b,
-	0x32, 0xab, 0xc5, 0x1d, 0x42, 0x5c, 0x76, 0x64, 0x9f, 0xdf, 0x77, 0xb9, 0x3a, 0xec, 0x42, 0x7d,
-	0x20, 0xc3, 0x74, 0x04, 0x9e, 0x88, 0x58, 0xf7, 0x02, 0x49, 0xed, 0x2d, 0x6c, 0x42, 0xe3, 0x2c,
-	0x88, 0x14, 0xb5, 0x2d, 0x74, 0xc0, 0x1e, 0xc8, 0x09, 0xb5, 0x6b, 0x47, 0xb7, 0xf5, 0x74, 0x40,
-	0xcd, 0x49, 0x46, 0x0f, 0xec, 0x34, 0x71, 0x74, 0xfc, 0x8c, 0x24, 0x2f, 0x5f, 0x29, 0xfc, 0x09,
-	0x1e, 0x2e, 0xbf, 0x33, 0x0a, 0xd1, 0x2f, 0x3d, 0xce, 0x5e, 0x19, 0x53, 0xd8, 0x87, 0x47, 0xd5,
-	0x4f, 0x14, 0x7a, 0xfe, 0xda, 0x87, 0xcf, 0x5b, 0xbf, 0xa7, 0xf0, 0x19, 0xb4, 0x57, 0xa5, 0x89,
-	0x07, 0x7e, 0x45, 0xcb, 0x79, 0x55, 0xa8, 0xc2, 0xe7, 0xb0, 0x57, 0x12, 0x17, 0x7e, 0xec, 0x57,
-	0x09, 0xd5, 0xab, 0x84, 0x15, 0x7e, 0x3f, 0x2b, 0xe1, 0x7c, 0x04, 0xe1, 0x9e, 0xbf, 0x3a, 0xd2,
-	0xbc, 0x12, 0xa4, 0xf0, 0x1d, 0x3c, 0xbe, 0xab, 0x7e, 0xd8, 0xf1, 0xef, 0xd1, 0x96, 0x77, 0x9f,
-	0x87, 0x3a, 0x6e, 0xbc, 0xad, 0x27, 0xa3, 0xc9, 0xbb, 0x6d, 0xf3, 0x1f, 0xea, 0xdb, 0x0f, 0x01,
-	0x00, 0x00, 0xff, 0xff, 0xad, 0x4e, 0x98, 0x29, 0x50, 0x09, 0x00, 0x00,
+func init() { proto.RegisterFile("pdu.proto", fileDescriptor_pdu_02b5f79b1ee403e3) }
+
+var fileDescriptor_pdu_02b5f79b1ee403e3 = []byte{
+	// 1140 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0xcf, 0x6e, 0xdb, 0xc6,
+	0x13, 0x36, 0x25, 0xca, 0xa6, 0x46, 0x76, 0x22, 0x8f, 0xfd, 0x0b, 0xf8, 0x23, 0xd2, 0x54, 0xdd,
+	0x06, 0x81, 0x12, 0xb4, 0x44, 0xe0, 0xfe, 0x41, 0x8b, 0x02, 0x01, 0x62, 0x59, 0xf9, 0x83, 0x26,
+	0xa9, 0xba, 0x56, 0x83, 0x22, 0x37, 0x5a, 0x1c, 0xc8, 0x84, 0x28, 0xae, 0xb2, 0x4b, 0x05, 0x51,
+	0x7b, 0xeb, 0xb5, 0xef, 0xd0, 0x63, 0x9f, 0xa8, 0xaf, 0xd1, 0x4b, 0x9f, 0xa0, 0xe0, 0x8a, 0x94,
+	0x56, 0xa2, 0xec, 0xe8, 0xd0, 0x93, 0x76, 0xbe, 0xf9, 0x76, 0xb9, 0x3b, 0xf3, 0xcd, 0xec, 0x0a,
+	0xea, 0x93, 0x70, 0xea, 0x4f, 0xa4, 0x48, 0x05, 0x3b, 0x82, 0xc3, 0x17, 0x91, 0x4a, 0x9f, 0x44,
+	0x31, 0xa9, 0x99, 0x4a, 0x69, 0xcc, 0xe9, 0x2d, 0x3b, 0x2d, 0x83, 0x0a, 0x3f, 0x87, 0xc6, 0x12,
+	0x50, 0xae, 0xd5, 0xaa, 0xb6, 0x1b, 0x27, 0x0d, 0xdf, 0x20, 0x99, 0x7e, 0xf6, 0xa7, 0x05, 0xb0,
+	0xb4, 0x11, 0xc1, 0xee, 0x05, 0xe9, 0xa5, 0x6b, 0xb5, 0xac, 0x76, 0x9d, 0xeb, 0x31, 0xb6, 0xa0,
+	0xc1, 0x49, 0x4d, 0xc7, 0xd4, 0x17, 0x23, 0x4a, 0xdc, 0x8a, 0x76, 0x99, 0x10, 0xde, 0x85, 0x83,
+	0xe7, 0xaa, 0x17, 0x07, 0x03, 0xba, 0x14, 0x71, 0x48, 0xd2, 0xad, 0xb6, 0xac, 0xb6, 0xc3, 0x57,
+	0xc1, 0x6c, 0x9d, 0xe7, 0xaa, 0x9b, 0x0c, 0xe4, 0x6c, 0x92, 0x52, 0xe8, 0xda, 0x9a, 0x63, 0x42,
+	0xe8, 0x81, 0xd3, 0x93, 0x91, 0x90, 0x51, 0x3a, 0x73, 0x6b, 0x2d, 0xab, 0x5d, 0xe3, 0x0b, 0x9b,
+	0x7d, 0x07, 0xff, 0x5f, 0x3d, 0xec, 0x6b, 0x92, 0x2a, 0x12, 0x89, 0xe2, 0xf4, 0x16, 0xef, 0x98,
+	0x87, 0xc8, 0x37, 0x6f, 0x20, 0xec, 0x77, 0xeb, 0xea, 0xd9, 0x0a, 0x7d, 0x70, 0x0a, 0x33, 0x8f,
+	0x17, 0xfa, 0x25, 0x26, 0x5f, 0x70, 0xf0, 0x11, 0x78, 0xdd, 0xf7, 0x83, 0x78, 0x1a, 0x52, 0x78,
+	0x9e, 0x04, 0x13, 0x75, 0x29, 0xd2, 0x8e, 0xa4, 0x20, 0xa5, 0xfe, 0xcf, 0x4f, 0x95, 0x5b, 0x69,
+	0x55, 0xdb, 0x36, 0xbf, 0x86, 0xc1, 0xfe, 0xb2, 0xe0, 0xb0, 0xb4, 0x3e, 0x9e, 0x80, 0xdd, 0x9f,
+	0x4d, 0x48, 0xef, 0xfe, 0xc6, 0xc9, 0x9d, 0xf2, 0x0e, 0xfc, 0xfc, 0x37, 0x63, 0x71, 0xcd, 0xcd,
+	0xd2, 0xf5, 0x2a, 0x18, 0x53, 0x9e, 0x13, 0x3d, 0xce, 0xb0, 0xa7, 0xd3, 0x28, 0xd4, 0x39, 0xb0,
+	0xb9, 0x1e, 0xe3, 0x6d, 0xa8, 0x2f, 0xbe, 0xaf, 0x03, 0x6f, 0xf3, 0x25, 0x90, 0x85, 0x5d, 0x1b,
+	0x91, 0x48, 0x74, 0xd8, 0xeb, 0x7c, 0x61, 0xb3, 0xfb, 0xd0, 0x30, 0x3e, 0x8b, 0xfb, 0xe0, 0x14,
+	0x07, 0x6a, 0xee, 0x64, 0xd6, 0xa9, 0x10, 0xa3, 0x71, 0x20, 0x47, 0x4d, 0x8b, 0xfd, 0x5d, 0x85,
+	0xbd, 0x73, 0x4a, 0xc2, 0x2d, 0x12, 0x82, 0xf7, 0xc0, 0x7e, 0x22, 0xc5, 0x58, 0x6f, 0x7c, 0x73,
+	0xb8, 0xb5, 0x1f, 0x19, 0x54, 0xfa, 0xc2, 0xad, 0x5e, 0xc9, 0xaa, 0xf4, 0xc5, 0xba, 0x3e, 0xed,
+	0xb2, 0x3e, 0x19, 0xd4, 0x97, 0xba, 0xab, 0xe9, 0xf8, 0xda, 0x7e, 0x5f, 0x46, 0x7c, 0x09, 0xe3,
+	0x2d, 0xd8, 0x3d, 0x93, 0x33, 0x3e, 0x4d, 0xdc, 0x5d, 0x2d, 0xcc, 0xdc, 0xc2, 0x7b, 0xd0, 0x78,
+	0x11, 0xc8, 0x21, 0x9d, 0xc6, 0x62, 0x30, 0x52, 0xee, 0x9e, 0x31, 0xdb, 0x74, 0xe0, 0x5d, 0x80,
+	0x8e, 0x18, 0x4f, 0x24, 0x29, 0x45, 0xa1, 0xeb, 0x18, 0x34, 0x03, 0xc7, 0x36, 0xec, 0x77, 0xc7,
+	0x17, 0x14, 0x86, 0x14, 0x9e, 0x05, 0x69, 0xe0, 0xd6, 0x0d, 0xde, 0x8a, 0x07, 0x3f, 0x83, 0x1b,
+	0x59, 0x30, 0x7b, 0x52, 0x4c, 0x48, 0xa6, 0x11, 0x29, 0x17, 0x0c, 0xee, 0x9a, 0x0f, 0x1f, 0x42,
+	0xf3, 0x34, 0x18, 0x8c, 0xa6, 0x13, 0x83, 0xdf, 0x30, 0xf8, 0x25, 0x2f, 0x7a, 0x50, 0x3b, 0x0f,
+	0xde, 0x51, 0xe8, 0xee, 0x1b, 0xb4, 0x39, 0xa4, 0xeb, 0x39, 0x49, 0x49, 0x8e, 0x29, 0x8c, 0x82,
+	0x94, 0x94, 0x7b, 0x90, 0xd7, 0xb3, 0x09, 0xb2, 0x2f, 0xc1, 0xc9, 0xd7, 0x9b, 0x2d, 0x84, 0x68,
+	0x19, 0x42, 0x3c, 0x86, 0xda, 0xeb, 0x20, 0x9e, 0x16, 0xea, 0x9c, 0x1b, 0xec, 0x37, 0xab, 0x50,
+	0x89, 0xc2, 0x36, 0xdc, 0xfc, 0x49, 0x51, 0xb8, 0xde, 0x5d, 0x1c, 0xbe, 0x0e, 0x23, 0x83, 0xfd,
+	0xee, 0xfb, 0x09, 0x0d, 0x52, 0x0a, 0xcf, 0xa3, 0x5f, 0x48, 0x2b, 0xa2, 0xca, 0x57, 0x30, 0xbc,
+	0x0f, 0x60, 0x9c, 0xde, 0xd6, 0x85, 0x5c, 0xf7, 0x8b, 0x2d, 0x72, 0xc3, 0xc9, 0x1e, 0x41, 0x33,
+	0xdb, 0x43, 0x96, 0x98, 0x98, 0x52, 0xd2, 0x92, 0x7d, 0x00, 0x8d, 0x1f, 0x64, 0x34, 0x8c, 0x92,
+	0x20, 0xe6, 0xf4, 0x36, 0x57, 0xa6, 0xe3, 0xe7, 0x8a, 0xe6, 0xa6, 0x93, 0x61, 0x69, 0xbe, 0x62,
+	0xff, 0x58, 0x00, 0x9c, 0x06, 0x14, 0xbd, 0xa3, 0x6d, 0x2a, 0x60, 0xae, 0xec, 0xca, 0xb5, 0xca,
+	0x7e, 0x00, 0xcd, 0x4e, 0x4c, 0x81, 0x34, 0x03, 0x34, 0x6f, 0xad, 0x25, 0x1c, 0x1f, 0xc2, 0x11,
+	0xa7, 0x24, 0x18, 0x53, 0xf7, 0x7d, 0xa4, 0xd2, 0x28, 0x19, 0x3e, 0x56, 0x51, 0x48, 0x79, 0x97,
+	0xdd, 0xe4, 0x2a, 0xc5, 0xb4, 0xb6, 0x21, 0xa6, 0x77, 0x00, 0xe6, 0x53, 0x75, 0xb5, 0xee, 0xce,
+	0x4f, 0xb1, 0x44, 0xd8, 0xbe, 0x71, 0x66, 0xc5, 0x86, 0x70, 0x74, 0x46, 0x2a, 0x95, 0x62, 0x56,
+	0x34, 0x89, 0x6d, 0xba, 0x33, 0x3e, 0x84, 0xfa, 0x82, 0xaf, 0xdb, 0xe7, 0xe6, 0x88, 0x2c, 0x49,
+	0xec, 0x0d, 0xe0, 0xda, 0x87, 0xf2, 0x3e, 0x5e, 0x98, 0xfa, 0x2b, 0x57, 0xf4, 0xf1, 0x82, 0x93,
+	0x09, 0xb4, 0x2b, 0xa5, 0x90, 0x85, 0x40, 0xb5, 0xc1, 0xce, 0x36, 0x1d, 0x22, 0xbb, 0x57, 0xf7,
+	0xb2, 0x70, 0xc7, 0x69, 0x71, 0x47, 0x1c, 0xf9, 0xe5, 0x2d, 0xf0, 0x82, 0xc3, 0x7e, 0x84, 0x06,
+	0x17, 0x71, 0x7c, 0x11, 0x0c, 0x46, 0xff, 0x91, 0x1a, 0xd8, 0x81, 0xb9, 0xa4, 0x62, 0xdf, 0x43,
+	0x7d, 0x9e, 0x88, 0x6d, 0xd6, 0x5f, 0xcd, 0x63, 0xa5, 0x94, 0xc7, 0xc6, 0x72, 0x31, 0xc5, 0xbe,
+	0x86, 0x63, 0x4e, 0x93, 0x38, 0x1a, 0xe8, 0x2b, 0xa0, 0x33, 0x95, 0x4a, 0xc8, 0x6d, 0x6e, 0xd9,
+	0xfe, 0xc6, 0x79, 0x0a, 0x8f, 0xf3, 0x1b, 0x29, 0x9b, 0x61, 0x3f, 0xdb, 0x59, 0xdc, 0x49, 0xce,
+	0x2b, 0x91, 0x52, 0x26, 0xc9, 0x79, 0xd5, 0x3f, 0xdb, 0xe1, 0x0b, 0xe4, 0xd4, 0x81, 0xdd, 0x79,
+	0x28, 0xd9, 0xa7, 0xb0, 0xd7, 0x8b, 0x92, 0x61, 0xb6, 0x01, 0x17, 0xf6, 0x5e, 0x92, 0x52, 0xc1,
+	0xb0, 0x68, 0x34, 0x85, 0xc9, 0x3e, 0x2a, 0x48, 0x2a, 0x6b, 0x45, 0xdd, 0xc1, 0xa5, 0x28, 0x5a,
+	0x51, 0x36, 0x66, 0xbf, 0xc2, 0xc7, 0xcf, 0xa2, 0x24, 0x7d, 0x29, 0x54, 0x9a, 0xc9, 0x35, 0x49,
+	0x3b, 0x62, 0x3c, 0x16, 0xc9, 0xe3, 0x64, 0x40, 0x2a, 0xdd, 0xea, 0x70, 0xf8, 0x0d, 0x1c, 0x64,
+	0x25, 0x4f, 0x32, 0x4f, 0xc9, 0x35, 0xc9, 0x5a, 0x25, 0xb2, 0x4f, 0x3e, 0xf4, 0x71, 0xf5, 0xa0,
+	0x0d, 0xd5, 0xbe, 0x8c, 0xb2, 0xfb, 0xf4, 0x4c, 0x24, 0x69, 0x27, 0x90, 0xd4, 0xdc, 0xc1, 0x3a,
+	0xd4, 0x9e, 0x04, 0xb1, 0xa2, 0xa6, 0x85, 0x0e, 0xd8, 0x7d, 0x39, 0xa5, 0x66, 0xe5, 0xe4, 0x0f,
+	0x1b, 0x1a, 0x46, 0x90, 0xd1, 0x03, 0x3b, 0x3b, 0x38, 0x3a, 0x7e, 0x1e, 0x24, 0xaf, 0x18, 0x29,
+	0xfc, 0x16, 0x6e, 0xae, 0x3e, 0x7a, 0x14, 0xa2, 0x5f, 0x7a, 0x46, 0x7a, 0x65, 0x4c, 0x61, 0x0f,
+	0x6e, 0x6d, 0x7e, 0x2f, 0xa1, 0xe7, 0x5f, 0xf9, 0x0c, 0xf3, 0xae, 0xf6, 0x65, 0x8f, 0xa6, 0xe6,
+	0x7a, 0x59, 0xe1, 0xb1, 0xbf, 0xa1, 0x5d, 0x78, 0x9b, 0x50, 0x85, 0xf7, 0xc0, 0x29, 0xd4, 0x8f,
+	0xfb, 0xbe, 0x51, 0x5b, 0x9e, 0x69, 0x29, 0x6c, 0xc1, 0xee, 0x5c, 0xc9, 0x08, 0xfe, 0xa2, 0x3e,
+	0xbc, 0xe5, 0x58, 0xe1, 0x63, 0x38, 0x2c, 0xc9, 0x14, 0xff, 0xe7, 0x6f, 0x92, 0xbc, 0xb7, 0x11,
+	0x56, 0xf8, 0x15, 0x1c, 0xac, 0xf4, 0x7f, 0x3c, 0xf4, 0xd7, 0xef, 0x13, 0xaf, 0x04, 0x29, 0xbc,
+	0x80, 0xdb, 0xd7, 0x29, 0x01, 0x5b, 0xfe, 0x07, 0x54, 0xea, 0x7d, 0x88, 0xa1, 0x4e, 0x6b, 0x6f,
+	0xaa, 0x93, 0x70, 0x7a, 0xb1, 0xab, 0xff, 0x37, 0x7c, 0xf1, 0xef, 0x00, 0xab, 0x6f, 0x6b, 0xef,
+	0x44, 0x0c, 0x00, 0x00,
 }
@@ -48,10 +48,72 @@ type Receiver interface {
 	// Receive sends r and sendStream (the latter containing a ZFS send stream)
 	// to the parent github.com/zrepl/zrepl/replication.Endpoint.
 	Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error)
+	Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error)
+	Rename(ctx context.Context, req *pdu.RenameReq) (*pdu.RenameRes, error)
 }
 
 type PlannerPolicy struct {
-	EncryptedSend tri // all sends must be encrypted (send -w, and encryption!=off)
+	EncryptedSend      tri // all sends must be encrypted (send -w, and encryption!=off)
+	SendFlags          SendFlagsPolicy
+	ConflictResolution ConflictResolution
+	Initial            InitialReplication
+	StepStrategy       StepStrategy
+	RenameDetection    RenameDetection
+}
+
+// SendFlagsPolicy describes the zfs send flags (besides -w) that all sends must use.
+type SendFlagsPolicy struct {
+	LargeBlocks      tri // send -L
+	Compressed       tri // send -c
+	EmbeddedData     tri // send -e
+	SendProperties   tri // send -p
+	BackupProperties tri // send -b
+}
+
+func SendFlagsPolicyFromFlags(f zfs.ZFSSendFlags) SendFlagsPolicy {
+	return SendFlagsPolicy{
+		LargeBlocks:      TriFromBool(f.LargeBlocks),
+		Compressed:       TriFromBool(f.Compressed),
+		EmbeddedData:     TriFromBool(f.EmbeddedData),
+		SendProperties:   TriFromBool(f.Properties),
+		BackupProperties: TriFromBool(f.BackupProperties),
+	}
+}
+
+// resumeTokenMatches checks whether the flags encoded in the resume token t
+// are compatible with policy p.
+func (p PlannerPolicy) resumeTokenMatches(t *zfs.ResumeToken) error {
+	triMatches := func(policy tri, v bool) bool {
+		return policy == DontCare || (policy == True) == v
+	}
+	if t.SavedOK {
+		return fmt.Errorf("resume token `savedok`=%v: resuming sends of saved receive state is not supported", t.SavedOK)
+	}
+	if !triMatches(p.EncryptedSend, t.RawOK) {
+		return fmt.Errorf("resume token `rawok`=%v is incompatible with encryption policy=%v", t.RawOK, p.EncryptedSend)
+	}
+	// raw sends always set `compressok`
+	compressed := p.SendFlags.Compressed
+	if p.EncryptedSend == True {
+		compressed = True
+	} else if p.EncryptedSend == DontCare && compressed == False {
+		compressed = DontCare
+	}
+	if !triMatches(compressed, t.CompressOK) {
+		return fmt.Errorf("resume token `compressok`=%v is incompatible with encryption policy=%v and compressed policy=%v", t.CompressOK, p.EncryptedSend, p.SendFlags.Compressed)
+	}
+	// the sender only sets `largeblockok` and `embedok` if the pool features are active,
+	// and raw sends imply both
+	if p.EncryptedSend == True {
+		return nil
+	}
+	if p.SendFlags.LargeBlocks == False && t.LargeBlockOK {
+		return fmt.Errorf("resume token `largeblockok`=%v is incompatible with large_blocks policy=%v", t.LargeBlockOK, p.SendFlags.LargeBlocks)
+	}
+	if p.SendFlags.EmbeddedData == False && t.EmbedOK {
+		return fmt.Errorf("resume token `embedok`=%v is incompatible with embedded_data policy=%v", t.EmbedOK, p.SendFlags.EmbeddedData)
+	}
+	return nil
 }
 
 type Planner struct {
@@ -123,6 +185,12 @@ type Filesystem struct {
 	promBytesReplicated  prometheus.Counter // compat
 
 	sizeEstimateRequestSem *semaphore.S
+
+	renameDetector *renameDetector // nil if rename detection is off or there are no candidates
+
+	// describes the automatic resolution of a conflict during planning, empty if none
+	conflictResolution    string
+	conflictResolutionMtx sync.Mutex
 }
 
 func (f *Filesystem) EqualToPreviousAttempt(other driver.FS) bool {
@@ -146,7 +214,13 @@ func (f *Filesystem) PlanFS(ctx context.Context) ([]driver.Step, error) {
 	return dsteps, nil
 }
 func (f *Filesystem) ReportInfo() *report.FilesystemInfo {
-	return &report.FilesystemInfo{Name: f.Path} // FIXME compat name
+	f.conflictResolutionMtx.Lock()
+	defer f.conflictResolutionMtx.Unlock()
+	return &report.FilesystemInfo{
+		Name:               f.Path, // FIXME compat name
+		Priority:           int(f.senderFS.GetPriority()),
+		ConflictResolution: f.conflictResolution,
+	}
 }
 
 type Step struct {
@@ -157,6 +231,18 @@ type Step struct {
 	from, to    *pdu.FilesystemVersion // from may be nil, indicating full send
 	encrypt     tri
 	resumeToken string // empty means no resume token shall be used
+	// the receiver renames the existing filesystem aside before receiving (full send only)
+	renameExistingAside bool
+	// if not empty, the snapshots between from and to that are included in the stream (zfs send -I)
+	intermediates []*pdu.FilesystemVersion
+	// if not empty, the receiver renames this filesystem to the step's filesystem before receiving (incremental send only)
+	renameFrom string
+	// if not nil, the receiver's snapshot that the receiver is rolled back to before sending (incremental send only)
+	rollbackTo *pdu.FilesystemVersion
+	// the step only rolls back the receiver to rollbackTo, from and to are the common ancestor
+	rollbackOnly bool
+	// the step only renames the receiver's filesystem renameFrom, from and to are its most recent version
+	renameOnly bool
 
 	expectedSize int64 // 0 means no size estimate present / possible
 
@@ -178,6 +264,39 @@ func (s *Step) TargetEquals(other driver.Step) bool {
 		s.to.GetGuid() == t.to.GetGuid()
 }
 
+var _ driver.RangeStep = (*Step)(nil)
+
+// Continues implements driver.RangeStep for batched steps (zfs send -I).
+// An interrupted batched step leaves a resume token for one of its snapshots
+// on the receiver, so the next planning yields a resume step for that snapshot,
+// followed by the rest of the range.
+func (s *Step) Continues(other driver.Step) (continues, end bool) {
+	t, ok := other.(*Step)
+	if !ok || len(s.intermediates) == 0 || t.from == nil {
+		return false, false
+	}
+	if !s.parent.EqualToPreviousAttempt(t.parent) {
+		panic("Step interface promise broken: parent filesystems must be same")
+	}
+	r := make([]*pdu.FilesystemVersion, 0, len(s.intermediates)+2)
+	r = append(r, s.from)
+	r = append(r, s.intermediates...)
+	r = append(r, s.to)
+	idx := func(v *pdu.FilesystemVersion) int {
+		for i := range r {
+			if r[i].GetGuid() == v.GetGuid() {
+				return i
+			}
+		}
+		return -1
+	}
+	fromIdx, toIdx := idx(t.from), idx(t.to)
+	if fromIdx == -1 || toIdx <= fromIdx {
+		return false, false
+	}
+	return true, toIdx == len(r)-1
+}
+
 func (s *Step) TargetDate() time.Time {
 	return s.to.SnapshotTime() // FIXME compat name
 }
@@ -211,9 +330,22 @@ func (s *Step) ReportInfo() *report.StepInfo {
 	default:
 		panic(fmt.Sprintf("unknown variant %s", s.encrypt))
 	}
+	var intermediates []string
+	for _, v := range s.intermediates {
+		intermediates = append(intermediates, v.RelName())
+	}
+	rollbackTo := ""
+	if s.rollbackTo != nil {
+		rollbackTo = s.rollbackTo.RelName()
+	}
 	return &report.StepInfo{
 		From:            from,
 		To:              s.to.RelName(),
+		Intermediates:   intermediates,
+		RollbackTo:      rollbackTo,
+		RollbackOnly:    s.rollbackOnly,
+		RenameFrom:      s.renameFrom,
+		RenameOnly:      s.renameOnly,
 		Resumed:         s.resumeToken != "",
 		Encrypted:       encrypted,
 		BytesExpected:   s.expectedSize,
@@ -230,22 +362,12 @@ func NewPlanner(secsPerState *prometheus.HistogramVec, bytesReplicated *promethe
 		promBytesReplicated: bytesReplicated,
 	}
 }
-func resolveConflict(conflict error) (path []*pdu.FilesystemVersion, msg string) {
+func resolveConflict(conflict error, initial InitialReplication, now time.Time) (path []*pdu.FilesystemVersion, msg string) {
 	if noCommonAncestor, ok := conflict.(*ConflictNoCommonAncestor); ok {
 		if len(noCommonAncestor.SortedReceiverVersions) == 0 {
-			// TODO this is hard-coded replication policy: most recent snapshot as source
-			// NOTE: Keep in sync with listStaleFiltering, it depends on this hard-coded assumption
-			var mostRecentSnap *pdu.FilesystemVersion
-			for n := len(noCommonAncestor.SortedSenderVersions) - 1; n >= 0; n-- {
-				if noCommonAncestor.SortedSenderVersions[n].Type == pdu.FilesystemVersion_Snapshot {
-					mostRecentSnap = noCommonAncestor.SortedSenderVersions[n]
-					break
-				}
-			}
-			if mostRecentSnap == nil {
-				return nil, "no snapshots available on sender side"
-			}
-			return []*pdu.FilesystemVersion{mostRecentSnap}, fmt.Sprintf("start replication at most recent snapshot %s", mostRecentSnap.RelName())
+			// NOTE: Keep in sync with listStaleFiltering, it depends on the first step of the
+			// initial replication being the only one that is active without replication cursor
+			return initial.path(noCommonAncestor.SortedSenderVersions, now)
 		}
 	}
 	return nil, "no automated way to handle conflict type"
@@ -273,6 +395,11 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 
 	sizeEstimateRequestSem := semaphore.New(envconst.Int64("ZREPL_REPLICATION_MAX_CONCURRENT_SIZE_ESTIMATE", 4))
 
+	var renameDetector *renameDetector
+	if p.policy.RenameDetection != RenameDetectionOff {
+		renameDetector = newRenameDetector(p.receiver, sfss, rfss)
+	}
+
 	q := make([]*Filesystem, 0, len(sfss))
 	for _, fs := range sfss {
 
@@ -294,6 +421,7 @@ func (p *Planner) doPlanning(ctx context.Context) ([]*Filesystem, error) {
 			receiverFS:             receiverFS,
 			promBytesReplicated:    ctr,
 			sizeEstimateRequestSem: sizeEstimateRequestSem,
+			renameDetector:         renameDetector,
 		})
 	}
 
@@ -335,6 +463,23 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 		rfsvs = []*pdu.FilesystemVersion{}
 	}
 
+	// the receiver's versions of a filesystem that was renamed on the sender are those of the old name
+	var renameFrom string
+	if fs.receiverFS == nil && fs.renameDetector != nil {
+		renamed, err := fs.renameDetector.detect(ctx, fs.Path, sfsvs)
+		if err != nil {
+			log.WithError(err).Error("cannot detect rename")
+			return nil, err
+		}
+		if renamed != nil {
+			var skip bool
+			rfsvs, renameFrom, skip = fs.handleRename(ctx, renamed, sfsvs)
+			if skip {
+				return nil, nil
+			}
+		}
+	}
+
 	var resumeToken *zfs.ResumeToken
 	var resumeTokenRaw string
 	if fs.receiverFS != nil && fs.receiverFS.ResumeToken != "" {
@@ -417,29 +562,21 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 			}
 		}
 
-		encryptionMatches := false
-		switch fs.policy.EncryptedSend {
-		case True:
-			encryptionMatches = resumeToken.RawOK && resumeToken.CompressOK
-		case False:
-			encryptionMatches = !resumeToken.RawOK && !resumeToken.CompressOK
-		case DontCare:
-			encryptionMatches = true
-		}
+		flagsMismatch := fs.policy.resumeTokenMatches(resumeToken)
 
 		log.WithField("fromVersion", fromVersion).
 			WithField("toVersion", toVersion).
-			WithField("encryptionMatches", encryptionMatches).
+			WithField("flagsMatch", flagsMismatch == nil).
 			Debug("result of resume-token-matching to sender's versions")
 
-		if !encryptionMatches {
-			return nil, fmt.Errorf("resume token `rawok`=%v and `compressok`=%v are incompatible with encryption policy=%v", resumeToken.RawOK, resumeToken.CompressOK, fs.policy.EncryptedSend)
+		if flagsMismatch != nil {
+			return nil, flagsMismatch
 		} else if toVersion == nil {
 			return nil, fmt.Errorf("resume token `toguid` = %v not found on sender (`toname` = %q)", resumeToken.ToGUID, resumeToken.ToName)
 		} else if fromVersion == toVersion {
 			return nil, fmt.Errorf("resume token `fromguid` and `toguid` match same version on sener")
 		}
-		// fromVersion may be nil, toVersion is no nil, encryption matches
+		// fromVersion may be nil, toVersion is no nil, send flags match
 		// good to go this one step!
 		resumeStep := &Step{
 			parent:   fs,
@@ -467,35 +604,88 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 
 		steps = make([]*Step, 0, len(remainingSFSVs)) // shadow
 		steps = append(steps, resumeStep)
-		for i := 0; i < len(remainingSFSVs)-1; i++ {
-			steps = append(steps, &Step{
-				parent:   fs,
-				sender:   fs.sender,
-				receiver: fs.receiver,
-				from:     remainingSFSVs[i],
-				to:       remainingSFSVs[i+1],
-				encrypt:  fs.policy.EncryptedSend,
-			})
-		}
+		steps = append(steps, fs.incrementalSteps(remainingSFSVs, sfsvsres.GetExcludedSnapshotCreateTXGs())...)
 	} else { // resumeToken == nil
 		path, conflict := IncrementalPath(rfsvs, sfsvs)
+		// path[0] is sent in full
+		var fullSend, renameAside bool
+		var rollbackTo, commonAncestor *pdu.FilesystemVersion
+		if diverged, ok := conflict.(*ConflictDiverged); ok {
+			commonAncestor = diverged.CommonAncestor
+		}
 		if conflict != nil {
 			var msg string
-			path, msg = resolveConflict(conflict) // no shadowing allowed!
+			path, msg = resolveConflict(conflict, fs.policy.Initial, time.Now()) // no shadowing allowed!
+			fullSend = path != nil
+			if path == nil {
+				var resolution string
+				var err error
+				path, rollbackTo, renameAside, resolution, err = fs.resolveConflictByPolicy(conflict, rfsvs, sfsvs) // no shadowing allowed!
+				if err != nil {
+					log.WithField("conflict", conflict).Error("conflict")
+					log.WithField("conflict_resolution", fs.policy.ConflictResolution).WithError(err).Error("cannot resolve conflict")
+					return nil, err
+				}
+				if path != nil {
+					msg = resolution
+					fullSend = renameAside
+					fs.conflictResolutionMtx.Lock()
+					fs.conflictResolution = resolution
+					fs.conflictResolutionMtx.Unlock()
+				}
+			}
 			if path != nil {
 				log.WithField("conflict", conflict).Info("conflict")
 				log.WithField("resolution", msg).Info("automatically resolved")
+				conflict = nil // path may be empty after a rollback to the common ancestor
 			} else {
 				log.WithField("conflict", conflict).Error("conflict")
 				log.WithField("problem", msg).Error("cannot resolve conflict")
 			}
 		}
+		if len(path) == 0 && rollbackTo != nil {
+			// the sender has no snapshots newer than the common ancestor,
+			// resolve the conflict in this attempt nonetheless
+			steps = []*Step{{
+				parent:   fs,
+				sender:   fs.sender,
+				receiver: fs.receiver,
+
+				from:    commonAncestor,
+				to:      commonAncestor,
+				encrypt: fs.policy.EncryptedSend,
+
+				rollbackTo:   rollbackTo,
+				rollbackOnly: true,
+				renameFrom:   renameFrom,
+			}}
+			return steps, nil
+		}
+		if len(path) == 0 && conflict == nil && renameFrom != "" {
+			// the receiver's filesystem is up to date, rename it in this attempt nonetheless
+			// because the renames of its children may depend on it
+			sorted := SortVersionListByCreateTXGThenBookmarkLTSnapshot(rfsvs)
+			mostRecent := sorted[len(sorted)-1]
+			steps = []*Step{{
+				parent:   fs,
+				sender:   fs.sender,
+				receiver: fs.receiver,
+
+				from:    mostRecent,
+				to:      mostRecent,
+				encrypt: fs.policy.EncryptedSend,
+
+				renameFrom: renameFrom,
+				renameOnly: true,
+			}}
+			return steps, nil
+		}
 		if len(path) == 0 {
 			return nil, conflict
 		}
 
 		steps = make([]*Step, 0, len(path)) // shadow
-		if len(path) == 1 {
+		if fullSend {
 			steps = append(steps, &Step{
 				parent:   fs,
 				sender:   fs.sender,
@@ -504,20 +694,13 @@ func (fs *Filesystem) doPlanning(ctx context.Context) ([]*Step, error) {
 				from:    nil,
 				to:      path[0],
 				encrypt: fs.policy.EncryptedSend,
+
+				renameExistingAside: renameAside,
 			})
-		} else {
-			for i := 0; i < len(path)-1; i++ {
-				steps = append(steps, &Step{
-					parent:   fs,
-					sender:   fs.sender,
-					receiver: fs.receiver,
-
-					from:    path[i],
-					to:      path[i+1],
-					encrypt: fs.policy.EncryptedSend,
-				})
-			}
 		}
+		steps = append(steps, fs.incrementalSteps(path, sfsvsres.GetExcludedSnapshotCreateTXGs())...)
+		steps[0].rollbackTo = rollbackTo
+		steps[0].renameFrom = renameFrom
 	}
 
 	if len(steps) == 0 {
@@ -594,6 +777,14 @@ func (s *Step) buildSendRequest(dryRun bool) (sr *pdu.SendReq) {
 		Encrypted:   s.encrypt.ToPDU(),
 		ResumeToken: s.resumeToken,
 		DryRun:      dryRun,
+
+		Intermediates: len(s.intermediates) > 0,
+
+		LargeBlocks:      s.parent.policy.SendFlags.LargeBlocks.ToPDU(),
+		Compressed:       s.parent.policy.SendFlags.Compressed.ToPDU(),
+		EmbeddedData:     s.parent.policy.SendFlags.EmbeddedData.ToPDU(),
+		SendProperties:   s.parent.policy.SendFlags.SendProperties.ToPDU(),
+		BackupProperties: s.parent.policy.SendFlags.BackupProperties.ToPDU(),
 	}
 	return sr
 }
@@ -603,6 +794,23 @@ func (s *Step) doReplication(ctx context.Context) error {
 	fs := s.parent.Path
 
 	log := getLogger(ctx)
+
+	if s.rollbackTo != nil {
+		if err := s.doRollback(ctx); err != nil {
+			log.WithError(err).Error("cannot roll back receiver to common ancestor")
+			return err
+		}
+	}
+	if s.rollbackOnly || s.renameOnly {
+		if s.renameFrom != "" {
+			if err := s.doRename(ctx); err != nil {
+				log.WithError(err).Error("cannot rename receiver filesystem")
+				return err
+			}
+		}
+		return nil
+	}
+
 	sr := s.buildSendRequest(false)
 
 	log.Debug("initiate send request")
@@ -631,6 +839,11 @@ func (s *Step) doReplication(ctx context.Context) error {
 		Filesystem:       fs,
 		To:               sr.GetTo(),
 		ClearResumeToken: !sres.UsedResumeToken,
+
+		RenameExistingAside: s.renameExistingAside,
+		RenameFrom:          s.renameFrom,
+
+		ExpectedSize: sres.GetExpectedSize(),
 	}
 	log.Debug("initiate receive request")
 	_, err = s.receiver.Receive(ctx, rr, byteCountingStream)
@@ -660,9 +873,53 @@ func (s *Step) doReplication(ctx context.Context) error {
 	return err
 }
 
+// doRollback rolls back the receiver to s.rollbackTo, destroying all more recent snapshots and bookmarks.
+// If s renames the receiver's filesystem, the filesystem is rolled back before the rename.
+func (s *Step) doRollback(ctx context.Context) error {
+	fs := s.parent.Path
+	if s.renameFrom != "" {
+		fs = s.renameFrom
+	}
+	getLogger(ctx).WithField("receiver_filesystem", fs).WithField("rollback_to", s.rollbackTo.RelName()).
+		Info("roll back receiver to common ancestor")
+	_, err := s.receiver.Rollback(ctx, &pdu.RollbackReq{
+		Filesystem: fs,
+		To:         s.rollbackTo,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot roll back receiver to common ancestor: %s", err)
+	}
+	// the step might be retried
+	s.rollbackTo = nil
+	return nil
+}
+
+// doRename renames the receiver's filesystem s.renameFrom to the step's filesystem without receiving.
+// Steps that replicate a snapshot rename the filesystem as part of the receive instead.
+func (s *Step) doRename(ctx context.Context) error {
+	getLogger(ctx).WithField("receiver_filesystem", s.renameFrom).
+		Info("rename receiver filesystem")
+	_, err := s.receiver.Rename(ctx, &pdu.RenameReq{
+		Filesystem: s.parent.Path,
+		RenameFrom: s.renameFrom,
+	})
+	if err != nil {
+		return fmt.Errorf("cannot rename receiver filesystem %q: %s", s.renameFrom, err)
+	}
+	// the step might be retried
+	s.renameFrom = ""
+	return nil
+}
+
 func (s *Step) String() string {
-	if s.from == nil { // FIXME: ZFS semantics are that to is nil on non-incremental send
+	if s.rollbackOnly {
+		return fmt.Sprintf("%s(rollback to %s)", s.parent.Path, s.to.RelName())
+	} else if s.renameOnly {
+		return fmt.Sprintf("%s(rename from %s)", s.parent.Path, s.renameFrom)
+	} else if s.from == nil { // FIXME: ZFS semantics are that to is nil on non-incremental send
 		return fmt.Sprintf("%s%s (full)", s.parent.Path, s.to.RelName())
+	} else if len(s.intermediates) > 0 {
+		return fmt.Sprintf("%s(%s => %s, %d intermediate snapshots)", s.parent.Path, s.from.RelName(), s.to.RelName(), len(s.intermediates))
 	} else {
 		return fmt.Sprintf("%s(%s => %s)", s.parent.Path, s.from.RelName(), s.to.RelName())
 	}
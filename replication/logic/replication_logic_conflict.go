@@ -0,0 +1,116 @@
+package logic
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// ConflictResolution determines how the planner handles a conflict between
+// sender and receiver that resolveConflict cannot handle, i.e.,
+// a receiver that has snapshots newer than the most recent common ancestor (*ConflictDiverged),
+// or a receiver that has snapshots but no common ancestor with the sender (*ConflictNoCommonAncestor).
+type ConflictResolution int
+
+const (
+	// The filesystem is not replicated until the conflict is resolved manually.
+	ConflictResolutionFail ConflictResolution = iota
+	// The receiver is rolled back to the most recent common ancestor (zfs rollback -r),
+	// destroying its more recent snapshots and bookmarks.
+	// Does not resolve *ConflictNoCommonAncestor.
+	ConflictResolutionRollbackToCommonAncestor
+	// The receiver renames the filesystem aside and receives a full send of the sender's most recent snapshot.
+	ConflictResolutionFullResendIntoNewDataset
+)
+
+func (r ConflictResolution) String() string {
+	switch r {
+	case ConflictResolutionFail:
+		return "fail"
+	case ConflictResolutionRollbackToCommonAncestor:
+		return "rollback_to_common_ancestor"
+	case ConflictResolutionFullResendIntoNewDataset:
+		return "full_resend_into_new_dataset"
+	}
+	panic(fmt.Sprintf("unknown variant %v", int(r)))
+}
+
+func ConflictResolutionFromString(s string) (ConflictResolution, error) {
+	for _, r := range []ConflictResolution{
+		ConflictResolutionFail,
+		ConflictResolutionRollbackToCommonAncestor,
+		ConflictResolutionFullResendIntoNewDataset,
+	} {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown conflict resolution %q", s)
+}
+
+// resolveConflictByPolicy applies fs.policy.ConflictResolution to a conflict that resolveConflict cannot handle.
+// It does not modify the receiver, the returned plan is executed by the replication steps.
+//
+// If the conflict is resolved, path is the incremental path to replicate, renameAside is true
+// if the receiver must rename the filesystem aside and path is that of an initial replication,
+// rollbackTo is the receiver's snapshot that the receiver must be rolled back to before the first incremental step,
+// and resolution describes the resolution for the filesystem report.
+// path may be empty if rollbackTo is not nil.
+// If the policy does not resolve the conflict, path is nil and err is nil.
+func (fs *Filesystem) resolveConflictByPolicy(conflict error, rfsvs, sfsvs []*pdu.FilesystemVersion) (path []*pdu.FilesystemVersion, rollbackTo *pdu.FilesystemVersion, renameAside bool, resolution string, err error) {
+	switch fs.policy.ConflictResolution {
+	case ConflictResolutionFail:
+		return nil, nil, false, "", nil
+
+	case ConflictResolutionRollbackToCommonAncestor:
+		diverged, ok := conflict.(*ConflictDiverged)
+		if !ok {
+			return nil, nil, false, "", nil
+		}
+		for _, v := range rfsvs {
+			if v.GetGuid() == diverged.CommonAncestor.GetGuid() && v.Type == pdu.FilesystemVersion_Snapshot {
+				rollbackTo = v
+			}
+		}
+		if rollbackTo == nil {
+			return nil, nil, false, "", fmt.Errorf("cannot roll back receiver to common ancestor %s: receiver only has a bookmark of it", diverged.CommonAncestor.RelName())
+		}
+		// zfs rollback -r destroys all snapshots and bookmarks more recent than rollbackTo
+		receiverOnly := make(map[uint64]bool, len(diverged.ReceiverOnly))
+		names := make([]string, len(diverged.ReceiverOnly))
+		for i, v := range diverged.ReceiverOnly {
+			receiverOnly[v.GetGuid()] = true
+			names[i] = v.RelName()
+		}
+		remaining := make([]*pdu.FilesystemVersion, 0, len(rfsvs))
+		for _, v := range rfsvs {
+			if !receiverOnly[v.GetGuid()] {
+				remaining = append(remaining, v)
+			}
+		}
+		incPath, remainingConflict := IncrementalPath(remaining, sfsvs)
+		if remainingConflict != nil {
+			return nil, nil, false, "", fmt.Errorf("conflict persists after rolling back receiver to common ancestor: %s", remainingConflict)
+		}
+		resolution = fmt.Sprintf("rolling back receiver to common ancestor %s", rollbackTo.RelName())
+		if len(names) > 0 {
+			resolution += fmt.Sprintf(", destroying receiver-only versions %s", strings.Join(names, ", "))
+		}
+		return incPath, rollbackTo, false, resolution, nil
+
+	case ConflictResolutionFullResendIntoNewDataset:
+		// the new dataset is replicated like a receiver that does not have the filesystem yet
+		initialPath, msg := fs.policy.Initial.path(sfsvs, time.Now())
+		if initialPath == nil {
+			return nil, nil, false, "", nil
+		}
+		resolution = fmt.Sprintf("renaming receiver filesystem aside, %s", msg)
+		return initialPath, nil, true, resolution, nil
+
+	default:
+		panic(fmt.Sprintf("unknown conflict resolution %v", int(fs.policy.ConflictResolution)))
+	}
+}
@@ -0,0 +1,348 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/util/semaphore"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+func TestConflictResolutionFromString(t *testing.T) {
+	for _, r := range []ConflictResolution{
+		ConflictResolutionFail,
+		ConflictResolutionRollbackToCommonAncestor,
+		ConflictResolutionFullResendIntoNewDataset,
+	} {
+		parsed, err := ConflictResolutionFromString(r.String())
+		require.NoError(t, err)
+		assert.Equal(t, r, parsed)
+	}
+	_, err := ConflictResolutionFromString("rollback")
+	assert.Error(t, err)
+}
+
+// planTestEndpoint is the sender and the receiver of a Filesystem
+// with in-memory filesystem versions.
+type planTestEndpoint struct {
+	Sender
+	sender, receiver map[string][]*pdu.FilesystemVersion
+	excluded         []uint64 // the sender's ExcludedSnapshotCreateTXGs
+	// the receiver's filesystems that were modified after their most recent snapshot
+	modified    map[string]bool
+	rollbackErr string
+}
+
+func (e *planTestEndpoint) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	panic("use senderSide or receiverSide")
+}
+
+func (e *planTestEndpoint) HintMostRecentCommonAncestor(context.Context, *pdu.HintMostRecentCommonAncestorReq) (*pdu.HintMostRecentCommonAncestorRes, error) {
+	return &pdu.HintMostRecentCommonAncestorRes{}, nil
+}
+
+func (e *planTestEndpoint) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
+	res := &pdu.SendRes{ExpectedSize: 1}
+	if r.DryRun {
+		return res, nil, nil
+	}
+	return res, zfs.NewReadCloserCopier(ioutil.NopCloser(strings.NewReader("stream"))), nil
+}
+
+func (e *planTestEndpoint) SendCompleted(ctx context.Context, r *pdu.SendCompletedReq) (*pdu.SendCompletedRes, error) {
+	return &pdu.SendCompletedRes{}, nil
+}
+
+// Receive behaves like zfs recv without -F: it fails if the receiver has
+// snapshots newer than the incremental source or was modified after it.
+func (e *planTestEndpoint) Receive(ctx context.Context, req *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
+	fs := req.Filesystem
+	if req.RenameFrom != "" {
+		fs = req.RenameFrom
+	}
+	rfsvs := e.receiver[fs]
+	if e.modified[fs] || len(rfsvs) == 0 || !e.hasSenderVersion(rfsvs[len(rfsvs)-1]) {
+		return nil, fmt.Errorf("destination has been modified since most recent snapshot")
+	}
+	if err := receive.WriteStreamTo(ioutil.Discard); err != nil {
+		return nil, err
+	}
+	delete(e.receiver, fs)
+	e.receiver[req.Filesystem] = append(rfsvs, req.To)
+	return &pdu.ReceiveRes{}, nil
+}
+
+func (e *planTestEndpoint) hasSenderVersion(v *pdu.FilesystemVersion) bool {
+	for _, vs := range e.sender {
+		for _, s := range vs {
+			if s.Guid == v.Guid {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Rename behaves like zfs rename, it renames the children of req.RenameFrom, too.
+func (e *planTestEndpoint) Rename(ctx context.Context, req *pdu.RenameReq) (*pdu.RenameRes, error) {
+	if _, ok := e.receiver[req.RenameFrom]; !ok {
+		return nil, fmt.Errorf("filesystem %q does not exist", req.RenameFrom)
+	}
+	for p, v := range e.receiver {
+		if p == req.RenameFrom || strings.HasPrefix(p, req.RenameFrom+"/") {
+			delete(e.receiver, p)
+			e.receiver[req.Filesystem+strings.TrimPrefix(p, req.RenameFrom)] = v
+		}
+	}
+	return &pdu.RenameRes{}, nil
+}
+
+// Rollback behaves like zfs rollback -r.
+func (e *planTestEndpoint) Rollback(ctx context.Context, req *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	if e.rollbackErr != "" {
+		return nil, fmt.Errorf("%s", e.rollbackErr)
+	}
+	rfsvs := e.receiver[req.Filesystem]
+	for i, v := range rfsvs {
+		if v.Guid == req.To.Guid && v.Type == pdu.FilesystemVersion_Snapshot {
+			e.receiver[req.Filesystem] = rfsvs[:i+1]
+			delete(e.modified, req.Filesystem)
+			return &pdu.RollbackRes{}, nil
+		}
+	}
+	return nil, fmt.Errorf("snapshot %s does not exist", req.To.RelName())
+}
+
+type planTestSide struct {
+	*planTestEndpoint
+	versions map[string][]*pdu.FilesystemVersion
+	excluded []uint64
+}
+
+func (s planTestSide) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	v, ok := s.versions[req.Filesystem]
+	if !ok {
+		return nil, fmt.Errorf("filesystem %q does not exist", req.Filesystem)
+	}
+	return &pdu.ListFilesystemVersionsRes{Versions: v, ExcludedSnapshotCreateTXGs: s.excluded}, nil
+}
+
+func (e *planTestEndpoint) filesystem(path string, policy PlannerPolicy) *Filesystem {
+	return &Filesystem{
+		sender:                 planTestSide{e, e.sender, e.excluded},
+		receiver:               planTestSide{e, e.receiver, nil},
+		policy:                 policy,
+		Path:                   path,
+		senderFS:               &pdu.Filesystem{Path: path},
+		receiverFS:             &pdu.Filesystem{Path: path},
+		sizeEstimateRequestSem: semaphore.New(1),
+		promBytesReplicated:    prometheus.NewCounter(prometheus.CounterOpts{Name: "test_bytes_replicated"}),
+	}
+}
+
+func planTestVersion(relName string, guid uint64) *pdu.FilesystemVersion {
+	typ := pdu.FilesystemVersion_Snapshot
+	if relName[0] == '#' {
+		typ = pdu.FilesystemVersion_Bookmark
+	}
+	return &pdu.FilesystemVersion{
+		Name:      relName[1:],
+		Type:      typ,
+		Guid:      guid,
+		CreateTXG: guid,
+		Creation:  pdu.FilesystemVersionCreation(time.Unix(int64(guid), 0)),
+	}
+}
+
+func TestResolveConflictByPolicy(t *testing.T) {
+	v := planTestVersion
+	a, x, y, b := v("@a", 1), v("@x", 2), v("#y", 3), v("@b", 4)
+	rfsvs := []*pdu.FilesystemVersion{a, x, y}
+	sfsvs := []*pdu.FilesystemVersion{a, b}
+	_, diverged := IncrementalPath(rfsvs, sfsvs)
+	require.IsType(t, &ConflictDiverged{}, diverged)
+	_, noCommonAncestor := IncrementalPath([]*pdu.FilesystemVersion{x}, sfsvs)
+	require.IsType(t, &ConflictNoCommonAncestor{}, noCommonAncestor)
+
+	fs := func(r ConflictResolution) *Filesystem {
+		return &Filesystem{Path: "pool/fs", policy: PlannerPolicy{ConflictResolution: r}}
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		path, rollbackTo, renameAside, _, err := fs(ConflictResolutionFail).resolveConflictByPolicy(diverged, rfsvs, sfsvs)
+		assert.NoError(t, err)
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+		assert.False(t, renameAside)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		path, rollbackTo, renameAside, resolution, err := fs(ConflictResolutionRollbackToCommonAncestor).resolveConflictByPolicy(diverged, rfsvs, sfsvs)
+		require.NoError(t, err)
+		assert.Equal(t, []*pdu.FilesystemVersion{a, b}, path)
+		assert.Equal(t, a, rollbackTo)
+		assert.False(t, renameAside)
+		assert.Contains(t, resolution, "@a")
+		// zfs rollback -r destroys the receiver-only bookmark, too
+		assert.Contains(t, resolution, "@x")
+		assert.Contains(t, resolution, "#y")
+	})
+
+	t.Run("rollback_sender_has_nothing_new", func(t *testing.T) {
+		_, conflict := IncrementalPath(rfsvs, []*pdu.FilesystemVersion{a})
+		require.IsType(t, &ConflictDiverged{}, conflict)
+		path, rollbackTo, _, _, err := fs(ConflictResolutionRollbackToCommonAncestor).resolveConflictByPolicy(conflict, rfsvs, []*pdu.FilesystemVersion{a})
+		require.NoError(t, err)
+		assert.NotNil(t, path)
+		assert.Empty(t, path)
+		assert.Equal(t, a, rollbackTo)
+	})
+
+	t.Run("rollback_to_bookmark", func(t *testing.T) {
+		// zfs rollback requires a snapshot
+		aBookmark := v("#a", 1)
+		rfsvs := []*pdu.FilesystemVersion{aBookmark, x}
+		_, conflict := IncrementalPath(rfsvs, sfsvs)
+		require.IsType(t, &ConflictDiverged{}, conflict)
+		path, rollbackTo, _, _, err := fs(ConflictResolutionRollbackToCommonAncestor).resolveConflictByPolicy(conflict, rfsvs, sfsvs)
+		assert.Error(t, err)
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+	})
+
+	t.Run("rollback_no_common_ancestor", func(t *testing.T) {
+		path, rollbackTo, _, _, err := fs(ConflictResolutionRollbackToCommonAncestor).resolveConflictByPolicy(noCommonAncestor, []*pdu.FilesystemVersion{x}, sfsvs)
+		assert.NoError(t, err)
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+	})
+
+	t.Run("rollback_remaining_conflict", func(t *testing.T) {
+		// the receiver's versions do not match the conflict, e.g., because they changed in the meantime
+		z := v("@z", 5)
+		path, rollbackTo, _, _, err := fs(ConflictResolutionRollbackToCommonAncestor).resolveConflictByPolicy(diverged, append(rfsvs, z), sfsvs)
+		assert.Error(t, err)
+		assert.Nil(t, path)
+		assert.Nil(t, rollbackTo)
+	})
+
+	t.Run("full_resend_into_new_dataset", func(t *testing.T) {
+		for _, conflict := range []error{diverged, noCommonAncestor} {
+			path, rollbackTo, renameAside, _, err := fs(ConflictResolutionFullResendIntoNewDataset).resolveConflictByPolicy(conflict, rfsvs, sfsvs)
+			require.NoError(t, err)
+			assert.Equal(t, []*pdu.FilesystemVersion{b}, path)
+			assert.Nil(t, rollbackTo)
+			assert.True(t, renameAside)
+		}
+	})
+}
+
+func TestPlanningConflictResolution(t *testing.T) {
+	v := planTestVersion
+	a, x, b, c := v("@a", 1), v("@x", 2), v("@b", 4), v("@c", 5)
+	ctx := context.Background()
+	endpoint := func() *planTestEndpoint {
+		return &planTestEndpoint{
+			sender:   map[string][]*pdu.FilesystemVersion{"pool/fs": {a, b, c}},
+			receiver: map[string][]*pdu.FilesystemVersion{"pool/fs": {a, x}, "pool/old": {a, x}},
+			// x was taken on the receiver and the receiver was written to since
+			modified: map[string]bool{"pool/fs": true, "pool/old": true},
+		}
+	}
+	replicate := func(t *testing.T, steps []*Step) {
+		for _, s := range steps {
+			require.NoError(t, s.doReplication(ctx))
+		}
+	}
+
+	t.Run("rollback_is_done_by_the_first_step", func(t *testing.T) {
+		e := endpoint()
+		fs := e.filesystem("pool/fs", PlannerPolicy{ConflictResolution: ConflictResolutionRollbackToCommonAncestor})
+		steps, err := fs.doPlanning(ctx)
+		require.NoError(t, err)
+		require.Len(t, steps, 2)
+		assert.Equal(t, []*pdu.FilesystemVersion{a, x}, e.receiver["pool/fs"], "planning must not modify the receiver")
+		assert.Equal(t, a, steps[0].rollbackTo)
+		assert.Nil(t, steps[1].rollbackTo)
+		assert.Equal(t, "@a", steps[0].ReportInfo().RollbackTo)
+		assert.NotEmpty(t, fs.ReportInfo().ConflictResolution)
+
+		e.rollbackErr = "dataset is busy"
+		assert.Error(t, steps[0].doReplication(ctx))
+		assert.Equal(t, a, steps[0].rollbackTo, "a failed rollback must be retried")
+		assert.Equal(t, []*pdu.FilesystemVersion{a, x}, e.receiver["pool/fs"])
+
+		e.rollbackErr = ""
+		replicate(t, steps)
+		assert.Nil(t, steps[0].rollbackTo)
+		assert.Equal(t, []*pdu.FilesystemVersion{a, b, c}, e.receiver["pool/fs"])
+		assert.False(t, e.modified["pool/fs"])
+	})
+
+	t.Run("rollback_only_step", func(t *testing.T) {
+		e := endpoint()
+		e.sender["pool/fs"] = []*pdu.FilesystemVersion{a}
+		fs := e.filesystem("pool/fs", PlannerPolicy{ConflictResolution: ConflictResolutionRollbackToCommonAncestor})
+		steps, err := fs.doPlanning(ctx)
+		require.NoError(t, err)
+		require.Len(t, steps, 1, "the conflict must be resolved although the sender has nothing to replicate")
+		assert.True(t, steps[0].rollbackOnly)
+		assert.Equal(t, a, steps[0].rollbackTo)
+		info := steps[0].ReportInfo()
+		assert.True(t, info.RollbackOnly)
+		assert.Equal(t, "@a", info.RollbackTo)
+
+		replicate(t, steps)
+		assert.Equal(t, []*pdu.FilesystemVersion{a}, e.receiver["pool/fs"])
+		assert.False(t, e.modified["pool/fs"])
+
+		steps, err = fs.doPlanning(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, steps)
+	})
+
+	t.Run("rollback_before_rename", func(t *testing.T) {
+		e := endpoint()
+		fs := e.filesystem("pool/fs", PlannerPolicy{ConflictResolution: ConflictResolutionRollbackToCommonAncestor})
+		steps, err := fs.doPlanning(ctx)
+		require.NoError(t, err)
+		// the receiver's filesystem is pool/old, it is renamed to pool/fs by the first step
+		delete(e.receiver, "pool/fs")
+		delete(e.modified, "pool/fs")
+		steps[0].renameFrom = "pool/old"
+		replicate(t, steps)
+		assert.Equal(t, []*pdu.FilesystemVersion{a, b, c}, e.receiver["pool/fs"])
+		assert.NotContains(t, e.receiver, "pool/old")
+	})
+
+	t.Run("rename_aside", func(t *testing.T) {
+		e := endpoint()
+		fs := e.filesystem("pool/fs", PlannerPolicy{ConflictResolution: ConflictResolutionFullResendIntoNewDataset})
+		steps, err := fs.doPlanning(ctx)
+		require.NoError(t, err)
+		require.Len(t, steps, 1)
+		assert.Nil(t, steps[0].from, "must be a full send")
+		assert.Equal(t, c, steps[0].to)
+		assert.True(t, steps[0].renameExistingAside)
+		assert.Nil(t, steps[0].rollbackTo)
+		assert.Equal(t, []*pdu.FilesystemVersion{a, x}, e.receiver["pool/fs"])
+	})
+
+	t.Run("fail", func(t *testing.T) {
+		e := endpoint()
+		fs := e.filesystem("pool/fs", PlannerPolicy{})
+		_, err := fs.doPlanning(ctx)
+		assert.IsType(t, &ConflictDiverged{}, err)
+		assert.Empty(t, fs.ReportInfo().ConflictResolution)
+	})
+}
@@ -0,0 +1,55 @@
+package logic
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// InitialReplication determines the sender snapshots that are replicated to
+// a receiver that does not have any versions of the filesystem.
+// The zero value replicates the most recent snapshot.
+type InitialReplication struct {
+	// replicate all of the sender's snapshots
+	All bool
+	// if > 0, replicate the snapshots created within Since before planning,
+	// or the most recent snapshot if there are none
+	Since time.Duration
+}
+
+// path returns the versions of sfsvs to replicate to an empty receiver:
+// path[0] is sent in full, the remaining ones incrementally from their predecessor.
+// If path is nil, msg describes why.
+func (i InitialReplication) path(sfsvs []*pdu.FilesystemVersion, now time.Time) (path []*pdu.FilesystemVersion, msg string) {
+	var snaps []*pdu.FilesystemVersion
+	for _, v := range SortVersionListByCreateTXGThenBookmarkLTSnapshot(sfsvs) {
+		if v.Type == pdu.FilesystemVersion_Snapshot {
+			snaps = append(snaps, v)
+		}
+	}
+	if len(snaps) == 0 {
+		return nil, "no snapshots available on sender side"
+	}
+	mostRecent := snaps[len(snaps)-1]
+
+	switch {
+	case i.All:
+		return snaps, fmt.Sprintf("start replication at oldest snapshot %s", snaps[0].RelName())
+	case i.Since > 0:
+		cutoff := now.Add(-i.Since)
+		for n, v := range snaps {
+			creation, err := v.CreationAsTime()
+			if err != nil {
+				return nil, fmt.Sprintf("cannot parse creation date of snapshot %s: %s", v.RelName(), err)
+			}
+			if !creation.Before(cutoff) {
+				return snaps[n:], fmt.Sprintf("start replication at oldest snapshot created within %s: %s", i.Since, v.RelName())
+			}
+		}
+		return []*pdu.FilesystemVersion{mostRecent}, fmt.Sprintf("no snapshot created within %s, start replication at most recent snapshot %s", i.Since, mostRecent.RelName())
+	default:
+		return []*pdu.FilesystemVersion{mostRecent}, fmt.Sprintf("start replication at most recent snapshot %s", mostRecent.RelName())
+	}
+}
@@ -0,0 +1,46 @@
+package logic
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestInitialReplicationPath(t *testing.T) {
+	now := time.Date(2020, 6, 1, 0, 0, 0, 0, time.UTC)
+	v := func(name string, typ pdu.FilesystemVersion_VersionType, txg uint64, age time.Duration) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:      name,
+			Type:      typ,
+			Guid:      txg,
+			CreateTXG: txg,
+			Creation:  pdu.FilesystemVersionCreation(now.Add(-age)),
+		}
+	}
+	snap := pdu.FilesystemVersion_Snapshot
+	a := v("a", snap, 1, 72*time.Hour)
+	b := v("b", pdu.FilesystemVersion_Bookmark, 2, 48*time.Hour)
+	c := v("c", snap, 3, 24*time.Hour)
+	d := v("d", snap, 4, time.Hour)
+	sfsvs := []*pdu.FilesystemVersion{d, b, a, c}
+
+	names := func(path []*pdu.FilesystemVersion) (n []string) {
+		for _, v := range path {
+			n = append(n, v.Name)
+		}
+		return n
+	}
+	path := func(i InitialReplication, sfsvs []*pdu.FilesystemVersion) []string {
+		p, _ := i.path(sfsvs, now)
+		return names(p)
+	}
+
+	assert.Equal(t, []string{"d"}, path(InitialReplication{}, sfsvs))
+	assert.Equal(t, []string{"a", "c", "d"}, path(InitialReplication{All: true}, sfsvs))
+	assert.Equal(t, []string{"c", "d"}, path(InitialReplication{Since: 24 * time.Hour}, sfsvs))
+	assert.Equal(t, []string{"d"}, path(InitialReplication{Since: 30 * time.Minute}, sfsvs))
+	assert.Empty(t, path(InitialReplication{All: true}, []*pdu.FilesystemVersion{b}))
+}
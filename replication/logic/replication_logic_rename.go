@@ -0,0 +1,225 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"sync"
+
+	. "github.com/zrepl/zrepl/replication/logic/diff"
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// RenameDetection determines how the planner handles a sender filesystem that the receiver
+// does not have, but that shares snapshots with a receiver filesystem that the sender does not have.
+// This is the case if the filesystem was renamed on the sender (`zfs rename`).
+// Without rename detection, the filesystem is replicated like a new filesystem (full send)
+// and the receiver keeps the filesystem under the old name.
+type RenameDetection int
+
+const (
+	// The receiver's filesystems are not compared with the sender's filesystems.
+	RenameDetectionOff RenameDetection = iota
+	// A detected rename is logged, the filesystem is replicated like a new filesystem.
+	RenameDetectionWarn
+	// The receiver renames its filesystem and the replication continues incrementally.
+	RenameDetectionRename
+)
+
+func (r RenameDetection) String() string {
+	switch r {
+	case RenameDetectionOff:
+		return "off"
+	case RenameDetectionWarn:
+		return "warn"
+	case RenameDetectionRename:
+		return "rename"
+	}
+	panic(fmt.Sprintf("unknown variant %v", int(r)))
+}
+
+func RenameDetectionFromString(s string) (RenameDetection, error) {
+	for _, r := range []RenameDetection{
+		RenameDetectionOff,
+		RenameDetectionWarn,
+		RenameDetectionRename,
+	} {
+		if r.String() == s {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown rename detection %q", s)
+}
+
+// renameDetector finds the receiver filesystem that a sender filesystem was renamed from.
+// It is shared by the filesystems of a planning run.
+type renameDetector struct {
+	receiver Receiver
+	// receiver filesystems that the sender does not have, except placeholders
+	orphans map[string]*pdu.Filesystem
+	// sender filesystems that the receiver does not have
+	newOnSender map[string]bool
+
+	mtx sync.Mutex
+	// versions of the orphans, listed on demand
+	versions map[string][]*pdu.FilesystemVersion
+	// orphan path => sender filesystem that it is renamed to
+	claimed map[string]string
+}
+
+// newRenameDetector returns nil if there are no candidates for renames.
+func newRenameDetector(receiver Receiver, sfss, rfss []*pdu.Filesystem) *renameDetector {
+	d := &renameDetector{
+		receiver:    receiver,
+		orphans:     make(map[string]*pdu.Filesystem),
+		newOnSender: make(map[string]bool),
+		versions:    make(map[string][]*pdu.FilesystemVersion),
+		claimed:     make(map[string]string),
+	}
+	onSender := make(map[string]bool, len(sfss))
+	for _, fs := range sfss {
+		onSender[fs.Path] = true
+	}
+	onReceiver := make(map[string]bool, len(rfss))
+	for _, fs := range rfss {
+		onReceiver[fs.Path] = true
+		if !onSender[fs.Path] && !fs.GetIsPlaceholder() {
+			d.orphans[fs.Path] = fs
+		}
+	}
+	for _, fs := range sfss {
+		if !onReceiver[fs.Path] {
+			d.newOnSender[fs.Path] = true
+		}
+	}
+	if len(d.orphans) == 0 || len(d.newOnSender) == 0 {
+		return nil
+	}
+	return d
+}
+
+// renamedFrom is the result of renameDetector.detect.
+type renamedFrom struct {
+	Orphan   *pdu.Filesystem
+	Versions []*pdu.FilesystemVersion
+	// The orphan is renamed along with a renamed ancestor, which is renamed by another filesystem's step.
+	WithAncestor bool
+}
+
+// detect returns the receiver filesystem that the sender filesystem senderPath with versions sfsvs
+// was renamed from, or nil if there is none or it is ambiguous.
+func (d *renameDetector) detect(ctx context.Context, senderPath string, sfsvs []*pdu.FilesystemVersion) (*renamedFrom, error) {
+	if !d.newOnSender[senderPath] {
+		return nil, nil
+	}
+	log := getLogger(ctx).WithField("filesystem", senderPath)
+
+	senderSnaps := make(map[uint64]bool, len(sfsvs))
+	for _, v := range sfsvs {
+		if v.Type == pdu.FilesystemVersion_Snapshot {
+			senderSnaps[v.GetGuid()] = true
+		}
+	}
+
+	orphanPaths := make([]string, 0, len(d.orphans))
+	for p := range d.orphans {
+		orphanPaths = append(orphanPaths, p)
+	}
+	sort.Strings(orphanPaths)
+
+	var matches []*renamedFrom
+	for _, p := range orphanPaths {
+		rfsvs, err := d.orphanVersions(ctx, p)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range rfsvs {
+			if v.Type == pdu.FilesystemVersion_Snapshot && senderSnaps[v.GetGuid()] {
+				matches = append(matches, &renamedFrom{Orphan: d.orphans[p], Versions: rfsvs})
+				break
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+	if len(matches) > 1 {
+		names := make([]string, len(matches))
+		for i, m := range matches {
+			names[i] = m.Orphan.Path
+		}
+		log.WithField("receiver_filesystems", names).
+			Warn("sender filesystem shares snapshots with multiple receiver filesystems that the sender does not have, cannot determine from which one it was renamed")
+		return nil, nil
+	}
+	m := matches[0]
+	m.WithAncestor = d.renamedWithAncestor(m.Orphan.Path, senderPath)
+
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if other, ok := d.claimed[m.Orphan.Path]; ok && other != senderPath {
+		log.WithField("receiver_filesystem", m.Orphan.Path).WithField("other_filesystem", other).
+			Warn("receiver filesystem shares snapshots with multiple sender filesystems, cannot determine to which one it was renamed")
+		return nil, nil
+	}
+	d.claimed[m.Orphan.Path] = senderPath
+	return m, nil
+}
+
+// renamedWithAncestor returns true if an ancestor of orphan is an orphan, too,
+// and the corresponding ancestor of senderPath is new on the sender,
+// i.e., the ancestor was renamed and renaming it on the receiver renames orphan as well.
+func (d *renameDetector) renamedWithAncestor(orphan, senderPath string) bool {
+	for orphan != "." && senderPath != "." && path.Base(orphan) == path.Base(senderPath) {
+		orphan, senderPath = path.Dir(orphan), path.Dir(senderPath)
+		if _, ok := d.orphans[orphan]; ok && d.newOnSender[senderPath] {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *renameDetector) orphanVersions(ctx context.Context, orphan string) ([]*pdu.FilesystemVersion, error) {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+	if v, ok := d.versions[orphan]; ok {
+		return v, nil
+	}
+	res, err := d.receiver.ListFilesystemVersions(ctx, &pdu.ListFilesystemVersionsReq{Filesystem: orphan})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list versions of receiver filesystem %q for rename detection: %s", orphan, err)
+	}
+	d.versions[orphan] = res.GetVersions()
+	return d.versions[orphan], nil
+}
+
+// handleRename applies fs.policy.RenameDetection to a rename detected by the renameDetector.
+// It returns the receiver's versions to plan with and the receiver filesystem that the first step
+// renames, or skip = true if the filesystem must not be replicated by this attempt.
+func (fs *Filesystem) handleRename(ctx context.Context, renamed *renamedFrom, sfsvs []*pdu.FilesystemVersion) (rfsvs []*pdu.FilesystemVersion, renameFrom string, skip bool) {
+	log := getLogger(ctx).WithField("filesystem", fs.Path).WithField("receiver_filesystem", renamed.Orphan.Path)
+	newFilesystem := []*pdu.FilesystemVersion{}
+
+	if fs.policy.RenameDetection != RenameDetectionRename {
+		log.Warn("filesystem was presumably renamed on the sender, replicating it as a new filesystem")
+		return newFilesystem, "", false
+	}
+	if renamed.Orphan.GetResumeToken() != "" {
+		log.Warn("filesystem was presumably renamed on the sender, but the receiver filesystem has partial receive state, replicating it as a new filesystem")
+		return newFilesystem, "", false
+	}
+	if _, conflict := IncrementalPath(renamed.Versions, sfsvs); conflict != nil {
+		log.WithField("conflict", conflict).
+			Warn("filesystem was presumably renamed on the sender, but cannot continue incrementally, replicating it as a new filesystem")
+		return newFilesystem, "", false
+	}
+	if renamed.WithAncestor {
+		// the ancestor's first step renames the receiver filesystem, even if the ancestor is up to date,
+		// and the next replication run finds the receiver filesystem under the new name
+		log.Info("filesystem was presumably renamed on the sender along with an ancestor, the receiver filesystem is renamed by the ancestor's replication and replicated by the next replication run")
+		return nil, "", true
+	}
+	log.Info("filesystem was presumably renamed on the sender, renaming receiver filesystem")
+	return renamed.Versions, renamed.Orphan.Path, false
+}
@@ -0,0 +1,238 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestRenameDetectionFromString(t *testing.T) {
+	for _, r := range []RenameDetection{
+		RenameDetectionOff,
+		RenameDetectionWarn,
+		RenameDetectionRename,
+	} {
+		parsed, err := RenameDetectionFromString(r.String())
+		require.NoError(t, err)
+		assert.Equal(t, r, parsed)
+	}
+	_, err := RenameDetectionFromString("on")
+	assert.Error(t, err)
+}
+
+// renameTestReceiver only implements ListFilesystemVersions.
+type renameTestReceiver struct {
+	Receiver
+	versions map[string][]*pdu.FilesystemVersion
+	listed   map[string]int
+}
+
+func (r *renameTestReceiver) ListFilesystemVersions(ctx context.Context, req *pdu.ListFilesystemVersionsReq) (*pdu.ListFilesystemVersionsRes, error) {
+	r.listed[req.Filesystem]++
+	v, ok := r.versions[req.Filesystem]
+	if !ok {
+		return nil, fmt.Errorf("filesystem %q does not exist", req.Filesystem)
+	}
+	return &pdu.ListFilesystemVersionsRes{Versions: v}, nil
+}
+
+func TestRenameDetector(t *testing.T) {
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:     name,
+			Type:     pdu.FilesystemVersion_Snapshot,
+			Guid:     guid,
+			Creation: pdu.FilesystemVersionCreation(time.Unix(int64(guid), 0)),
+		}
+	}
+	fss := func(paths ...string) (fss []*pdu.Filesystem) {
+		for _, p := range paths {
+			fss = append(fss, &pdu.Filesystem{Path: p})
+		}
+		return fss
+	}
+
+	receiver := &renameTestReceiver{
+		versions: map[string][]*pdu.FilesystemVersion{
+			"pool/old":         {snap("a", 1), snap("b", 2)},
+			"pool/old/child":   {snap("a", 11)},
+			"pool/unrelated":   {snap("x", 21)},
+			"pool/copy1":       {snap("c", 31)},
+			"pool/copy2":       {snap("c", 31)},
+			"pool/placeholder": {},
+		},
+		listed: make(map[string]int),
+	}
+	rfss := fss("pool/old", "pool/old/child", "pool/unrelated", "pool/copy1", "pool/copy2", "pool/existing")
+	rfss = append(rfss, &pdu.Filesystem{Path: "pool/placeholder", IsPlaceholder: true})
+	sfss := fss("pool/new", "pool/new/child", "pool/other", "pool/existing", "pool/dup")
+
+	d := newRenameDetector(receiver, sfss, rfss)
+	require.NotNil(t, d)
+	assert.NotContains(t, d.orphans, "pool/placeholder")
+	assert.NotContains(t, d.orphans, "pool/existing")
+	ctx := context.Background()
+
+	t.Run("renamed", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/new", []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2), snap("c", 3)})
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "pool/old", r.Orphan.Path)
+		assert.Len(t, r.Versions, 2)
+		assert.False(t, r.WithAncestor)
+	})
+
+	t.Run("renamed_with_ancestor", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/new/child", []*pdu.FilesystemVersion{snap("a", 11), snap("b", 12)})
+		require.NoError(t, err)
+		require.NotNil(t, r)
+		assert.Equal(t, "pool/old/child", r.Orphan.Path)
+		assert.True(t, r.WithAncestor)
+	})
+
+	t.Run("no_shared_snapshots", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/other", []*pdu.FilesystemVersion{snap("a", 41)})
+		require.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("not_new_on_sender", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/existing", []*pdu.FilesystemVersion{snap("a", 1)})
+		require.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/dup", []*pdu.FilesystemVersion{snap("c", 31)})
+		require.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("claimed_by_other_filesystem", func(t *testing.T) {
+		r, err := d.detect(ctx, "pool/other", []*pdu.FilesystemVersion{snap("a", 1)})
+		require.NoError(t, err)
+		assert.Nil(t, r)
+	})
+
+	t.Run("versions_are_listed_once", func(t *testing.T) {
+		for p, n := range receiver.listed {
+			assert.Equal(t, 1, n, "%q", p)
+		}
+	})
+
+	t.Run("no_candidates", func(t *testing.T) {
+		assert.Nil(t, newRenameDetector(receiver, fss("pool/a"), fss("pool/a")))
+		assert.Nil(t, newRenameDetector(receiver, fss("pool/a", "pool/b"), fss("pool/a")))
+		assert.Nil(t, newRenameDetector(receiver, fss("pool/a"), fss("pool/a", "pool/b")))
+	})
+}
+
+func TestHandleRename(t *testing.T) {
+	snap := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:     name,
+			Type:     pdu.FilesystemVersion_Snapshot,
+			Guid:     guid,
+			Creation: pdu.FilesystemVersionCreation(time.Unix(int64(guid), 0)),
+		}
+	}
+	sfsvs := []*pdu.FilesystemVersion{snap("a", 1), snap("b", 2)}
+	renamed := &renamedFrom{
+		Orphan:   &pdu.Filesystem{Path: "pool/old"},
+		Versions: []*pdu.FilesystemVersion{snap("a", 1)},
+	}
+	ctx := context.Background()
+
+	fs := &Filesystem{Path: "pool/new", policy: PlannerPolicy{RenameDetection: RenameDetectionWarn}}
+	rfsvs, renameFrom, skip := fs.handleRename(ctx, renamed, sfsvs)
+	assert.Empty(t, rfsvs)
+	assert.Equal(t, "", renameFrom)
+	assert.False(t, skip)
+
+	fs.policy.RenameDetection = RenameDetectionRename
+	rfsvs, renameFrom, skip = fs.handleRename(ctx, renamed, sfsvs)
+	assert.Equal(t, renamed.Versions, rfsvs)
+	assert.Equal(t, "pool/old", renameFrom)
+	assert.False(t, skip)
+
+	withAncestor := *renamed
+	withAncestor.WithAncestor = true
+	_, _, skip = fs.handleRename(ctx, &withAncestor, sfsvs)
+	assert.True(t, skip)
+
+	diverged := *renamed
+	diverged.Versions = []*pdu.FilesystemVersion{snap("a", 1), snap("x", 3)}
+	rfsvs, renameFrom, skip = fs.handleRename(ctx, &diverged, sfsvs)
+	assert.Empty(t, rfsvs)
+	assert.Equal(t, "", renameFrom)
+	assert.False(t, skip)
+
+	resumable := *renamed
+	resumable.Orphan = &pdu.Filesystem{Path: "pool/old", ResumeToken: "token"}
+	_, renameFrom, _ = fs.handleRename(ctx, &resumable, sfsvs)
+	assert.Equal(t, "", renameFrom)
+}
+
+func TestPlanningRenameOnlyStep(t *testing.T) {
+	v := planTestVersion
+	a, b, c := v("@a", 1), v("@b", 2), v("@c", 3)
+	ctx := context.Background()
+	e := &planTestEndpoint{
+		sender: map[string][]*pdu.FilesystemVersion{
+			"pool/new":       {a},
+			"pool/new/child": {b, c},
+		},
+		receiver: map[string][]*pdu.FilesystemVersion{
+			"pool/old":       {a},
+			"pool/old/child": {b},
+		},
+	}
+	sfss := []*pdu.Filesystem{{Path: "pool/new"}, {Path: "pool/new/child"}}
+	rfss := []*pdu.Filesystem{{Path: "pool/old"}, {Path: "pool/old/child"}}
+	policy := PlannerPolicy{RenameDetection: RenameDetectionRename}
+	d := newRenameDetector(planTestSide{e, e.receiver, nil}, sfss, rfss)
+	require.NotNil(t, d)
+	newFS := func(path string) *Filesystem {
+		fs := e.filesystem(path, policy)
+		fs.receiverFS = nil
+		fs.renameDetector = d
+		return fs
+	}
+
+	// the child's receiver filesystem is renamed along with its parent
+	child := newFS("pool/new/child")
+	steps, err := child.doPlanning(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, steps)
+
+	// the parent is up to date, it must be renamed nonetheless
+	parent := newFS("pool/new")
+	steps, err = parent.doPlanning(ctx)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.True(t, steps[0].renameOnly)
+	assert.Equal(t, "pool/old", steps[0].renameFrom)
+	info := steps[0].ReportInfo()
+	assert.True(t, info.RenameOnly)
+	assert.Equal(t, "pool/old", info.RenameFrom)
+
+	require.NoError(t, steps[0].doReplication(ctx))
+	assert.Equal(t, map[string][]*pdu.FilesystemVersion{
+		"pool/new":       {a},
+		"pool/new/child": {b},
+	}, e.receiver)
+
+	// the next replication run replicates the child incrementally
+	child = e.filesystem("pool/new/child", policy)
+	steps, err = child.doPlanning(ctx)
+	require.NoError(t, err)
+	require.Len(t, steps, 1)
+	assert.Equal(t, b, steps[0].from)
+	assert.Equal(t, c, steps[0].to)
+}
@@ -0,0 +1,94 @@
+package logic
+
+import (
+	"fmt"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+// StepStrategy determines how the incremental path of a filesystem is split into replication steps.
+type StepStrategy int
+
+const (
+	// One step per snapshot (zfs send -i).
+	StepStrategyIndividual StepStrategy = iota
+	// One step for all consecutive snapshots of the incremental path (zfs send -I).
+	// Steps that start at a bookmark are not batched because zfs send -I requires a snapshot as incremental source.
+	// Steps are not batched across snapshots that the sender excludes from replication.
+	StepStrategyBatched
+)
+
+func (s StepStrategy) String() string {
+	switch s {
+	case StepStrategyIndividual:
+		return "individual"
+	case StepStrategyBatched:
+		return "batched"
+	}
+	panic(fmt.Sprintf("unknown variant %v", int(s)))
+}
+
+func StepStrategyFromString(s string) (StepStrategy, error) {
+	for _, st := range []StepStrategy{StepStrategyIndividual, StepStrategyBatched} {
+		if st.String() == s {
+			return st, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown step strategy %q", s)
+}
+
+// incrementalSteps returns the incremental steps from path[0] to path[len(path)-1] according to fs.policy.StepStrategy.
+// excluded are the CreateTXGs of snapshots that the sender excludes from replication
+// (pdu.ListFilesystemVersionsRes.ExcludedSnapshotCreateTXGs), batched steps never span them.
+func (fs *Filesystem) incrementalSteps(path []*pdu.FilesystemVersion, excluded []uint64) []*Step {
+	step := func(from, to *pdu.FilesystemVersion, intermediates []*pdu.FilesystemVersion) *Step {
+		return &Step{
+			parent:        fs,
+			sender:        fs.sender,
+			receiver:      fs.receiver,
+			from:          from,
+			to:            to,
+			intermediates: intermediates,
+			encrypt:       fs.policy.EncryptedSend,
+		}
+	}
+
+	steps := make([]*Step, 0, len(path))
+	if fs.policy.StepStrategy == StepStrategyIndividual {
+		for i := 0; i < len(path)-1; i++ {
+			steps = append(steps, step(path[i], path[i+1], nil))
+		}
+		return steps
+	}
+
+	// whether path[i] => path[i+1] can be part of a batched step
+	batchable := func(i int) bool {
+		if path[i].Type != pdu.FilesystemVersion_Snapshot {
+			return false
+		}
+		for _, txg := range excluded {
+			if txg > path[i].CreateTXG && txg < path[i+1].CreateTXG {
+				return false
+			}
+		}
+		return true
+	}
+	for i := 0; i < len(path)-1; {
+		if !batchable(i) {
+			steps = append(steps, step(path[i], path[i+1], nil))
+			i++
+			continue
+		}
+		last := i + 1
+		for last < len(path)-1 && batchable(last) {
+			last++
+		}
+		var intermediates []*pdu.FilesystemVersion
+		if last > i+1 {
+			intermediates = path[i+1 : last]
+		}
+		steps = append(steps, step(path[i], path[last], intermediates))
+		i = last
+	}
+	return steps
+}
@@ -0,0 +1,144 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+)
+
+func TestIncrementalSteps(t *testing.T) {
+	v := func(relName string) *pdu.FilesystemVersion {
+		typ := pdu.FilesystemVersion_Snapshot
+		if relName[0] == '#' {
+			typ = pdu.FilesystemVersion_Bookmark
+		}
+		return &pdu.FilesystemVersion{
+			Name:     relName[1:],
+			Type:     typ,
+			Creation: pdu.FilesystemVersionCreation(time.Unix(0, 0)),
+		}
+	}
+	path := func(relNames ...string) (p []*pdu.FilesystemVersion) {
+		for _, n := range relNames {
+			p = append(p, v(n))
+		}
+		return p
+	}
+	steps := func(strategy StepStrategy, p []*pdu.FilesystemVersion) (s []string) {
+		fs := &Filesystem{Path: "pool/fs", policy: PlannerPolicy{StepStrategy: strategy}}
+		for _, step := range fs.incrementalSteps(p, nil) {
+			s = append(s, step.String())
+		}
+		return s
+	}
+
+	assert.Equal(t, []string{"pool/fs(@a => @b)", "pool/fs(@b => @c)", "pool/fs(@c => @d)"},
+		steps(StepStrategyIndividual, path("@a", "@b", "@c", "@d")))
+
+	assert.Equal(t, []string{"pool/fs(@a => @d, 2 intermediate snapshots)"},
+		steps(StepStrategyBatched, path("@a", "@b", "@c", "@d")))
+	assert.Equal(t, []string{"pool/fs(@a => @b)"},
+		steps(StepStrategyBatched, path("@a", "@b")))
+	assert.Equal(t, []string{"pool/fs(#a => @b)", "pool/fs(@b => @d, 1 intermediate snapshots)"},
+		steps(StepStrategyBatched, path("#a", "@b", "@c", "@d")))
+	assert.Equal(t, []string{"pool/fs(#a => @b)"},
+		steps(StepStrategyBatched, path("#a", "@b")))
+	assert.Empty(t, steps(StepStrategyBatched, path("@a")))
+}
+
+func TestBatchedStepContinues(t *testing.T) {
+	v := func(name string, guid uint64) *pdu.FilesystemVersion {
+		return &pdu.FilesystemVersion{
+			Name:     name,
+			Type:     pdu.FilesystemVersion_Snapshot,
+			Guid:     guid,
+			Creation: pdu.FilesystemVersionCreation(time.Unix(int64(guid), 0)),
+		}
+	}
+	a, b, c, d, e := v("a", 1), v("b", 2), v("c", 3), v("d", 4), v("e", 5)
+	fs := &Filesystem{Path: "pool/fs", policy: PlannerPolicy{StepStrategy: StepStrategyBatched}}
+	step := func(from, to *pdu.FilesystemVersion) *Step {
+		return &Step{parent: fs, from: from, to: to}
+	}
+
+	batched := fs.incrementalSteps([]*pdu.FilesystemVersion{a, b, c, d}, nil)
+	require.Len(t, batched, 1)
+	continues := func(other *Step) [2]bool {
+		c, end := batched[0].Continues(other)
+		return [2]bool{c, end}
+	}
+
+	// the resume step of the interrupted receive of c, followed by the rest of the range
+	assert.Equal(t, [2]bool{true, false}, continues(step(b, c)))
+	assert.Equal(t, [2]bool{true, true}, continues(step(c, d)))
+	assert.Equal(t, [2]bool{true, false}, continues(step(a, b)))
+
+	assert.Equal(t, [2]bool{false, false}, continues(step(nil, c)), "full sends do not continue a batched step")
+	assert.Equal(t, [2]bool{false, false}, continues(step(c, b)))
+	assert.Equal(t, [2]bool{false, false}, continues(step(c, e)), "must not replicate beyond the target")
+	assert.Equal(t, [2]bool{false, false}, continues(step(e, d)))
+
+	notBatched := step(a, b)
+	ok, _ := notBatched.Continues(step(a, b))
+	assert.False(t, ok, "only batched steps are continued, others are retried")
+	assert.True(t, notBatched.TargetEquals(step(a, b)))
+	assert.False(t, batched[0].TargetEquals(step(b, d)))
+}
+
+func TestIncrementalStepsExcludedSnapshots(t *testing.T) {
+	v := func(relName string, txg uint64) *pdu.FilesystemVersion {
+		typ := pdu.FilesystemVersion_Snapshot
+		if relName[0] == '#' {
+			typ = pdu.FilesystemVersion_Bookmark
+		}
+		return &pdu.FilesystemVersion{
+			Name:      relName[1:],
+			Type:      typ,
+			CreateTXG: txg,
+			Creation:  pdu.FilesystemVersionCreation(time.Unix(0, 0)),
+		}
+	}
+	path := []*pdu.FilesystemVersion{v("@a", 10), v("@b", 20), v("@c", 30), v("@d", 40), v("@e", 50), v("@f", 60)}
+	steps := func(strategy StepStrategy, path []*pdu.FilesystemVersion, excluded ...uint64) (s []string) {
+		fs := &Filesystem{Path: "pool/fs", policy: PlannerPolicy{StepStrategy: strategy}}
+		for _, step := range fs.incrementalSteps(path, excluded) {
+			s = append(s, step.String())
+		}
+		return s
+	}
+
+	assert.Equal(t, []string{"pool/fs(@a => @c, 1 intermediate snapshots)", "pool/fs(@c => @d)", "pool/fs(@d => @f, 1 intermediate snapshots)"},
+		steps(StepStrategyBatched, path, 35))
+	assert.Equal(t, []string{"pool/fs(@a => @b)", "pool/fs(@b => @c)", "pool/fs(@c => @f, 2 intermediate snapshots)"},
+		steps(StepStrategyBatched, path, 15, 25, 26))
+	assert.Equal(t, []string{"pool/fs(@a => @f, 4 intermediate snapshots)"},
+		steps(StepStrategyBatched, path, 5, 70), "excluded snapshots outside of the path")
+	assert.Equal(t, []string{"pool/fs(#a => @b)", "pool/fs(@b => @c)", "pool/fs(@c => @f, 2 intermediate snapshots)"},
+		steps(StepStrategyBatched, append([]*pdu.FilesystemVersion{v("#a", 10)}, path[1:]...), 25))
+	assert.Len(t, steps(StepStrategyIndividual, path, 15, 25), 5)
+}
+
+func TestPlanningBatchedWithSnapshotFilter(t *testing.T) {
+	v := planTestVersion
+	a, b, c, d, e := v("@a", 1), v("@b", 2), v("@c", 4), v("@d", 5), v("@e", 6)
+	ep := &planTestEndpoint{
+		// the sender excludes a snapshot with CreateTXG 3 from replication, e.g. @tmp-1
+		sender:   map[string][]*pdu.FilesystemVersion{"pool/fs": {a, b, c, d, e}},
+		excluded: []uint64{3},
+		receiver: map[string][]*pdu.FilesystemVersion{"pool/fs": {a}},
+	}
+	fs := ep.filesystem("pool/fs", PlannerPolicy{StepStrategy: StepStrategyBatched})
+	steps, err := fs.doPlanning(context.Background())
+	require.NoError(t, err)
+	var s []string
+	for _, step := range steps {
+		s = append(s, step.String())
+	}
+	assert.Equal(t, []string{"pool/fs(@a => @b)", "pool/fs(@b => @c)", "pool/fs(@c => @e, 1 intermediate snapshots)"}, s)
+	assert.Empty(t, steps[1].intermediates, "the step across the excluded snapshot must use zfs send -i")
+}
@@ -9,7 +9,9 @@ type Report struct {
 	StartAt, FinishAt                      time.Time
 	WaitReconnectSince, WaitReconnectUntil time.Time
 	WaitReconnectError                     *TimedError
-	Attempts                               []*AttemptReport
+	// non-zero while the run waits for the next attempt after a transient error
+	NextAttemptAt time.Time
+	Attempts      []*AttemptReport
 }
 
 var _, _ = json.Marshal(&Report{})
@@ -40,6 +42,8 @@ type AttemptReport struct {
 	StartAt, FinishAt time.Time
 	PlanError         *TimedError
 	Filesystems       []*FilesystemReport
+	// Valid in State = AttemptFanOutFSs, nil otherwise
+	Throughput *Throughput `json:",omitempty"`
 }
 
 type AttemptState string
@@ -75,14 +79,36 @@ type FilesystemReport struct {
 	// Valid in State = FilesystemStepping
 	CurrentStep int
 	Steps       []*StepReport
+
+	// true while the filesystem is being planned or a step is being executed,
+	// false while it waits for one of the job's concurrent replication slots
+	Active bool
+	// Position in the order in which waiting filesystems get a replication slot,
+	// starting at 1. 0 if the filesystem is not waiting.
+	QueuePosition int
+
+	// Number of retries of the filesystem in this attempt after transient errors
+	Retries int
+	// Non-zero while the filesystem waits for its next retry after a transient error
+	NextRetryAt time.Time
+
+	// Valid in State = FilesystemStepping, nil otherwise
+	Throughput *Throughput `json:",omitempty"`
 }
 
 type FilesystemInfo struct {
 	Name string
+	// Filesystems with higher priority are planned and replicated first.
+	Priority int
+	// Describes how a conflict between sender and receiver was resolved
+	// automatically during planning, empty if there was none.
+	ConflictResolution string
 }
 
 type StepReport struct {
 	Info *StepInfo
+	// Valid while the step is being executed, nil otherwise
+	Throughput *Throughput `json:",omitempty"`
 }
 
 type EncryptedEnum string
@@ -99,6 +125,16 @@ type StepInfo struct {
 	Encrypted       EncryptedEnum
 	BytesExpected   int64
 	BytesReplicated int64
+	// the snapshots between From and To that are replicated in the same stream (zfs send -I)
+	Intermediates []string `json:",omitempty"`
+	// if not empty, the receiver's snapshot that the receiver is rolled back to before the step (zfs rollback -r)
+	RollbackTo string `json:",omitempty"`
+	// the step only rolls back the receiver, From and To are the common ancestor
+	RollbackOnly bool `json:",omitempty"`
+	// if not empty, the receiver's filesystem that is renamed to the step's filesystem (rename detection)
+	RenameFrom string `json:",omitempty"`
+	// the step only renames the receiver's filesystem, From and To are its most recent version
+	RenameOnly bool `json:",omitempty"`
 }
 
 func (a *AttemptReport) BytesSum() (expected, replicated int64, containsInvalidSizeEstimates bool) {
@@ -115,7 +151,7 @@ func (f *FilesystemReport) BytesSum() (expected, replicated int64, containsInval
 	for _, step := range f.Steps {
 		expected += step.Info.BytesExpected
 		replicated += step.Info.BytesReplicated
-		containsInvalidSizeEstimates = containsInvalidSizeEstimates || step.Info.BytesExpected == 0
+		containsInvalidSizeEstimates = containsInvalidSizeEstimates || (step.Info.BytesExpected == 0 && !step.Info.RollbackOnly && !step.Info.RenameOnly)
 	}
 	return
 }
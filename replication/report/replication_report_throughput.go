@@ -0,0 +1,68 @@
+package report
+
+import (
+	"math"
+	"time"
+)
+
+// Throughput is the smoothed replication throughput of a step, a filesystem or an attempt
+// while it is being replicated.
+type Throughput struct {
+	BytesPerSecond int64
+	// Estimated time until the expected bytes are replicated at BytesPerSecond.
+	// 0 if unknown, e.g. because there is no size estimate or no progress.
+	ETA time.Duration
+}
+
+// ThroughputTimeConstant is the time constant of the exponential smoothing of ThroughputEstimator,
+// i.e., the age at which a throughput sample's weight has decayed to 1/e.
+const ThroughputTimeConstant = 10 * time.Second
+
+// ThroughputEstimator computes an exponentially smoothed throughput
+// from samples of a monotonically increasing byte count.
+//
+// The zero value is ready to use. ThroughputEstimator is not safe for concurrent use.
+type ThroughputEstimator struct {
+	haveSample bool
+	lastAt     time.Time
+	lastBytes  int64
+
+	haveRate       bool
+	bytesPerSecond float64
+}
+
+// Update adds a sample of the total number of bytes replicated at time now.
+// If bytes is less than in the previous sample (e.g. because the filesystem was re-planned),
+// the sample only becomes the baseline for the next sample.
+func (e *ThroughputEstimator) Update(now time.Time, bytes int64) {
+	if !e.haveSample || bytes < e.lastBytes {
+		e.haveSample, e.lastAt, e.lastBytes = true, now, bytes
+		return
+	}
+	dt := now.Sub(e.lastAt)
+	if dt <= 0 {
+		return
+	}
+	rate := float64(bytes-e.lastBytes) / dt.Seconds()
+	if e.haveRate {
+		// the weight of the new sample depends on its duration, which makes
+		// the result independent of the sampling interval
+		alpha := 1 - math.Exp(-dt.Seconds()/ThroughputTimeConstant.Seconds())
+		e.bytesPerSecond += alpha * (rate - e.bytesPerSecond)
+	} else {
+		e.bytesPerSecond = rate
+		e.haveRate = true
+	}
+	e.lastAt, e.lastBytes = now, bytes
+}
+
+// Report returns the current throughput estimate and the ETA for the given byte counts.
+func (e *ThroughputEstimator) Report(expected, replicated int64) *Throughput {
+	t := &Throughput{
+		BytesPerSecond: int64(e.bytesPerSecond),
+	}
+	if t.BytesPerSecond > 0 && expected > replicated {
+		t.ETA = time.Duration(float64(expected-replicated) / e.bytesPerSecond * float64(time.Second))
+	}
+	return t
+}
@@ -0,0 +1,38 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThroughputEstimator(t *testing.T) {
+	var e ThroughputEstimator
+	t0 := time.Unix(1000, 0)
+	assert.Equal(t, &Throughput{}, e.Report(100, 0))
+
+	// constant rate of 10 B/s
+	for i := 0; i <= 10; i++ {
+		e.Update(t0.Add(time.Duration(i)*time.Second), int64(i*10))
+	}
+	assert.Equal(t, &Throughput{BytesPerSecond: 10, ETA: 5 * time.Second}, e.Report(150, 100))
+	assert.Equal(t, time.Duration(0), e.Report(100, 100).ETA, "no ETA when done")
+	assert.Equal(t, time.Duration(0), e.Report(0, 100).ETA, "no ETA without size estimate")
+
+	// the estimate converges towards the new rate, independent of the sampling interval
+	t1 := t0.Add(10 * time.Second)
+	a, b := e, e
+	a.Update(t1.Add(ThroughputTimeConstant), 100+int64(ThroughputTimeConstant.Seconds())*20)
+	for i := 1; i <= 10; i++ {
+		d := time.Duration(i) * ThroughputTimeConstant / 10
+		b.Update(t1.Add(d), 100+int64(d.Seconds())*20)
+	}
+	assert.InDelta(t, a.Report(0, 0).BytesPerSecond, b.Report(0, 0).BytesPerSecond, 1)
+	assert.True(t, a.Report(0, 0).BytesPerSecond > 10 && a.Report(0, 0).BytesPerSecond < 20)
+
+	// a decreasing byte count only resets the baseline
+	before := b.Report(0, 0)
+	b.Update(t1.Add(ThroughputTimeConstant+time.Second), 0)
+	assert.Equal(t, before, b.Report(0, 0))
+}
@@ -0,0 +1,198 @@
+// Package compression implements the block compression algorithms that can be
+// used for the ZFS stream frames of a data connection, and their negotiation
+// as a versionhandshake extension.
+package compression
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4"
+)
+
+type Algorithm string
+
+const (
+	None Algorithm = ""
+	Zstd Algorithm = "zstd"
+	LZ4  Algorithm = "lz4"
+)
+
+// MaxBlockSize is the maximum size of a block passed to or returned by a Codec.
+const MaxBlockSize = 1 << 22
+
+// AlgorithmsFromConfig validates the algorithm names of a config
+// `compression` field. Order is preserved, duplicates are rejected.
+func AlgorithmsFromConfig(in []string) ([]Algorithm, error) {
+	res := make([]Algorithm, 0, len(in))
+	seen := make(map[Algorithm]bool, len(in))
+	for _, name := range in {
+		a := Algorithm(name)
+		switch a {
+		case Zstd, LZ4:
+		default:
+			return nil, fmt.Errorf("unknown compression algorithm %q", name)
+		}
+		if seen[a] {
+			return nil, fmt.Errorf("duplicate compression algorithm %q", name)
+		}
+		seen[a] = true
+		res = append(res, a)
+	}
+	return res, nil
+}
+
+// the following is a protocol constant
+const handshakeExtensionPrefix = "STREAM_COMPRESSION="
+
+// HandshakeExtensions returns the versionhandshake extensions that announce algs
+// to the peer, or nil if algs is empty.
+func HandshakeExtensions(algs []Algorithm) []string {
+	if len(algs) == 0 {
+		return nil
+	}
+	names := make([]string, len(algs))
+	for i := range algs {
+		names[i] = string(algs[i])
+	}
+	return []string{handshakeExtensionPrefix + strings.Join(names, ",")}
+}
+
+func algorithmsFromHandshakeExtensions(exts []string) []Algorithm {
+	for _, ext := range exts {
+		if !strings.HasPrefix(ext, handshakeExtensionPrefix) {
+			continue
+		}
+		var algs []Algorithm
+		for _, name := range strings.Split(strings.TrimPrefix(ext, handshakeExtensionPrefix), ",") {
+			algs = append(algs, Algorithm(name))
+		}
+		return algs
+	}
+	return nil
+}
+
+// Negotiate determines the algorithm to use from the versionhandshake extensions
+// sent by the connecting and the listening side of a connection.
+// The result is the first algorithm in the connecter's list that is also in
+// the listener's list and known to this implementation.
+// It is None if there is no such algorithm, e.g. because the peer predates
+// stream compression or has it disabled.
+//
+// Both sides of a connection compute the same result.
+func Negotiate(connecterExtensions, listenerExtensions []string) Algorithm {
+	listener := algorithmsFromHandshakeExtensions(listenerExtensions)
+	for _, c := range algorithmsFromHandshakeExtensions(connecterExtensions) {
+		if c != Zstd && c != LZ4 {
+			continue
+		}
+		for _, l := range listener {
+			if c == l {
+				return c
+			}
+		}
+	}
+	return None
+}
+
+// A Codec compresses and decompresses independent blocks of data.
+// Codecs are safe for concurrent use.
+type Codec interface {
+	Algorithm() Algorithm
+	// Compress appends the compressed form of src to dst.
+	// ok is false if src does not compress, in which case the contents of res are undefined.
+	Compress(dst, src []byte) (res []byte, ok bool)
+	// Decompress appends the decompressed form of src to dst.
+	// The decompressed data must not exceed MaxBlockSize.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// NewCodec returns nil if a is None.
+// It panics if a is not a known algorithm.
+func NewCodec(a Algorithm) Codec {
+	switch a {
+	case None:
+		return nil
+	case Zstd:
+		return zstdCodec
+	case LZ4:
+		return lz4Codec{}
+	default:
+		panic(fmt.Sprintf("unknown compression algorithm %q", a))
+	}
+}
+
+type zstdCodecT struct {
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+}
+
+var zstdCodec = func() *zstdCodecT {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	if err != nil {
+		panic(err)
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxBlockSize))
+	if err != nil {
+		panic(err)
+	}
+	return &zstdCodecT{enc, dec}
+}()
+
+func (c *zstdCodecT) Algorithm() Algorithm { return Zstd }
+
+func (c *zstdCodecT) Compress(dst, src []byte) ([]byte, bool) {
+	res := c.enc.EncodeAll(src, dst)
+	return res, len(res)-len(dst) < len(src)
+}
+
+func (c *zstdCodecT) Decompress(dst, src []byte) ([]byte, error) {
+	res, err := c.dec.DecodeAll(src, dst)
+	if err != nil {
+		return dst, err
+	}
+	if len(res)-len(dst) > MaxBlockSize {
+		return dst, fmt.Errorf("zstd: decompressed block exceeds maximum size")
+	}
+	return res, nil
+}
+
+type lz4Codec struct{}
+
+// lz4.CompressBlock requires a hash table of 64k entries, reuse them
+var lz4HashTables = sync.Pool{
+	New: func() interface{} { return make([]int, 1<<16) },
+}
+
+func grow(dst []byte, n int) []byte {
+	if cap(dst)-len(dst) >= n {
+		return dst
+	}
+	res := make([]byte, len(dst), len(dst)+n)
+	copy(res, dst)
+	return res
+}
+
+func (lz4Codec) Algorithm() Algorithm { return LZ4 }
+
+func (lz4Codec) Compress(dst, src []byte) ([]byte, bool) {
+	dst = grow(dst, lz4.CompressBlockBound(len(src)))
+	ht := lz4HashTables.Get().([]int)
+	defer lz4HashTables.Put(ht)
+	n, err := lz4.CompressBlock(src, dst[len(dst):cap(dst)], ht)
+	if err != nil || n == 0 || n >= len(src) {
+		return dst, false
+	}
+	return dst[:len(dst)+n], true
+}
+
+func (lz4Codec) Decompress(dst, src []byte) ([]byte, error) {
+	dst = grow(dst, MaxBlockSize)
+	n, err := lz4.UncompressBlock(src, dst[len(dst):len(dst)+MaxBlockSize])
+	if err != nil {
+		return dst, err
+	}
+	return dst[:len(dst)+n], nil
+}
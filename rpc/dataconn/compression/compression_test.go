@@ -0,0 +1,72 @@
+package compression
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiate(t *testing.T) {
+	ext := func(algs ...Algorithm) []string { return HandshakeExtensions(algs) }
+
+	tcs := []struct {
+		name                string
+		connecter, listener []string
+		expect              Algorithm
+	}{
+		{"both_disabled", nil, nil, None},
+		{"listener_disabled", ext(Zstd), nil, None},
+		{"connecter_disabled", nil, ext(Zstd, LZ4), None},
+		{"connecter_preference", ext(LZ4, Zstd), ext(Zstd, LZ4), LZ4},
+		{"intersection", ext(Zstd, LZ4), ext(LZ4), LZ4},
+		{"disjoint", ext(Zstd), ext(LZ4), None},
+		{"unknown_algorithm_from_newer_peer", []string{"STREAM_COMPRESSION=brotli,zstd"}, []string{"STREAM_COMPRESSION=zstd,brotli"}, Zstd},
+		{"other_extensions", []string{"FOO", "STREAM_COMPRESSION=lz4"}, []string{"STREAM_COMPRESSION=lz4", "BAR"}, LZ4},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expect, Negotiate(tc.connecter, tc.listener))
+		})
+	}
+}
+
+func TestAlgorithmsFromConfig(t *testing.T) {
+	algs, err := AlgorithmsFromConfig([]string{"lz4", "zstd"})
+	require.NoError(t, err)
+	assert.Equal(t, []Algorithm{LZ4, Zstd}, algs)
+
+	_, err = AlgorithmsFromConfig([]string{"gzip"})
+	assert.Error(t, err)
+	_, err = AlgorithmsFromConfig([]string{"zstd", "zstd"})
+	assert.Error(t, err)
+}
+
+func TestCodecs(t *testing.T) {
+	compressible := bytes.Repeat([]byte("zrepl"), 1<<16)
+	random := make([]byte, 1<<16)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	for _, a := range []Algorithm{Zstd, LZ4} {
+		t.Run(string(a), func(t *testing.T) {
+			c := NewCodec(a)
+			require.Equal(t, a, c.Algorithm())
+
+			prefix := []byte{0x23}
+			compressed, ok := c.Compress(append([]byte(nil), prefix...), compressible)
+			require.True(t, ok)
+			assert.Equal(t, prefix, compressed[:len(prefix)])
+			assert.True(t, len(compressed) < len(compressible))
+
+			decompressed, err := c.Decompress(nil, compressed[len(prefix):])
+			require.NoError(t, err)
+			assert.Equal(t, compressible, decompressed)
+
+			_, ok = c.Compress(nil, random)
+			assert.False(t, ok)
+		})
+	}
+	assert.Nil(t, NewCodec(None))
+}
@@ -77,8 +77,12 @@ func (c *Client) recv(ctx context.Context, conn *stream.Conn, res proto.Message)
 	}
 	header := string(headerBuf)
 	if strings.HasPrefix(header, responseHeaderHandlerErrorPrefix) {
+		msg := strings.TrimPrefix(header, responseHeaderHandlerErrorPrefix)
+		if strings.HasPrefix(msg, responseHeaderPermissionDeniedPrefix) {
+			return &PermissionDeniedError{strings.TrimPrefix(msg, responseHeaderPermissionDeniedPrefix)}
+		}
 		// FIXME distinguishable error type
-		return &RemoteHandlerError{strings.TrimPrefix(header, responseHeaderHandlerErrorPrefix)}
+		return &RemoteHandlerError{msg}
 	}
 	if !strings.HasPrefix(header, responseHeaderHandlerOk) {
 		return &ProtocolError{fmt.Errorf("invalid header: %q", header)}
@@ -100,6 +104,7 @@ func (c *Client) getWire(ctx context.Context) (*stream.Conn, error) {
 		return nil, err
 	}
 	conn := stream.Wrap(nc, HeartbeatInterval, HeartbeatPeerTimeout)
+	conn.SetCompression(negotiatedCompression(nc, true))
 	return conn, nil
 }
 
@@ -82,12 +82,15 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 	s.log.Debug("serveConn begin")
 	defer s.log.Debug("serveConn done")
 
+	codec := negotiatedCompression(nc, false)
+
 	ctx := context.Background()
 	if s.wi != nil {
 		ctx, nc = s.wi(ctx, nc)
 	}
 
 	c := stream.Wrap(nc, HeartbeatInterval, HeartbeatPeerTimeout)
+	c.SetCompression(codec)
 	defer func() {
 		s.log.Debug("close client connection")
 		if err := c.Close(); err != nil {
@@ -164,7 +167,12 @@ func (s *Server) serveConn(nc *transport.AuthConn) {
 		resHeaderBuf.WriteString(responseHeaderHandlerOk)
 	} else {
 		resHeaderBuf.WriteString(responseHeaderHandlerErrorPrefix)
-		resHeaderBuf.WriteString(handlerErr.Error())
+		if pde, ok := handlerErr.(*PermissionDeniedError); ok {
+			resHeaderBuf.WriteString(responseHeaderPermissionDeniedPrefix)
+			resHeaderBuf.WriteString(pde.Msg)
+		} else {
+			resHeaderBuf.WriteString(handlerErr.Error())
+		}
 	}
 	if err := c.WriteStreamedMessage(ctx, &resHeaderBuf, ResHeader); err != nil {
 		s.log.WithError(err).Error("cannot write response header")
@@ -1,11 +1,15 @@
 package dataconn
 
 import (
+	"fmt"
 	"io"
 	"sync"
 	"time"
 
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/stream"
+	"github.com/zrepl/zrepl/rpc/versionhandshake"
+	"github.com/zrepl/zrepl/transport"
 	"github.com/zrepl/zrepl/zfs"
 )
 
@@ -38,8 +42,35 @@ const (
 const (
 	responseHeaderHandlerOk          = "HANDLER OK\n"
 	responseHeaderHandlerErrorPrefix = "HANDLER ERROR:\n"
+	// follows responseHeaderHandlerErrorPrefix, hence older clients treat it as a regular handler error
+	responseHeaderPermissionDeniedPrefix = "PERMISSION DENIED:\n"
 )
 
+// PermissionDeniedError indicates that the server refused to perform a request.
+// Handlers return it to have the Server transmit it as such,
+// and the Client returns it for such responses.
+type PermissionDeniedError struct {
+	Msg string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return fmt.Sprintf("server denied permission: %s", e.Msg)
+}
+
+// negotiatedCompression returns the codec for the ZFSStream frames on nc,
+// as negotiated through the versionhandshake extensions, or nil if
+// the connection is not to be compressed.
+func negotiatedCompression(nc transport.Wire, isConnecter bool) compression.Codec {
+	ours, theirs, ok := versionhandshake.Extensions(nc)
+	if !ok {
+		return nil
+	}
+	if isConnecter {
+		return compression.NewCodec(compression.Negotiate(ours, theirs))
+	}
+	return compression.NewCodec(compression.Negotiate(theirs, ours))
+}
+
 type streamCopier struct {
 	mtx                sync.Mutex
 	used               bool
@@ -61,7 +61,9 @@ var bufpool = base2bufpool.New(FramePayloadShift, FramePayloadShift, base2bufpoo
 
 // if sendStream returns an error, that error will be sent as a trailer to the client
 // ok will return nil, though.
-func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32) (errStream, errConn error) {
+//
+// If fc is not nil, the data frames are compressed using fc (error trailers are not).
+func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32, fc *frameCompression) (errStream, errConn error) {
 	debug("writeStream: enter stype=%v", stype)
 	defer debug("writeStream: return")
 	if stype == 0 {
@@ -70,10 +72,10 @@ func writeStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, s
 	if !IsPublicFrameType(stype) {
 		panic(fmt.Sprintf("stype %v is not public", stype))
 	}
-	return doWriteStream(ctx, c, stream, stype)
+	return doWriteStream(ctx, c, stream, stype, fc)
 }
 
-func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32) (errStream, errConn error) {
+func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader, stype uint32, fc *frameCompression) (errStream, errConn error) {
 
 	// RULE1 (buf == <zero>) XOR (err == nil)
 	type read struct {
@@ -119,7 +121,11 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 		if read.err == nil {
 			// RULE 1: read.buf is valid
 			// next line is the hot path...
-			writeErr := c.WriteFrame(read.buf.Bytes(), stype)
+			payload := read.buf.Bytes()
+			if fc != nil {
+				payload = fc.encode(payload)
+			}
+			writeErr := c.WriteFrame(payload, stype)
 			read.buf.Free()
 			if writeErr != nil {
 				return nil, writeErr
@@ -132,7 +138,7 @@ func doWriteStream(ctx context.Context, c *heartbeatconn.Conn, stream io.Reader,
 			break
 		} else {
 			errReader := strings.NewReader(read.err.Error())
-			errReadErrReader, errConnWrite := doWriteStream(ctx, c, errReader, StreamErrTrailer)
+			errReadErrReader, errConnWrite := doWriteStream(ctx, c, errReader, StreamErrTrailer, nil)
 			if errReadErrReader != nil {
 				panic(errReadErrReader) // in-memory, cannot happen
 			}
@@ -235,7 +241,9 @@ func readFrames(reads chan<- readFrameResult, noMoreReads chan<- struct{}, c *he
 //
 // readStream calls itself recursively to read multi-frame error trailers
 // Thus, the reads channel needs to be a parameter.
-func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io.Writer, stype uint32) *ReadStreamError {
+//
+// If fc is not nil, the data frames are decompressed using fc.
+func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io.Writer, stype uint32, fc *frameCompression) *ReadStreamError {
 
 	var f frameconn.Frame
 	for read := range reads {
@@ -248,12 +256,20 @@ func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io
 			break
 		}
 
-		n, err := receiver.Write(f.Buffer.Bytes())
+		payload := f.Buffer.Bytes()
+		if fc != nil {
+			var err error
+			if payload, err = fc.decode(payload); err != nil {
+				f.Buffer.Free()
+				return &ReadStreamError{ReadStreamErrorKindConn, err}
+			}
+		}
+		n, err := receiver.Write(payload)
 		if err != nil {
 			f.Buffer.Free()
 			return &ReadStreamError{ReadStreamErrorKindWrite, err} // FIXME wrap as writer error
 		}
-		if n != len(f.Buffer.Bytes()) {
+		if n != len(payload) {
 			f.Buffer.Free()
 			return &ReadStreamError{ReadStreamErrorKindWrite, io.ErrShortWrite}
 		}
@@ -272,7 +288,7 @@ func readStream(reads <-chan readFrameResult, c *heartbeatconn.Conn, receiver io
 			panic(fmt.Sprintf("unexpected bytes.Buffer write error: %v %v", n, err))
 		}
 		// recursion ftw! we won't enter this if stmt because stype == StreamErrTrailer in the following call
-		rserr := readStream(reads, c, &errBuf, StreamErrTrailer)
+		rserr := readStream(reads, c, &errBuf, StreamErrTrailer, nil)
 		if rserr != nil && rserr.Kind == ReadStreamErrorKindWrite {
 			panic(fmt.Sprintf("unexpected bytes.Buffer write error: %s", rserr))
 		} else if rserr != nil {
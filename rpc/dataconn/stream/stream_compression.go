@@ -0,0 +1,73 @@
+package stream
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
+)
+
+// the following are protocol constants
+const (
+	compressionFlagStored     byte = 0
+	compressionFlagCompressed byte = 1
+)
+
+// frameCompression compresses or decompresses the payloads of the data frames of a stream.
+// Each payload is prefixed with a flag byte that indicates whether the remainder
+// is compressed or stored as-is because it did not compress.
+//
+// The buffer returned by encode and decode is only valid until the next call,
+// i.e., callers must serialize access.
+type frameCompression struct {
+	codec compression.Codec
+	buf   []byte
+
+	raw, compressed prometheus.Counter
+}
+
+func newFrameCompression(codec compression.Codec, direction string) *frameCompression {
+	if codec == nil {
+		return nil
+	}
+	return &frameCompression{
+		codec:      codec,
+		raw:        prom.CompressionRawBytes.WithLabelValues(string(codec.Algorithm()), direction),
+		compressed: prom.CompressionCompressedBytes.WithLabelValues(string(codec.Algorithm()), direction),
+	}
+}
+
+func (fc *frameCompression) encode(payload []byte) []byte {
+	res, ok := fc.codec.Compress(append(fc.buf[:0], compressionFlagCompressed), payload)
+	if !ok {
+		res = append(append(fc.buf[:0], compressionFlagStored), payload...)
+	}
+	fc.buf = res
+	fc.raw.Add(float64(len(payload)))
+	fc.compressed.Add(float64(len(res)))
+	return res
+}
+
+func (fc *frameCompression) decode(payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, fmt.Errorf("compressed frame lacks flag byte")
+	}
+	var res []byte
+	switch payload[0] {
+	case compressionFlagStored:
+		res = payload[1:]
+	case compressionFlagCompressed:
+		var err error
+		fc.buf, err = fc.codec.Decompress(fc.buf[:0], payload[1:])
+		if err != nil {
+			return nil, fmt.Errorf("cannot decompress frame (%s): %s", fc.codec.Algorithm(), err)
+		}
+		res = fc.buf
+	default:
+		return nil, fmt.Errorf("unknown compressed frame flag %v", payload[0])
+	}
+	fc.raw.Add(float64(len(res)))
+	fc.compressed.Add(float64(len(payload)))
+	return res, nil
+}
@@ -12,6 +12,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/heartbeatconn"
 	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
 	"github.com/zrepl/zrepl/zfs"
@@ -36,6 +37,10 @@ type Conn struct {
 	// support a single stream at a time over hc.
 	writeMtx   sync.Mutex
 	writeClean bool
+
+	// compression of SendStream and ReadStreamInto, nil if disabled
+	// protected by writeMtx and readMtx, respectively
+	sendCompression, recvCompression *frameCompression
 }
 
 var readMessageSentinel = fmt.Errorf("read stream complete")
@@ -61,6 +66,21 @@ func Wrap(nc timeoutconn.Wire, sendHeartbeatInterval, peerTimeout time.Duration)
 	return conn
 }
 
+// SetCompression enables compression of the streams sent by SendStream and
+// received by ReadStreamInto using codec (nil disables compression).
+// Messages are never compressed.
+//
+// Both sides of the connection must use the same codec,
+// and must not change it while a stream is in progress.
+func (c *Conn) SetCompression(codec compression.Codec) {
+	c.writeMtx.Lock()
+	c.sendCompression = newFrameCompression(codec, "send")
+	c.writeMtx.Unlock()
+	c.readMtx.Lock()
+	c.recvCompression = newFrameCompression(codec, "recv")
+	c.readMtx.Unlock()
+}
+
 func isConnCleanAfterRead(res *ReadStreamError) bool {
 	return res == nil || res.Kind == ReadStreamErrorKindSource || res.Kind == ReadStreamErrorKindStreamErrTrailerEncoding
 }
@@ -112,7 +132,7 @@ func (c *Conn) ReadStreamedMessage(ctx context.Context, maxSize uint32, frameTyp
 			panic(err)
 		}
 	}()
-	err = readStream(c.frameReads, c.hc, w, frameType)
+	err = readStream(c.frameReads, c.hc, w, frameType, nil)
 	c.readClean = isConnCleanAfterRead(err)
 	_ = w.CloseWithError(readMessageSentinel) // always returns nil
 	wg.Wait()
@@ -142,7 +162,7 @@ func (c *Conn) ReadStreamInto(w io.Writer, frameType uint32) (err zfs.StreamCopi
 	if !c.readClean {
 		return writeStreamToErrorUnknownState{}
 	}
-	var rse *ReadStreamError = readStream(c.frameReads, c.hc, w, frameType)
+	var rse *ReadStreamError = readStream(c.frameReads, c.hc, w, frameType, c.recvCompression)
 	c.readClean = isConnCleanAfterRead(rse)
 
 	// https://golang.org/doc/faq#nil_error
@@ -170,7 +190,7 @@ func (c *Conn) WriteStreamedMessage(ctx context.Context, buf io.Reader, frameTyp
 	if !c.writeClean {
 		return fmt.Errorf("dataconn write message: connection is in unknown state")
 	}
-	errBuf, errConn := writeStream(ctx, c.hc, buf, frameType)
+	errBuf, errConn := writeStream(ctx, c.hc, buf, frameType, nil)
 	if errBuf != nil {
 		panic(errBuf)
 	}
@@ -219,7 +239,7 @@ func (c *Conn) SendStream(ctx context.Context, src zfs.StreamCopier, frameType u
 	writeStreamErrChan := make(chan writeStreamRes, 1)
 	go func() {
 		var res writeStreamRes
-		res.errStream, res.errConn = writeStream(ctx, c.hc, r, frameType)
+		res.errStream, res.errConn = writeStream(ctx, c.hc, r, frameType, c.sendCompression)
 		if w != nil {
 			_ = w.CloseWithError(res.errStream) // always returns nil
 		}
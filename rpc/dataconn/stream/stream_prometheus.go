@@ -0,0 +1,33 @@
+package stream
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var prom struct {
+	CompressionRawBytes        *prometheus.CounterVec
+	CompressionCompressedBytes *prometheus.CounterVec
+}
+
+func init() {
+	prom.CompressionRawBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "dataconn_stream",
+		Name:      "compression_raw_bytes",
+		Help:      "Number of uncompressed bytes of ZFS streams sent or received with stream compression",
+	}, []string{"algorithm", "direction"})
+	prom.CompressionCompressedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zrepl",
+		Subsystem: "dataconn_stream",
+		Name:      "compression_compressed_bytes",
+		Help:      "Number of bytes of ZFS streams sent or received with stream compression, as transferred on the wire",
+	}, []string{"algorithm", "direction"})
+}
+
+func PrometheusRegister(registry prometheus.Registerer) error {
+	if err := registry.Register(prom.CompressionRawBytes); err != nil {
+		return err
+	}
+	if err := registry.Register(prom.CompressionCompressedBytes); err != nil {
+		return err
+	}
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math/rand"
 	"strings"
 	"sync"
 	"testing"
@@ -13,6 +14,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/zrepl/zrepl/logger"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/dataconn/heartbeatconn"
 	"github.com/zrepl/zrepl/util/socketpair"
 )
@@ -45,7 +47,7 @@ func TestStreamer(t *testing.T) {
 		buf.Write(
 			bytes.Repeat([]byte{1, 2}, 1<<25),
 		)
-		writeStream(ctx, a, &buf, stype)
+		writeStream(ctx, a, &buf, stype, nil)
 		log.Debug("WriteStream returned")
 		a.Shutdown()
 	}()
@@ -59,7 +61,7 @@ func TestStreamer(t *testing.T) {
 			defer wg.Done()
 			readFrames(ch, nil, b)
 		}()
-		err := readStream(ch, b, &buf, stype)
+		err := readStream(ch, b, &buf, stype, nil)
 		log.WithField("errType", fmt.Sprintf("%T %v", err, err)).Debug("ReadStream returned")
 		assert.Nil(t, err)
 		expected := bytes.Repeat([]byte{1, 2}, 1<<25)
@@ -71,6 +73,55 @@ func TestStreamer(t *testing.T) {
 
 }
 
+func TestStreamerCompression(t *testing.T) {
+
+	anc, bnc, err := socketpair.SocketPair()
+	require.NoError(t, err)
+
+	hto := 1 * time.Hour
+	a := heartbeatconn.Wrap(anc, hto, hto)
+	b := heartbeatconn.Wrap(bnc, hto, hto)
+
+	ctx := WithLogger(context.Background(), logger.NewNullLogger())
+
+	stype := uint32(0x23)
+
+	// compressible data followed by random (incompressible) data
+	expected := bytes.Repeat([]byte{1, 2}, 1<<20)
+	random := make([]byte, 1<<20)
+	rand.New(rand.NewSource(1)).Read(random)
+	expected = append(expected, random...)
+
+	codec := compression.NewCodec(compression.Zstd)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		errStream, errConn := writeStream(ctx, a, bytes.NewReader(expected), stype, newFrameCompression(codec, "send"))
+		assert.NoError(t, errStream)
+		assert.NoError(t, errConn)
+		a.Shutdown()
+	}()
+
+	go func() {
+		defer wg.Done()
+		var buf bytes.Buffer
+		ch := make(chan readFrameResult, 5)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			readFrames(ch, nil, b)
+		}()
+		err := readStream(ch, b, &buf, stype, newFrameCompression(codec, "recv"))
+		assert.Nil(t, err)
+		assert.True(t, bytes.Equal(expected, buf.Bytes()))
+		b.Shutdown()
+	}()
+
+	wg.Wait()
+}
+
 type errReader struct {
 	t       *testing.T
 	readErr error
@@ -101,7 +152,7 @@ func TestMultiFrameStreamErrTraileror(t *testing.T) {
 	go func() {
 		defer wg.Done()
 		r := errReader{t, longErr}
-		writeStream(ctx, a, &r, stype)
+		writeStream(ctx, a, &r, stype, nil)
 		a.Shutdown()
 	}()
 
@@ -115,7 +166,7 @@ func TestMultiFrameStreamErrTraileror(t *testing.T) {
 			defer wg.Done()
 			readFrames(ch, nil, b)
 		}()
-		err := readStream(ch, b, &buf, stype)
+		err := readStream(ch, b, &buf, stype, nil)
 		t.Logf("%s", err)
 		require.NotNil(t, err)
 		assert.True(t, buf.Len() == 0)
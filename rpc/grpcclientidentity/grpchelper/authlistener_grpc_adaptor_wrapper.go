@@ -50,7 +50,10 @@ func ClientConn(cn transport.Connecter, log Logger) *grpc.ClientConn {
 }
 
 // NewServer is a convenience interface around the TransportCredentials and Interceptors interface.
-func NewServer(authListener transport.AuthenticatedListener, clientIdentityKey interface{}, logger grpcclientidentity.Logger, ctxInterceptor grpcclientidentity.ContextInterceptor) (srv *grpc.Server, serve func() error) {
+//
+// handlerInterceptor (may be nil) is invoked for each unary request with the context
+// that carries the client identity and has been passed through ctxInterceptor.
+func NewServer(authListener transport.AuthenticatedListener, clientIdentityKey interface{}, logger grpcclientidentity.Logger, ctxInterceptor grpcclientidentity.ContextInterceptor, handlerInterceptor grpc.UnaryServerInterceptor) (srv *grpc.Server, serve func() error) {
 	ka := grpc.KeepaliveParams(keepalive.ServerParameters{
 		Time:    StartKeepalivesAfterInactivityDuration,
 		Timeout: KeepalivePeerTimeout,
@@ -61,6 +64,14 @@ func NewServer(authListener transport.AuthenticatedListener, clientIdentityKey i
 	})
 	tcs := grpcclientidentity.NewTransportCredentials(logger)
 	unary, stream := grpcclientidentity.NewInterceptors(logger, clientIdentityKey, ctxInterceptor)
+	if handlerInterceptor != nil {
+		identityUnary := unary
+		unary = func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			return identityUnary(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+				return handlerInterceptor(ctx, req, info, handler)
+			})
+		}
+	}
 	srv = grpc.NewServer(grpc.Creds(tcs), grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream), ka, ep)
 
 	serve = func() error {
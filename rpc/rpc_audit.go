@@ -0,0 +1,160 @@
+package rpc
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// RequestAuditor is informed by the Server about the outcome of every request
+// of the control and the data connection, including requests denied by the RequestAuthorizer.
+// The client identity is available as endpoint.ClientIdentityKey context value.
+type RequestAuditor interface {
+	// AuditRequest is called after the Handler returned, or, if the request
+	// transfers a ZFS stream, after the transfer has ended.
+	// res is nil if err != nil.
+	// streamBytes is the number of bytes of the ZFS stream that were transferred.
+	AuditRequest(ctx context.Context, req interface{}, res interface{}, streamBytes int64, err error)
+}
+
+// auditingUnaryInterceptor reports the outcome of next (may be nil) to auditor.
+func auditingUnaryInterceptor(auditor RequestAuditor, next grpc.UnaryServerInterceptor) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (res interface{}, err error) {
+		defer func() {
+			auditor.AuditRequest(ctx, req, res, 0, err)
+		}()
+		if next != nil {
+			return next(ctx, req, info, handler)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// auditingDataconnHandler reports the outcome of the requests passed to the wrapped dataconn.Handler to auditor
+type auditingDataconnHandler struct {
+	dataconn.Handler
+	auditor RequestAuditor
+}
+
+var _ dataconn.Handler = auditingDataconnHandler{}
+
+func (h auditingDataconnHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
+	res, stream, err := h.Handler.Send(ctx, r)
+	if err != nil {
+		h.auditor.AuditRequest(ctx, r, nil, 0, err)
+		return nil, nil, err
+	}
+	if stream == nil {
+		h.auditor.AuditRequest(ctx, r, res, 0, nil)
+		return res, stream, nil
+	}
+	return res, newCountingStreamCopier(stream, func(n int64, err error) {
+		h.auditor.AuditRequest(ctx, r, res, n, err)
+	}), nil
+}
+
+func (h auditingDataconnHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
+	var n int64
+	receive = newCountingStreamCopier(receive, func(count int64, _ error) {
+		n = count
+	})
+	res, err := h.Handler.Receive(ctx, r, receive)
+	if err != nil {
+		h.auditor.AuditRequest(ctx, r, nil, n, err)
+		return nil, err
+	}
+	h.auditor.AuditRequest(ctx, r, res, n, nil)
+	return res, nil
+}
+
+func (h auditingDataconnHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	res, err := h.Handler.PingDataconn(ctx, r)
+	if err != nil {
+		h.auditor.AuditRequest(ctx, r, nil, 0, err)
+		return nil, err
+	}
+	h.auditor.AuditRequest(ctx, r, res, 0, nil)
+	return res, nil
+}
+
+// countingStreamCopier counts the bytes of the wrapped StreamCopier's stream
+// and calls done once when the stream has been copied completely or with an error,
+// or when it is closed before.
+type countingStreamCopier struct {
+	sc zfs.StreamCopier
+
+	mtx   sync.Mutex
+	n     int64
+	done  func(n int64, err error)
+	ended bool
+}
+
+func newCountingStreamCopier(sc zfs.StreamCopier, done func(n int64, err error)) zfs.StreamCopier {
+	c := &countingStreamCopier{sc: sc, done: done}
+	if r, ok := sc.(io.Reader); ok {
+		// preserve the io.Reader optimization of stream.Conn.SendStream
+		return countingStreamCopierAndReader{c, r}
+	}
+	return c
+}
+
+func (c *countingStreamCopier) add(n int) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	c.n += int64(n)
+}
+
+func (c *countingStreamCopier) end(err error) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+	if c.ended {
+		return
+	}
+	c.ended = true
+	c.done(c.n, err)
+}
+
+func (c *countingStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	err := c.sc.WriteStreamTo(countingWriter{c, w})
+	c.end(err)
+	return err
+}
+
+func (c *countingStreamCopier) Close() error {
+	err := c.sc.Close()
+	c.end(nil)
+	return err
+}
+
+type countingWriter struct {
+	c *countingStreamCopier
+	w io.Writer
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.c.add(n)
+	return n, err
+}
+
+type countingStreamCopierAndReader struct {
+	*countingStreamCopier
+	r io.Reader
+}
+
+func (c countingStreamCopierAndReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.add(n)
+	if err == io.EOF {
+		c.end(nil)
+	} else if err != nil {
+		c.end(err)
+	}
+	return n, err
+}
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/zrepl/zrepl/replication/logic/pdu"
+	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// RequestAuthorizer decides whether a client may perform a request.
+// The Server consults it for every request of the control and the data connection
+// before passing the request to the Handler.
+// The client identity is available as endpoint.ClientIdentityKey context value.
+type RequestAuthorizer interface {
+	// AuthorizeRequest returns a non-nil error if the client must not perform req.
+	AuthorizeRequest(ctx context.Context, req interface{}) error
+	// FilterResponse may remove information that the client must not see from res.
+	FilterResponse(ctx context.Context, res interface{})
+}
+
+// IsPermissionDenied returns true if err indicates that a RequestAuthorizer denied a request,
+// on either side of the connection.
+func IsPermissionDenied(err error) bool {
+	if _, ok := err.(*dataconn.PermissionDeniedError); ok {
+		return true
+	}
+	if st, ok := status.FromError(err); ok && st.Code() == codes.PermissionDenied {
+		return true
+	}
+	return false
+}
+
+func authorizingUnaryInterceptor(authz RequestAuthorizer, log Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := authz.AuthorizeRequest(ctx, req); err != nil {
+			log.WithField("method", info.FullMethod).WithError(err).Warn("request denied")
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		res, err := handler(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		authz.FilterResponse(ctx, res)
+		return res, nil
+	}
+}
+
+// authorizingDataconnHandler consults authz before passing requests to the wrapped dataconn.Handler
+type authorizingDataconnHandler struct {
+	dataconn.Handler
+	authz RequestAuthorizer
+	log   Logger
+}
+
+var _ dataconn.Handler = authorizingDataconnHandler{}
+
+func (h authorizingDataconnHandler) authorize(ctx context.Context, endpoint string, req interface{}) error {
+	if err := h.authz.AuthorizeRequest(ctx, req); err != nil {
+		h.log.WithField("endpoint", endpoint).WithError(err).Warn("request denied")
+		return &dataconn.PermissionDeniedError{Msg: err.Error()}
+	}
+	return nil
+}
+
+func (h authorizingDataconnHandler) Send(ctx context.Context, r *pdu.SendReq) (*pdu.SendRes, zfs.StreamCopier, error) {
+	if err := h.authorize(ctx, dataconn.EndpointSend, r); err != nil {
+		return nil, nil, err
+	}
+	return h.Handler.Send(ctx, r)
+}
+
+func (h authorizingDataconnHandler) Receive(ctx context.Context, r *pdu.ReceiveReq, receive zfs.StreamCopier) (*pdu.ReceiveRes, error) {
+	if err := h.authorize(ctx, dataconn.EndpointRecv, r); err != nil {
+		receive.Close()
+		return nil, err
+	}
+	return h.Handler.Receive(ctx, r, receive)
+}
+
+func (h authorizingDataconnHandler) PingDataconn(ctx context.Context, r *pdu.PingReq) (*pdu.PingRes, error) {
+	if err := h.authorize(ctx, dataconn.EndpointPing, r); err != nil {
+		return nil, err
+	}
+	return h.Handler.PingDataconn(ctx, r)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/zrepl/zrepl/replication/logic"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/grpcclientidentity/grpchelper"
 	"github.com/zrepl/zrepl/rpc/versionhandshake"
 	"github.com/zrepl/zrepl/transport"
@@ -40,9 +41,13 @@ var _ logic.Receiver = &Client{}
 type DialContextFunc = func(ctx context.Context, network string, addr string) (net.Conn, error)
 
 // config must be validated, NewClient will panic if it is not valid
-func NewClient(cn transport.Connecter, loggers Loggers) *Client {
+//
+// streamCompression lists the algorithms for compression of ZFS streams in order of preference.
+// The algorithm actually used is negotiated with the server, see package compression.
+func NewClient(cn transport.Connecter, loggers Loggers, streamCompression []compression.Algorithm) *Client {
 
-	cn = versionhandshake.Connecter(cn, envconst.Duration("ZREPL_RPC_CLIENT_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second))
+	cn = versionhandshake.Connecter(cn, envconst.Duration("ZREPL_RPC_CLIENT_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second),
+		compression.HandshakeExtensions(streamCompression))
 
 	muxedConnecter := mux(cn)
 
@@ -112,6 +117,14 @@ func (c *Client) DestroySnapshots(ctx context.Context, in *pdu.DestroySnapshotsR
 	return c.controlClient.DestroySnapshots(ctx, in)
 }
 
+func (c *Client) Rollback(ctx context.Context, in *pdu.RollbackReq) (*pdu.RollbackRes, error) {
+	return c.controlClient.Rollback(ctx, in)
+}
+
+func (c *Client) Rename(ctx context.Context, in *pdu.RenameReq) (*pdu.RenameRes, error) {
+	return c.controlClient.Rename(ctx, in)
+}
+
 func (c *Client) ReplicationCursor(ctx context.Context, in *pdu.ReplicationCursorReq) (*pdu.ReplicationCursorRes, error) {
 	return c.controlClient.ReplicationCursor(ctx, in)
 }
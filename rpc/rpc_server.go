@@ -4,9 +4,12 @@ import (
 	"context"
 	"time"
 
+	"google.golang.org/grpc"
+
 	"github.com/zrepl/zrepl/endpoint"
 	"github.com/zrepl/zrepl/replication/logic/pdu"
 	"github.com/zrepl/zrepl/rpc/dataconn"
+	"github.com/zrepl/zrepl/rpc/dataconn/compression"
 	"github.com/zrepl/zrepl/rpc/grpcclientidentity/grpchelper"
 	"github.com/zrepl/zrepl/rpc/versionhandshake"
 	"github.com/zrepl/zrepl/transport"
@@ -28,17 +31,31 @@ type Server struct {
 	controlServerServe serveFunc
 	dataServer         *dataconn.Server
 	dataServerServe    serveFunc
+
+	handshakeExtensions []string
 }
 
 type HandlerContextInterceptor func(ctx context.Context) context.Context
 
 // config must be valid (use its Validate function).
-func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextInterceptor) *Server {
+//
+// authz (may be nil) is consulted for all requests before they are passed to handler.
+// auditor (may be nil) is informed about the outcome of all requests.
+//
+// streamCompression lists the algorithms for compression of ZFS streams accepted by the server.
+func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextInterceptor, authz RequestAuthorizer, auditor RequestAuditor, streamCompression []compression.Algorithm) *Server {
 
 	// setup control server
 	controlServerServe := func(ctx context.Context, controlListener transport.AuthenticatedListener, errOut chan<- error) {
 
-		controlServer, serve := grpchelper.NewServer(controlListener, endpoint.ClientIdentityKey, loggers.Control, ctxInterceptor)
+		var handlerInterceptor grpc.UnaryServerInterceptor
+		if authz != nil {
+			handlerInterceptor = authorizingUnaryInterceptor(authz, loggers.Control)
+		}
+		if auditor != nil {
+			handlerInterceptor = auditingUnaryInterceptor(auditor, handlerInterceptor)
+		}
+		controlServer, serve := grpchelper.NewServer(controlListener, endpoint.ClientIdentityKey, loggers.Control, ctxInterceptor, handlerInterceptor)
 		pdu.RegisterReplicationServer(controlServer, handler)
 
 		// give time for graceful stop until deadline expires, then hard stop
@@ -63,18 +80,27 @@ func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextIn
 		}
 		return ctx, wire
 	}
-	dataServer := dataconn.NewServer(dataServerClientIdentitySetter, loggers.Data, handler)
+	var dataHandler dataconn.Handler = handler
+	if authz != nil {
+		dataHandler = authorizingDataconnHandler{handler, authz, loggers.Data}
+	}
+	if auditor != nil {
+		// wraps the authorizingDataconnHandler so that denied requests are audited, too
+		dataHandler = auditingDataconnHandler{dataHandler, auditor}
+	}
+	dataServer := dataconn.NewServer(dataServerClientIdentitySetter, loggers.Data, dataHandler)
 	dataServerServe := func(ctx context.Context, dataListener transport.AuthenticatedListener, errOut chan<- error) {
 		dataServer.Serve(ctx, dataListener)
 		errOut <- nil // TODO bad design of dataServer?
 	}
 
 	server := &Server{
-		logger:             loggers.General,
-		handler:            handler,
-		controlServerServe: controlServerServe,
-		dataServer:         dataServer,
-		dataServerServe:    dataServerServe,
+		logger:              loggers.General,
+		handler:             handler,
+		controlServerServe:  controlServerServe,
+		dataServer:          dataServer,
+		dataServerServe:     dataServerServe,
+		handshakeExtensions: compression.HandshakeExtensions(streamCompression),
 	}
 
 	return server
@@ -85,7 +111,7 @@ func NewServer(handler Handler, loggers Loggers, ctxInterceptor HandlerContextIn
 func (s *Server) Serve(ctx context.Context, l transport.AuthenticatedListener) {
 	ctx, cancel := context.WithCancel(ctx)
 
-	l = versionhandshake.Listener(l, envconst.Duration("ZREPL_RPC_SERVER_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second))
+	l = versionhandshake.Listener(l, envconst.Duration("ZREPL_RPC_SERVER_VERSIONHANDSHAKE_TIMEOUT", 10*time.Second), s.handshakeExtensions)
 
 	// it is important that demux's context is cancelled,
 	// it has background goroutines attached
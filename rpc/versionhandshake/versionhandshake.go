@@ -151,25 +151,39 @@ func (m *HandshakeMessage) DecodeReader(r io.Reader, maxLen int) error {
 }
 
 func DoHandshakeCurrentVersion(conn net.Conn, deadline time.Time) *HandshakeError {
+	_, err := DoHandshakeCurrentVersionExtensions(conn, deadline, nil)
+	return err
+}
+
+// DoHandshakeCurrentVersionExtensions is like DoHandshakeCurrentVersion,
+// but additionally sends the given extensions and returns those sent by the peer.
+// Extensions do not affect the outcome of the handshake: it is up to the
+// caller to interpret them, and to ignore unknown ones.
+func DoHandshakeCurrentVersionExtensions(conn net.Conn, deadline time.Time, extensions []string) ([]string, *HandshakeError) {
 	// current protocol version is hardcoded here
-	return DoHandshakeVersion(conn, deadline, 3)
+	return doHandshake(conn, deadline, 3, extensions)
 }
 
 const HandshakeMessageMaxLen = 16 * 4096
 
 func DoHandshakeVersion(conn net.Conn, deadline time.Time, version int) (rErr *HandshakeError) {
+	_, err := doHandshake(conn, deadline, version, nil)
+	return err
+}
+
+func doHandshake(conn net.Conn, deadline time.Time, version int, extensions []string) (_ []string, rErr *HandshakeError) {
 	ours := HandshakeMessage{
 		ProtocolVersion: version,
-		Extensions:      nil,
+		Extensions:      extensions,
 	}
 	hsb, err := ours.Encode()
 	if err != nil {
-		return hsErr("could not encode protocol banner: %s", err)
+		return nil, hsErr("could not encode protocol banner: %s", err)
 	}
 
 	err = conn.SetDeadline(deadline)
 	if err != nil {
-		return hsErr("could not set deadline for protocol banner handshake: %s", err)
+		return nil, hsErr("could not set deadline for protocol banner handshake: %s", err)
 	}
 	defer func() {
 		if rErr != nil {
@@ -182,19 +196,18 @@ func DoHandshakeVersion(conn net.Conn, deadline time.Time, version int) (rErr *H
 	}()
 	_, err = io.Copy(conn, bytes.NewBuffer(hsb))
 	if err != nil {
-		return hsErr("could not send protocol banner: %s", err)
+		return nil, hsErr("could not send protocol banner: %s", err)
 	}
 
 	theirs := HandshakeMessage{}
 	if err := theirs.DecodeReader(conn, HandshakeMessageMaxLen); err != nil {
-		return hsErr("could not decode protocol banner: %s", err)
+		return nil, hsErr("could not decode protocol banner: %s", err)
 	}
 
 	if theirs.ProtocolVersion != ours.ProtocolVersion {
-		return hsErr("protocol versions do not match: ours is %d, theirs is %d",
+		return nil, hsErr("protocol versions do not match: ours is %d, theirs is %d",
 			ours.ProtocolVersion, theirs.ProtocolVersion)
 	}
-	// ignore extensions, we don't use them
 
-	return nil
+	return theirs.Extensions, nil
 }
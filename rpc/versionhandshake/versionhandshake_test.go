@@ -117,3 +117,28 @@ func TestDoHandshakeCurrentVersion(t *testing.T) {
 	assert.Nil(t, <-srvErrCh)
 
 }
+
+func TestDoHandshakeCurrentVersionExtensions(t *testing.T) {
+	srv, client, err := socketpair.SocketPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close()
+	defer client.Close()
+
+	type res struct {
+		theirs []string
+		err    *HandshakeError
+	}
+	srvResCh := make(chan res)
+	go func() {
+		theirs, err := DoHandshakeCurrentVersionExtensions(srv, time.Now().Add(2*time.Second), nil)
+		srvResCh <- res{theirs, err}
+	}()
+	theirs, hsErr := DoHandshakeCurrentVersionExtensions(client, time.Now().Add(2*time.Second), []string{"FOO=bar", "BAZ"})
+	assert.Nil(t, hsErr)
+	assert.Nil(t, theirs)
+	srvRes := <-srvResCh
+	assert.Nil(t, srvRes.err)
+	assert.Equal(t, []string{"FOO=bar", "BAZ"}, srvRes.theirs)
+}
@@ -3,14 +3,49 @@ package versionhandshake
 import (
 	"context"
 	"net"
+	"syscall"
 	"time"
 
+	"github.com/zrepl/zrepl/rpc/dataconn/timeoutconn"
 	"github.com/zrepl/zrepl/transport"
 )
 
+// Conn is the transport.Wire returned by HandshakeConnecter and HandshakeListener
+// (the latter wraps it in a transport.AuthConn).
+// Use Extensions to access the extensions exchanged during the handshake.
+type Conn struct {
+	transport.Wire
+	ours, theirs []string
+}
+
+var _ timeoutconn.SyscallConner = (*Conn)(nil)
+
+func (c *Conn) SyscallConn() (rawConn syscall.RawConn, err error) {
+	scc, ok := c.Wire.(timeoutconn.SyscallConner)
+	if !ok {
+		return nil, timeoutconn.SyscallConnNotSupported
+	}
+	return scc.SyscallConn()
+}
+
+// Extensions returns the extensions sent by this side and by the peer
+// of a connection returned by HandshakeConnecter or HandshakeListener.
+// ok is false if the handshake was not performed through one of these.
+func Extensions(w transport.Wire) (ours, theirs []string, ok bool) {
+	if ac, isAuthConn := w.(*transport.AuthConn); isAuthConn {
+		w = ac.Wire
+	}
+	c, ok := w.(*Conn)
+	if !ok {
+		return nil, nil, false
+	}
+	return c.ours, c.theirs, true
+}
+
 type HandshakeConnecter struct {
-	connecter transport.Connecter
-	timeout   time.Duration
+	connecter  transport.Connecter
+	timeout    time.Duration
+	extensions []string
 }
 
 func (c HandshakeConnecter) Connect(ctx context.Context) (transport.Wire, error) {
@@ -22,24 +57,29 @@ func (c HandshakeConnecter) Connect(ctx context.Context) (transport.Wire, error)
 	if !ok {
 		dl = time.Now().Add(c.timeout)
 	}
-	if err := DoHandshakeCurrentVersion(conn, dl); err != nil {
+	theirs, hsErr := DoHandshakeCurrentVersionExtensions(conn, dl, c.extensions)
+	if hsErr != nil {
 		conn.Close()
-		return nil, err
+		return nil, hsErr
 	}
-	return conn, nil
+	return &Conn{conn, c.extensions, theirs}, nil
 }
 
-func Connecter(connecter transport.Connecter, timeout time.Duration) HandshakeConnecter {
+// Connecter wraps connecter to perform a protocol version handshake on each connection,
+// sending extensions to the peer (may be nil).
+func Connecter(connecter transport.Connecter, timeout time.Duration, extensions []string) HandshakeConnecter {
 	return HandshakeConnecter{
-		connecter: connecter,
-		timeout:   timeout,
+		connecter:  connecter,
+		timeout:    timeout,
+		extensions: extensions,
 	}
 }
 
 // wrapper type that performs a a protocol version handshake before returning the connection
 type HandshakeListener struct {
-	l       transport.AuthenticatedListener
-	timeout time.Duration
+	l          transport.AuthenticatedListener
+	timeout    time.Duration
+	extensions []string
 }
 
 func (l HandshakeListener) Addr() net.Addr { return l.l.Addr() }
@@ -55,14 +95,17 @@ func (l HandshakeListener) Accept(ctx context.Context) (*transport.AuthConn, err
 	if !ok {
 		dl = time.Now().Add(l.timeout) // shadowing
 	}
-	if err := DoHandshakeCurrentVersion(conn, dl); err != nil {
-		err.isAcceptError = true
+	theirs, hsErr := DoHandshakeCurrentVersionExtensions(conn, dl, l.extensions)
+	if hsErr != nil {
+		hsErr.isAcceptError = true
 		conn.Close()
-		return nil, err
+		return nil, hsErr
 	}
-	return conn, nil
+	return transport.NewAuthConn(&Conn{conn.Wire, l.extensions, theirs}, conn.ClientIdentity()), nil
 }
 
-func Listener(l transport.AuthenticatedListener, timeout time.Duration) transport.AuthenticatedListener {
-	return HandshakeListener{l, timeout}
+// Listener wraps l to perform a protocol version handshake on each accepted connection,
+// sending extensions to the peer (may be nil).
+func Listener(l transport.AuthenticatedListener, timeout time.Duration, extensions []string) transport.AuthenticatedListener {
+	return HandshakeListener{l, timeout, extensions}
 }
@@ -0,0 +1,112 @@
+// Package bandwidthlimit implements a token bucket rate limiter for byte streams
+// whose rate can be changed at runtime.
+package bandwidthlimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Unlimited can be passed to NewLimiter and Limiter.SetRate to disable limiting.
+const Unlimited int64 = -1
+
+// the maximum time a blocked writer sleeps before re-checking the rate,
+// bounds the latency with which rate changes take effect
+const maxSleep = 100 * time.Millisecond
+
+// Limiter is a token bucket that refills at a configurable number of bytes per second.
+// The bucket capacity is one second worth of tokens, but at least minCapacity bytes.
+// Limiter is safe for concurrent use, all streams that share a Limiter share its rate.
+type Limiter struct {
+	mtx    sync.Mutex
+	rate   int64 // bytes per second, Unlimited if <= 0
+	tokens float64
+	last   time.Time
+}
+
+const minCapacity = 64 * 1024
+
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	l := &Limiter{}
+	l.SetRate(bytesPerSecond)
+	return l
+}
+
+// SetRate changes the rate of the limiter, pass Unlimited to disable limiting.
+func (l *Limiter) SetRate(bytesPerSecond int64) {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	l.refill(time.Now())
+	if bytesPerSecond <= 0 {
+		bytesPerSecond = Unlimited
+	}
+	l.rate = bytesPerSecond
+	if l.tokens > l.capacity() {
+		l.tokens = l.capacity()
+	}
+}
+
+// Rate returns the current rate in bytes per second, or Unlimited.
+func (l *Limiter) Rate() int64 {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.rate
+}
+
+func (l *Limiter) capacity() float64 {
+	if l.rate < minCapacity {
+		return minCapacity
+	}
+	return float64(l.rate)
+}
+
+// l.mtx must be held
+func (l *Limiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if l.tokens > l.capacity() {
+			l.tokens = l.capacity()
+		}
+	}
+	l.last = now
+}
+
+// maxChunk returns the maximum number of bytes that should be passed to wait at once.
+func (l *Limiter) maxChunk() int {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return int(l.capacity())
+}
+
+// wait blocks until n bytes may be transferred or ctx is done.
+// The bucket may go into debt by up to n bytes, which is paid back by
+// subsequent calls to wait, so that the average rate is maintained.
+// Callers should not pass more than maxChunk() bytes at once to avoid large bursts.
+func (l *Limiter) wait(ctx context.Context, n int) error {
+	for {
+		l.mtx.Lock()
+		l.refill(time.Now())
+		if l.rate <= 0 {
+			l.mtx.Unlock()
+			return nil
+		}
+		if l.tokens >= 0 {
+			l.tokens -= float64(n)
+			l.mtx.Unlock()
+			return nil
+		}
+		sleep := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		l.mtx.Unlock()
+		if sleep > maxSleep {
+			sleep = maxSleep
+		}
+		t := time.NewTimer(sleep)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package bandwidthlimit
+
+import (
+	"context"
+	"io"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+// WrapStreamCopier returns a zfs.StreamCopier that copies sc's stream
+// at most at the rate of l.
+// Copying is aborted with ctx.Err() if ctx is done while waiting for l.
+// If sc is io.Reader, it is guaranteed that the returned StreamCopier
+// implements that interface, too.
+func WrapStreamCopier(ctx context.Context, sc zfs.StreamCopier, l *Limiter) zfs.StreamCopier {
+	lsc := &streamCopier{ctx, sc, l}
+	if scr, ok := sc.(io.Reader); ok {
+		return streamCopierAndReader{lsc, scr}
+	}
+	return lsc
+}
+
+type streamCopier struct {
+	ctx context.Context
+	sc  zfs.StreamCopier
+	l   *Limiter
+}
+
+var _ zfs.StreamCopier = &streamCopier{}
+
+func (s *streamCopier) Close() error {
+	return s.sc.Close()
+}
+
+func (s *streamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	return s.sc.WriteStreamTo(&limitedWriter{s.ctx, s.l, w})
+}
+
+type limitedWriter struct {
+	ctx context.Context
+	l   *Limiter
+	w   io.Writer
+}
+
+func (w *limitedWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		chunk := len(p)
+		if max := w.l.maxChunk(); chunk > max {
+			chunk = max
+		}
+		if err := w.l.wait(w.ctx, chunk); err != nil {
+			return n, err
+		}
+		var cn int
+		cn, err = w.w.Write(p[:chunk])
+		n += cn
+		if err != nil {
+			return n, err
+		}
+		p = p[chunk:]
+	}
+	return n, nil
+}
+
+// a streamCopier whose underlying sc is an io.Reader
+type streamCopierAndReader struct {
+	*streamCopier
+	asReader io.Reader
+}
+
+func (scr streamCopierAndReader) Read(p []byte) (int, error) {
+	if max := scr.l.maxChunk(); len(p) > max {
+		p = p[:max]
+	}
+	n, err := scr.asReader.Read(p)
+	if werr := scr.l.wait(scr.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+	return n, err
+}
@@ -0,0 +1,84 @@
+package bandwidthlimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zrepl/zrepl/zfs"
+)
+
+type readerStreamCopier struct{ io.Reader }
+
+func (readerStreamCopier) Close() error { return nil }
+
+func (c readerStreamCopier) WriteStreamTo(w io.Writer) zfs.StreamCopierError {
+	_, err := io.Copy(w, c.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return nil
+}
+
+func TestLimiterLimitsWriteStreamTo(t *testing.T) {
+	const rate = 1 << 20
+	l := NewLimiter(rate)
+	sc := WrapStreamCopier(context.Background(), readerStreamCopier{bytes.NewReader(make([]byte, rate+rate/2))}, l)
+
+	var buf bytes.Buffer
+	begin := time.Now()
+	require.Nil(t, sc.WriteStreamTo(&buf))
+	// the first second worth of bytes passes immediately, the remainder has to wait for the first second to be paid back
+	assert.True(t, time.Since(begin) > 800*time.Millisecond, "took %s", time.Since(begin))
+	assert.Equal(t, rate+rate/2, buf.Len())
+}
+
+func TestLimiterReexportsReaderAndUnlimited(t *testing.T) {
+	l := NewLimiter(Unlimited)
+	assert.Equal(t, Unlimited, l.Rate())
+	sc := WrapStreamCopier(context.Background(), readerStreamCopier{bytes.NewReader(make([]byte, 100<<20))}, l)
+	r, ok := sc.(io.Reader)
+	require.True(t, ok)
+
+	begin := time.Now()
+	n, err := io.Copy(ioutil.Discard, r)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100<<20), n)
+	assert.True(t, time.Since(begin) < 1*time.Second)
+
+	l.SetRate(0)
+	assert.Equal(t, Unlimited, l.Rate(), "non-positive rates mean unlimited")
+	l.SetRate(23)
+	assert.Equal(t, int64(23), l.Rate())
+}
+
+func TestLimiterWaitReturnsWhenContextDone(t *testing.T) {
+	l := NewLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	sc := WrapStreamCopier(ctx, readerStreamCopier{bytes.NewReader(make([]byte, 2*minCapacity))}, l)
+	r, ok := sc.(io.Reader)
+	require.True(t, ok)
+
+	// drain the bucket, the next read would wait for days at 1 byte per second
+	_, err := r.Read(make([]byte, 2*minCapacity))
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, minCapacity))
+		done <- err
+	}()
+	cancel()
+	select {
+	case err := <-done:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("read did not return after cancellation")
+	}
+}
@@ -0,0 +1,24 @@
+package zfs
+
+import "context"
+
+// ReceivedFromPropertyName is the user property in which a receiver that maps filesystem names
+// records the sender's name of a received filesystem.
+// Like PlaceholderPropertyName, the property source must be local, i.e. not inherited or received.
+const ReceivedFromPropertyName string = "zrepl:received_from"
+
+// ZFSGetReceivedFrom returns the local value of ReceivedFromPropertyName,
+// or an empty string if it is not set locally.
+func ZFSGetReceivedFrom(ctx context.Context, p *DatasetPath) (string, error) {
+	props, err := zfsGet(ctx, p.ToString(), []string{ReceivedFromPropertyName}, sourceLocal)
+	if err != nil {
+		return "", err
+	}
+	return props.Get(ReceivedFromPropertyName), nil
+}
+
+func ZFSSetReceivedFrom(ctx context.Context, p *DatasetPath, senderFS string) error {
+	props := NewZFSProperties()
+	props.Set(ReceivedFromPropertyName, senderFS)
+	return zfsSet(ctx, p.ToString(), props)
+}
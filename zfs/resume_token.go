@@ -18,11 +18,15 @@ import (
 
 // NOTE: Update ZFSSendARgs.Validate when changing fields (potentially SECURITY SENSITIVE)
 type ResumeToken struct {
-	HasFromGUID, HasToGUID    bool
-	FromGUID, ToGUID          uint64
-	ToName                    string
-	HasCompressOK, CompressOK bool
-	HasRawOk, RawOK           bool
+	HasFromGUID, HasToGUID        bool
+	FromGUID, ToGUID              uint64
+	ToName                        string
+	HasCompressOK, CompressOK     bool
+	HasRawOk, RawOK               bool
+	HasLargeBlockOK, LargeBlockOK bool
+	HasEmbedOK, EmbedOK           bool
+	// the token resumes a send of saved partially received state (zfs send -S)
+	HasSavedOK, SavedOK bool
 }
 
 var resumeTokenNVListRE = regexp.MustCompile(`\t(\S+) = (.*)`)
@@ -240,6 +244,24 @@ func ParseResumeToken(ctx context.Context, token string) (*ResumeToken, error) {
 			if err != nil {
 				return nil, ResumeTokenParsingError
 			}
+		case "largeblockok":
+			rt.HasLargeBlockOK = true
+			rt.LargeBlockOK, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+		case "embedok":
+			rt.HasEmbedOK = true
+			rt.EmbedOK, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
+		case "savedok":
+			rt.HasSavedOK = true
+			rt.SavedOK, err = strconv.ParseBool(val)
+			if err != nil {
+				return nil, ResumeTokenParsingError
+			}
 		}
 	}
 
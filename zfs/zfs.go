@@ -329,9 +329,34 @@ func (a ZFSSendArgsUnvalidated) buildCommonSendArgs() ([]string, error) {
 		return args, nil
 	}
 
+	// The stream of a saved send has the flags of the interrupted stream
+	// and cannot be incremental, Validate ensures that the other fields are consistent.
+	if a.Saved {
+		if err := validateZFSFilesystem(a.FS); err != nil {
+			return nil, err
+		}
+		args = append(args, "-S", a.FS)
+		return args, nil
+	}
+
 	if a.Encrypted.B {
 		args = append(args, "-w")
 	}
+	if a.LargeBlocks {
+		args = append(args, "-L")
+	}
+	if a.Compressed {
+		args = append(args, "-c")
+	}
+	if a.EmbeddedData {
+		args = append(args, "-e")
+	}
+	if a.Properties {
+		args = append(args, "-p")
+	}
+	if a.BackupProperties {
+		args = append(args, "-b")
+	}
 
 	toV, err := absVersion(a.FS, a.To)
 	if err != nil {
@@ -348,6 +373,8 @@ func (a ZFSSendArgsUnvalidated) buildCommonSendArgs() ([]string, error) {
 
 	if fromV == "" { // Initial
 		args = append(args, toV)
+	} else if a.Intermediates {
+		args = append(args, "-I", fromV, toV)
 	} else {
 		args = append(args, "-i", fromV, toV)
 	}
@@ -626,11 +653,30 @@ func (n *NilBool) String() string {
 	return fmt.Sprintf("%v", n.B)
 }
 
+// ZFSSendFlags are the flags for zfs send besides -w, which is controlled by ZFSSendArgsUnvalidated.Encrypted.
+// The zero value corresponds to a plain zfs send.
+//
+// When updating this struct, check buildCommonSendArgs and ValidateCorrespondsToResumeToken (POTENTIALLY SECURITY SENSITIVE)
+type ZFSSendFlags struct {
+	LargeBlocks      bool // -L
+	Compressed       bool // -c
+	EmbeddedData     bool // -e
+	Properties       bool // -p
+	BackupProperties bool // -b
+	// Send the saved partially received state of the filesystem (-S) instead of a snapshot.
+	// To must be the version that is being received, From must be nil.
+	Saved bool
+}
+
 // When updating this struct, check Validate and ValidateCorrespondsToResumeToken (POTENTIALLY SECURITY SENSITIVE)
 type ZFSSendArgsUnvalidated struct {
 	FS        string
 	From, To  *ZFSSendArgVersion // From may be nil
 	Encrypted *NilBool
+	ZFSSendFlags
+	// send -I: include all snapshots between From and To in the stream.
+	// Requires From to be a snapshot, cannot be combined with ResumeToken.
+	Intermediates bool
 
 	// Preferred if not empty
 	ResumeToken string // if not nil, must match what is specified in From, To (covered by ValidateCorrespondsToResumeToken)
@@ -685,9 +731,25 @@ func (a ZFSSendArgsUnvalidated) Validate(ctx context.Context) (v ZFSSendArgsVali
 	if a.To == nil {
 		return v, newGenericValidationError(a, fmt.Errorf("`To` must not be nil"))
 	}
-	toVersion, err := a.To.ValidateExistsAndGetVersion(ctx, a.FS)
-	if err != nil {
-		return v, newGenericValidationError(a, errors.Wrap(err, "`To` invalid"))
+	var toVersion FilesystemVersion
+	var err error
+	if a.Saved {
+		if a.From != nil || a.Intermediates {
+			return v, newGenericValidationError(a, fmt.Errorf("`Saved` cannot be combined with `From` or `Intermediates`"))
+		}
+		if a.LargeBlocks || a.Compressed || a.EmbeddedData || a.Properties || a.BackupProperties {
+			return v, newGenericValidationError(a, fmt.Errorf("`Saved` cannot be combined with other send flags, the stream has the flags of the interrupted stream"))
+		}
+		// the version that is being received does not exist as a snapshot yet
+		toVersion, err = a.validateSavedState(ctx)
+		if err != nil {
+			return v, newGenericValidationError(a, errors.Wrap(err, "`To` invalid"))
+		}
+	} else {
+		toVersion, err = a.To.ValidateExistsAndGetVersion(ctx, a.FS)
+		if err != nil {
+			return v, newGenericValidationError(a, errors.Wrap(err, "`To` invalid"))
+		}
 	}
 
 	var fromVersion *FilesystemVersion
@@ -700,6 +762,15 @@ func (a ZFSSendArgsUnvalidated) Validate(ctx context.Context) (v ZFSSendArgsVali
 		// fallthrough
 	}
 
+	if a.Intermediates {
+		if fromVersion == nil || fromVersion.Type != Snapshot {
+			return v, newGenericValidationError(a, fmt.Errorf("`Intermediates` requires `From` to be a snapshot"))
+		}
+		if a.ResumeToken != "" {
+			return v, newGenericValidationError(a, fmt.Errorf("`Intermediates` cannot be combined with `ResumeToken`"))
+		}
+	}
+
 	if err := a.Encrypted.Validate(); err != nil {
 		return v, newGenericValidationError(a, errors.Wrap(err, "`Raw` invalid"))
 	}
@@ -730,6 +801,47 @@ func (a ZFSSendArgsUnvalidated) Validate(ctx context.Context) (v ZFSSendArgsVali
 	}, nil
 }
 
+// validateSavedState checks that a.FS has saved partially received state
+// of a full (non-incremental) stream of a.To whose encryption matches a.Encrypted.
+//
+// SECURITY SENSITIVE because Encrypted must be handled correctly
+func (a ZFSSendArgsUnvalidated) validateSavedState(ctx context.Context) (FilesystemVersion, error) {
+	fs, err := NewDatasetPath(a.FS)
+	if err != nil {
+		return FilesystemVersion{}, err
+	}
+	props, err := ZFSGet(ctx, fs, []string{"receive_resume_token"})
+	if err != nil {
+		return FilesystemVersion{}, errors.Wrap(err, "cannot get saved state")
+	}
+	token := props.Get("receive_resume_token")
+	if token == "" || token == "-" {
+		return FilesystemVersion{}, fmt.Errorf("filesystem %q has no saved partially received state", a.FS)
+	}
+	t, err := ParseResumeToken(ctx, token)
+	if err != nil {
+		return FilesystemVersion{}, errors.Wrap(err, "cannot parse saved state")
+	}
+	if t.HasFromGUID {
+		return FilesystemVersion{}, fmt.Errorf("saved state of filesystem %q is incremental", a.FS)
+	}
+	if t.ToGUID != a.To.GUID {
+		return FilesystemVersion{}, fmt.Errorf("saved state `toguid` != expected: %v != %v", t.ToGUID, a.To.GUID)
+	}
+	if t.RawOK != a.Encrypted.B {
+		return FilesystemVersion{}, fmt.Errorf("saved state `rawok` = %v does not match expected value %v", t.RawOK, a.Encrypted.B)
+	}
+	_, snapName, err := t.ToNameSplit()
+	if err != nil {
+		return FilesystemVersion{}, err
+	}
+	return FilesystemVersion{
+		Type: Snapshot,
+		Name: snapName,
+		Guid: t.ToGUID,
+	}, nil
+}
+
 type ZFSSendArgsResumeTokenMismatchError struct {
 	What ZFSSendArgsResumeTokenMismatchErrorCode
 	Err  error
@@ -745,6 +857,7 @@ const (
 	ZFSSendArgsResumeTokenMismatchEncryptionNotSet                                         // encryption not set in token but required by send args
 	ZFSSendArgsResumeTokenMismatchEncryptionSet                                            // encryption not set in token but not required by send args
 	ZFSSendArgsResumeTokenMismatchFilesystem
+	ZFSSendArgsResumeTokenMismatchFlags // `largeblockok`, `embedok`, `compressok` or `savedok` do not match the send args
 )
 
 func (c ZFSSendArgsResumeTokenMismatchErrorCode) fmt(format string, args ...interface{}) *ZFSSendArgsResumeTokenMismatchError {
@@ -804,6 +917,11 @@ func (a ZFSSendArgsUnvalidated) validateCorrespondsToResumeToken(ctx context.Con
 		return gen.fmt("resume token `toguid` != expected: %q != %q", t.ToGUID, a.To.GUID)
 	}
 
+	if t.SavedOK != a.Saved {
+		return ZFSSendArgsResumeTokenMismatchFlags.fmt(
+			"resume token `savedok` = %v does not match expected value %v", t.SavedOK, a.Saved)
+	}
+
 	if a.Encrypted.B {
 		if !(t.RawOK && t.CompressOK) {
 			return ZFSSendArgsResumeTokenMismatchEncryptionNotSet.fmt(
@@ -811,13 +929,33 @@ func (a ZFSSendArgsUnvalidated) validateCorrespondsToResumeToken(ctx context.Con
 		}
 		// fallthrough
 	} else {
-		if t.RawOK || t.CompressOK {
+		if t.RawOK {
 			return ZFSSendArgsResumeTokenMismatchEncryptionSet.fmt(
-				"resume token must not have `rawok` or `compressok` set but got %v %v", t.RawOK, t.CompressOK)
+				"resume token must not have `rawok` set but got %v", t.RawOK)
+		}
+		// compressed (-c) sends of unencrypted filesystems also set `compressok`,
+		// saved sends have the flags of the interrupted stream
+		if !a.Saved && t.CompressOK != a.Compressed {
+			return ZFSSendArgsResumeTokenMismatchFlags.fmt(
+				"resume token `compressok` = %v does not match expected value %v", t.CompressOK, a.Compressed)
 		}
 		// fallthrough
 	}
 
+	// The kernel only sets `largeblockok` and `embedok` if the corresponding pool features
+	// are active, and raw sends imply both. Hence we can only check that the token
+	// does not request more than the send args permit.
+	if !a.Encrypted.B && !a.Saved {
+		if t.LargeBlockOK && !a.LargeBlocks {
+			return ZFSSendArgsResumeTokenMismatchFlags.fmt(
+				"resume token must not have `largeblockok` set but got %v", t.LargeBlockOK)
+		}
+		if t.EmbedOK && !a.EmbeddedData {
+			return ZFSSendArgsResumeTokenMismatchFlags.fmt(
+				"resume token must not have `embedok` set but got %v", t.EmbedOK)
+		}
+	}
+
 	return nil
 }
 
@@ -826,7 +964,7 @@ var zfsSendStderrCaptureMaxSize = envconst.Int("ZREPL_ZFS_SEND_STDERR_MAX_CAPTUR
 var ErrEncryptedSendNotSupported = fmt.Errorf("raw sends which are required for encrypted zfs send are not supported")
 
 // if token != "", then send -t token is used
-// otherwise send [-i from] to is used
+// otherwise send [-i from] to (or send -I from to if Intermediates) is used
 // (if from is "" a full ZFS send is done)
 //
 // Returns ErrEncryptedSendNotSupported if encrypted send is requested but not supported by CLI
@@ -923,20 +1061,37 @@ var (
 )
 
 // see test cases for example output
+//
+// The output of send -I contains one info line per snapshot in the stream:
+// From is that of the first, To that of the last line, and SizeEstimate is the sum of all lines.
 func (s *DrySendInfo) unmarshalZFSOutput(output []byte) (err error) {
 	debug("DrySendInfo.unmarshalZFSOutput: output=%q", output)
 	lines := strings.Split(string(output), "\n")
+	matched := false
 	for _, l := range lines {
-		regexMatched, err := s.unmarshalInfoLine(l)
+		var li DrySendInfo
+		regexMatched, err := li.unmarshalInfoLine(l)
 		if err != nil {
 			return fmt.Errorf("line %q: %s", l, err)
 		}
 		if !regexMatched {
 			continue
 		}
-		return nil
+		if !matched {
+			*s = li
+			matched = true
+			continue
+		}
+		if li.Type != DrySendTypeIncremental || li.Filesystem != s.Filesystem {
+			return fmt.Errorf("line %q: unexpected info line after %s send of %q", l, s.Type, s.To)
+		}
+		s.To = li.To
+		s.SizeEstimate += li.SizeEstimate
+	}
+	if !matched {
+		return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
 	}
-	return fmt.Errorf("no match for info line (regex1 %s) (regex2 %s)", sendDryRunInfoLineRegexFull, sendDryRunInfoLineRegexIncremental)
+	return nil
 }
 
 // unmarshal info line, looks like this:
@@ -1049,6 +1204,59 @@ type RecvOptions struct {
 	RollbackAndForceRecv bool
 	// Set -s flag used for resumable send & recv
 	SavePartialRecvState bool
+	// Set `-o property=value` for each entry
+	OverrideProperties map[string]string
+	// Set `-x property` for each entry
+	InheritProperties []string
+}
+
+// ValidateProperties checks OverrideProperties and InheritProperties.
+func (o RecvOptions) ValidateProperties() error {
+	for _, prop := range o.InheritProperties {
+		if err := validateRecvPropertyName(prop); err != nil {
+			return err
+		}
+		if _, ok := o.OverrideProperties[prop]; ok {
+			return fmt.Errorf("property %q must not be both overridden and inherited", prop)
+		}
+	}
+	for prop := range o.OverrideProperties {
+		if err := validateRecvPropertyName(prop); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o RecvOptions) appendPropertyArgs(args *[]string) error {
+	if err := o.ValidateProperties(); err != nil {
+		return err
+	}
+	overrides := make([]string, 0, len(o.OverrideProperties))
+	for prop := range o.OverrideProperties {
+		overrides = append(overrides, prop)
+	}
+	sort.Strings(overrides) // deterministic command line
+	for _, prop := range overrides {
+		*args = append(*args, "-o", fmt.Sprintf("%s=%s", prop, o.OverrideProperties[prop]))
+	}
+	for _, prop := range o.InheritProperties {
+		*args = append(*args, "-x", prop)
+	}
+	return nil
+}
+
+func validateRecvPropertyName(prop string) error {
+	if prop == "" {
+		return errors.New("property name must not be empty")
+	}
+	if strings.ContainsAny(prop, "= \t\n") {
+		return fmt.Errorf("property name %q must not contain '=' or whitespace", prop)
+	}
+	if prop == PlaceholderPropertyName {
+		return fmt.Errorf("property %q is managed by zrepl", prop)
+	}
+	return nil
 }
 
 type ErrRecvResumeNotSupported struct {
@@ -1122,6 +1330,9 @@ func ZFSRecv(ctx context.Context, fs string, v *ZFSSendArgVersion, streamCopier
 		}
 		args = append(args, "-s")
 	}
+	if err := opts.appendPropertyArgs(&args); err != nil {
+		return err
+	}
 	args = append(args, v.FullPath(fs))
 
 	ctx, cancelCmd := context.WithCancel(ctx)
@@ -1305,6 +1516,31 @@ func zfsSet(ctx context.Context, path string, props *ZFSProperties) (err error)
 	return
 }
 
+// ZFSInherit clears the local value of prop on fs.
+func ZFSInherit(ctx context.Context, fs *DatasetPath, prop string) error {
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "inherit", prop, fs.ToString())
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		return &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
+func ZFSRename(ctx context.Context, fs, newName *DatasetPath) error {
+	cmd := zfscmd.CommandContext(ctx, ZFS_BINARY, "rename", fs.ToString(), newName.ToString())
+	stdio, err := cmd.CombinedOutput()
+	if err != nil {
+		return &ZFSError{
+			Stderr:  stdio,
+			WaitErr: err,
+		}
+	}
+	return nil
+}
+
 func ZFSGet(ctx context.Context, fs *DatasetPath, props []string) (*ZFSProperties, error) {
 	return zfsGet(ctx, fs.ToString(), props, sourceAny)
 }
@@ -140,6 +140,15 @@ size	10518512
 	incrementalWithSpaces := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces@blaffoo2\t624\nsize\t624\n"
 	incrementalWithSpacesInIntermediateComponent := "\nincremental\tblaffoo\tpool1/otherjob/another ds with spaces/childfs@blaffoo2\t624\nsize\t624\n"
 
+	// incremental send with intermediates
+	// $ sudo zfs send -nvP -I @1 zroot/test/a@4
+	incIntermediates := `
+incremental	1	zroot/test/a@2	10511856
+incremental	2	zroot/test/a@3	4096
+incremental	3	zroot/test/a@4	8192
+size	10524144
+`
+
 	type tc struct {
 		name   string
 		in     string
@@ -240,6 +249,20 @@ size	10518512
 				SizeEstimate: 624,
 			},
 		},
+		{
+			name: "incIntermediates", in: incIntermediates,
+			exp: &DrySendInfo{
+				Type:         DrySendTypeIncremental,
+				Filesystem:   "zroot/test/a",
+				From:         "1",
+				To:           "zroot/test/a@4",
+				SizeEstimate: 10524144,
+			},
+		},
+		{
+			name: "fullFollowedByFull", in: "\nfull\tzroot/test/a@1\t4096\nfull\tzroot/test/b@1\t4096\n",
+			expErr: true,
+		},
 	}
 
 	for _, tc := range tcs {
@@ -259,3 +282,97 @@ size	10518512
 		})
 	}
 }
+
+func TestZFSSendArgsBuildCommonSendArgs(t *testing.T) {
+	a := ZFSSendArgsUnvalidated{
+		FS:        "pool/fs",
+		From:      &ZFSSendArgVersion{RelName: "@a", GUID: 1},
+		To:        &ZFSSendArgVersion{RelName: "@b", GUID: 2},
+		Encrypted: &NilBool{B: false},
+	}
+	args, err := a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-i", "pool/fs@a", "pool/fs@b"}, args)
+
+	a.Encrypted.B = true
+	a.ZFSSendFlags = ZFSSendFlags{
+		LargeBlocks:      true,
+		Compressed:       true,
+		EmbeddedData:     true,
+		Properties:       true,
+		BackupProperties: true,
+	}
+	args, err = a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-w", "-L", "-c", "-e", "-p", "-b", "-i", "pool/fs@a", "pool/fs@b"}, args)
+
+	a.Intermediates = true
+	args, err = a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-w", "-L", "-c", "-e", "-p", "-b", "-I", "pool/fs@a", "pool/fs@b"}, args)
+	a.Intermediates = false
+
+	// the saved state is sent with the flags of the interrupted stream
+	saved := ZFSSendArgsUnvalidated{
+		FS:           "pool/fs",
+		To:           &ZFSSendArgVersion{RelName: "@b", GUID: 2},
+		Encrypted:    &NilBool{B: true},
+		ZFSSendFlags: ZFSSendFlags{Saved: true},
+	}
+	args, err = saved.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-S", "pool/fs"}, args)
+
+	// the flags are encoded in the resume token
+	a.ResumeToken = "1-abc"
+	args, err = a.buildCommonSendArgs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"-t", "1-abc"}, args)
+}
+
+func TestZFSSendArgsValidateSaved(t *testing.T) {
+	ctx := context.Background()
+	base := ZFSSendArgsUnvalidated{
+		FS:           "pool/fs",
+		To:           &ZFSSendArgVersion{RelName: "@b", GUID: 2},
+		Encrypted:    &NilBool{B: false},
+		ZFSSendFlags: ZFSSendFlags{Saved: true},
+	}
+
+	// rejected before the filesystem is inspected
+	incremental := base
+	incremental.From = &ZFSSendArgVersion{RelName: "@a", GUID: 1}
+	_, err := incremental.Validate(ctx)
+	assert.Error(t, err)
+
+	intermediates := incremental
+	intermediates.Intermediates = true
+	_, err = intermediates.Validate(ctx)
+	assert.Error(t, err)
+
+	compressed := base
+	compressed.Compressed = true
+	_, err = compressed.Validate(ctx)
+	assert.Error(t, err)
+}
+
+func TestRecvOptionsAppendPropertyArgs(t *testing.T) {
+	o := RecvOptions{
+		OverrideProperties: map[string]string{"readonly": "on", "mountpoint": "none"},
+		InheritProperties:  []string{"keylocation", "sharenfs"},
+	}
+	var args []string
+	assert.NoError(t, o.appendPropertyArgs(&args))
+	assert.Equal(t, []string{"-o", "mountpoint=none", "-o", "readonly=on", "-x", "keylocation", "-x", "sharenfs"}, args)
+
+	invalid := []RecvOptions{
+		{InheritProperties: []string{"mountpoint"}, OverrideProperties: map[string]string{"mountpoint": "none"}},
+		{OverrideProperties: map[string]string{"a=b": "c"}},
+		{InheritProperties: []string{""}},
+		{InheritProperties: []string{PlaceholderPropertyName}},
+	}
+	for _, o := range invalid {
+		args = nil
+		assert.Error(t, o.appendPropertyArgs(&args), "%#v", o)
+	}
+}